@@ -57,7 +57,7 @@ func init() {
 	flags.BoolVarP(&af.NoHidden, "no-hidden", "H", false, "Ignore hidden directories (beginning with dot)")
 	flags.BoolVarP(
 		&af.FollowSymlinks, "follow-symlinks", "L", false,
-		"Follow symlinks for files, i.e. show the size of the file to which symlink points to (symlinks to directories are not followed)",
+		"Follow symlinks, i.e. show the size of the file or directory to which symlink points to (symlinks to ancestor directories are not followed)",
 	)
 	flags.BoolVarP(
 		&af.ShowAnnexedSize, "show-annexed-size", "A", false,
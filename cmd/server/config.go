@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/dundee/gdu/v5/pkg/server"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// reloadableFlags are flags whose change is applied to the running server on SIGHUP
+var reloadableFlags = map[string]bool{
+	"config":            true,
+	"help":              true,
+	"log-level":         true,
+	"log-format":        true,
+	"log-file":          true,
+	"scan-concurrency":  true,
+	"scan-throttle":     true,
+	"max-memory-mb":     true,
+	"const-gc":          true,
+	"gc-percent":        true,
+	"max-depth":         true,
+	"watch-limit":       true,
+	"progress-interval": true,
+	"allow-path":        true,
+	"webhook-url":       true,
+	"webhook-secret":    true,
+	"webhook-timeout":   true,
+}
+
+// loadConfig sets flags not given on the command line from the YAML config file.
+// Keys of the file are names of flags, repeatable flags take a list
+// and rate-weight takes also a map of methods to weights.
+func loadConfig(flags *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if flags.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("unknown option %s in config file %s", name, path)
+		}
+		if given[name] {
+			continue
+		}
+		for _, value := range configValues(values[name]) {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value of option %s in config file %s: %w", name, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues converts value of the config file to values of the flag
+func configValues(value interface{}) []string {
+	switch v := value.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case map[string]interface{}:
+		values := make([]string, 0, len(v))
+		for key, item := range v {
+			values = append(values, fmt.Sprintf("%s=%v", key, item))
+		}
+		sort.Strings(values)
+		return values
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// changedFlags returns names of flags whose value differs between the two options
+func changedFlags(old, current *options) []string {
+	var names []string
+	old.flags.VisitAll(func(f *flag.Flag) {
+		if f.Value.String() != current.flags.Lookup(f.Name).Value.String() {
+			names = append(names, f.Name)
+		}
+	})
+	return names
+}
+
+// reload parses the command line args and the config file again and applies settings
+// which can be changed while the server runs. Changes of other settings are only logged.
+// Options now in effect are returned, the old ones are kept when the new ones are invalid,
+// in which case none of the new settings is applied.
+func reload(protoServer *server.UnixSocketServer, old *options, args []string) *options {
+	opts, err := parseOptions(args)
+	if err == nil {
+		err = opts.validate()
+	}
+	if err != nil {
+		log.Errorf("Failed to reload configuration: %v", err)
+		return old
+	}
+	if err := setupLogging(opts.logLevel, opts.logFormat, opts.logFile); err != nil {
+		log.Errorf("Failed to reload logging: %v", err)
+		return old
+	}
+	if err := opts.apply(protoServer, old); err != nil {
+		log.Errorf("Failed to reload configuration: %v", err)
+		return old
+	}
+
+	for _, name := range changedFlags(old, opts) {
+		if !reloadableFlags[name] {
+			log.Warnf("Change of %s takes effect after restart", name)
+		}
+	}
+	log.Info("Configuration reloaded")
+	return opts
+}
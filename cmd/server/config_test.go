@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/pkg/client"
+	"github.com/dundee/gdu/v5/pkg/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "gdu-server.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestParseOptionsConfig(t *testing.T) {
+	path := writeConfig(t, `
+log-level: debug
+max-depth: 10
+use-storage: false
+webhook-timeout: 3s
+allow-path:
+  - /home
+  - /srv
+rate-weight:
+  directory: 5
+  ping: 0.5
+`)
+
+	opts, err := parseOptions([]string{"-config", path, "-max-depth", "20"})
+	assert.NoError(t, err)
+	assert.Equal(t, "debug", opts.logLevel)
+	// command line takes precedence over the config file
+	assert.Equal(t, 20, opts.maxDepth)
+	assert.False(t, opts.useStorage)
+	assert.Equal(t, "3s", opts.webhookTime.String())
+	assert.Equal(t, pathsFlag{"/home", "/srv"}, opts.allowPaths)
+	assert.Equal(t, weightsFlag{"directory": 5, "ping": 0.5}, opts.rateWeights)
+}
+
+func TestParseOptionsConfigErrors(t *testing.T) {
+	_, err := parseOptions([]string{"-config", writeConfig(t, "unknown: 1")})
+	assert.ErrorContains(t, err, "unknown option unknown")
+
+	_, err = parseOptions([]string{"-config", writeConfig(t, "max-depth: deep")})
+	assert.ErrorContains(t, err, "invalid value of option max-depth")
+
+	_, err = parseOptions([]string{"-config", "/nonexistent/gdu-server.yaml"})
+	assert.Error(t, err)
+}
+
+func TestChangedFlags(t *testing.T) {
+	old, err := parseOptions([]string{"-log-level", "info", "-storage-path", "/tmp/a"})
+	assert.NoError(t, err)
+	current, err := parseOptions([]string{"-log-level", "debug", "-storage-path", "/tmp/b"})
+	assert.NoError(t, err)
+
+	changed := changedFlags(old, current)
+	assert.Equal(t, []string{"log-level", "storage-path"}, changed)
+	assert.True(t, reloadableFlags["log-level"])
+	assert.False(t, reloadableFlags["storage-path"])
+}
+
+func TestParseOptionsServerConfig(t *testing.T) {
+	path := writeConfig(t, `
+socket: /run/gdu.sock
+storage-path: /var/lib/gdu
+max-message-size: 4096
+ignore-hidden: true
+ignore-file-pattern: "*.tmp"
+`)
+
+	opts, err := parseOptions([]string{"-config", path, "-ignore-file-pattern", "*.log"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/run/gdu.sock", opts.socket)
+	assert.Equal(t, "/var/lib/gdu", opts.storagePath)
+	assert.Equal(t, 4096, opts.maxMessage)
+	assert.True(t, opts.ignoreDots)
+	// patterns given on the command line replace those of the config file
+	assert.Equal(t, pathsFlag{"*.log"}, opts.ignoreFiles)
+}
+
+// startServer starts socket server configured by the args and returns client connected to it
+func startServer(t *testing.T, args ...string) (*server.UnixSocketServer, *options, *client.Client) {
+	opts, err := parseOptions(args)
+	assert.NoError(t, err)
+
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	srv, err := server.NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	assert.NoError(t, opts.apply(srv, nil))
+	go func() {
+		assert.NoError(t, srv.Start())
+	}()
+	t.Cleanup(func() { srv.Stop() })
+
+	c, err := client.Dial(socketPath)
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return srv, opts, c
+}
+
+func TestReloadKeepsRuntimeWebhook(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+	}))
+	defer ts.Close()
+
+	srv, opts, c := startServer(t, "-max-depth", "5")
+	// webhook set by set_webhook is not configured by options
+	assert.NoError(t, srv.SetWebhook(server.WebhookConfig{URL: ts.URL}))
+
+	current := reload(srv, opts, []string{"-max-depth", "6"})
+	assert.NotSame(t, opts, current)
+
+	assert.NoError(t, c.Scan(t.TempDir(), client.ScanOptions{}))
+	_, err := c.WaitForScan(context.Background())
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return calls.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReloadInvalidAppliesNothing(t *testing.T) {
+	allowed := t.TempDir()
+	srv, opts, c := startServer(t, "-allow-path", allowed)
+
+	// allowed path is valid, but the webhook is not, so none of them is applied
+	current := reload(srv, opts, []string{"-allow-path", t.TempDir(), "-webhook-url", "ftp://example.com"})
+	assert.Same(t, opts, current)
+
+	var status server.StatusResponse
+	assert.NoError(t, c.Call("status", nil, &status))
+	resolved, err := filepath.EvalSymlinks(allowed)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{resolved}, status.AllowedPaths)
+}
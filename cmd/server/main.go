@@ -1,38 +1,231 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/dundee/gdu/v5/pkg/server"
+	log "github.com/sirupsen/logrus"
 )
 
+// pathsFlag collects values of repeatable flag
+type pathsFlag []string
+
+func (p *pathsFlag) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathsFlag) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// weightsFlag collects method weights of repeatable flag in method=weight form
+type weightsFlag map[string]float64
+
+func (w weightsFlag) String() string {
+	pairs := make([]string, 0, len(w))
+	for method, weight := range w {
+		pairs = append(pairs, method+"="+strconv.FormatFloat(weight, 'g', -1, 64))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (w weightsFlag) Set(value string) error {
+	method, weight, ok := strings.Cut(value, "=")
+	if !ok || method == "" {
+		return fmt.Errorf("weight must be in method=weight form")
+	}
+	n, err := strconv.ParseFloat(weight, 64)
+	if err != nil {
+		return fmt.Errorf("invalid weight of method %s: %w", method, err)
+	}
+	w[method] = n
+	return nil
+}
+
+// options holds settings given by command line flags or the config file
+type options struct {
+	flags *flag.FlagSet
+
+	config      string
+	socket      string
+	useStorage  bool
+	storagePath string
+	maxDepth    int
+	concurrency int
+	throttle    int
+	maxMemoryMB int
+	gcPercent   int
+	constGC     bool
+	watchLimit  int
+	socketMode  string
+	socketGroup string
+	baseDir     string
+	readOnly    bool
+	logLevel    string
+	logFormat   string
+	logFile     string
+	metricsAddr string
+	httpAddr    string
+	grpcAddr    string
+	webhookURL  string
+	webhookKey  string
+	webhookTime time.Duration
+	progressInt time.Duration
+	reqTimeout  time.Duration
+	rateLimit   float64
+	rateBurst   float64
+	maxRequests uint64
+	closeLimit  bool
+	gwWrites    bool
+	maxMessage  int
+	ignoreDots  bool
+	force       bool
+	help        bool
+	allowPaths  pathsFlag
+	ignoreFiles pathsFlag
+	rateWeights weightsFlag
+}
+
+// parseOptions parses the command line arguments,
+// flags not given there are read from the config file
+func parseOptions(args []string) (*options, error) {
+	flags := flag.NewFlagSet("gdu-server", flag.ContinueOnError)
+	o := &options{flags: flags, rateWeights: weightsFlag{}}
+
+	flags.Var(&o.allowPaths, "allow-path", "Path which can be scanned together with its subdirs, can be repeated (default: all paths)")
+	flags.Var(&o.ignoreFiles, "ignore-file-pattern", "Glob pattern of files left out of scans not setting ignore_file_patterns, can be repeated")
+	flags.Var(o.rateWeights, "rate-weight", "Tokens taken by a method in method=weight form, can be repeated (default: 1 per request)")
+	flags.StringVar(&o.config, "config", "", "Path to YAML config file setting flags not given on the command line, re-read on SIGHUP")
+	flags.StringVar(&o.socket, "socket", "/tmp/gdu.sock", "Unix socket path (e.g., /tmp/gdu.sock)")
+	flags.BoolVar(&o.useStorage, "use-storage", true, "Use persistent storage for analysis data")
+	flags.StringVar(&o.storagePath, "storage-path", "/tmp/gdu-storage", "Path to persistent storage directory")
+	flags.IntVar(&o.maxDepth, "max-depth", server.DefaultMaxDepth, "Max depth of directory tree returned to clients (0 = unlimited)")
+	flags.IntVar(&o.concurrency, "scan-concurrency", 0, "Max number of directories read in parallel (0 = 3 * number of CPUs)")
+	flags.IntVar(&o.throttle, "scan-throttle", 0, "Max number of directories read per second by every scan, scans can set a lower limit (0 = unlimited)")
+	flags.IntVar(&o.maxMemoryMB, "max-memory-mb", 0, "Memory ceiling of the server in MiB, scans over it are paused and then aborted (0 = unlimited)")
+	flags.BoolVar(&o.constGC, "const-gc", false, "Keep GC settings during scans not setting const_gc instead of disabling GC")
+	flags.IntVar(&o.gcPercent, "gc-percent", 0, "GOGC set for the time of scans not setting gc_percent, implies const-gc (0 = keep)")
+	flags.IntVar(&o.watchLimit, "watch-limit", server.DefaultWatchLimit, "Max number of directories watched in watch mode")
+	flags.StringVar(&o.socketMode, "socket-mode", "0700", "Permission mode of the socket file (octal)")
+	flags.StringVar(&o.socketGroup, "socket-group", "", "Group the socket file is given to (name or ID)")
+	flags.StringVar(&o.baseDir, "base-dir", "", "Directory relative paths of requests are resolved against, paths outside of it are rejected")
+	flags.BoolVar(&o.readOnly, "read-only", false, "Reject methods changing the filesystem (move)")
+	flags.StringVar(&o.logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	flags.StringVar(&o.logFormat, "log-format", "text", "Log format (text or json)")
+	flags.StringVar(&o.logFile, "log-file", "", "Path to a log file (default: stderr)")
+	flags.StringVar(&o.metricsAddr, "metrics-addr", "", "Address of HTTP listener serving Prometheus metrics on /metrics (e.g., 127.0.0.1:9090)")
+	flags.StringVar(&o.httpAddr, "http", "", "Address of HTTP listener serving scan, progress, cancel and directory (e.g., 127.0.0.1:8080)")
+	flags.BoolVar(&o.gwWrites, "gateway-allow-write", false, "Allow move, export to file and set_webhook over HTTP, WebSocket and gRPC")
+	flags.StringVar(&o.grpcAddr, "grpc-addr", "", "Address of gRPC listener serving GduService (e.g., 127.0.0.1:9000)")
+	flags.StringVar(&o.webhookURL, "webhook-url", "", "URL receiving POST with summary of every finished or cancelled scan")
+	flags.StringVar(&o.webhookKey, "webhook-secret", "", "Secret signing webhook payloads with HMAC-SHA256 in X-Gdu-Signature header")
+	flags.DurationVar(&o.webhookTime, "webhook-timeout", server.DefaultWebhookTimeout, "Timeout of each webhook attempt")
+	flags.DurationVar(&o.progressInt, "progress-interval", server.DefaultProgressInterval, "Minimal time between two progress events pushed to subscribers")
+	flags.DurationVar(&o.reqTimeout, "request-timeout", 0, "Time budget of every request, clients can set a shorter one (0 = unlimited)")
+	flags.Float64Var(&o.rateLimit, "rate-limit", 0, "Max requests per second of every connection (0 = unlimited)")
+	flags.Float64Var(&o.rateBurst, "rate-burst", 0, "Max requests of a connection sent at once above the rate limit (default: rate limit)")
+	flags.Uint64Var(&o.maxRequests, "max-requests", 0, "Max number of requests of every connection (0 = unlimited)")
+	flags.BoolVar(&o.closeLimit, "close-on-limit", false, "Close connection once its request is rejected by rate limit or max requests")
+	flags.IntVar(&o.maxMessage, "max-message-size", server.DefaultMaxMessageSize, "Max size of a request in bytes")
+	flags.BoolVar(&o.ignoreDots, "ignore-hidden", false, "Skip hidden files in scans not setting ignore_hidden")
+	flags.BoolVar(&o.force, "force", false, "Remove existing socket even if another server listens on it")
+	flags.BoolVar(&o.help, "help", false, "Show help")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if o.config != "" {
+		if err := loadConfig(flags, o.config); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// webhookConfig returns webhook set by the options
+func (o *options) webhookConfig() server.WebhookConfig {
+	return server.WebhookConfig{
+		URL:     o.webhookURL,
+		Secret:  o.webhookKey,
+		Timeout: o.webhookTime,
+	}
+}
+
+// validate checks settings of apply which the server can refuse,
+// so that invalid options are rejected before any of them is applied
+func (o *options) validate() error {
+	if err := server.ValidateAllowedPaths(o.allowPaths); err != nil {
+		return fmt.Errorf("failed to set allowed paths: %w", err)
+	}
+	if err := o.webhookConfig().Validate(); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+	return nil
+}
+
+// apply sets settings which can be changed while the server runs.
+// Webhook is set only when its options differ from the old ones, so webhook set
+// by set_webhook is kept on reload. Old options are nil when the server starts.
+func (o *options) apply(protoServer *server.UnixSocketServer, old *options) error {
+	protoServer.SetScanConcurrency(o.concurrency)
+	protoServer.SetScanThrottle(o.throttle)
+	protoServer.SetMaxMemory(int64(o.maxMemoryMB) << 20)
+	protoServer.SetScanGC(o.constGC, o.gcPercent)
+	protoServer.SetMaxDepth(o.maxDepth)
+	protoServer.SetWatchLimit(o.watchLimit)
+	protoServer.SetProgressInterval(o.progressInt)
+	if err := protoServer.SetAllowedPaths(o.allowPaths); err != nil {
+		return fmt.Errorf("failed to set allowed paths: %w", err)
+	}
+	if old == nil || o.webhookConfig() != old.webhookConfig() {
+		if err := protoServer.SetWebhook(o.webhookConfig()); err != nil {
+			return fmt.Errorf("failed to set webhook: %w", err)
+		}
+	}
+	return nil
+}
+
 func main() {
-	var (
-		socket      = flag.String("socket", "/tmp/gdu.sock", "Unix socket path (e.g., /tmp/gdu.sock)")
-		useStorage  = flag.Bool("use-storage", true, "Use persistent storage for analysis data")
-		storagePath = flag.String("storage-path", "/tmp/gdu-storage", "Path to persistent storage directory")
-		help        = flag.Bool("help", false, "Show help")
-	)
-	flag.Parse()
-
-	if *help {
+	opts, err := parseOptions(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse options: %v\n", err)
+		os.Exit(2)
+	}
+
+	if opts.help {
 		printHelp()
 		os.Exit(0)
 	}
 
+	if err := setupLogging(opts.logLevel, opts.logFormat, opts.logFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up logging: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Setup cleanup on interrupt
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
 		fmt.Println("\nShutting down...")
-		if fileExists(*socket) {
-			os.Remove(*socket)
+		if !server.IsAbstractSocket(opts.socket) && fileExists(opts.socket) {
+			os.Remove(opts.socket)
 		}
 		os.Exit(0)
 	}()
@@ -40,24 +233,122 @@ func main() {
 	// Start server
 	fmt.Println("Gdu Unix Socket Protocol Server")
 	fmt.Println("=================================")
-	fmt.Printf("Socket: %s\n\n", *socket)
+	fmt.Printf("Socket: %s\n\n", opts.socket)
 	fmt.Println("Protocol: Length-prefixed JSON")
 	fmt.Println("  [4 bytes: length][N bytes: JSON][1 byte: newline]")
+	fmt.Println("  Newline-delimited JSON is used if the connection starts with '{'")
+	fmt.Println("  JSON-RPC 2.0 is used if the first request has \"jsonrpc\":\"2.0\"")
 	fmt.Println("")
 	fmt.Println("Methods:")
-	fmt.Println("  scan       - Start scanning")
-	fmt.Println("  progress   - Get scanning progress")
-	fmt.Println("  cancel     - Cancel scanning")
-	fmt.Println("  directory  - Get directory info")
+	fmt.Println("  scan        - Start scanning")
+	fmt.Println("  progress    - Get scanning progress")
+	fmt.Println("  cancel      - Cancel scanning and export")
+	fmt.Println("  set_concurrency - Change concurrency of running scan")
+	fmt.Println("  directory   - Get directory info")
+	fmt.Println("  list        - List directory children names")
+	fmt.Println("  ancestors   - Get dirs from the scanned root down to a path")
+	fmt.Println("  tree        - Render scanned tree as text")
+	fmt.Println("  move        - Move or rename item")
+	fmt.Println("  estimate    - Estimate size of a path")
+	fmt.Println("  mounts      - List mounted filesystems")
+	fmt.Println("  duplicates  - Find duplicate files")
+	fmt.Println("  empty_dirs  - Find empty directories")
+	fmt.Println("  count_by_depth - Count files and directories at each depth")
+	fmt.Println("  ping        - Check server is alive")
+	fmt.Println("  set_webhook - Set URL notified when a scan finishes")
+	fmt.Println("  set_alert   - Alert when size or daily growth of a path exceeds limit")
+	fmt.Println("  list_alerts - List alerts and their state")
+	fmt.Println("  delete_alert - Delete alert")
+	fmt.Println("  set_encoding - Switch to json or msgpack")
+	fmt.Println("  status      - Get server health")
+	fmt.Println("  metrics     - Get server metrics in Prometheus text format")
+	fmt.Println("  top_files   - Get largest files")
+	fmt.Println("  top_dirs    - Get largest directories")
+	fmt.Println("  export      - Export as csv, tsv, du, ncdu or sqlite")
+	fmt.Println("  export_ncdu - Export in ncdu format")
+	fmt.Println("  watch       - Start watch mode")
+	fmt.Println("  unwatch     - Stop watch mode")
+	fmt.Println("  subscribe   - Receive pushed events (progress, scan_complete, tree_update, alert)")
+	fmt.Println("  unsubscribe - Stop receiving events")
 	fmt.Println("")
 	fmt.Println("Example request:")
 	fmt.Println(`  {"id":"1","method":"progress","params":{}}`)
 	fmt.Println("")
 
-	protoServer, err := server.NewUnixSocketServer(*socket, *useStorage, *storagePath)
+	if opts.force && !server.IsAbstractSocket(opts.socket) {
+		if err := os.Remove(opts.socket); err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Failed to remove existing socket: %v", err)
+		}
+	}
+
+	mode, err := strconv.ParseUint(opts.socketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		log.Fatalf("Invalid socket mode %s", opts.socketMode)
+	}
+
+	protoServer, err := server.NewUnixSocketServerWithOptions(opts.socket, opts.useStorage, opts.storagePath, server.Options{
+		SocketMode:  os.FileMode(mode),
+		SocketGroup: opts.socketGroup,
+		ReadOnly:    opts.readOnly,
+		BaseDir:     opts.baseDir,
+
+		MaxMessageSize:     opts.maxMessage,
+		IgnoreHidden:       opts.ignoreDots,
+		IgnoreFilePatterns: opts.ignoreFiles,
+	})
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
 	}
+	if err := opts.apply(protoServer, nil); err != nil {
+		log.Fatalf("Failed to configure server: %v", err)
+	}
+	protoServer.SetRequestTimeout(opts.reqTimeout)
+	protoServer.SetGatewayWrites(opts.gwWrites)
+	limit := server.RateLimit{
+		Rate:         opts.rateLimit,
+		Burst:        opts.rateBurst,
+		Weights:      opts.rateWeights,
+		MaxRequests:  opts.maxRequests,
+		CloseOnLimit: opts.closeLimit,
+	}
+	if err := protoServer.SetRateLimit(limit); err != nil {
+		log.Fatalf("Failed to set rate limit: %v", err)
+	}
+
+	// Reload configuration on hangup
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		current := opts
+		for range hup {
+			current = reload(protoServer, current, os.Args[1:])
+		}
+	}()
+
+	if opts.metricsAddr != "" {
+		go serveMetrics(opts.metricsAddr, protoServer.MetricsHandler())
+	}
+
+	if opts.httpAddr != "" {
+		httpServer := server.NewHTTPServer(opts.httpAddr, protoServer)
+		if err := httpServer.SetRateLimit(limit); err != nil {
+			log.Fatalf("Failed to set rate limit: %v", err)
+		}
+		go func() {
+			if err := httpServer.Start(); err != nil {
+				log.Fatalf("Failed to serve HTTP: %v", err)
+			}
+		}()
+	}
+
+	if opts.grpcAddr != "" {
+		grpcServer := server.NewGRPCServer(opts.grpcAddr, protoServer)
+		go func() {
+			if err := grpcServer.Start(); err != nil {
+				log.Fatalf("Failed to serve gRPC: %v", err)
+			}
+		}()
+	}
 
 	if err := protoServer.Start(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
@@ -68,16 +359,65 @@ func printHelp() {
 	fmt.Println("Usage: gdu-server [options]")
 	fmt.Println("")
 	fmt.Println("Options:")
-	fmt.Println("  -socket string         Unix socket path (default: /tmp/gdu.sock)")
+	fmt.Println("  -socket string         Unix socket path (default: /tmp/gdu.sock),")
+	fmt.Println("                         path beginning with @ is abstract socket (Linux only)")
+	fmt.Println("  -socket-mode string    Permission mode of the socket file (default: 0700)")
+	fmt.Println("  -socket-group string   Group the socket file is given to (name or ID)")
 	fmt.Println("  -use-storage           Use persistent storage for analysis data (default: true)")
 	fmt.Println("  -storage-path string   Path to persistent storage directory (default: /tmp/gdu-storage)")
+	fmt.Println("  -scan-concurrency int  Max number of directories read in parallel (default: 3 * number of CPUs)")
+	fmt.Println("  -scan-throttle int     Max number of directories read per second by every scan,")
+	fmt.Println("                         scans can set a lower limit (default: 0 = unlimited)")
+	fmt.Println("  -max-memory-mb int     Memory ceiling of the server in MiB, scans over it are paused")
+	fmt.Println("                         and then aborted (default: 0 = unlimited)")
+	fmt.Println("  -const-gc              Keep GC settings during scans not setting const_gc instead of disabling GC")
+	fmt.Println("  -gc-percent int        GOGC set for the time of scans not setting gc_percent, implies -const-gc")
+	fmt.Println("                         (default: 0 = keep)")
+	fmt.Println("  -max-depth int         Max depth of directory tree returned to clients (default: 256)")
+	fmt.Println("  -watch-limit int       Max number of directories watched in watch mode (default: 8192)")
+	fmt.Println("  -allow-path string     Path which can be scanned together with its subdirs, can be repeated")
+	fmt.Println("                         (default: all paths)")
+	fmt.Println("  -base-dir string       Directory relative paths of requests are resolved against,")
+	fmt.Println("                         paths outside of it are rejected")
+	fmt.Println("  -max-message-size int  Max size of a request in bytes (default: 104857600)")
+	fmt.Println("  -ignore-hidden         Skip hidden files in scans not setting ignore_hidden")
+	fmt.Println("  -ignore-file-pattern string Glob pattern of files left out of scans not setting")
+	fmt.Println("                         ignore_file_patterns, can be repeated")
+	fmt.Println("  -read-only             Reject methods changing the filesystem (move)")
+	fmt.Println("  -log-level string      Log level: debug, info, warn or error (default: info)")
+	fmt.Println("  -log-format string     Log format: text or json (default: text)")
+	fmt.Println("  -log-file string       Path to a log file (default: stderr)")
+	fmt.Println("  -config string         Path to YAML config file setting options not given on the command line")
+	fmt.Println("  -metrics-addr string   Address of HTTP listener serving Prometheus metrics on /metrics")
+	fmt.Println("  -http string           Address of HTTP listener serving POST /scan, GET /progress,")
+	fmt.Println("                         POST /cancel, GET /directory?path=&depth=, GET /healthz")
+	fmt.Println("                         and WebSocket on /ws speaking the socket protocol")
+	fmt.Println("  -gateway-allow-write   Allow move, export to file and set_webhook over HTTP, WebSocket and gRPC,")
+	fmt.Println("                         the gateways don't authenticate clients")
+	fmt.Println("  -grpc-addr string      Address of gRPC listener serving GduService (see pkg/server/grpc/gdu.proto)")
+	fmt.Println("  -webhook-url string    URL receiving POST with summary of every finished or cancelled scan")
+	fmt.Println("  -webhook-secret string Secret signing webhook payloads (HMAC-SHA256 in X-Gdu-Signature header)")
+	fmt.Println("  -webhook-timeout duration Timeout of each webhook attempt (default: 10s)")
+	fmt.Println("  -force                 Remove existing socket even if another server listens on it")
 	fmt.Println("  -help                  Show this help message")
 	fmt.Println("")
 	fmt.Println("Examples:")
 	fmt.Println("  gdu-server                                                  # Use default socket with stored analyzer")
 	fmt.Println("  gdu-server -socket /tmp/gdu.sock                           # Unix socket with stored analyzer")
+	fmt.Println("  gdu-server -socket @gdu                                    # Abstract socket without file (Linux only)")
 	fmt.Println("  gdu-server -use-storage=false                              # Disable persistent storage")
 	fmt.Println("  gdu-server -storage-path /path/to/storage                  # Custom storage path")
+	fmt.Println("  gdu-server -socket-mode 0770 -socket-group gdu             # Allow access to members of group gdu")
+	fmt.Println("  gdu-server -allow-path /home -allow-path /srv              # Allow scanning only /home and /srv")
+	fmt.Println("  gdu-server -log-level debug -log-format json               # Log every request as JSON")
+	fmt.Println("  gdu-server -http 127.0.0.1:8080                            # Serve also HTTP API")
+	fmt.Println("  gdu-server -use-storage=false -ignore-file-pattern '*.tmp' # Leave out temporary files by default")
+	fmt.Println("  gdu-server -config /etc/gdu-server.yaml                    # Read options from config file")
+	fmt.Println("")
+	fmt.Println("Signals:")
+	fmt.Println("  SIGHUP                 Re-read the config file and reopen the log file, log level, log format,")
+	fmt.Println("                         scan concurrency, scan throttle, max memory, scan GC, max depth, watch limit,")
+	fmt.Println("                         progress interval, allowed paths and webhook are applied to the running server")
 	fmt.Println("")
 	fmt.Println("Unix socket mode features:")
 	fmt.Println("  - Latency: ~0.05ms")
@@ -85,6 +425,64 @@ func printHelp() {
 	fmt.Println("  - See SOCKET_PROTOCOL.md for binary protocol specification")
 }
 
+// serveMetrics serves metrics over HTTP on the address
+func serveMetrics(addr string, handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("Serving metrics on http://%s/metrics", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("Failed to serve metrics: %v", err)
+	}
+}
+
+// logOutput is log file currently written to, nil when logging to stderr
+var logOutput *os.File
+
+// setupLogging configures logger shared by the server and the analyzer
+func setupLogging(level, format, file string) error {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	var formatter log.Formatter
+	switch format {
+	case "text":
+		formatter = &log.TextFormatter{FullTimestamp: true}
+	case "json":
+		formatter = &log.JSONFormatter{}
+	default:
+		return fmt.Errorf("unknown log format %s", format)
+	}
+
+	out := io.Writer(os.Stderr)
+	var f *os.File
+	if file != "" {
+		f, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		out = f
+	}
+
+	// settings are changed only once all of them are valid
+	log.SetLevel(lvl)
+	log.SetFormatter(formatter)
+	log.SetOutput(out)
+
+	// the previous file is closed, so reloading reopens rotated log file
+	if logOutput != nil {
+		logOutput.Close()
+	}
+	logOutput = f
+	return nil
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
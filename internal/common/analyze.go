@@ -5,20 +5,29 @@ import "github.com/dundee/gdu/v5/pkg/fs"
 // CurrentProgress struct
 type CurrentProgress struct {
 	CurrentItemName string
-	ItemCount       int
+	ItemCount       int // FileCount + DirCount
+	FileCount       int
+	DirCount        int
 	TotalSize       int64
+	VanishedCount   int // entries deleted after their dir was read
+	// FDExhaustedCount is number of failed attempts to open a dir for lack of file descriptors
+	FDExhaustedCount int
 }
 
 // ShouldDirBeIgnored whether path should be ignored
 type ShouldDirBeIgnored func(name, path string) bool
 
+// ShouldFileBeIgnored whether file should be left out of the analysis
+type ShouldFileBeIgnored func(name, path string) bool
+
 // Analyzer is type for dir analyzing function
 type Analyzer interface {
 	AnalyzeDir(path string, ignore ShouldDirBeIgnored, constGC bool) fs.Item
 	SetFollowSymlinks(bool)
 	SetShowAnnexedSize(bool)
 	GetProgressChan() chan CurrentProgress
+	GetProgress() CurrentProgress
 	GetDone() SignalGroup
 	ResetProgress()
-	Cancel()  // Cancel the analysis gracefully
+	Cancel() // Cancel the analysis gracefully
 }
@@ -47,6 +47,11 @@ func (a *MockedAnalyzer) GetProgressChan() chan CurrentProgress {
 	return make(chan CurrentProgress)
 }
 
+// GetProgress returns empty progress
+func (a *MockedAnalyzer) GetProgress() CurrentProgress {
+	return CurrentProgress{}
+}
+
 // GetDone returns always Done
 func (a *MockedAnalyzer) GetDone() SignalGroup {
 	c := make(SignalGroup)
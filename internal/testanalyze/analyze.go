@@ -71,6 +71,11 @@ func (a *MockedAnalyzer) GetProgressChan() chan common.CurrentProgress {
 	return make(chan common.CurrentProgress)
 }
 
+// GetProgress returns empty progress
+func (a *MockedAnalyzer) GetProgress() common.CurrentProgress {
+	return common.CurrentProgress{}
+}
+
 // GetDone returns always Done
 func (a *MockedAnalyzer) GetDone() common.SignalGroup {
 	c := make(common.SignalGroup)
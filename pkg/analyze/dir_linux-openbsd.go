@@ -15,10 +15,14 @@ func setPlatformSpecificAttrs(file *File, f os.FileInfo) {
 	if stat, ok := f.Sys().(*syscall.Stat_t); ok {
 		file.Usage = stat.Blocks * devBSize
 		file.Mtime = time.Unix(int64(stat.Mtim.Sec), int64(stat.Mtim.Nsec))
+		file.Atime = time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec)).UnixNano()
+		file.Ctime = time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec)).UnixNano()
+		file.UID = stat.Uid
+		file.GID = stat.Gid
+		file.Dev = uint64(stat.Dev)
+		file.Ino = stat.Ino
 
-		if stat.Nlink > 1 {
-			file.Mli = stat.Ino
-		}
+		file.HardLinked = stat.Nlink > 1
 	}
 }
 
@@ -29,4 +33,10 @@ func setDirPlatformSpecificAttrs(dir *Dir, path string) {
 	}
 
 	dir.Mtime = time.Unix(int64(stat.Mtim.Sec), int64(stat.Mtim.Nsec))
+	dir.Atime = time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec)).UnixNano()
+	dir.Ctime = time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec)).UnixNano()
+	dir.UID = stat.Uid
+	dir.GID = stat.Gid
+	dir.Dev = uint64(stat.Dev)
+	dir.Ino = stat.Ino
 }
@@ -6,7 +6,9 @@ package analyze
 import (
 	"os"
 	"testing"
+	"time"
 
+	"github.com/dundee/gdu/v5/internal/common"
 	"github.com/dundee/gdu/v5/internal/testdir"
 	"github.com/dundee/gdu/v5/pkg/fs"
 	"github.com/stretchr/testify/assert"
@@ -36,6 +38,9 @@ func TestErr(t *testing.T) {
 
 	assert.Equal(t, "nested", dir.Files[0].GetName())
 	assert.Equal(t, '!', dir.Files[0].GetFlag())
+	flags, message := dir.Files[0].(*Dir).FlagReasons()
+	assert.Equal(t, DirReadError, flags)
+	assert.Contains(t, message, "permission denied")
 }
 
 func TestSeqErr(t *testing.T) {
@@ -62,4 +67,69 @@ func TestSeqErr(t *testing.T) {
 
 	assert.Equal(t, "nested", dir.Files[0].GetName())
 	assert.Equal(t, '!', dir.Files[0].GetFlag())
+	flags, message := dir.Files[0].(*Dir).FlagReasons()
+	assert.Equal(t, DirReadError, flags)
+	assert.Contains(t, message, "permission denied")
+}
+
+func TestProgressMatchesItemCount(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	err := os.MkdirAll("test_dir/ignored/deeper", 0o755)
+	assert.Nil(t, err)
+	err = os.WriteFile("test_dir/ignored/file", []byte("ignored"), 0o600)
+	assert.Nil(t, err)
+
+	err = os.Chmod("test_dir/nested/subnested", 0)
+	assert.Nil(t, err)
+	defer func() {
+		err = os.Chmod("test_dir/nested/subnested", 0o755)
+		assert.Nil(t, err)
+	}()
+
+	ignore := func(name, _ string) bool { return name == "ignored" }
+
+	analyzers := map[string]common.Analyzer{
+		"parallel":   CreateAnalyzer(),
+		"sequential": CreateSeqAnalyzer(),
+	}
+	for name, analyzer := range analyzers {
+		t.Run(name, func(t *testing.T) {
+			dir := analyzer.AnalyzeDir("test_dir", ignore, false)
+			analyzer.GetDone().Wait()
+			dir.UpdateStats(make(fs.HardLinkedItems))
+
+			progress := <-analyzer.GetProgressChan()
+			assert.Equal(t, dir.GetItemCount(), progress.ItemCount)
+			assert.Equal(t, progress.FileCount+progress.DirCount, progress.ItemCount)
+		})
+	}
+}
+
+func TestTimesAndOwner(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	atime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := os.Chtimes("test_dir/nested/file2", atime, time.Now())
+	assert.Nil(t, err)
+
+	analyzer := CreateAnalyzer()
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	).(*Dir)
+
+	file := dir.Files[0].(*Dir).Files[0]
+	assert.Equal(t, "file2", file.GetName())
+	assert.True(t, atime.Equal(file.GetAtime()))
+	assert.False(t, file.GetCtime().IsZero())
+
+	uid, gid := file.GetOwner()
+	assert.Equal(t, uint32(os.Getuid()), uid)
+	assert.Equal(t, uint32(os.Getgid()), gid)
+
+	uid, _ = dir.GetOwner()
+	assert.Equal(t, uint32(os.Getuid()), uid)
+	assert.False(t, dir.GetAtime().IsZero())
 }
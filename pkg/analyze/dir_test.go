@@ -1,12 +1,17 @@
 package analyze
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/dundee/gdu/v5/internal/common"
 	"github.com/dundee/gdu/v5/internal/testdir"
 	"github.com/dundee/gdu/v5/pkg/fs"
 	"github.com/stretchr/testify/assert"
@@ -242,6 +247,82 @@ func BenchmarkAnalyzeDir(b *testing.B) {
 	dir.UpdateStats(make(fs.HardLinkedItems))
 }
 
+// BenchmarkAnalyzeDeepTree compares the worker pool of ParallelAnalyzer
+// with the goroutine per directory walk of ParallelStableOrderAnalyzer
+func BenchmarkAnalyzeDeepTree(b *testing.B) {
+	root := b.TempDir()
+	createTree(b, root, 5, 5)
+
+	type analyzer interface {
+		AnalyzeDir(path string, ignore common.ShouldDirBeIgnored, constGC bool) fs.Item
+		GetDone() common.SignalGroup
+	}
+	analyzers := map[string]func() analyzer{
+		"worker-pool":       func() analyzer { return CreateAnalyzer() },
+		"goroutine-per-dir": func() analyzer { return CreateStableOrderAnalyzer() },
+	}
+
+	for name, create := range analyzers {
+		b.Run(name, func(b *testing.B) {
+			peak := 0
+			for i := 0; i < b.N; i++ {
+				stop := make(chan struct{})
+				peakChan := trackPeakGoroutines(stop)
+
+				analyzer := create()
+				analyzer.AnalyzeDir(root, func(_, _ string) bool { return false }, true)
+				analyzer.GetDone().Wait()
+
+				close(stop)
+				if p := <-peakChan; p > peak {
+					peak = p
+				}
+			}
+			b.ReportMetric(float64(peak), "peak-goroutines")
+		})
+	}
+}
+
+// createTree creates tree of directories with given depth and number of subdirs in each dir,
+// every dir contains one file
+func createTree(b testing.TB, path string, depth, width int) {
+	if err := os.WriteFile(filepath.Join(path, "file"), []byte("hello"), 0o600); err != nil {
+		b.Fatal(err)
+	}
+	if depth == 0 {
+		return
+	}
+	for i := 0; i < width; i++ {
+		sub := filepath.Join(path, fmt.Sprintf("dir%d", i))
+		if err := os.Mkdir(sub, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		createTree(b, sub, depth-1, width)
+	}
+}
+
+// trackPeakGoroutines samples number of goroutines until stop is closed
+func trackPeakGoroutines(stop chan struct{}) chan int {
+	res := make(chan int)
+	go func() {
+		peak := runtime.NumGoroutine()
+		ticker := time.NewTicker(100 * time.Microsecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				res <- peak
+				return
+			case <-ticker.C:
+				if n := runtime.NumGoroutine(); n > peak {
+					peak = n
+				}
+			}
+		}
+	}()
+	return res
+}
+
 func TestParallelStableOrderAnalyzerDeterminism(t *testing.T) {
 	fin := testdir.CreateTestDir()
 	defer fin()
@@ -342,6 +423,149 @@ func TestFileDirectoryInterleaving(t *testing.T) {
 	assert.Equal(t, "ddd_file", seqOrder[3])
 }
 
+func TestAnalyzeDirWithConcurrencyLimit(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := CreateAnalyzer()
+	analyzer.SetConcurrency(1)
+	assert.Equal(t, 1, analyzer.concurrency)
+
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	).(*Dir)
+	analyzer.GetDone().Wait()
+	dir.UpdateStats(make(fs.HardLinkedItems))
+
+	assert.Equal(t, 5, dir.ItemCount)
+	assert.Equal(t, int64(7+4096*3), dir.Size)
+
+	stable := CreateStableOrderAnalyzer()
+	stable.SetConcurrency(1)
+	stableDir := stable.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	)
+	stable.GetDone().Wait()
+	stableDir.UpdateStats(make(fs.HardLinkedItems))
+
+	assert.Equal(t, getFileNames(dir), getFileNames(stableDir))
+
+	analyzer.SetConcurrency(0)
+	assert.Equal(t, defaultConcurrency(), analyzer.concurrency)
+}
+
+func TestAnalyzeDirResizeConcurrency(t *testing.T) {
+	root := t.TempDir()
+	createTree(t, root, 3, 4)
+
+	analyzer := CreateAnalyzer()
+	analyzer.SetConcurrency(1)
+
+	stop := make(chan struct{})
+	resized := make(chan struct{})
+	go func() {
+		defer close(resized)
+		for n := 1; ; n = n%8 + 1 {
+			select {
+			case <-stop:
+				return
+			default:
+				analyzer.SetConcurrency(n)
+			}
+		}
+	}()
+
+	dir := analyzer.AnalyzeDir(
+		root, func(_, _ string) bool { return false }, false,
+	).(*Dir)
+	analyzer.GetDone().Wait()
+	close(stop)
+	<-resized
+	dir.UpdateStats(make(fs.HardLinkedItems))
+
+	// 1 + 4 + 16 + 64 dirs each with one file
+	assert.Equal(t, 85*2, dir.ItemCount)
+
+	analyzer.SetConcurrency(3)
+	assert.Equal(t, 3, analyzer.concurrency)
+}
+
+func TestAnalyzeDirRacingCancel(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	for i := 0; i < 200; i++ {
+		analyzer := CreateAnalyzer()
+		done := make(chan struct{})
+
+		go func() {
+			analyzer.AnalyzeDir(
+				"test_dir", func(_, _ string) bool { return false }, true,
+			)
+			close(done)
+		}()
+		time.Sleep(time.Duration(i%10) * 10 * time.Microsecond)
+		analyzer.Cancel()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("AnalyzeDir blocked after cancel in iteration %d", i)
+		}
+	}
+}
+
+func TestResetProgressRacingCancel(t *testing.T) {
+	analyzer := CreateAnalyzer()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			analyzer.Cancel()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		analyzer.ResetProgress()
+	}
+	<-done
+}
+
+func TestCancelledAnalysisWorkersExit(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 50; i++ {
+		for j := 0; j < 10; j++ {
+			assert.NoError(t, os.MkdirAll(filepath.Join(root, fmt.Sprintf("dir%d", i), fmt.Sprintf("sub%d", j)), 0o755))
+		}
+	}
+	var countItems func(item fs.Item) int
+	countItems = func(item fs.Item) int {
+		count := 1
+		for _, child := range item.GetFiles() {
+			count += countItems(child)
+		}
+		return count
+	}
+
+	analyzer := CreateAnalyzer()
+	analyzer.SetConcurrency(4)
+	for i := 0; i < 20; i++ {
+		analyzer.ResetProgress()
+		cancelled := make(chan struct{})
+		go func() {
+			time.Sleep(time.Duration(i%5) * 100 * time.Microsecond)
+			analyzer.Cancel()
+			close(cancelled)
+		}()
+		dir := analyzer.AnalyzeDir(root, func(_, _ string) bool { return false }, false)
+		<-cancelled
+
+		// no worker adds subdirs to the returned tree
+		items := countItems(dir)
+		time.Sleep(time.Millisecond)
+		assert.Equal(t, items, countItems(dir))
+	}
+}
+
 // getFileNames recursively collects file names from a directory tree
 func getFileNames(item fs.Item) []string {
 	names := []string{item.GetName()}
@@ -352,3 +576,88 @@ func getFileNames(item fs.Item) []string {
 	}
 	return names
 }
+
+func TestAnalyzeDirIgnoreHidden(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	err := os.MkdirAll("test_dir/nested/.cache", os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile("test_dir/nested/.cache/blob", []byte("cached"), 0o600)
+	assert.NoError(t, err)
+	err = os.WriteFile("test_dir/.hidden", []byte("secret"), 0o600)
+	assert.NoError(t, err)
+
+	analyzer := CreateAnalyzer()
+	analyzer.SetIgnoreHidden(true)
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	).(*Dir)
+	dir.UpdateStats(make(fs.HardLinkedItems))
+
+	assert.Equal(t, 5, dir.ItemCount)
+	assert.Equal(t, int64(7+4096*3), dir.Size)
+	assert.Equal(t, 5, analyzer.GetProgress().ItemCount)
+}
+
+func TestAnalyzeDirWithFileIgnore(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := CreateAnalyzer()
+	analyzer.SetFileIgnore(func(name, _ string) bool { return name == "file2" })
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	).(*Dir)
+	dir.UpdateStats(make(fs.HardLinkedItems))
+
+	assert.Equal(t, 4, dir.ItemCount)
+	assert.Equal(t, int64(5+4096*3), dir.Size)
+	assert.Equal(t, 4, analyzer.GetProgress().ItemCount)
+	assert.Equal(t, int64(5), analyzer.GetProgress().TotalSize)
+}
+
+func TestGetPartialRoot(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := CreateAnalyzer()
+	assert.Nil(t, analyzer.GetPartialRoot())
+
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	)
+	assert.Same(t, dir, analyzer.GetPartialRoot())
+
+	analyzer.ResetProgress()
+	assert.Nil(t, analyzer.GetPartialRoot())
+}
+
+func TestBlockSize(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	for _, analyzer := range []interface {
+		common.Analyzer
+		SetBlockSize(int64)
+	}{CreateAnalyzer(), CreateSeqAnalyzer()} {
+		analyzer.SetBlockSize(1000)
+		dir := analyzer.AnalyzeDir(
+			"test_dir", func(_, _ string) bool { return false }, false,
+		).(*Dir)
+		analyzer.GetDone().Wait()
+		dir.UpdateStats(make(fs.HardLinkedItems))
+		sort.Sort(sort.Reverse(dir.Files))
+
+		nested := dir.Files[0].(*Dir)
+		sort.Sort(sort.Reverse(nested.Files))
+		// file2 has 2 bytes and takes one whole block
+		assert.Equal(t, "file2", nested.Files[1].GetName())
+		assert.Equal(t, int64(2), nested.Files[1].GetSize())
+		assert.Equal(t, int64(1000), nested.Files[1].GetUsage())
+	}
+
+	assert.Equal(t, int64(4096), roundUpToBlock(4096, 4096))
+	assert.Equal(t, int64(8192), roundUpToBlock(4097, 4096))
+	assert.Equal(t, int64(0), roundUpToBlock(0, 4096))
+}
@@ -80,7 +80,7 @@ func (f *File) EncodeJSON(writer io.Writer, topLevel bool) error {
 		buff = append(buff, []byte(`,"notreg":true`)...)
 	}
 	if f.Flag == 'H' {
-		buff = append(buff, []byte(`,"ino":`+strconv.FormatUint(f.Mli, 10)+`,"hlnkc":true`)...)
+		buff = append(buff, []byte(`,"ino":`+strconv.FormatUint(f.GetMultiLinkedInode(), 10)+`,"hlnkc":true`)...)
 	}
 
 	buff = append(buff, '}')
@@ -50,9 +50,10 @@ func TestEncode(t *testing.T) {
 		Mtime:  time.Date(2021, 8, 19, 0, 40, 0, 0, time.UTC),
 	}
 	file3 := &File{
-		Name: "file3",
-		Mli:  1234,
-		Flag: 'H',
+		Name:       "file3",
+		Ino:        1234,
+		HardLinked: true,
+		Flag:       'H',
 	}
 	dir.Files = fs.Files{subdir}
 	subdir.Files = fs.Files{file, file2, file3}
@@ -0,0 +1,61 @@
+package analyze
+
+import (
+	"errors"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// fdRetries is number of times opening of a dir is retried when file descriptors run out
+	fdRetries = 6
+	// fdBackoff is wait before the first retry, it doubles with every further retry
+	fdBackoff = 10 * time.Millisecond
+	// fdReduceInterval is minimal time between two reductions of concurrency,
+	// failures of reads running at the same time reduce it only once
+	fdReduceInterval = 100 * time.Millisecond
+)
+
+// isFDExhausted returns true if the error means that the process or the system
+// ran out of file descriptors
+func isFDExhausted(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+// openDirRetrying opens the dir like openDir. When file descriptors run out,
+// number of dirs read at once is reduced and the opening is retried with backoff.
+// Reader of the last attempt is returned, also when the analysis was cancelled meanwhile.
+func (a *ParallelAnalyzer) openDirRetrying(path string) *dirReader {
+	backoff := fdBackoff
+	for attempt := 0; ; attempt++ {
+		reader := openDir(path)
+		if !isFDExhausted(reader.err) || attempt == fdRetries || a.isCancelled() {
+			return reader
+		}
+		a.progress.addFDExhausted()
+		a.reduceConcurrency()
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// reduceConcurrency halves number of dirs read at once for the rest of the analysis
+func (a *ParallelAnalyzer) reduceConcurrency() {
+	a.workersMutex.Lock()
+	defer a.workersMutex.Unlock()
+
+	if a.limit == nil || time.Since(a.fdReducedAt) < fdReduceInterval {
+		return
+	}
+	a.fdReducedAt = time.Now()
+	n := a.limit.halve()
+	log.Warnf("Out of file descriptors, reading at most %d directories at once", n)
+}
+
+func (a *ParallelAnalyzer) isCancelled() bool {
+	a.cancelMutex.Lock()
+	defer a.cancelMutex.Unlock()
+	return a.cancelled
+}
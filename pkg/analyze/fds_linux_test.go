@@ -0,0 +1,72 @@
+//go:build linux
+// +build linux
+
+package analyze
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+// lowestFreeFD returns the lowest file descriptor number not open by the process,
+// new file always gets the lowest free number
+func lowestFreeFD(t *testing.T) uint64 {
+	f, err := os.Open(os.DevNull)
+	assert.NoError(t, err)
+	defer f.Close()
+	return uint64(f.Fd())
+}
+
+func TestOpenDirRetrying(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	var limit syscall.Rlimit
+	assert.NoError(t, syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit))
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit)
+
+	a := CreateAnalyzer()
+	a.limit = newLimiter(8)
+
+	// no file can be opened until the limit is restored
+	lowered := limit
+	lowered.Cur = lowestFreeFD(t)
+	assert.NoError(t, syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lowered))
+	time.AfterFunc(25*time.Millisecond, func() {
+		assert.NoError(t, syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit))
+	})
+
+	reader := a.openDirRetrying("test_dir")
+	defer reader.close()
+	assert.NoError(t, reader.err)
+	assert.Len(t, reader.next(), 1)
+
+	exhausted := a.GetProgress().FDExhaustedCount
+	assert.GreaterOrEqual(t, exhausted, 2)
+	// retries close to each other reduce the concurrency once
+	assert.Equal(t, 4, a.limit.limit)
+}
+
+func TestOpenDirRetryingGivesUp(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	var limit syscall.Rlimit
+	assert.NoError(t, syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit))
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit)
+
+	a := CreateAnalyzer()
+	lowered := limit
+	lowered.Cur = lowestFreeFD(t)
+	assert.NoError(t, syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lowered))
+	reader := a.openDirRetrying("test_dir")
+	assert.NoError(t, syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit))
+
+	assert.True(t, isFDExhausted(reader.err))
+	assert.Equal(t, fdRetries, a.GetProgress().FDExhaustedCount)
+}
@@ -1,6 +1,7 @@
 package analyze
 
 import (
+	"os"
 	"path/filepath"
 	"sync"
 	"time"
@@ -9,14 +10,64 @@ import (
 )
 
 // File struct
+//
+// Fields are ordered to leave no padding, so the struct fits 128 bytes allocation class
+// on 64-bit platforms. Every scanned item holds one, keep it that way when adding fields.
 type File struct {
-	Mtime  time.Time
-	Parent fs.Item
-	Name   string
-	Size   int64
-	Usage  int64
-	Mli    uint64
-	Flag   rune
+	Mtime      time.Time
+	Parent     fs.Item
+	Name       string
+	Size       int64
+	Usage      int64
+	Atime      int64  // unix nanoseconds, zero if unknown
+	Ctime      int64  // unix nanoseconds, zero if unknown
+	Dev        uint64 // device and inode number, zero if unknown
+	Ino        uint64
+	Link       *Link // target of symlink, set only when reading of link targets is enabled
+	UID        uint32
+	GID        uint32
+	Flag       rune
+	Kind       FileKind // tells symlinks and sockets flagged '@' apart
+	HardLinked bool     // file has more links, Ino tells them apart from other files
+}
+
+// Link is target of symlink
+type Link struct {
+	Target string
+	// Broken is true if the target does not exist
+	Broken bool
+}
+
+// FileKind is kind of non-directory item
+type FileKind uint8
+
+// Kinds of files, symlinks and sockets are both flagged '@'
+const (
+	KindRegular FileKind = iota
+	KindSymlink
+	KindSocket
+	KindFifo
+	KindCharDevice
+	KindBlockDevice
+)
+
+// CreateFileFromInfo creates file in the parent dir from its info,
+// it is used to update already analyzed tree
+func CreateFileFromInfo(info os.FileInfo, parent *Dir) *File {
+	file := &File{
+		Name:   info.Name(),
+		Flag:   getFlag(info),
+		Kind:   getKind(info),
+		Size:   info.Size(),
+		Parent: parent,
+	}
+	setPlatformSpecificAttrs(file, info)
+	return file
+}
+
+// roundUpToBlock rounds size up to whole blocks of the block size
+func roundUpToBlock(size, blockSize int64) int64 {
+	return (size + blockSize - 1) / blockSize * blockSize
 }
 
 // GetName returns name of dir
@@ -64,12 +115,44 @@ func (f *File) GetMtime() time.Time {
 	return f.Mtime
 }
 
+// GetAtime returns access time of the file, zero time if unknown
+func (f *File) GetAtime() time.Time {
+	return unixNanoTime(f.Atime)
+}
+
+// GetCtime returns status change time of the file, zero time if unknown
+func (f *File) GetCtime() time.Time {
+	return unixNanoTime(f.Ctime)
+}
+
+// GetOwner returns user and group ID of the file owner
+func (f *File) GetOwner() (uid, gid uint32) {
+	return f.UID, f.GID
+}
+
+// GetInode returns device and inode number of the file, zero inode if unknown
+func (f *File) GetInode() (dev, ino uint64) {
+	return f.Dev, f.Ino
+}
+
 // GetType returns name type of item
 func (f *File) GetType() string {
-	if f.Flag == '@' {
+	switch {
+	case f.Kind == KindSymlink:
+		return "Symlink"
+	case f.Kind == KindSocket:
+		return "Socket"
+	case f.Kind == KindFifo:
+		return "Fifo"
+	case f.Kind == KindCharDevice:
+		return "CharDevice"
+	case f.Kind == KindBlockDevice:
+		return "BlockDevice"
+	case f.Flag == '@':
 		return "Other"
+	default:
+		return "File"
 	}
-	return "File"
 }
 
 // GetItemCount returns 1 for file
@@ -77,13 +160,16 @@ func (f *File) GetItemCount() int {
 	return 1
 }
 
-// GetMultiLinkedInode returns inode number of multilinked file
+// GetMultiLinkedInode returns inode number of multilinked file, zero for other files
 func (f *File) GetMultiLinkedInode() uint64 {
-	return f.Mli
+	if !f.HardLinked {
+		return 0
+	}
+	return f.Ino
 }
 
 func (f *File) alreadyCounted(linkedItems fs.HardLinkedItems) bool {
-	mli := f.Mli
+	mli := f.GetMultiLinkedInode()
 	counted := false
 	if mli > 0 {
 		f.Flag = 'H'
@@ -142,7 +228,81 @@ type Dir struct {
 	BasePath  string
 	Files     fs.Files
 	ItemCount int
-	m         sync.RWMutex
+	// Virtual dir only groups roots of analysis of multiple paths,
+	// it has no path and no size of its own
+	Virtual bool
+	// Flags are reasons of the flag set on the dir itself,
+	// ErrorMessage is the first error met while reading the dir
+	Flags        DirFlags
+	ErrorMessage string
+	m            sync.RWMutex
+}
+
+// DirFlags are reasons of flag of directory
+type DirFlags uint8
+
+// Reasons of directory flag, the dir is flagged '!' when it has read error or is partial
+const (
+	// DirReadError is set when entries of the dir could not be read
+	DirReadError DirFlags = 1 << iota
+	// DirPartial is set when some entries could not be examined or symlink could not be followed
+	DirPartial
+	// DirEmpty is set when the dir has no entries
+	DirEmpty
+	// DirCancelled is set when the scan was cancelled before all entries of the dir were read
+	DirCancelled
+	// DirIncomplete is set when the scan was cancelled before some subdir was read completely
+	DirIncomplete
+)
+
+var dirFlagNames = []string{"read_error", "partial", "empty", "cancelled", "incomplete"}
+
+// Names returns names of the set flags
+func (f DirFlags) Names() []string {
+	var names []string
+	for i, name := range dirFlagNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// FlagReasons returns reasons of the dir flag and the first error met while reading the dir
+func (f *Dir) FlagReasons() (DirFlags, string) {
+	f.m.RLock()
+	defer f.m.RUnlock()
+	return f.Flags, f.ErrorMessage
+}
+
+// IsComplete returns false if the scan was cancelled before the dir or its subdirs were read,
+// size and item count of the dir are lower bounds then
+func (f *Dir) IsComplete() bool {
+	flags, _ := f.FlagReasons()
+	return flags&(DirCancelled|DirIncomplete) == 0
+}
+
+// addFlags records reasons of the dir flag, message of the first error is kept
+func (f *Dir) addFlags(flags DirFlags, err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.Flags |= flags
+	if err != nil && f.ErrorMessage == "" {
+		f.ErrorMessage = err.Error()
+	}
+}
+
+// markIncomplete marks the dir incomplete if the entry is dir which was not read completely
+func (f *Dir) markIncomplete(entry fs.Item) {
+	if d, ok := entry.(interface{ IsComplete() bool }); ok && !d.IsComplete() {
+		f.addFlags(DirIncomplete, nil)
+	}
+}
+
+// setPartial flags the dir whose entry could not be examined
+func (f *Dir) setPartial(err error) {
+	f.Flag = '!'
+	f.addFlags(DirPartial, err)
 }
 
 // AddFile add item to files
@@ -208,9 +368,8 @@ func (f *Dir) GetItemStats(linkedItems fs.HardLinkedItems) (itemCount int, size,
 // UpdateStats recursively updates size and item count
 // It is safe to call this function while AddFile is being called from other goroutines
 func (f *Dir) UpdateStats(linkedItems fs.HardLinkedItems) {
-	totalSize := int64(4096)
-	totalUsage := int64(4096)
-	var itemCount int
+	itemCount, totalSize := f.ownStats()
+	totalUsage := totalSize
 
 	// Safely get a copy of the files slice while holding the read lock
 	f.m.RLock()
@@ -234,12 +393,21 @@ func (f *Dir) UpdateStats(linkedItems fs.HardLinkedItems) {
 				f.Flag = '.'
 			}
 		}
+		f.markIncomplete(entry)
 	}
-	f.ItemCount = itemCount + 1
+	f.ItemCount = itemCount
 	f.Size = totalSize
 	f.Usage = totalUsage
 }
 
+// ownStats returns item count and size of the dir itself without its entries
+func (f *Dir) ownStats() (int, int64) {
+	if f.Virtual {
+		return 0, 0
+	}
+	return 1, 4096
+}
+
 // RemoveFile removes item from dir, updates size and item count
 func (f *Dir) RemoveFile(item fs.Item) {
 	f.m.Lock()
@@ -265,3 +433,10 @@ func (f *Dir) RLock() func() {
 	f.m.RLock()
 	return f.m.RUnlock
 }
+
+func unixNanoTime(nsec int64) time.Time {
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
+}
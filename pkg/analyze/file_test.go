@@ -1,13 +1,23 @@
 package analyze
 
 import (
+	"errors"
 	"testing"
 	"time"
+	"unsafe"
 
 	"github.com/dundee/gdu/v5/pkg/fs"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestFileSize(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("size is checked on 64-bit platforms")
+	}
+	// every scanned item holds File, it should fit 128 bytes allocation class
+	assert.LessOrEqual(t, unsafe.Sizeof(File{}), uintptr(128))
+}
+
 func TestIsDir(t *testing.T) {
 	dir := Dir{
 		File: &File{
@@ -27,6 +37,20 @@ func TestIsDir(t *testing.T) {
 	assert.False(t, file.IsDir())
 }
 
+func TestDirFlagsNames(t *testing.T) {
+	assert.Empty(t, DirFlags(0).Names())
+	assert.Equal(t, []string{"read_error"}, DirReadError.Names())
+	assert.Equal(t, []string{"partial", "cancelled"}, (DirPartial | DirCancelled).Names())
+
+	dir := &Dir{File: &File{}}
+	dir.setPartial(errors.New("first"))
+	dir.setPartial(errors.New("second"))
+	flags, message := dir.FlagReasons()
+	assert.Equal(t, '!', dir.GetFlag())
+	assert.Equal(t, DirPartial, flags)
+	assert.Equal(t, "first", message)
+}
+
 func TestGetType(t *testing.T) {
 	dir := Dir{
 		File: &File{
@@ -52,6 +76,17 @@ func TestGetType(t *testing.T) {
 	assert.Equal(t, "Directory", dir.GetType())
 	assert.Equal(t, "File", file.GetType())
 	assert.Equal(t, "Other", file2.GetType())
+
+	file2.Kind = KindSymlink
+	assert.Equal(t, "Symlink", file2.GetType())
+	file2.Kind = KindSocket
+	assert.Equal(t, "Socket", file2.GetType())
+	file2.Kind = KindFifo
+	assert.Equal(t, "Fifo", file2.GetType())
+	file2.Kind = KindCharDevice
+	assert.Equal(t, "CharDevice", file2.GetType())
+	file2.Kind = KindBlockDevice
+	assert.Equal(t, "BlockDevice", file2.GetType())
 }
 
 func TestFind(t *testing.T) {
@@ -232,8 +267,9 @@ func TestUpdateStats(t *testing.T) {
 
 func TestGetMultiLinkedInode(t *testing.T) {
 	file := &File{
-		Name: "xxx",
-		Mli:  5,
+		Name:       "xxx",
+		Ino:        5,
+		HardLinked: true,
 	}
 
 	assert.Equal(t, uint64(5), file.GetMultiLinkedInode())
@@ -264,8 +300,9 @@ func TestSetParent(t *testing.T) {
 		BasePath:  "/",
 	}
 	file := &File{
-		Name: "xxx",
-		Mli:  5,
+		Name:       "xxx",
+		Ino:        5,
+		HardLinked: true,
 	}
 	file.SetParent(dir)
 
@@ -274,8 +311,9 @@ func TestSetParent(t *testing.T) {
 
 func TestGetFiles(t *testing.T) {
 	file := &File{
-		Name: "xxx",
-		Mli:  5,
+		Name:       "xxx",
+		Ino:        5,
+		HardLinked: true,
 	}
 	dir := &Dir{
 		File: &File{
@@ -294,8 +332,9 @@ func TestGetFiles(t *testing.T) {
 
 func TestGetFilesLocked(t *testing.T) {
 	file := &File{
-		Name: "xxx",
-		Mli:  5,
+		Name:       "xxx",
+		Ino:        5,
+		HardLinked: true,
 	}
 	dir := &Dir{
 		File: &File{
@@ -318,8 +357,9 @@ func TestGetFilesLocked(t *testing.T) {
 
 func TestSetFilesPanicsOnFile(t *testing.T) {
 	file := &File{
-		Name: "xxx",
-		Mli:  5,
+		Name:       "xxx",
+		Ino:        5,
+		HardLinked: true,
 	}
 	assert.Panics(t, func() {
 		file.SetFiles(fs.Files{file})
@@ -328,10 +368,18 @@ func TestSetFilesPanicsOnFile(t *testing.T) {
 
 func TestAddFilePanicsOnFile(t *testing.T) {
 	file := &File{
-		Name: "xxx",
-		Mli:  5,
+		Name:       "xxx",
+		Ino:        5,
+		HardLinked: true,
 	}
 	assert.Panics(t, func() {
 		file.AddFile(file)
 	})
 }
+
+func TestUnknownTimes(t *testing.T) {
+	file := &File{Name: "xxx"}
+
+	assert.True(t, file.GetAtime().IsZero())
+	assert.True(t, file.GetCtime().IsZero())
+}
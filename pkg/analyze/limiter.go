@@ -0,0 +1,80 @@
+package analyze
+
+import "sync"
+
+// limiter limits number of goroutines reading directories at once.
+// Unlike buffered channel its limit can be changed while it is in use.
+type limiter struct {
+	m      sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	closed bool
+}
+
+func newLimiter(limit int) *limiter {
+	l := &limiter{limit: max(limit, 1)}
+	l.cond = sync.NewCond(&l.m)
+	return l
+}
+
+// tryAcquire takes a slot if there is a free one
+func (l *limiter) tryAcquire() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.active >= l.limit {
+		return false
+	}
+	l.active++
+	return true
+}
+
+// acquire blocks until there is a free slot and takes it,
+// false is returned when the limiter was closed
+func (l *limiter) acquire() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	for l.active >= l.limit && !l.closed {
+		l.cond.Wait()
+	}
+	if l.closed {
+		return false
+	}
+	l.active++
+	return true
+}
+
+// release frees slot taken by acquire or tryAcquire
+func (l *limiter) release() {
+	l.m.Lock()
+	l.active--
+	l.m.Unlock()
+	l.cond.Signal()
+}
+
+// setLimit changes number of slots, at least one slot is kept.
+// Goroutines already holding a slot over the new limit are not interrupted.
+func (l *limiter) setLimit(limit int) {
+	l.m.Lock()
+	l.limit = max(limit, 1)
+	l.m.Unlock()
+	l.cond.Broadcast()
+}
+
+// halve halves number of slots, at least one slot is kept. The new limit is returned.
+func (l *limiter) halve() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.limit = max(l.limit/2, 1)
+	return l.limit
+}
+
+// close wakes up all goroutines waiting in acquire
+func (l *limiter) close() {
+	l.m.Lock()
+	l.closed = true
+	l.m.Unlock()
+	l.cond.Broadcast()
+}
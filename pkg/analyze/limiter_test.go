@@ -0,0 +1,64 @@
+package analyze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterTryAcquire(t *testing.T) {
+	l := newLimiter(0)
+
+	assert.True(t, l.tryAcquire())
+	assert.False(t, l.tryAcquire())
+
+	l.setLimit(2)
+	assert.True(t, l.tryAcquire())
+	assert.False(t, l.tryAcquire())
+
+	l.release()
+	l.release()
+	l.setLimit(1)
+	assert.True(t, l.tryAcquire())
+	assert.False(t, l.tryAcquire())
+}
+
+func TestLimiterAcquireAfterResize(t *testing.T) {
+	l := newLimiter(1)
+	assert.True(t, l.acquire())
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- l.acquire()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("slot acquired over the limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	l.setLimit(2)
+	assert.True(t, <-acquired)
+}
+
+func TestLimiterClose(t *testing.T) {
+	l := newLimiter(1)
+	assert.True(t, l.acquire())
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- l.acquire()
+	}()
+
+	l.close()
+	assert.False(t, <-acquired)
+}
+
+func TestLimiterHalve(t *testing.T) {
+	l := newLimiter(5)
+	assert.Equal(t, 2, l.halve())
+	assert.Equal(t, 1, l.halve())
+	assert.Equal(t, 1, l.halve())
+}
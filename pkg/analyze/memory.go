@@ -9,6 +9,30 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// setupGC configures garbage collection for the analysis and returns function restoring the previous settings.
+// With constGC the GC settings are left untouched.
+// With positive memoryLimit GC is disabled until the heap reaches the limit,
+// otherwise GC is tuned according to free memory of the host.
+func setupGC(constGC bool, memoryLimit int64, done <-chan struct{}) func() {
+	if constGC {
+		return func() {}
+	}
+
+	gcPercent := debug.SetGCPercent(-1)
+	if memoryLimit > 0 {
+		prevLimit := debug.SetMemoryLimit(memoryLimit)
+		return func() {
+			debug.SetMemoryLimit(prevLimit)
+			debug.SetGCPercent(gcPercent)
+		}
+	}
+
+	go manageMemoryUsage(done)
+	return func() {
+		debug.SetGCPercent(gcPercent)
+	}
+}
+
 // set GC percentage according to memory usage and system free memory
 func manageMemoryUsage(c <-chan struct{}) {
 	disabledGC := true
@@ -25,3 +25,30 @@ func TestRebalanceGC(t *testing.T) {
 		assert.Greater(t, 0, debug.SetGCPercent(-1))
 	}
 }
+
+func TestSetupGCWithMemoryLimit(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	prevPercent := debug.SetGCPercent(100)
+	defer debug.SetGCPercent(prevPercent)
+	prevLimit := debug.SetMemoryLimit(-1)
+
+	restore := setupGC(false, 1<<30, done)
+	assert.Equal(t, int64(1<<30), debug.SetMemoryLimit(-1))
+	assert.Equal(t, -1, debug.SetGCPercent(-1))
+
+	restore()
+	assert.Equal(t, prevLimit, debug.SetMemoryLimit(-1))
+	assert.Equal(t, 100, debug.SetGCPercent(-1))
+}
+
+func TestSetupGCConst(t *testing.T) {
+	prevPercent := debug.SetGCPercent(100)
+	defer debug.SetGCPercent(prevPercent)
+
+	restore := setupGC(true, 1<<30, nil)
+	assert.Equal(t, 100, debug.SetGCPercent(100))
+	restore()
+	assert.Equal(t, 100, debug.SetGCPercent(100))
+}
@@ -0,0 +1,89 @@
+package analyze
+
+import (
+	"hash/maphash"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// nameShards is number of independently locked parts of the name table
+	nameShards = 64
+	// nameChunkSize is size of byte chunks names are copied to
+	nameChunkSize = 64 * 1024
+	// maxInternedNames caps number of distinct names remembered by one table
+	maxInternedNames = 1 << 20
+	// maxInternedNameLen is length of the longest name interned, longer names rarely repeat
+	maxInternedNameLen = 64
+)
+
+// nameTable interns names of items read by one analysis.
+// Names met repeatedly (index.js, .gitignore, src) share single copy of their bytes
+// and copies are packed into large chunks, so short names don't pay for separate allocations.
+// Only up to maxInternedNames distinct names are remembered to bound memory of the table itself,
+// names met afterwards are still packed into chunks.
+type nameTable struct {
+	seed   maphash.Seed
+	shards [nameShards]nameShard
+}
+
+type nameShard struct {
+	mu    sync.Mutex
+	names map[string]string
+	chunk []byte
+}
+
+func newNameTable() *nameTable {
+	t := &nameTable{seed: maphash.MakeSeed()}
+	for i := range t.shards {
+		t.shards[i].names = make(map[string]string)
+	}
+	return t
+}
+
+// intern returns string equal to the name sharing its bytes with names interned before.
+// Nil or released table returns the name unchanged.
+func (t *nameTable) intern(name string) string {
+	if t == nil || name == "" || len(name) > maxInternedNameLen {
+		return name
+	}
+
+	shard := &t.shards[maphash.String(t.seed, name)%nameShards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if shard.names == nil {
+		return name
+	}
+	if interned, ok := shard.names[name]; ok {
+		return interned
+	}
+	interned := shard.copy(name)
+	if len(shard.names) < maxInternedNames/nameShards {
+		shard.names[interned] = interned
+	}
+	return interned
+}
+
+// copy appends the name to the current chunk, caller must hold s.mu
+func (s *nameShard) copy(name string) string {
+	if cap(s.chunk)-len(s.chunk) < len(name) {
+		s.chunk = make([]byte, 0, nameChunkSize)
+	}
+	start := len(s.chunk)
+	s.chunk = append(s.chunk, name...)
+	// bytes of the chunk are never written again once appended
+	return unsafe.String(&s.chunk[start], len(name))
+}
+
+// release drops the lookup maps once the analysis is done, interned names stay valid.
+// Workers of cancelled analysis can still call intern, they get their names unchanged.
+func (t *nameTable) release() {
+	for i := range t.shards {
+		shard := &t.shards[i]
+		shard.mu.Lock()
+		shard.names = nil
+		shard.chunk = nil
+		shard.mu.Unlock()
+	}
+}
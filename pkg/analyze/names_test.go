@@ -0,0 +1,108 @@
+package analyze
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+var benchFiles = flag.Int("bench-files", 100000, "number of files in tree generated by BenchmarkAnalyzeMemory")
+
+func TestNameTable(t *testing.T) {
+	table := newNameTable()
+
+	a := table.intern(strings.Clone("index.js"))
+	b := table.intern(strings.Clone("index.js"))
+	assert.Equal(t, "index.js", a)
+	assert.Equal(t, unsafe.StringData(a), unsafe.StringData(b))
+
+	other := table.intern("package.json")
+	assert.Equal(t, "package.json", other)
+	assert.NotEqual(t, unsafe.StringData(a), unsafe.StringData(other))
+
+	long := strings.Repeat("x", maxInternedNameLen+1)
+	assert.Equal(t, unsafe.StringData(long), unsafe.StringData(table.intern(long)))
+	assert.Equal(t, "", table.intern(""))
+
+	// interned names stay valid, new names are returned unchanged
+	table.release()
+	assert.Equal(t, "index.js", a)
+	name := strings.Clone("index.js")
+	assert.Equal(t, unsafe.StringData(name), unsafe.StringData(table.intern(name)))
+
+	var nilTable *nameTable
+	assert.Equal(t, "index.js", nilTable.intern("index.js"))
+}
+
+func TestAnalyzeInternsNames(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		assert.NoError(t, os.Mkdir(filepath.Join(root, dir), 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(root, dir, "index.js"), nil, 0o600))
+	}
+
+	analyzer := CreateAnalyzer()
+	dir := analyzer.AnalyzeDir(root, func(_, _ string) bool { return false }, false).(*Dir)
+	analyzer.GetDone().Wait()
+
+	var names []string
+	for _, sub := range dir.Files {
+		names = append(names, sub.GetFiles()[0].GetName())
+	}
+	assert.Equal(t, []string{"index.js", "index.js"}, names)
+	assert.Equal(t, unsafe.StringData(names[0]), unsafe.StringData(names[1]))
+}
+
+// BenchmarkAnalyzeMemory reports heap retained by the analyzed tree per file.
+// Size of the generated tree is set by -bench-files.
+func BenchmarkAnalyzeMemory(b *testing.B) {
+	root := b.TempDir()
+	createNamedTree(b, root, *benchFiles)
+
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		var before runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		analyzer := CreateAnalyzer()
+		dir := analyzer.AnalyzeDir(root, func(_, _ string) bool { return false }, true)
+		analyzer.GetDone().Wait()
+		dir.UpdateStats(make(fs.HardLinkedItems))
+
+		runtime.GC()
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		runtime.KeepAlive(dir)
+
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(*benchFiles), "heap-B/file")
+	}
+}
+
+// createNamedTree creates dirs of ten files, half of them named the same in every dir
+// as in source trees, the other half having unique names
+func createNamedTree(b *testing.B, root string, files int) {
+	common := []string{"index.js", "package.json", "README.md", ".gitignore", "LICENSE"}
+	for d := 0; d*10 < files; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("group%d", d/1000), fmt.Sprintf("module%d", d))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		names := append([]string{}, common...)
+		for i := 0; i < 5; i++ {
+			names = append(names, fmt.Sprintf("component%d_%d.js", d, i))
+		}
+		for _, name := range names {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
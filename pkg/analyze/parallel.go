@@ -4,60 +4,173 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"runtime/debug"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/dundee/gdu/v5/internal/common"
 	"github.com/dundee/gdu/v5/pkg/fs"
 	log "github.com/sirupsen/logrus"
 )
 
-var concurrencyLimit = make(chan struct{}, 3*runtime.GOMAXPROCS(0))
+// defaultConcurrency returns the default number of directories read in parallel
+func defaultConcurrency() int {
+	return 3 * runtime.GOMAXPROCS(0)
+}
 
 // ParallelAnalyzer implements Analyzer
 type ParallelAnalyzer struct {
-	progress            *common.CurrentProgress
-	progressChan        chan common.CurrentProgress
-	progressOutChan     chan common.CurrentProgress
-	progressDoneChan    chan struct{}
-	doneChan            common.SignalGroup
-	wait                *WaitGroup
-	ignoreDir           common.ShouldDirBeIgnored
-	followSymlinks      bool
-	gitAnnexedSize      bool
-	cancelled           bool
-	cancelMutex         sync.Mutex
-	progressDoneOnce    sync.Once
+	progress       *progressTracker
+	doneChan       common.SignalGroup
+	wait           *WaitGroup
+	queue          *dirQueue
+	limit          *limiter
+	concurrency    int
+	workers        int
+	workersMutex   sync.Mutex
+	workersDone    sync.WaitGroup // analysis returns once all its workers exit
+	fdReducedAt    time.Time
+	ignoreDir      common.ShouldDirBeIgnored
+	ignoreFile     common.ShouldFileBeIgnored
+	followSymlinks bool
+	gitAnnexedSize bool
+	ignoreHidden   bool
+	memoryLimit    int64
+	blockSize      int64
+	linkTargets    bool
+	sortBy         string
+	cancelled      bool
+	cancelMutex    sync.Mutex
+	throttle       *throttle
+	root           *Dir
+	rootMutex      sync.Mutex
+	topFilesCount  int
+	topFiles       *topFilesTracker
+	names          *nameTable
 }
 
 // CreateAnalyzer returns Analyzer
 func CreateAnalyzer() *ParallelAnalyzer {
 	return &ParallelAnalyzer{
-		progress: &common.CurrentProgress{
-			ItemCount: 0,
-			TotalSize: int64(0),
-		},
-		progressChan:     make(chan common.CurrentProgress, 1),
-		progressOutChan:  make(chan common.CurrentProgress, 1),
-		progressDoneChan: make(chan struct{}),
-		doneChan:         make(common.SignalGroup),
-		wait:             (&WaitGroup{}).Init(),
+		progress:    newProgressTracker(),
+		doneChan:    make(common.SignalGroup),
+		wait:        (&WaitGroup{}).Init(),
+		throttle:    newThrottle(),
+		concurrency: defaultConcurrency(),
 	}
 }
 
+// SetConcurrency sets number of workers reading directories in parallel,
+// non-positive value sets the default.
+// When called while analysis is running, the worker pool is resized.
+func (a *ParallelAnalyzer) SetConcurrency(n int) {
+	if n <= 0 {
+		n = defaultConcurrency()
+	}
+
+	a.workersMutex.Lock()
+	defer a.workersMutex.Unlock()
+
+	a.concurrency = n
+	if a.limit == nil {
+		return
+	}
+	// surplus workers wait for a free slot until the analysis is done
+	a.limit.setLimit(n)
+	a.startWorkers(n)
+}
+
 // SetFollowSymlinks sets whether symlink to files should be followed
 func (a *ParallelAnalyzer) SetFollowSymlinks(v bool) {
 	a.followSymlinks = v
 }
 
+// SetIgnoreHidden sets whether files and directories beginning with dot should be skipped
+func (a *ParallelAnalyzer) SetIgnoreHidden(v bool) {
+	a.ignoreHidden = v
+}
+
+// SetFileIgnore sets function deciding which files should be left out,
+// nil means no file is ignored
+func (a *ParallelAnalyzer) SetFileIgnore(ignore common.ShouldFileBeIgnored) {
+	a.ignoreFile = ignore
+}
+
 // SetShowAnnexedSize sets whether to use annexed size of git-annex files
 func (a *ParallelAnalyzer) SetShowAnnexedSize(v bool) {
 	a.gitAnnexedSize = v
 }
 
+// SetDirsPerSecondLimit limits number of directory reads per second,
+// every further batch of entries of huge directories counts as another read.
+// Non-positive value disables the limit.
+func (a *ParallelAnalyzer) SetDirsPerSecondLimit(n int) {
+	a.throttle.setLimit(n)
+}
+
+// SetPaused pauses reading of directories until it is called with false,
+// directories being read are finished. Cancel ends the pause.
+func (a *ParallelAnalyzer) SetPaused(paused bool) {
+	a.throttle.setPaused(paused)
+}
+
+// SetMemoryLimit sets heap size up to which GC is disabled during analysis,
+// zero means GC is tuned according to free memory
+func (a *ParallelAnalyzer) SetMemoryLimit(limit int64) {
+	a.memoryLimit = limit
+}
+
+// SetBlockSize sets size of blocks usage of files is computed in, usage is apparent size
+// rounded up to whole blocks. Non-positive size keeps usage allocated by the filesystem.
+func (a *ParallelAnalyzer) SetBlockSize(n int64) {
+	a.blockSize = n
+}
+
+// SetReadLinkTargets enables reading of targets of symlinks, they are stored
+// only when enabled to keep memory of the tree low
+func (a *ParallelAnalyzer) SetReadLinkTargets(v bool) {
+	a.linkTargets = v
+}
+
+// SetSortResults sets order of children of every dir sorted once the analysis is done,
+// SortResultsByName or SortResultsBySize. Empty order keeps items in order they were read.
+func (a *ParallelAnalyzer) SetSortResults(by string) {
+	a.sortBy = by
+}
+
 // GetProgressChan returns channel for getting progress
 func (a *ParallelAnalyzer) GetProgressChan() chan common.CurrentProgress {
-	return a.progressOutChan
+	return a.progress.outChan
+}
+
+// GetProgress returns current progress of the analysis
+func (a *ParallelAnalyzer) GetProgress() common.CurrentProgress {
+	return a.progress.get()
+}
+
+// SetTrackTopFiles sets number of the largest files tracked during analysis,
+// non-positive value disables the tracking
+func (a *ParallelAnalyzer) SetTrackTopFiles(n int) {
+	a.topFilesCount = n
+}
+
+// GetTopFiles returns the largest files found by the last analysis
+// sorted by apparent size descending, nil if the tracking was disabled
+func (a *ParallelAnalyzer) GetTopFiles() fs.Files {
+	return a.topFiles.get()
+}
+
+// GetPartialRoot returns root dir of the running analysis, nil if no dir was read yet.
+// Subdirs are added to the tree when they are read completely,
+// sizes and item counts of dirs are not updated until the analysis is done.
+func (a *ParallelAnalyzer) GetPartialRoot() fs.Item {
+	a.rootMutex.Lock()
+	defer a.rootMutex.Unlock()
+
+	if a.root == nil {
+		return nil
+	}
+	return a.root
 }
 
 // GetDone returns channel for checking when analysis is done
@@ -67,13 +180,17 @@ func (a *ParallelAnalyzer) GetDone() common.SignalGroup {
 
 // ResetProgress returns progress
 func (a *ParallelAnalyzer) ResetProgress() {
-	a.progress = &common.CurrentProgress{}
-	a.progressChan = make(chan common.CurrentProgress, 1)
-	a.progressOutChan = make(chan common.CurrentProgress, 1)
-	a.progressDoneChan = make(chan struct{})
+	a.progress = newProgressTracker()
 	a.doneChan = make(common.SignalGroup)
+	a.cancelMutex.Lock()
 	a.wait = (&WaitGroup{}).Init()
 	a.cancelled = false
+	a.cancelMutex.Unlock()
+	a.throttle.reset()
+
+	a.rootMutex.Lock()
+	a.root = nil
+	a.rootMutex.Unlock()
 }
 
 // Cancel cancels the analysis gracefully
@@ -86,52 +203,105 @@ func (a *ParallelAnalyzer) Cancel() {
 	}
 
 	a.cancelled = true
-	// Send cancellation signal to wait group and progress channels
+	// Send cancellation signal to wait group
 	a.wait.Cancel()
-	a.progressDoneOnce.Do(func() {
-		close(a.progressDoneChan)
-	})
+	a.throttle.stop()
 }
 
 // AnalyzeDir analyzes given path
 func (a *ParallelAnalyzer) AnalyzeDir(
 	path string, ignore common.ShouldDirBeIgnored, constGC bool,
 ) fs.Item {
-	if !constGC {
-		defer debug.SetGCPercent(debug.SetGCPercent(-1))
-		go manageMemoryUsage(a.doneChan)
-	}
+	return a.analyze(ignore, constGC, func() *Dir {
+		return a.processDir(path, nil)
+	})
+}
+
+// AnalyzeDirs analyzes given paths in one analysis, roots of the paths
+// are children of returned virtual dir. Relative paths are made absolute.
+func (a *ParallelAnalyzer) AnalyzeDirs(
+	paths []string, ignore common.ShouldDirBeIgnored, constGC bool,
+) fs.Item {
+	root := newRootsDir()
+	a.rootMutex.Lock()
+	a.root = root
+	a.rootMutex.Unlock()
+
+	return a.analyze(ignore, constGC, func() *Dir {
+		for _, path := range absPaths(paths) {
+			root.addRoot(a.processDir(path, nil))
+		}
+		return root
+	})
+}
+
+// analyze runs workers reading subdirs queued by processRoots
+// and waits until all of them are read
+func (a *ParallelAnalyzer) analyze(
+	ignore common.ShouldDirBeIgnored, constGC bool, processRoots func() *Dir,
+) fs.Item {
+	defer setupGC(constGC, a.memoryLimit, a.doneChan)()
 
 	a.ignoreDir = ignore
+	a.topFiles = nil
+	if a.topFilesCount > 0 {
+		a.topFiles = newTopFilesTracker(a.topFilesCount)
+	}
+	a.names = newNameTable()
+
+	a.workersMutex.Lock()
+	a.queue = newDirQueue()
+	a.limit = newLimiter(a.concurrency)
+	a.workers = 0
+	a.startWorkers(a.concurrency)
+	a.workersMutex.Unlock()
 
-	go a.updateProgress()
-	dir := a.processDir(path)
+	// root dirs are counted as a job so that the wait group
+	// doesn't reach zero before all subdirs are queued
+	a.wait.Add(1)
+	dir := processRoots()
+	a.wait.Done()
 
 	a.wait.Wait()
 
-	// Safely send to progressDoneChan only if not cancelled
+	a.workersMutex.Lock()
+	a.limit.close()
+	// subdirs left in the queue by cancelled analysis are not read, their parents are incomplete
+	for _, job := range a.queue.close() {
+		job.parent.addFlags(DirIncomplete, nil)
+	}
+	a.limit = nil
+	a.workersMutex.Unlock()
+	// workers of cancelled analysis finish dirs they are reading, they must not
+	// touch the tree and state of the analysis once it is returned or reset
+	a.workersDone.Wait()
+	a.names.release()
+
+	// cancelled analysis returns its incomplete tree unsorted
 	a.cancelMutex.Lock()
 	cancelled := a.cancelled
 	a.cancelMutex.Unlock()
-
-	if !cancelled {
-		a.progressDoneChan <- struct{}{}
+	if a.sortBy != "" && !cancelled {
+		sortResults(dir, a.sortBy)
 	}
+
 	a.doneChan.Broadcast()
 
 	return dir
 }
 
-func (a *ParallelAnalyzer) processDir(path string) *Dir {
+func (a *ParallelAnalyzer) processDir(path string, ancestors *dirChain) *Dir {
 	var (
-		file       *File
-		err        error
-		totalSize  int64
-		info       os.FileInfo
-		subDirChan = make(chan *Dir)
-		dirCount   int
+		file      *File
+		err       error
+		totalSize int64
+		fileCount int
+		info      os.FileInfo
 	)
 
+	// throttled analysis waits for its turn to read the dir, cancellation ends the wait
+	a.throttle.wait()
+
 	// Check if cancelled before starting
 	a.cancelMutex.Lock()
 	if a.cancelled {
@@ -142,29 +312,25 @@ func (a *ParallelAnalyzer) processDir(path string) *Dir {
 				Name: filepath.Base(path),
 				Flag: '!',
 			},
+			Flags:     DirCancelled,
 			ItemCount: 1,
 			Files:     make(fs.Files, 0),
 		}
-		a.wait.Add(1)
-		a.wait.Done()
+		a.progress.addDir(path, 0, 0)
 		return dir
 	}
 	a.cancelMutex.Unlock()
 
-	a.wait.Add(1)
-
-	files, err := os.ReadDir(path)
-	if err != nil {
-		log.Print(err.Error())
-	}
+	reader := a.openDirRetrying(path)
+	defer reader.close()
 
 	dir := &Dir{
 		File: &File{
-			Name: filepath.Base(path),
-			Flag: getDirFlag(err, len(files)),
+			Name: a.names.intern(filepath.Base(path)),
+			Flag: ' ',
 		},
 		ItemCount: 1,
-		Files:     make(fs.Files, 0, len(files)),
+		Files:     make(fs.Files, 0),
 	}
 	setDirPlatformSpecificAttrs(dir, path)
 
@@ -174,105 +340,151 @@ func (a *ParallelAnalyzer) processDir(path string) *Dir {
 		dir.BasePath = filepath.Dir(path)
 	}
 
-	for _, f := range files {
-		// Check cancellation periodically
-		a.cancelMutex.Lock()
-		if a.cancelled {
-			a.cancelMutex.Unlock()
-			break
-		}
-		a.cancelMutex.Unlock()
+	if a.followSymlinks {
+		ancestors = ancestors.push(path)
+	}
 
-		name := f.Name()
-		entryPath := filepath.Join(path, name)
-		if f.IsDir() {
-			if a.ignoreDir(name, entryPath) {
-				continue
+	// first read dir is the root
+	a.rootMutex.Lock()
+	if a.root == nil {
+		a.root = dir
+	}
+	a.rootMutex.Unlock()
+
+batches:
+	for files := reader.next(); len(files) > 0; files = reader.next() {
+		for _, f := range files {
+			// Check cancellation periodically
+			a.cancelMutex.Lock()
+			if a.cancelled {
+				a.cancelMutex.Unlock()
+				dir.addFlags(DirCancelled, nil)
+				break batches
 			}
-			dirCount++
-
-			go func(entryPath string) {
-				concurrencyLimit <- struct{}{}
-				subdir := a.processDir(entryPath)
-				subdir.Parent = dir
-
-				subDirChan <- subdir
-				<-concurrencyLimit
-			}(entryPath)
-		} else {
-			info, err = f.Info()
-			if err != nil {
-				log.Print(err.Error())
-				dir.Flag = '!'
+			a.cancelMutex.Unlock()
+
+			var flag rune
+			name := f.Name()
+			if a.ignoreHidden && strings.HasPrefix(name, ".") {
 				continue
 			}
-			if a.followSymlinks && info.Mode()&os.ModeSymlink != 0 {
-				infoF, err := followSymlink(entryPath, a.gitAnnexedSize)
+			entryPath := filepath.Join(path, name)
+			if f.IsDir() {
+				if a.ignoreDir(name, entryPath) {
+					continue
+				}
+
+				a.wait.Add(1)
+				a.queue.push(dirJob{path: entryPath, parent: dir, ancestors: ancestors})
+			} else {
+				if a.ignoreFile != nil && a.ignoreFile(name, entryPath) {
+					continue
+				}
+
+				info, err = f.Info()
+				if isVanished(err) {
+					a.progress.addVanished()
+					continue
+				}
 				if err != nil {
 					log.Print(err.Error())
-					dir.Flag = '!'
+					dir.setPartial(err)
 					continue
 				}
-				if infoF != nil {
-					info = infoF
+				if a.followSymlinks && info.Mode()&os.ModeSymlink != 0 {
+					infoF, err := followSymlink(entryPath, a.gitAnnexedSize)
+					if err != nil {
+						log.Print(err.Error())
+						dir.setPartial(err)
+						continue
+					}
+					if infoF != nil {
+						info = infoF
+					} else {
+						follow, loop := checkDirSymlink(name, entryPath, ancestors, a.ignoreDir)
+						if follow {
+							a.wait.Add(1)
+							a.queue.push(dirJob{path: entryPath, parent: dir, ancestors: ancestors})
+							continue
+						}
+						if loop {
+							flag = 'L'
+						}
+					}
 				}
-			}
 
-			file = &File{
-				Name:   name,
-				Flag:   getFlag(info),
-				Size:   info.Size(),
-				Parent: dir,
-			}
-			setPlatformSpecificAttrs(file, info)
+				if flag == 0 {
+					flag = getFlag(info)
+				}
+				file = &File{
+					Name:   a.names.intern(name),
+					Flag:   flag,
+					Kind:   getKind(info),
+					Size:   info.Size(),
+					Parent: dir,
+				}
+				setPlatformSpecificAttrs(file, info)
+				if a.blockSize > 0 {
+					file.Usage = roundUpToBlock(file.Size, a.blockSize)
+				}
+				if a.linkTargets && file.Kind == KindSymlink {
+					file.Link = readLink(entryPath)
+				}
 
-			totalSize += info.Size()
+				totalSize += info.Size()
+				fileCount++
 
-			dir.AddFile(file)
+				dir.AddFile(file)
+				a.topFiles.add(file)
+			}
 		}
-	}
-
-	go func() {
-		var sub *Dir
 
-		for i := 0; i < dirCount; i++ {
-			sub = <-subDirChan
-			dir.AddFile(sub)
+		// progress of huge dirs is reported after every batch,
+		// reading of the next batch is throttled the same as reading of another dir
+		if len(files) == readDirBatchSize {
+			a.progress.addFiles(path, fileCount, totalSize)
+			fileCount, totalSize = 0, 0
+			a.throttle.wait()
 		}
+	}
+	if reader.err != nil {
+		log.Print(reader.err.Error())
+	}
+	reader.setReadFlags(dir)
 
-		a.wait.Done()
-	}()
+	a.progress.addDir(path, fileCount, totalSize)
+	return dir
+}
 
-	// Check cancellation before sending final progress
-	a.cancelMutex.Lock()
-	if !a.cancelled {
-		a.cancelMutex.Unlock()
-		a.progressChan <- common.CurrentProgress{
-			CurrentItemName: path,
-			ItemCount:       len(files),
-			TotalSize:       totalSize,
-		}
-	} else {
-		a.cancelMutex.Unlock()
+// startWorkers starts workers until there are n of them,
+// workersMutex must be held
+func (a *ParallelAnalyzer) startWorkers(n int) {
+	for ; a.workers < n; a.workers++ {
+		a.workersDone.Add(1)
+		go a.worker(a.queue, a.limit)
 	}
-	return dir
 }
 
-func (a *ParallelAnalyzer) updateProgress() {
+// worker reads queued directories and adds them to their parents until the queue is closed,
+// only as many workers as the limit allows are reading at once
+func (a *ParallelAnalyzer) worker(queue *dirQueue, limit *limiter) {
+	defer a.workersDone.Done()
 	for {
-		select {
-		case <-a.progressDoneChan:
+		if !limit.acquire() {
 			return
-		case progress := <-a.progressChan:
-			a.progress.CurrentItemName = progress.CurrentItemName
-			a.progress.ItemCount += progress.ItemCount
-			a.progress.TotalSize += progress.TotalSize
 		}
-
-		select {
-		case a.progressOutChan <- *a.progress:
-		default:
+		job, ok := queue.pop()
+		if !ok {
+			limit.release()
+			return
 		}
+
+		subdir := a.processDir(job.path, job.ancestors)
+		subdir.Parent = job.parent
+		job.parent.AddFile(subdir)
+
+		a.wait.Done()
+		limit.release()
 	}
 }
 
@@ -287,9 +499,49 @@ func getDirFlag(err error, items int) rune {
 	}
 }
 
+// getDirFlags returns reasons of the flag returned by getDirFlag
+func getDirFlags(err error, items int) DirFlags {
+	switch {
+	case err != nil:
+		return DirReadError
+	case items == 0:
+		return DirEmpty
+	default:
+		return 0
+	}
+}
+
 func getFlag(f os.FileInfo) rune {
 	if f.Mode()&os.ModeSymlink != 0 || f.Mode()&os.ModeSocket != 0 {
 		return '@'
 	}
 	return ' '
 }
+
+func getKind(f os.FileInfo) FileKind {
+	switch {
+	case f.Mode()&os.ModeSymlink != 0:
+		return KindSymlink
+	case f.Mode()&os.ModeSocket != 0:
+		return KindSocket
+	case f.Mode()&os.ModeNamedPipe != 0:
+		return KindFifo
+	case f.Mode()&os.ModeCharDevice != 0:
+		return KindCharDevice
+	case f.Mode()&os.ModeDevice != 0:
+		return KindBlockDevice
+	default:
+		return KindRegular
+	}
+}
+
+// readLink returns target of the symlink, nil is returned if the link cannot be read
+func readLink(path string) *Link {
+	target, err := os.Readlink(path)
+	if err != nil {
+		log.Print(err.Error())
+		return nil
+	}
+	_, err = os.Stat(path)
+	return &Link{Target: target, Broken: err != nil}
+}
@@ -3,7 +3,6 @@ package analyze
 import (
 	"os"
 	"path/filepath"
-	"runtime/debug"
 
 	"github.com/dundee/gdu/v5/internal/common"
 	"github.com/dundee/gdu/v5/pkg/fs"
@@ -12,30 +11,34 @@ import (
 
 // ParallelStableOrderAnalyzer implements Analyzer
 type ParallelStableOrderAnalyzer struct {
-	progress         *common.CurrentProgress
-	progressChan     chan common.CurrentProgress
-	progressOutChan  chan common.CurrentProgress
-	progressDoneChan chan struct{}
-	doneChan         common.SignalGroup
-	wait             *WaitGroup
-	ignoreDir        common.ShouldDirBeIgnored
-	followSymlinks   bool
-	gitAnnexedSize   bool
+	progress       *progressTracker
+	doneChan       common.SignalGroup
+	wait           *WaitGroup
+	limit          *limiter
+	ignoreDir      common.ShouldDirBeIgnored
+	followSymlinks bool
+	gitAnnexedSize bool
+	memoryLimit    int64
 }
 
 // CreateStableOrderAnalyzer returns parallel Analyzer which keeps stable order of files
 func CreateStableOrderAnalyzer() *ParallelStableOrderAnalyzer {
 	return &ParallelStableOrderAnalyzer{
-		progress: &common.CurrentProgress{
-			ItemCount: 0,
-			TotalSize: int64(0),
-		},
-		progressChan:     make(chan common.CurrentProgress, 1),
-		progressOutChan:  make(chan common.CurrentProgress, 1),
-		progressDoneChan: make(chan struct{}),
-		doneChan:         make(common.SignalGroup),
-		wait:             (&WaitGroup{}).Init(),
+		progress: newProgressTracker(),
+		doneChan: make(common.SignalGroup),
+		wait:     (&WaitGroup{}).Init(),
+		limit:    newLimiter(defaultConcurrency()),
+	}
+}
+
+// SetConcurrency sets maximum number of directories read in parallel,
+// non-positive value sets the default.
+// It can be called while analysis is running.
+func (a *ParallelStableOrderAnalyzer) SetConcurrency(n int) {
+	if n <= 0 {
+		n = defaultConcurrency()
 	}
+	a.limit.setLimit(n)
 }
 
 // SetFollowSymlinks sets whether symlink to files should be followed
@@ -48,9 +51,20 @@ func (a *ParallelStableOrderAnalyzer) SetShowAnnexedSize(v bool) {
 	a.gitAnnexedSize = v
 }
 
+// SetMemoryLimit sets heap size up to which GC is disabled during analysis,
+// zero means GC is tuned according to free memory
+func (a *ParallelStableOrderAnalyzer) SetMemoryLimit(limit int64) {
+	a.memoryLimit = limit
+}
+
 // GetProgressChan returns channel for getting progress
 func (a *ParallelStableOrderAnalyzer) GetProgressChan() chan common.CurrentProgress {
-	return a.progressOutChan
+	return a.progress.outChan
+}
+
+// GetProgress returns current progress of the analysis
+func (a *ParallelStableOrderAnalyzer) GetProgress() common.CurrentProgress {
+	return a.progress.get()
 }
 
 // GetDone returns channel for checking when analysis is done
@@ -60,10 +74,7 @@ func (a *ParallelStableOrderAnalyzer) GetDone() common.SignalGroup {
 
 // ResetProgress returns progress
 func (a *ParallelStableOrderAnalyzer) ResetProgress() {
-	a.progress = &common.CurrentProgress{}
-	a.progressChan = make(chan common.CurrentProgress, 1)
-	a.progressOutChan = make(chan common.CurrentProgress, 1)
-	a.progressDoneChan = make(chan struct{})
+	a.progress = newProgressTracker()
 	a.doneChan = make(common.SignalGroup)
 	a.wait = (&WaitGroup{}).Init()
 }
@@ -72,20 +83,15 @@ func (a *ParallelStableOrderAnalyzer) ResetProgress() {
 func (a *ParallelStableOrderAnalyzer) AnalyzeDir(
 	path string, ignore common.ShouldDirBeIgnored, constGC bool,
 ) fs.Item {
-	if !constGC {
-		defer debug.SetGCPercent(debug.SetGCPercent(-1))
-		go manageMemoryUsage(a.doneChan)
-	}
+	defer setupGC(constGC, a.memoryLimit, a.doneChan)()
 
 	a.ignoreDir = ignore
 
-	go a.updateProgress()
 	dir := a.processDir(path)
 
 	dir.BasePath = filepath.Dir(path)
 	a.wait.Wait()
 
-	a.progressDoneChan <- struct{}{}
 	a.doneChan.Broadcast()
 
 	return dir
@@ -101,6 +107,7 @@ func (a *ParallelStableOrderAnalyzer) processDir(path string) *Dir {
 		file      *File
 		err       error
 		totalSize int64
+		fileCount int
 		info      os.FileInfo
 		itemCount int
 		dirCount  int
@@ -122,6 +129,7 @@ func (a *ParallelStableOrderAnalyzer) processDir(path string) *Dir {
 		Files:     make(fs.Files, 0, len(files)),
 	}
 	setDirPlatformSpecificAttrs(dir, path)
+	dir.addFlags(getDirFlags(err, len(files)), err)
 
 	// Buffer channel to prevent deadlock when sending files synchronously
 	itemChan := make(chan indexedItem, len(files))
@@ -137,26 +145,36 @@ func (a *ParallelStableOrderAnalyzer) processDir(path string) *Dir {
 			itemCount++
 			dirCount++
 
-			go func(entryPath string, idx int) {
-				concurrencyLimit <- struct{}{}
+			if a.limit.tryAcquire() {
+				go func(entryPath string, idx int) {
+					subdir := a.processDir(entryPath)
+					subdir.Parent = dir
+
+					a.limit.release()
+					itemChan <- indexedItem{idx, subdir}
+				}(entryPath, currentIndex)
+			} else {
+				// no free slot, read the subdir in this goroutine
 				subdir := a.processDir(entryPath)
 				subdir.Parent = dir
-
-				itemChan <- indexedItem{idx, subdir}
-				<-concurrencyLimit
-			}(entryPath, currentIndex)
+				itemChan <- indexedItem{currentIndex, subdir}
+			}
 		} else {
 			info, err = f.Info()
+			if isVanished(err) {
+				a.progress.addVanished()
+				continue
+			}
 			if err != nil {
 				log.Print(err.Error())
-				dir.Flag = '!'
+				dir.setPartial(err)
 				continue
 			}
 			if a.followSymlinks && info.Mode()&os.ModeSymlink != 0 {
 				infoF, err := followSymlink(entryPath, a.gitAnnexedSize)
 				if err != nil {
 					log.Print(err.Error())
-					dir.Flag = '!'
+					dir.setPartial(err)
 					continue
 				}
 				if infoF != nil {
@@ -167,12 +185,14 @@ func (a *ParallelStableOrderAnalyzer) processDir(path string) *Dir {
 			file = &File{
 				Name:   name,
 				Flag:   getFlag(info),
+				Kind:   getKind(info),
 				Size:   info.Size(),
 				Parent: dir,
 			}
 			setPlatformSpecificAttrs(file, info)
 
 			totalSize += info.Size()
+			fileCount++
 
 			// Send file to channel with its index
 			itemChan <- indexedItem{itemCount, file}
@@ -197,28 +217,6 @@ func (a *ParallelStableOrderAnalyzer) processDir(path string) *Dir {
 		a.wait.Done()
 	}()
 
-	a.progressChan <- common.CurrentProgress{
-		CurrentItemName: path,
-		ItemCount:       len(files),
-		TotalSize:       totalSize,
-	}
+	a.progress.addDir(path, fileCount, totalSize)
 	return dir
 }
-
-func (a *ParallelStableOrderAnalyzer) updateProgress() {
-	for {
-		select {
-		case <-a.progressDoneChan:
-			return
-		case progress := <-a.progressChan:
-			a.progress.CurrentItemName = progress.CurrentItemName
-			a.progress.ItemCount += progress.ItemCount
-			a.progress.TotalSize += progress.TotalSize
-		}
-
-		select {
-		case a.progressOutChan <- *a.progress:
-		default:
-		}
-	}
-}
@@ -0,0 +1,84 @@
+package analyze
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/dundee/gdu/v5/internal/common"
+)
+
+// progressTracker holds the authoritative progress of analysis.
+// The out channel is a convenience for consumers polling the progress,
+// it always holds the latest snapshot when not drained.
+type progressTracker struct {
+	m        sync.Mutex
+	progress common.CurrentProgress
+	outChan  chan common.CurrentProgress
+}
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{
+		outChan: make(chan common.CurrentProgress, 1),
+	}
+}
+
+// addDir adds a read directory together with the files added into it to the total progress
+func (t *progressTracker) addDir(path string, fileCount int, totalSize int64) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.progress.DirCount++
+	t.add(path, fileCount, totalSize)
+}
+
+// addFiles adds files of a directory still being read to the total progress
+func (t *progressTracker) addFiles(path string, fileCount int, totalSize int64) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.add(path, fileCount, totalSize)
+}
+
+// add updates the progress and sends it to the consumer, caller must hold t.m
+func (t *progressTracker) add(path string, fileCount int, totalSize int64) {
+	t.progress.CurrentItemName = path
+	t.progress.FileCount += fileCount
+	t.progress.ItemCount = t.progress.FileCount + t.progress.DirCount
+	t.progress.TotalSize += totalSize
+
+	// replace stale snapshot not yet read by the consumer
+	select {
+	case <-t.outChan:
+	default:
+	}
+	t.outChan <- t.progress
+}
+
+// addVanished counts entry deleted after its dir was read,
+// it is sent to the consumer together with the next read directory
+func (t *progressTracker) addVanished() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.progress.VanishedCount++
+}
+
+// addFDExhausted counts dir which could not be opened because file descriptors ran out
+func (t *progressTracker) addFDExhausted() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.progress.FDExhaustedCount++
+}
+
+// get returns snapshot of the current progress
+func (t *progressTracker) get() common.CurrentProgress {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.progress
+}
+
+// isVanished returns true if reading of an entry failed because it was deleted after its dir was read.
+// Such entry is skipped without flagging the dir as not read completely.
+func isVanished(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
@@ -0,0 +1,72 @@
+package analyze
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressTrackerKeepsLatestSnapshot(t *testing.T) {
+	tracker := newProgressTracker()
+	tracker.addDir("a", 1, 10)
+	tracker.addDir("b", 2, 20)
+
+	assert.Equal(t, "b", (<-tracker.outChan).CurrentItemName)
+	assert.Empty(t, tracker.outChan)
+
+	progress := tracker.get()
+	assert.Equal(t, "b", progress.CurrentItemName)
+	assert.Equal(t, 3, progress.FileCount)
+	assert.Equal(t, 2, progress.DirCount)
+	assert.Equal(t, 5, progress.ItemCount)
+	assert.Equal(t, int64(30), progress.TotalSize)
+}
+
+func TestGetProgressAfterAnalysis(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := CreateAnalyzer()
+	analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	)
+	analyzer.GetDone().Wait()
+
+	progress := analyzer.GetProgress()
+	assert.Equal(t, 5, progress.ItemCount)
+	assert.Equal(t, 2, progress.FileCount)
+	assert.Equal(t, 3, progress.DirCount)
+	assert.Equal(t, int64(7), progress.TotalSize)
+	assert.Equal(t, progress, <-analyzer.GetProgressChan())
+
+	analyzer.ResetProgress()
+	assert.Equal(t, 0, analyzer.GetProgress().ItemCount)
+}
+
+func TestVanishedFilesAreCounted(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := CreateAnalyzer()
+	// file is deleted after its dir was read, right before it is stat'ed
+	analyzer.SetFileIgnore(func(name, path string) bool {
+		if name == "file2" {
+			assert.NoError(t, os.Remove(path))
+		}
+		return false
+	})
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	)
+	analyzer.GetDone().Wait()
+
+	progress := analyzer.GetProgress()
+	assert.Equal(t, 1, progress.VanishedCount)
+	assert.Equal(t, 1, progress.FileCount)
+
+	nested := dir.GetFiles()[0]
+	assert.Equal(t, "nested", nested.GetName())
+	assert.Equal(t, ' ', nested.GetFlag())
+}
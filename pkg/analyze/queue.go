@@ -0,0 +1,67 @@
+package analyze
+
+import "sync"
+
+// dirJob is a directory waiting to be read and added to its parent
+type dirJob struct {
+	path      string
+	parent    *Dir
+	ancestors *dirChain
+}
+
+// dirQueue is an unbounded queue of directories consumed by a pool of workers.
+// It is unbounded so that workers never block when pushing subdirectories.
+// Jobs are taken in LIFO order to walk the tree depth first,
+// which keeps the queue short for wide trees.
+type dirQueue struct {
+	m      sync.Mutex
+	cond   *sync.Cond
+	jobs   []dirJob
+	closed bool
+}
+
+func newDirQueue() *dirQueue {
+	q := &dirQueue{}
+	q.cond = sync.NewCond(&q.m)
+	return q
+}
+
+// push adds job to the queue, jobs pushed after close are dropped
+func (q *dirQueue) push(job dirJob) {
+	q.m.Lock()
+	if !q.closed {
+		q.jobs = append(q.jobs, job)
+	}
+	q.m.Unlock()
+	q.cond.Signal()
+}
+
+// pop blocks until there is a job in the queue or the queue is closed
+func (q *dirQueue) pop() (dirJob, bool) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for len(q.jobs) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return dirJob{}, false
+	}
+
+	last := len(q.jobs) - 1
+	job := q.jobs[last]
+	q.jobs[last] = dirJob{}
+	q.jobs = q.jobs[:last]
+	return job, true
+}
+
+// close wakes up all waiting workers and drops remaining jobs, they are returned
+func (q *dirQueue) close() []dirJob {
+	q.m.Lock()
+	q.closed = true
+	dropped := q.jobs
+	q.jobs = nil
+	q.m.Unlock()
+	q.cond.Broadcast()
+	return dropped
+}
@@ -0,0 +1,88 @@
+package analyze
+
+import (
+	"io"
+	"os"
+	"sort"
+)
+
+// readDirBatchSize is number of entries read from a directory at once
+const readDirBatchSize = 4096
+
+// dirReader reads entries of a directory in batches, so that huge directories
+// are never held in memory whole. Directory read in a single batch is closed right away
+// and its entries are sorted by name as by os.ReadDir, entries of larger directories
+// are returned in directory order.
+type dirReader struct {
+	f *os.File
+	// pending is batch read ahead to find out whether the previous one was the last
+	pending []os.DirEntry
+	// count is number of entries read so far
+	count int
+	// err is error which stopped the reading, nil once all entries are read
+	err error
+}
+
+func openDir(path string) *dirReader {
+	f, err := os.Open(path)
+	return &dirReader{f: f, err: err}
+}
+
+// next returns the next batch of entries, empty batch is returned once all entries are read
+// or the reading failed
+func (r *dirReader) next() []os.DirEntry {
+	entries := r.pending
+	r.pending = nil
+	if len(entries) == 0 {
+		entries = r.read()
+	}
+	// short batch is usually the last one, reading ahead closes small directories
+	// before their subdirs are walked
+	if len(entries) > 0 && len(entries) < readDirBatchSize {
+		r.pending = r.read()
+	}
+	if r.f == nil && len(r.pending) == 0 && r.count == len(entries) {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	}
+	return entries
+}
+
+// read reads one batch of entries, the directory is closed once the reading ends
+func (r *dirReader) read() []os.DirEntry {
+	if r.f == nil {
+		return nil
+	}
+	entries, err := r.f.ReadDir(readDirBatchSize)
+	r.count += len(entries)
+	if err != nil {
+		if err != io.EOF {
+			r.err = err
+		}
+		r.close()
+	}
+	return entries
+}
+
+// close closes the directory, it can be called repeatedly
+func (r *dirReader) close() {
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+}
+
+// setReadFlags flags the dir whose entries could not be read or which has no entries,
+// error of the reading takes precedence over errors of single entries
+func (r *dirReader) setReadFlags(dir *Dir) {
+	switch {
+	case r.err != nil:
+		dir.Flag = '!'
+		dir.m.Lock()
+		dir.Flags |= DirReadError
+		dir.ErrorMessage = r.err.Error()
+		dir.m.Unlock()
+	case r.count == 0:
+		dir.Flag = 'e'
+		dir.addFlags(DirEmpty, nil)
+	}
+}
@@ -0,0 +1,142 @@
+package analyze
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/common"
+	"github.com/dundee/gdu/v5/pkg/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirReaderBatches(t *testing.T) {
+	dir := t.TempDir()
+	createFlatDir(t, dir, 2*readDirBatchSize+1)
+
+	reader := openDir(dir)
+	var sizes []int
+	for batch := reader.next(); len(batch) > 0; batch = reader.next() {
+		sizes = append(sizes, len(batch))
+	}
+	assert.Equal(t, []int{readDirBatchSize, readDirBatchSize, 1}, sizes)
+	assert.Equal(t, 2*readDirBatchSize+1, reader.count)
+	assert.NoError(t, reader.err)
+	assert.Nil(t, reader.f)
+}
+
+func TestDirReaderSmallDirSorted(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"c", "a", "b"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+
+	reader := openDir(dir)
+	batch := reader.next()
+	// small dir is closed before its entries are processed
+	assert.Nil(t, reader.f)
+	names := make([]string, 0, len(batch))
+	for _, entry := range batch {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+	assert.Empty(t, reader.next())
+}
+
+func TestDirReaderError(t *testing.T) {
+	reader := openDir("/no/such/dir")
+	assert.Empty(t, reader.next())
+	assert.Error(t, reader.err)
+
+	dir := &Dir{File: &File{Flag: ' '}}
+	dir.addFlags(DirPartial, fmt.Errorf("entry failed"))
+	reader.setReadFlags(dir)
+	flags, msg := dir.FlagReasons()
+	assert.Equal(t, '!', dir.Flag)
+	assert.Equal(t, DirReadError|DirPartial, flags)
+	assert.Contains(t, msg, "no such file or directory")
+}
+
+func TestAnalyzeHugeDir(t *testing.T) {
+	dir := t.TempDir()
+	files := 2*readDirBatchSize + 1
+	createFlatDir(t, dir, files)
+
+	for name, analyzer := range map[string]interface {
+		AnalyzeDir(path string, ignore common.ShouldDirBeIgnored, constGC bool) fs.Item
+		GetDone() common.SignalGroup
+		GetProgress() common.CurrentProgress
+	}{
+		"parallel":   CreateAnalyzer(),
+		"sequential": CreateSeqAnalyzer(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			root := analyzer.AnalyzeDir(dir, func(_, _ string) bool { return false }, false)
+			analyzer.GetDone().Wait()
+			root.UpdateStats(make(fs.HardLinkedItems))
+
+			assert.Equal(t, files+1, root.GetItemCount())
+			assert.Equal(t, int64(files), analyzer.GetProgress().TotalSize)
+			assert.Equal(t, files, analyzer.GetProgress().FileCount)
+			assert.Equal(t, 1, analyzer.GetProgress().DirCount)
+		})
+	}
+}
+
+// BenchmarkAnalyzeHugeDir reads one directory with -bench-files entries and reports
+// peak heap per entry and the longest time without progress update
+func BenchmarkAnalyzeHugeDir(b *testing.B) {
+	dir := b.TempDir()
+	createFlatDir(b, dir, *benchFiles)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		analyzer := CreateAnalyzer()
+		progress := analyzer.GetProgressChan()
+		type result struct {
+			gap  time.Duration
+			peak uint64
+		}
+		res := make(chan result)
+		go func() {
+			var r result
+			sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+			ticker := time.NewTicker(5 * time.Millisecond)
+			defer ticker.Stop()
+			last := time.Now()
+			for {
+				select {
+				case <-progress:
+					r.gap = max(r.gap, time.Since(last))
+					last = time.Now()
+				case <-ticker.C:
+					metrics.Read(sample)
+					r.peak = max(r.peak, sample[0].Value.Uint64())
+				case <-analyzer.GetDone():
+					r.gap = max(r.gap, time.Since(last))
+					res <- r
+					return
+				}
+			}
+		}()
+
+		analyzer.AnalyzeDir(dir, func(_, _ string) bool { return false }, true)
+		r := <-res
+
+		b.ReportMetric(float64(r.peak)/float64(*benchFiles), "peak-heap-B/entry")
+		b.ReportMetric(float64(r.gap.Milliseconds()), "max-progress-gap-ms")
+	}
+}
+
+func createFlatDir(tb testing.TB, dir string, files int) {
+	for i := 0; i < files; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d", i)), []byte("x"), 0o600); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
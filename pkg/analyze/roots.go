@@ -0,0 +1,37 @@
+package analyze
+
+import (
+	"path/filepath"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+)
+
+// newRootsDir returns virtual dir grouping roots of analysis of multiple paths
+func newRootsDir() *Dir {
+	return &Dir{
+		File: &File{
+			Flag: ' ',
+		},
+		Virtual: true,
+		Files:   make(fs.Files, 0),
+	}
+}
+
+// addRoot adds root of one analyzed path to the virtual dir
+func (f *Dir) addRoot(root *Dir) {
+	root.Parent = f
+	f.AddFile(root)
+}
+
+// absPaths returns the paths made absolute, so that roots keep their full paths
+// under the virtual dir. Paths which cannot be made absolute are kept.
+func absPaths(paths []string) []string {
+	abs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if p, err := filepath.Abs(path); err == nil {
+			path = p
+		}
+		abs = append(abs, path)
+	}
+	return abs
+}
@@ -0,0 +1,63 @@
+package analyze
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dundee/gdu/v5/internal/common"
+	"github.com/dundee/gdu/v5/pkg/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeDirs(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(first, "file"), []byte("hello"), 0o600))
+	assert.NoError(t, os.Mkdir(filepath.Join(second, "nested"), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(second, "nested", "file"), []byte("go"), 0o600))
+
+	analyzers := map[string]interface {
+		AnalyzeDirs([]string, common.ShouldDirBeIgnored, bool) fs.Item
+		GetDone() common.SignalGroup
+	}{
+		"parallel":   CreateAnalyzer(),
+		"sequential": CreateSeqAnalyzer(),
+	}
+	for name, analyzer := range analyzers {
+		t.Run(name, func(t *testing.T) {
+			dir := analyzer.AnalyzeDirs(
+				[]string{first, second}, func(_, _ string) bool { return false }, false,
+			).(*Dir)
+			analyzer.GetDone().Wait()
+			dir.UpdateStats(make(fs.HardLinkedItems))
+
+			assert.True(t, dir.Virtual)
+			assert.Equal(t, "", dir.GetPath())
+			assert.Len(t, dir.Files, 2)
+
+			roots := map[string]*Dir{}
+			for _, item := range dir.Files {
+				root := item.(*Dir)
+				assert.Equal(t, dir, root.Parent)
+				roots[root.GetPath()] = root
+			}
+			assert.Equal(t, int64(5+4096), roots[first].Size)
+			assert.Equal(t, int64(2+2*4096), roots[second].Size)
+			assert.Equal(t, filepath.Join(second, "nested", "file"), roots[second].Files[0].(*Dir).Files[0].GetPath())
+
+			// the virtual dir adds nothing to stats of the roots
+			assert.Equal(t, roots[first].Size+roots[second].Size, dir.Size)
+			assert.Equal(t, roots[first].ItemCount+roots[second].ItemCount, dir.ItemCount)
+
+			dir.UpdateStatsParallel(make(fs.HardLinkedItems), 2)
+			assert.Equal(t, roots[first].Size+roots[second].Size, dir.Size)
+			assert.Equal(t, 5, dir.ItemCount)
+		})
+	}
+}
+
+func TestAbsPaths(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/tmp", filepath.Join(wd, "test_dir")}, absPaths([]string{"/tmp/", "test_dir"}))
+}
@@ -3,7 +3,7 @@ package analyze
 import (
 	"os"
 	"path/filepath"
-	"runtime/debug"
+	"strings"
 	"sync"
 
 	"github.com/dundee/gdu/v5/internal/common"
@@ -13,32 +13,35 @@ import (
 
 // SequentialAnalyzer implements Analyzer
 type SequentialAnalyzer struct {
-	progress            *common.CurrentProgress
-	progressChan        chan common.CurrentProgress
-	progressOutChan     chan common.CurrentProgress
-	progressDoneChan    chan struct{}
-	doneChan            common.SignalGroup
-	wait                *WaitGroup
-	ignoreDir           common.ShouldDirBeIgnored
-	followSymlinks      bool
-	gitAnnexedSize      bool
-	cancelled           bool
-	cancelMutex         sync.Mutex
-	progressDoneOnce    sync.Once
+	progress       *progressTracker
+	doneChan       common.SignalGroup
+	wait           *WaitGroup
+	ignoreDir      common.ShouldDirBeIgnored
+	ignoreFile     common.ShouldFileBeIgnored
+	followSymlinks bool
+	gitAnnexedSize bool
+	ignoreHidden   bool
+	memoryLimit    int64
+	blockSize      int64
+	linkTargets    bool
+	sortBy         string
+	cancelled      bool
+	cancelMutex    sync.Mutex
+	throttle       *throttle
+	root           *Dir
+	rootMutex      sync.Mutex
+	topFilesCount  int
+	topFiles       *topFilesTracker
+	names          *nameTable
 }
 
 // CreateSeqAnalyzer returns Analyzer
 func CreateSeqAnalyzer() *SequentialAnalyzer {
 	return &SequentialAnalyzer{
-		progress: &common.CurrentProgress{
-			ItemCount: 0,
-			TotalSize: int64(0),
-		},
-		progressChan:     make(chan common.CurrentProgress, 1),
-		progressOutChan:  make(chan common.CurrentProgress, 1),
-		progressDoneChan: make(chan struct{}),
-		doneChan:         make(common.SignalGroup),
-		wait:             (&WaitGroup{}).Init(),
+		progress: newProgressTracker(),
+		doneChan: make(common.SignalGroup),
+		wait:     (&WaitGroup{}).Init(),
+		throttle: newThrottle(),
 	}
 }
 
@@ -47,14 +50,92 @@ func (a *SequentialAnalyzer) SetFollowSymlinks(v bool) {
 	a.followSymlinks = v
 }
 
+// SetIgnoreHidden sets whether files and directories beginning with dot should be skipped
+func (a *SequentialAnalyzer) SetIgnoreHidden(v bool) {
+	a.ignoreHidden = v
+}
+
+// SetFileIgnore sets function deciding which files should be left out,
+// nil means no file is ignored
+func (a *SequentialAnalyzer) SetFileIgnore(ignore common.ShouldFileBeIgnored) {
+	a.ignoreFile = ignore
+}
+
 // SetShowAnnexedSize sets whether to use annexed size of git-annex files
 func (a *SequentialAnalyzer) SetShowAnnexedSize(v bool) {
 	a.gitAnnexedSize = v
 }
 
+// SetDirsPerSecondLimit limits number of directory reads per second,
+// every further batch of entries of huge directories counts as another read.
+// Non-positive value disables the limit.
+func (a *SequentialAnalyzer) SetDirsPerSecondLimit(n int) {
+	a.throttle.setLimit(n)
+}
+
+// SetPaused pauses reading of directories until it is called with false,
+// directories being read are finished. Cancel ends the pause.
+func (a *SequentialAnalyzer) SetPaused(paused bool) {
+	a.throttle.setPaused(paused)
+}
+
+// SetMemoryLimit sets heap size up to which GC is disabled during analysis,
+// zero means GC is tuned according to free memory
+func (a *SequentialAnalyzer) SetMemoryLimit(limit int64) {
+	a.memoryLimit = limit
+}
+
+// SetBlockSize sets size of blocks usage of files is computed in, usage is apparent size
+// rounded up to whole blocks. Non-positive size keeps usage allocated by the filesystem.
+func (a *SequentialAnalyzer) SetBlockSize(n int64) {
+	a.blockSize = n
+}
+
+// SetReadLinkTargets enables reading of targets of symlinks, they are stored
+// only when enabled to keep memory of the tree low
+func (a *SequentialAnalyzer) SetReadLinkTargets(v bool) {
+	a.linkTargets = v
+}
+
+// SetSortResults sets order of children of every dir sorted once the analysis is done,
+// SortResultsByName or SortResultsBySize. Empty order keeps items in order they were read.
+func (a *SequentialAnalyzer) SetSortResults(by string) {
+	a.sortBy = by
+}
+
 // GetProgressChan returns channel for getting progress
 func (a *SequentialAnalyzer) GetProgressChan() chan common.CurrentProgress {
-	return a.progressOutChan
+	return a.progress.outChan
+}
+
+// GetProgress returns current progress of the analysis
+func (a *SequentialAnalyzer) GetProgress() common.CurrentProgress {
+	return a.progress.get()
+}
+
+// SetTrackTopFiles sets number of the largest files tracked during analysis,
+// non-positive value disables the tracking
+func (a *SequentialAnalyzer) SetTrackTopFiles(n int) {
+	a.topFilesCount = n
+}
+
+// GetTopFiles returns the largest files found by the last analysis
+// sorted by apparent size descending, nil if the tracking was disabled
+func (a *SequentialAnalyzer) GetTopFiles() fs.Files {
+	return a.topFiles.get()
+}
+
+// GetPartialRoot returns root dir of the running analysis, nil if no dir was read yet.
+// Subdirs are added to the tree when they are read completely,
+// sizes and item counts of dirs are not updated until the analysis is done.
+func (a *SequentialAnalyzer) GetPartialRoot() fs.Item {
+	a.rootMutex.Lock()
+	defer a.rootMutex.Unlock()
+
+	if a.root == nil {
+		return nil
+	}
+	return a.root
 }
 
 // GetDone returns channel for checking when analysis is done
@@ -64,13 +145,17 @@ func (a *SequentialAnalyzer) GetDone() common.SignalGroup {
 
 // ResetProgress returns progress
 func (a *SequentialAnalyzer) ResetProgress() {
-	a.progress = &common.CurrentProgress{}
-	a.progressChan = make(chan common.CurrentProgress, 1)
-	a.progressOutChan = make(chan common.CurrentProgress, 1)
-	a.progressDoneChan = make(chan struct{})
+	a.progress = newProgressTracker()
 	a.doneChan = make(common.SignalGroup)
+	a.cancelMutex.Lock()
 	a.wait = (&WaitGroup{}).Init()
 	a.cancelled = false
+	a.cancelMutex.Unlock()
+	a.throttle.reset()
+
+	a.rootMutex.Lock()
+	a.root = nil
+	a.rootMutex.Unlock()
 }
 
 // Cancel cancels the analysis gracefully
@@ -83,82 +168,103 @@ func (a *SequentialAnalyzer) Cancel() {
 	}
 
 	a.cancelled = true
-	// Send cancellation signal to wait group and progress channels
+	// Send cancellation signal to wait group
 	a.wait.Cancel()
-	a.progressDoneOnce.Do(func() {
-		close(a.progressDoneChan)
-	})
+	a.throttle.stop()
 }
 
 // AnalyzeDir analyzes given path
 func (a *SequentialAnalyzer) AnalyzeDir(
 	path string, ignore common.ShouldDirBeIgnored, constGC bool,
 ) fs.Item {
-	if !constGC {
-		defer debug.SetGCPercent(debug.SetGCPercent(-1))
-		go manageMemoryUsage(a.doneChan)
-	}
+	return a.analyze(ignore, constGC, func() *Dir {
+		return a.processDir(path, nil)
+	})
+}
 
-	a.ignoreDir = ignore
+// AnalyzeDirs analyzes given paths one after another, roots of the paths
+// are children of returned virtual dir. Relative paths are made absolute.
+func (a *SequentialAnalyzer) AnalyzeDirs(
+	paths []string, ignore common.ShouldDirBeIgnored, constGC bool,
+) fs.Item {
+	root := newRootsDir()
+	a.rootMutex.Lock()
+	a.root = root
+	a.rootMutex.Unlock()
+
+	return a.analyze(ignore, constGC, func() *Dir {
+		for _, path := range absPaths(paths) {
+			root.addRoot(a.processDir(path, nil))
+		}
+		return root
+	})
+}
 
-	go a.updateProgress()
-	dir := a.processDir(path)
+// analyze reads the roots by processRoots and sorts the result
+func (a *SequentialAnalyzer) analyze(
+	ignore common.ShouldDirBeIgnored, constGC bool, processRoots func() *Dir,
+) fs.Item {
+	defer setupGC(constGC, a.memoryLimit, a.doneChan)()
 
-	// Safely send to progressDoneChan only if not cancelled
-	a.cancelMutex.Lock()
-	cancelled := a.cancelled
-	a.cancelMutex.Unlock()
+	a.ignoreDir = ignore
+	a.topFiles = nil
+	if a.topFilesCount > 0 {
+		a.topFiles = newTopFilesTracker(a.topFilesCount)
+	}
+	a.names = newNameTable()
 
-	if !cancelled {
-		a.progressDoneChan <- struct{}{}
+	dir := processRoots()
+	a.names.release()
+	// cancelled analysis returns right away, partial tree is left unsorted
+	if a.sortBy != "" && !a.isCancelled() {
+		sortResults(dir, a.sortBy)
 	}
+
 	a.doneChan.Broadcast()
 
 	return dir
 }
 
-func (a *SequentialAnalyzer) processDir(path string) *Dir {
+func (a *SequentialAnalyzer) processDir(path string, ancestors *dirChain) *Dir {
 	var (
 		file      *File
 		err       error
 		totalSize int64
+		fileCount int
 		info      os.FileInfo
-		dirCount  int
 	)
 
-	// Check if cancelled before starting
-	a.cancelMutex.Lock()
-	if a.cancelled {
-		a.cancelMutex.Unlock()
-		// Return empty directory if cancelled
-		dir := &Dir{
+	// Cancel releases the wait for throttle
+	a.throttle.wait()
+
+	// Return empty directory if cancelled before starting, it is not counted in the wait group
+	if a.isCancelled() {
+		a.progress.addDir(path, 0, 0)
+		return &Dir{
 			File: &File{
 				Name: filepath.Base(path),
 				Flag: '!',
 			},
+			Flags:     DirCancelled,
 			ItemCount: 1,
 			Files:     make(fs.Files, 0),
 		}
-		a.wait.Add(1)
-		a.wait.Done()
-		return dir
 	}
-	a.cancelMutex.Unlock()
 
+	// every return of read dir balances the wait group, also of dir cut short by cancellation
 	a.wait.Add(1)
+	defer a.wait.Done()
 
-	files, err := os.ReadDir(path)
-	if err != nil {
-		log.Print(err.Error())
-	}
+	reader := openDir(path)
+	defer reader.close()
 
 	dir := &Dir{
 		File: &File{
-			Name: filepath.Base(path),
-			Flag: getDirFlag(err, len(files)),
+			Name: a.names.intern(filepath.Base(path)),
+			Flag: ' ',
 		},
 		ItemCount: 1,
-		Files:     make(fs.Files, 0, len(files)),
+		Files:     make(fs.Files, 0),
 	}
 	setDirPlatformSpecificAttrs(dir, path)
 
@@ -168,90 +274,124 @@ func (a *SequentialAnalyzer) processDir(path string) *Dir {
 		dir.BasePath = filepath.Dir(path)
 	}
 
-	for _, f := range files {
-		// Check cancellation periodically
-		a.cancelMutex.Lock()
-		if a.cancelled {
-			a.cancelMutex.Unlock()
-			break
-		}
-		a.cancelMutex.Unlock()
+	if a.followSymlinks {
+		ancestors = ancestors.push(path)
+	}
 
-		name := f.Name()
-		entryPath := filepath.Join(path, name)
-		if f.IsDir() {
-			if a.ignoreDir(name, entryPath) {
-				continue
+	// first read dir is the root
+	a.rootMutex.Lock()
+	if a.root == nil {
+		a.root = dir
+	}
+	a.rootMutex.Unlock()
+
+batches:
+	for files := reader.next(); len(files) > 0; files = reader.next() {
+		for _, f := range files {
+			// entries of wide dirs are not read once the analysis is cancelled
+			if a.isCancelled() {
+				dir.addFlags(DirCancelled, nil)
+				break batches
 			}
-			dirCount++
-
-			subdir := a.processDir(entryPath)
-			subdir.Parent = dir
-			dir.AddFile(subdir)
-		} else {
-			info, err = f.Info()
-			if err != nil {
-				log.Print(err.Error())
-				dir.Flag = '!'
+
+			var flag rune
+			name := f.Name()
+			if a.ignoreHidden && strings.HasPrefix(name, ".") {
 				continue
 			}
-			if a.followSymlinks && info.Mode()&os.ModeSymlink != 0 {
-				infoF, err := followSymlink(entryPath, a.gitAnnexedSize)
+			entryPath := filepath.Join(path, name)
+			if f.IsDir() {
+				if a.ignoreDir(name, entryPath) {
+					continue
+				}
+
+				subdir := a.processDir(entryPath, ancestors)
+				subdir.Parent = dir
+				dir.AddFile(subdir)
+			} else {
+				if a.ignoreFile != nil && a.ignoreFile(name, entryPath) {
+					continue
+				}
+
+				info, err = f.Info()
+				if isVanished(err) {
+					a.progress.addVanished()
+					continue
+				}
 				if err != nil {
 					log.Print(err.Error())
-					dir.Flag = '!'
+					dir.setPartial(err)
 					continue
 				}
-				if infoF != nil {
-					info = infoF
+				if a.followSymlinks && info.Mode()&os.ModeSymlink != 0 {
+					infoF, err := followSymlink(entryPath, a.gitAnnexedSize)
+					if err != nil {
+						log.Print(err.Error())
+						dir.setPartial(err)
+						continue
+					}
+					if infoF != nil {
+						info = infoF
+					} else {
+						follow, loop := checkDirSymlink(name, entryPath, ancestors, a.ignoreDir)
+						if follow {
+							subdir := a.processDir(entryPath, ancestors)
+							subdir.Parent = dir
+							dir.AddFile(subdir)
+							continue
+						}
+						if loop {
+							flag = 'L'
+						}
+					}
 				}
-			}
 
-			file = &File{
-				Name:   name,
-				Flag:   getFlag(info),
-				Size:   info.Size(),
-				Parent: dir,
-			}
-			setPlatformSpecificAttrs(file, info)
+				if flag == 0 {
+					flag = getFlag(info)
+				}
+				file = &File{
+					Name:   a.names.intern(name),
+					Flag:   flag,
+					Kind:   getKind(info),
+					Size:   info.Size(),
+					Parent: dir,
+				}
+				setPlatformSpecificAttrs(file, info)
+				if a.blockSize > 0 {
+					file.Usage = roundUpToBlock(file.Size, a.blockSize)
+				}
+				if a.linkTargets && file.Kind == KindSymlink {
+					file.Link = readLink(entryPath)
+				}
 
-			totalSize += info.Size()
+				totalSize += info.Size()
+				fileCount++
 
-			dir.AddFile(file)
+				dir.AddFile(file)
+				a.topFiles.add(file)
+			}
 		}
-	}
 
-	// Check cancellation before sending final progress
-	a.cancelMutex.Lock()
-	if !a.cancelled {
-		a.cancelMutex.Unlock()
-		a.progressChan <- common.CurrentProgress{
-			CurrentItemName: path,
-			ItemCount:       len(files),
-			TotalSize:       totalSize,
+		// progress of huge dirs is reported after every batch,
+		// reading of the next batch is throttled the same as reading of another dir
+		if len(files) == readDirBatchSize {
+			a.progress.addFiles(path, fileCount, totalSize)
+			fileCount, totalSize = 0, 0
+			a.throttle.wait()
 		}
-	} else {
-		a.cancelMutex.Unlock()
 	}
+	if reader.err != nil {
+		log.Print(reader.err.Error())
+	}
+	reader.setReadFlags(dir)
+
+	a.progress.addDir(path, fileCount, totalSize)
 
-	a.wait.Done()
 	return dir
 }
 
-func (a *SequentialAnalyzer) updateProgress() {
-	for {
-		select {
-		case <-a.progressDoneChan:
-			return
-		case progress := <-a.progressChan:
-			a.progress.CurrentItemName = progress.CurrentItemName
-			a.progress.ItemCount += progress.ItemCount
-			a.progress.TotalSize += progress.TotalSize
-		}
-
-		select {
-		case a.progressOutChan <- *a.progress:
-		default:
-		}
-	}
+func (a *SequentialAnalyzer) isCancelled() bool {
+	a.cancelMutex.Lock()
+	defer a.cancelMutex.Unlock()
+	return a.cancelled
 }
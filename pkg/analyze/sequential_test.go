@@ -1,9 +1,12 @@
 package analyze
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -204,3 +207,121 @@ func BenchmarkAnalyzeDirSeq(b *testing.B) {
 	analyzer.GetDone().Wait()
 	dir.UpdateStats(make(fs.HardLinkedItems))
 }
+
+func TestAnalyzeDirRacingCancelSeq(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	for i := 0; i < 200; i++ {
+		analyzer := CreateSeqAnalyzer()
+		done := make(chan struct{})
+
+		go func() {
+			analyzer.AnalyzeDir(
+				"test_dir", func(_, _ string) bool { return false }, true,
+			)
+			close(done)
+		}()
+		time.Sleep(time.Duration(i%10) * 10 * time.Microsecond)
+		analyzer.Cancel()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("AnalyzeDir blocked after cancel in iteration %d", i)
+		}
+	}
+}
+
+func TestCancelWideDirSeq(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 3*readDirBatchSize; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(root, fmt.Sprintf("file%d", i)), nil, 0o600))
+	}
+
+	analyzer := CreateSeqAnalyzer()
+	analyzer.SetSortResults(SortResultsByName)
+	// cancel lands in the middle of the first batch of entries
+	var seen, seenAfterCancel int
+	analyzer.SetFileIgnore(func(_, _ string) bool {
+		seen++
+		if seen == 100 {
+			analyzer.Cancel()
+		} else if seen > 100 {
+			seenAfterCancel++
+		}
+		return false
+	})
+
+	done := make(chan *Dir)
+	go func() {
+		done <- analyzer.AnalyzeDir(root, func(_, _ string) bool { return false }, true).(*Dir)
+	}()
+
+	var dir *Dir
+	select {
+	case dir = <-done:
+	case <-time.After(time.Second):
+		t.Fatal("AnalyzeDir did not return after cancel")
+	}
+	analyzer.GetDone().Wait()
+
+	assert.Equal(t, 0, seenAfterCancel)
+	assert.Equal(t, 100, len(dir.Files))
+	assert.Equal(t, []string{"cancelled"}, dir.Flags.Names())
+	// every read dir is done, waiting for the analysis does not block
+	assert.Equal(t, 0, analyzer.wait.value)
+	assert.True(t, waitReturns(analyzer.wait))
+}
+
+func TestAnalyzeDirIgnoreHiddenSeq(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	err := os.MkdirAll("test_dir/nested/.cache", os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile("test_dir/nested/.cache/blob", []byte("cached"), 0o600)
+	assert.NoError(t, err)
+	err = os.WriteFile("test_dir/.hidden", []byte("secret"), 0o600)
+	assert.NoError(t, err)
+
+	analyzer := CreateSeqAnalyzer()
+	analyzer.SetIgnoreHidden(true)
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	).(*Dir)
+	dir.UpdateStats(make(fs.HardLinkedItems))
+
+	assert.Equal(t, 5, dir.ItemCount)
+	assert.Equal(t, int64(7+4096*3), dir.Size)
+	assert.Equal(t, 5, analyzer.GetProgress().ItemCount)
+}
+
+func TestAnalyzeDirWithFileIgnoreSeq(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := CreateSeqAnalyzer()
+	analyzer.SetFileIgnore(func(_, path string) bool { return path == "test_dir/nested/subnested/file" })
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	).(*Dir)
+	dir.UpdateStats(make(fs.HardLinkedItems))
+
+	assert.Equal(t, 4, dir.ItemCount)
+	assert.Equal(t, int64(2+4096*3), dir.Size)
+	assert.Equal(t, 4, analyzer.GetProgress().ItemCount)
+}
+
+func TestGetPartialRootSeq(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := CreateSeqAnalyzer()
+	assert.Nil(t, analyzer.GetPartialRoot())
+
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	)
+	assert.Same(t, dir, analyzer.GetPartialRoot())
+}
@@ -0,0 +1,142 @@
+package analyze
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+)
+
+// subtreeStats holds result of stats update of one subdirectory
+type subtreeStats struct {
+	dir         *Dir
+	linkedItems fs.HardLinkedItems
+}
+
+// UpdateStatsParallel recursively updates size and item count like UpdateStats,
+// subdirectories of the dir are updated in parallel by up to concurrency goroutines.
+// Non-positive concurrency uses the default.
+// Hard linked files are counted only once, the same as with UpdateStats.
+func (f *Dir) UpdateStatsParallel(linkedItems fs.HardLinkedItems, concurrency int) {
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency()
+	}
+	concurrencyLimit := make(chan struct{}, concurrency)
+
+	f.m.RLock()
+	files := make(fs.Files, len(f.Files))
+	copy(files, f.Files)
+	f.m.RUnlock()
+
+	// every subtree tracks its hard links separately, they are merged in order afterwards
+	subtrees := make([]*subtreeStats, len(files))
+	var wait sync.WaitGroup
+	for i, entry := range files {
+		dir, ok := entry.(*Dir)
+		if !ok {
+			continue
+		}
+		subtree := &subtreeStats{dir: dir, linkedItems: make(fs.HardLinkedItems)}
+		subtrees[i] = subtree
+
+		select {
+		case concurrencyLimit <- struct{}{}:
+			wait.Add(1)
+			go func() {
+				defer wait.Done()
+				subtree.dir.UpdateStats(subtree.linkedItems)
+				<-concurrencyLimit
+			}()
+		default:
+			// no free slot, update the subtree in this goroutine
+			subtree.dir.UpdateStats(subtree.linkedItems)
+		}
+	}
+	wait.Wait()
+
+	itemCount, totalSize := f.ownStats()
+	totalUsage := totalSize
+
+	for i, entry := range files {
+		var (
+			count       int
+			size, usage int64
+		)
+		if subtree := subtrees[i]; subtree != nil {
+			mergeLinkedItems(linkedItems, subtree.linkedItems, subtree.dir)
+			count, size, usage = subtree.dir.ItemCount, subtree.dir.Size, subtree.dir.Usage
+		} else {
+			count, size, usage = entry.GetItemStats(linkedItems)
+		}
+		totalSize += size
+		totalUsage += usage
+		itemCount += count
+
+		if entry.GetMtime().After(f.Mtime) {
+			f.Mtime = entry.GetMtime()
+		}
+
+		switch entry.GetFlag() {
+		case '!', '.':
+			if f.Flag != '!' {
+				f.Flag = '.'
+			}
+		}
+		f.markIncomplete(entry)
+	}
+	f.ItemCount = itemCount
+	f.Size = totalSize
+	f.Usage = totalUsage
+}
+
+// mergeLinkedItems adds hard links found in subtree to linkedItems.
+// Inode already counted before the subtree is subtracted from the subtree stats.
+func mergeLinkedItems(linkedItems, subtreeItems fs.HardLinkedItems, subtree *Dir) {
+	for mli, items := range subtreeItems {
+		if _, ok := linkedItems[mli]; ok {
+			// the first item is the one counted in the subtree
+			counted := items[0]
+			for cur := counted.GetParent(); cur != nil; cur = cur.GetParent() {
+				dir, ok := cur.(*Dir)
+				if !ok {
+					break
+				}
+				dir.Size -= counted.GetSize()
+				dir.Usage -= counted.GetUsage()
+				if dir == subtree {
+					break
+				}
+			}
+		}
+		linkedItems[mli] = append(linkedItems[mli], items...)
+	}
+}
+
+// Orders of children of dirs sorted once the analysis is done
+const (
+	SortResultsByName = "name"
+	SortResultsBySize = "size"
+)
+
+// sortResults sorts children of every dir of the finished tree by name,
+// or by apparent size descending with sizes of dirs updated first.
+// Every dir is sorted once, so the whole pass takes O(n log n).
+func sortResults(root *Dir, by string) {
+	if by == SortResultsBySize {
+		root.UpdateStats(make(fs.HardLinkedItems))
+	}
+	sortTree(root, by)
+}
+
+func sortTree(dir *Dir, by string) {
+	if by == SortResultsBySize {
+		sort.Sort(sort.Reverse(fs.ByApparentSize(dir.Files)))
+	} else {
+		sort.Sort(fs.ByName(dir.Files))
+	}
+	for _, item := range dir.Files {
+		if sub, ok := item.(*Dir); ok {
+			sortTree(sub, by)
+		}
+	}
+}
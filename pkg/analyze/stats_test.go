@@ -0,0 +1,162 @@
+package analyze
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+// createWideTree creates in-memory tree with width subdirectories of files each,
+// every file with mli set is hard linked with the same file in other subdirectories
+func createWideTree(width, files int, mli uint64) *Dir {
+	root := &Dir{File: &File{Name: "root"}, BasePath: "/"}
+	for i := 0; i < width; i++ {
+		sub := &Dir{File: &File{Name: fmt.Sprintf("dir%d", i), Parent: root}}
+		nested := &Dir{File: &File{Name: "nested", Parent: sub}}
+		sub.Files = fs.Files{nested}
+		for j := 0; j < files; j++ {
+			file := &File{
+				Name:   fmt.Sprintf("file%d", j),
+				Size:   int64(j + 1),
+				Usage:  int64(j+1) * 8,
+				Mtime:  time.Unix(int64(i*files+j), 0),
+				Parent: nested,
+			}
+			if j == 0 {
+				file.Ino, file.HardLinked = mli, true
+			}
+			nested.Files = append(nested.Files, file)
+		}
+		root.Files = append(root.Files, sub)
+	}
+	root.Files = append(root.Files, &File{Name: "linked", Size: 1, Usage: 8, Ino: mli, HardLinked: true, Parent: root})
+	return root
+}
+
+func TestUpdateStatsParallel(t *testing.T) {
+	expected := createWideTree(10, 5, 42)
+	expected.UpdateStats(make(fs.HardLinkedItems))
+
+	for _, concurrency := range []int{0, 1, 3, 20} {
+		dir := createWideTree(10, 5, 42)
+		linkedItems := make(fs.HardLinkedItems)
+		dir.UpdateStatsParallel(linkedItems, concurrency)
+
+		assert.Equal(t, expected.ItemCount, dir.ItemCount)
+		assert.Equal(t, expected.Size, dir.Size)
+		assert.Equal(t, expected.Usage, dir.Usage)
+		assert.Equal(t, expected.Mtime, dir.Mtime)
+		assert.Len(t, linkedItems[42], 11)
+
+		for i, sub := range dir.Files {
+			assert.Equal(t, expected.Files[i].GetSize(), sub.GetSize())
+			assert.Equal(t, expected.Files[i].GetUsage(), sub.GetUsage())
+		}
+	}
+}
+
+func TestUpdateStatsParallelWithoutHardLinks(t *testing.T) {
+	dir := createWideTree(3, 2, 0)
+	dir.UpdateStatsParallel(make(fs.HardLinkedItems), 2)
+
+	// 3 * (2 dirs + 2 files) + linked file + root
+	assert.Equal(t, 14, dir.ItemCount)
+	assert.Equal(t, int64(4096+3*(2*4096+3)+1), dir.Size)
+}
+
+// BenchmarkUpdateStatsWideTree compares sequential and parallel stats update
+func BenchmarkUpdateStatsWideTree(b *testing.B) {
+	dir := createWideTree(256, 4000, 0)
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dir.UpdateStats(make(fs.HardLinkedItems))
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dir.UpdateStatsParallel(make(fs.HardLinkedItems), 0)
+		}
+	})
+}
+
+func TestIncompletePropagated(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		root := createWideTree(3, 2, 0)
+		nested := root.Files[1].(*Dir).Files[0].(*Dir)
+		nested.Flags = DirCancelled
+
+		if parallel {
+			root.UpdateStatsParallel(make(fs.HardLinkedItems), 2)
+		} else {
+			root.UpdateStats(make(fs.HardLinkedItems))
+		}
+
+		assert.False(t, nested.IsComplete())
+		assert.False(t, root.Files[1].(*Dir).IsComplete())
+		assert.Equal(t, DirIncomplete, root.Flags)
+		assert.True(t, root.Files[0].(*Dir).IsComplete())
+	}
+}
+
+func TestCancelledAnalysisIncomplete(t *testing.T) {
+	analyzer := CreateAnalyzer()
+	analyzer.Cancel()
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	).(*Dir)
+	assert.False(t, dir.IsComplete())
+	assert.Equal(t, []string{"cancelled"}, dir.Flags.Names())
+
+	queue := newDirQueue()
+	parent := &Dir{File: &File{Name: "parent"}}
+	queue.push(dirJob{path: "parent/sub", parent: parent})
+	assert.Equal(t, []dirJob{{path: "parent/sub", parent: parent}}, queue.close())
+}
+
+func TestSortResults(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 30; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%d", i))
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o755))
+		for j := 0; j < 3; j++ {
+			data := make([]byte, (i+j)%7)
+			assert.NoError(t, os.WriteFile(filepath.Join(dir, "sub", fmt.Sprintf("file%d", j)), data, 0o600))
+		}
+	}
+
+	export := func() string {
+		analyzer := CreateAnalyzer()
+		analyzer.SetSortResults(SortResultsByName)
+		dir := analyzer.AnalyzeDir(root, func(_, _ string) bool { return false }, false)
+		analyzer.GetDone().Wait()
+		dir.UpdateStats(make(fs.HardLinkedItems))
+
+		var buff bytes.Buffer
+		assert.NoError(t, dir.EncodeJSON(&buff, true))
+		return buff.String()
+	}
+	// scans of the same tree are exported byte for byte the same
+	first := export()
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, export())
+	}
+
+	analyzer := CreateSeqAnalyzer()
+	analyzer.SetSortResults(SortResultsBySize)
+	dir := analyzer.AnalyzeDir(root, func(_, _ string) bool { return false }, false).(*Dir)
+	analyzer.GetDone().Wait()
+	for i := 1; i < len(dir.Files); i++ {
+		assert.GreaterOrEqual(t, dir.Files[i-1].GetSize(), dir.Files[i].GetSize())
+	}
+	// dirs of the same size are ordered by name descending
+	assert.Equal(t, []string{"dir25", "dir18", "dir11", "dir4"}, []string{
+		dir.Files[0].GetName(), dir.Files[1].GetName(), dir.Files[2].GetName(), dir.Files[3].GetName(),
+	})
+}
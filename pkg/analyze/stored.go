@@ -4,7 +4,6 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"runtime/debug"
 	"sync"
 	"time"
 
@@ -15,40 +14,51 @@ import (
 
 // StoredAnalyzer implements Analyzer
 type StoredAnalyzer struct {
-	storage          *Storage
-	progress         *common.CurrentProgress
-	progressChan     chan common.CurrentProgress
-	progressOutChan  chan common.CurrentProgress
-	progressDoneChan chan struct{}
-	doneChan         common.SignalGroup
-	wait             *WaitGroup
-	ignoreDir        common.ShouldDirBeIgnored
-	storagePath      string
-	followSymlinks   bool
-	gitAnnexedSize   bool
-	cancelled        bool
-	cancelMutex      sync.Mutex
+	storage        *Storage
+	progress       *progressTracker
+	doneChan       common.SignalGroup
+	wait           *WaitGroup
+	limit          *limiter
+	ignoreDir      common.ShouldDirBeIgnored
+	storagePath    string
+	followSymlinks bool
+	gitAnnexedSize bool
+	memoryLimit    int64
+	cancelled      bool
+	cancelMutex    sync.Mutex
+	throttle       *throttle
 }
 
 // CreateStoredAnalyzer returns Analyzer
 func CreateStoredAnalyzer(storagePath string) *StoredAnalyzer {
 	return &StoredAnalyzer{
 		storagePath: storagePath,
-		progress: &common.CurrentProgress{
-			ItemCount: 0,
-			TotalSize: int64(0),
-		},
-		progressChan:     make(chan common.CurrentProgress, 1),
-		progressOutChan:  make(chan common.CurrentProgress, 1),
-		progressDoneChan: make(chan struct{}),
-		doneChan:         make(common.SignalGroup),
-		wait:             (&WaitGroup{}).Init(),
+		progress:    newProgressTracker(),
+		doneChan:    make(common.SignalGroup),
+		wait:        (&WaitGroup{}).Init(),
+		throttle:    newThrottle(),
+		limit:       newLimiter(defaultConcurrency()),
+	}
+}
+
+// SetConcurrency sets maximum number of directories read in parallel,
+// non-positive value sets the default.
+// It can be called while analysis is running.
+func (a *StoredAnalyzer) SetConcurrency(n int) {
+	if n <= 0 {
+		n = defaultConcurrency()
 	}
+	a.limit.setLimit(n)
 }
 
 // GetProgressChan returns channel for getting progress
 func (a *StoredAnalyzer) GetProgressChan() chan common.CurrentProgress {
-	return a.progressOutChan
+	return a.progress.outChan
+}
+
+// GetProgress returns current progress of the analysis
+func (a *StoredAnalyzer) GetProgress() common.CurrentProgress {
+	return a.progress.get()
 }
 
 // GetDone returns channel for checking when analysis is done
@@ -64,15 +74,31 @@ func (a *StoredAnalyzer) SetShowAnnexedSize(v bool) {
 	a.gitAnnexedSize = v
 }
 
+// SetDirsPerSecondLimit limits number of directories read per second,
+// non-positive value disables the limit
+func (a *StoredAnalyzer) SetDirsPerSecondLimit(n int) {
+	a.throttle.setLimit(n)
+}
+
+// SetPaused pauses reading of directories until it is called with false,
+// directories being read are finished. Cancel ends the pause.
+func (a *StoredAnalyzer) SetPaused(paused bool) {
+	a.throttle.setPaused(paused)
+}
+
+// SetMemoryLimit sets heap size up to which GC is disabled during analysis,
+// zero means GC is tuned according to free memory
+func (a *StoredAnalyzer) SetMemoryLimit(limit int64) {
+	a.memoryLimit = limit
+}
+
 // ResetProgress returns progress
 func (a *StoredAnalyzer) ResetProgress() {
-	a.progress = &common.CurrentProgress{}
-	a.progressChan = make(chan common.CurrentProgress, 1)
-	a.progressOutChan = make(chan common.CurrentProgress, 1)
-	a.progressDoneChan = make(chan struct{})
+	a.progress = newProgressTracker()
 	a.doneChan = make(common.SignalGroup)
 	a.wait = (&WaitGroup{}).Init()
 	a.cancelled = false
+	a.throttle.reset()
 }
 
 // Cancel cancels the analysis gracefully
@@ -87,16 +113,14 @@ func (a *StoredAnalyzer) Cancel() {
 	a.cancelled = true
 	// Send cancellation signal to wait group
 	a.wait.Cancel()
+	a.throttle.stop()
 }
 
 // AnalyzeDir analyzes given path
 func (a *StoredAnalyzer) AnalyzeDir(
 	path string, ignore common.ShouldDirBeIgnored, constGC bool,
 ) fs.Item {
-	if !constGC {
-		defer debug.SetGCPercent(debug.SetGCPercent(-1))
-		go manageMemoryUsage(a.doneChan)
-	}
+	defer setupGC(constGC, a.memoryLimit, a.doneChan)()
 
 	a.storage = NewStorage(a.storagePath, path)
 	closeFn := a.storage.Open()
@@ -110,12 +134,10 @@ func (a *StoredAnalyzer) AnalyzeDir(
 
 	a.ignoreDir = ignore
 
-	go a.updateProgress()
 	dir := a.processDir(path)
 
 	a.wait.Wait()
 
-	a.progressDoneChan <- struct{}{}
 	a.doneChan.Broadcast()
 
 	return dir
@@ -126,10 +148,13 @@ func (a *StoredAnalyzer) processDir(path string) *StoredDir {
 		file      *File
 		err       error
 		totalSize int64
+		fileCount int
 		info      os.FileInfo
 		dirCount  int
 	)
 
+	a.throttle.wait()
+
 	// Check if cancelled before starting
 	a.cancelMutex.Lock()
 	if a.cancelled {
@@ -141,12 +166,14 @@ func (a *StoredAnalyzer) processDir(path string) *StoredDir {
 					Name: filepath.Base(path),
 					Flag: '!',
 				},
+				Flags:     DirCancelled,
 				ItemCount: 1,
 				Files:     make(fs.Files, 0),
 			},
 		}
 		a.wait.Add(1)
 		a.wait.Done()
+		a.progress.addDir(path, 0, 0)
 		return dir
 	}
 	a.cancelMutex.Unlock()
@@ -172,12 +199,14 @@ func (a *StoredAnalyzer) processDir(path string) *StoredDir {
 	parent := &ParentDir{Path: path}
 
 	setDirPlatformSpecificAttrs(dir.Dir, path)
+	dir.addFlags(getDirFlags(err, len(files)), err)
 
 	for _, f := range files {
 		// Check cancellation periodically
 		a.cancelMutex.Lock()
 		if a.cancelled {
 			a.cancelMutex.Unlock()
+			dir.addFlags(DirCancelled, nil)
 			break
 		}
 		a.cancelMutex.Unlock()
@@ -202,13 +231,21 @@ func (a *StoredAnalyzer) processDir(path string) *StoredDir {
 			}
 			dir.AddFile(subdir)
 
-			go func(entryPath string) {
-				concurrencyLimit <- struct{}{}
+			if a.limit.tryAcquire() {
+				go func(entryPath string) {
+					a.processDir(entryPath)
+					a.limit.release()
+				}(entryPath)
+			} else {
+				// no free slot, read the subdir in this goroutine
 				a.processDir(entryPath)
-				<-concurrencyLimit
-			}(entryPath)
+			}
 		} else {
 			info, err = f.Info()
+			if isVanished(err) {
+				a.progress.addVanished()
+				continue
+			}
 			if err != nil {
 				log.Print(err.Error())
 				continue
@@ -216,12 +253,14 @@ func (a *StoredAnalyzer) processDir(path string) *StoredDir {
 			file = &File{
 				Name:   name,
 				Flag:   getFlag(info),
+				Kind:   getKind(info),
 				Size:   info.Size(),
 				Parent: parent,
 			}
 			setPlatformSpecificAttrs(file, info)
 
 			totalSize += info.Size()
+			fileCount++
 
 			dir.AddFile(file)
 		}
@@ -232,41 +271,12 @@ func (a *StoredAnalyzer) processDir(path string) *StoredDir {
 		log.Print(err.Error())
 	}
 
-	// Check cancellation before sending final progress
-	a.cancelMutex.Lock()
-	if !a.cancelled {
-		a.cancelMutex.Unlock()
-		a.progressChan <- common.CurrentProgress{
-			CurrentItemName: path,
-			ItemCount:       len(files),
-			TotalSize:       totalSize,
-		}
-	} else {
-		a.cancelMutex.Unlock()
-	}
+	a.progress.addDir(path, fileCount, totalSize)
 
 	a.wait.Done()
 	return dir
 }
 
-func (a *StoredAnalyzer) updateProgress() {
-	for {
-		select {
-		case <-a.progressDoneChan:
-			return
-		case progress := <-a.progressChan:
-			a.progress.CurrentItemName = progress.CurrentItemName
-			a.progress.ItemCount += progress.ItemCount
-			a.progress.TotalSize += progress.TotalSize
-		}
-
-		select {
-		case a.progressOutChan <- *a.progress:
-		default:
-		}
-	}
-}
-
 // StoredDir implements Dir item stored on disk
 type StoredDir struct {
 	*Dir
@@ -405,6 +415,7 @@ func (f *StoredDir) UpdateStats(linkedItems fs.HardLinkedItems) {
 				f.Flag = '.'
 			}
 		}
+		f.markIncomplete(entry)
 	}
 	f.cachedFiles = nil
 	f.ItemCount = itemCount + 1
@@ -432,6 +443,9 @@ func (p *ParentDir) GetSize() int64                                   { panic("m
 func (p *ParentDir) GetType() string                                  { panic("must not be called") }
 func (p *ParentDir) GetUsage() int64                                  { panic("must not be called") }
 func (p *ParentDir) GetMtime() time.Time                              { panic("must not be called") }
+func (p *ParentDir) GetAtime() time.Time                              { panic("must not be called") }
+func (p *ParentDir) GetCtime() time.Time                              { panic("must not be called") }
+func (p *ParentDir) GetOwner() (uid, gid uint32)                      { panic("must not be called") }
 func (p *ParentDir) GetItemCount() int                                { panic("must not be called") }
 func (p *ParentDir) GetParent() fs.Item                               { panic("must not be called") }
 func (p *ParentDir) SetParent(fs.Item)                                { panic("must not be called") }
@@ -5,9 +5,65 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/dundee/gdu/v5/internal/common"
 	"github.com/dundee/gdu/v5/pkg/annex"
 )
 
+// dirChain links directories from the analyzed one up to the root.
+// It is used to detect symlinks pointing back to an ancestor directory.
+type dirChain struct {
+	info   os.FileInfo
+	parent *dirChain
+}
+
+// push returns the chain extended by directory on path,
+// the chain is returned unchanged if the directory cannot be stat'ed
+func (c *dirChain) push(path string) *dirChain {
+	info, err := os.Stat(path)
+	if err != nil {
+		return c
+	}
+	return &dirChain{info: info, parent: c}
+}
+
+// contains returns true if directory with the same device and inode is in the chain
+func (c *dirChain) contains(info os.FileInfo) bool {
+	for ; c != nil; c = c.parent {
+		if os.SameFile(c.info, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDirSymlink decides whether symlink to directory should be descended into.
+// Loop is true if the target is one of the ancestors.
+// Targets which are ignored (e.g. mount points when not crossing filesystems)
+// or cannot be resolved are not followed.
+func checkDirSymlink(
+	name, path string, ancestors *dirChain, ignore common.ShouldDirBeIgnored,
+) (follow, loop bool) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, false
+	}
+	if ignore(name, path) || ignore(filepath.Base(target), target) {
+		return false, false
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return false, false
+	}
+	if ancestors.contains(info) {
+		return false, true
+	}
+	return true, false
+}
+
+// followSymlink returns info of the symlink target.
+// Nil info is returned for directories, see checkDirSymlink.
+// Links forming a cycle fail to resolve and are reported as error.
 func followSymlink(path string, gitAnnexedSize bool) (tInfo os.FileInfo, err error) {
 	target, err := filepath.EvalSymlinks(path)
 	if err != nil {
@@ -1,10 +1,15 @@
 package analyze
 
 import (
+	"net"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/dundee/gdu/v5/internal/common"
 	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/dundee/gdu/v5/pkg/fs"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -40,3 +45,167 @@ func TestFollowSymlinkErr(t *testing.T) {
 	assert.Equal(t, nil, res)
 	assert.NoError(t, err)
 }
+
+func TestFollowSymlinkLoop(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	err := os.Symlink("loop_b", "test_dir/nested/loop_a")
+	assert.Nil(t, err)
+	err = os.Symlink("loop_a", "test_dir/nested/loop_b")
+	assert.Nil(t, err)
+	err = os.Symlink("..", "test_dir/nested/subnested/up")
+	assert.Nil(t, err)
+
+	analyzers := map[string]interface {
+		AnalyzeDir(string, common.ShouldDirBeIgnored, bool) fs.Item
+		SetFollowSymlinks(bool)
+	}{
+		"parallel":   CreateAnalyzer(),
+		"sequential": CreateSeqAnalyzer(),
+	}
+
+	for name, analyzer := range analyzers {
+		t.Run(name, func(t *testing.T) {
+			analyzer.SetFollowSymlinks(true)
+
+			done := make(chan fs.Item)
+			go func() {
+				done <- analyzer.AnalyzeDir(
+					"test_dir", func(_, _ string) bool { return false }, false,
+				)
+			}()
+
+			select {
+			case dir := <-done:
+				nested := dir.(*Dir).Files[0].(*Dir)
+				assert.Equal(t, "nested", nested.GetName())
+				assert.Equal(t, '!', nested.GetFlag())
+			case <-time.After(5 * time.Second):
+				t.Fatal("analysis of symlink loop did not terminate")
+			}
+		})
+	}
+}
+
+func TestFollowDirSymlinks(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	// benign link to sibling dir
+	err := os.Symlink("nested/subnested", "test_dir/linked")
+	assert.Nil(t, err)
+	// cycle back to ancestor
+	err = os.Symlink("..", "test_dir/nested/subnested/up")
+	assert.Nil(t, err)
+
+	analyzers := map[string]interface {
+		AnalyzeDir(string, common.ShouldDirBeIgnored, bool) fs.Item
+		SetFollowSymlinks(bool)
+	}{
+		"parallel":   CreateAnalyzer(),
+		"sequential": CreateSeqAnalyzer(),
+	}
+
+	for name, analyzer := range analyzers {
+		t.Run(name, func(t *testing.T) {
+			analyzer.SetFollowSymlinks(true)
+
+			dir := analyzer.AnalyzeDir(
+				"test_dir", func(_, _ string) bool { return false }, false,
+			).(*Dir)
+			dir.UpdateStats(make(fs.HardLinkedItems))
+
+			linked := findChild(dir, "linked")
+			assert.True(t, linked.IsDir())
+			assert.Equal(t, int64(5), findChild(linked, "file").GetSize())
+
+			// linked/up points to nested which is not an ancestor of linked
+			up := findChild(linked, "up")
+			assert.True(t, up.IsDir())
+			assert.Equal(t, 'L', findChild(findChild(up, "subnested"), "up").GetFlag())
+
+			nested := findChild(dir, "nested")
+			assert.Equal(t, 'L', findChild(findChild(nested, "subnested"), "up").GetFlag())
+		})
+	}
+}
+
+func TestNotFollowIgnoredDirSymlink(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	err := os.Symlink("nested/subnested", "test_dir/linked")
+	assert.Nil(t, err)
+
+	analyzer := CreateAnalyzer()
+	analyzer.SetFollowSymlinks(true)
+	dir := analyzer.AnalyzeDir(
+		"test_dir", func(name, _ string) bool { return name == "subnested" }, false,
+	).(*Dir)
+
+	linked := findChild(dir, "linked")
+	assert.False(t, linked.IsDir())
+	assert.Equal(t, '@', linked.GetFlag())
+}
+
+func findChild(item fs.Item, name string) fs.Item {
+	for _, child := range item.GetFiles() {
+		if child.GetName() == name {
+			return child
+		}
+	}
+	return nil
+}
+
+func TestSymlinkAndSocketKind(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "file"), []byte("data"), 0o600))
+	assert.NoError(t, os.Symlink("file", filepath.Join(root, "link")))
+	listener, err := net.Listen("unix", filepath.Join(root, "sock"))
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	analyzer := CreateAnalyzer()
+	dir := analyzer.AnalyzeDir(root, func(_, _ string) bool { return false }, false)
+	analyzer.GetDone().Wait()
+
+	types := map[string]string{}
+	for _, item := range dir.GetFiles() {
+		types[item.GetName()] = item.GetType()
+	}
+	assert.Equal(t, map[string]string{"file": "File", "link": "Symlink", "sock": "Socket"}, types)
+}
+
+func TestLinkTargets(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "file"), []byte("data"), 0o600))
+	assert.NoError(t, os.Symlink("file", filepath.Join(root, "link")))
+	assert.NoError(t, os.Symlink("missing", filepath.Join(root, "broken")))
+
+	analyzers := map[string]interface {
+		common.Analyzer
+		SetReadLinkTargets(bool)
+	}{
+		"parallel":   CreateAnalyzer(),
+		"sequential": CreateSeqAnalyzer(),
+	}
+
+	for name, analyzer := range analyzers {
+		t.Run(name, func(t *testing.T) {
+			analyzer.SetReadLinkTargets(true)
+			dir := analyzer.AnalyzeDir(root, func(_, _ string) bool { return false }, false)
+			analyzer.GetDone().Wait()
+
+			assert.Equal(t, &Link{Target: "file"}, findChild(dir, "link").(*File).Link)
+			assert.Equal(t, &Link{Target: "missing", Broken: true}, findChild(dir, "broken").(*File).Link)
+			assert.Nil(t, findChild(dir, "file").(*File).Link)
+		})
+	}
+
+	// targets are not stored by default
+	analyzer := CreateAnalyzer()
+	dir := analyzer.AnalyzeDir(root, func(_, _ string) bool { return false }, false)
+	analyzer.GetDone().Wait()
+	assert.Nil(t, findChild(dir, "link").(*File).Link)
+}
@@ -0,0 +1,123 @@
+package analyze
+
+import (
+	"sync"
+	"time"
+)
+
+// throttle limits number of directory reads per second of one analyzer.
+// Reads are spread evenly, time a reader does not use is not saved up for later ones.
+// Paused throttle holds all reads until it is resumed.
+type throttle struct {
+	mu sync.Mutex
+	// limit is number of reads per second, zero means unlimited
+	limit int
+	// next is time at which the next read may start
+	next time.Time
+	// stopped is closed by cancellation to release waiting readers
+	stopped chan struct{}
+	// resumed is closed when paused throttle is resumed, nil while not paused
+	resumed chan struct{}
+}
+
+func newThrottle() *throttle {
+	return &throttle{stopped: make(chan struct{})}
+}
+
+// setLimit sets number of reads per second, non-positive value disables throttling
+func (t *throttle) setLimit(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limit = max(n, 0)
+	t.next = time.Time{}
+}
+
+// getLimit returns number of reads per second, zero if throttling is disabled
+func (t *throttle) getLimit() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// wait blocks until the next read may start. It returns right away once the throttle is stopped,
+// callers check cancellation of the analysis afterwards.
+func (t *throttle) wait() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	for t.resumed != nil {
+		resumed, stopped := t.resumed, t.stopped
+		t.mu.Unlock()
+		select {
+		case <-resumed:
+		case <-stopped:
+			return
+		}
+		t.mu.Lock()
+	}
+	if t.limit == 0 {
+		t.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	start := t.next
+	if start.Before(now) {
+		start = now
+	}
+	t.next = start.Add(time.Second / time.Duration(t.limit))
+	stopped := t.stopped
+	t.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-stopped:
+	}
+}
+
+// setPaused pauses or resumes reads, reads already running are not interrupted
+func (t *throttle) setPaused(paused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if paused && t.resumed == nil {
+		t.resumed = make(chan struct{})
+	}
+	if !paused && t.resumed != nil {
+		close(t.resumed)
+		t.resumed = nil
+	}
+}
+
+// stop releases waiting readers and lets all following reads start right away
+func (t *throttle) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.stopped:
+	default:
+		close(t.stopped)
+	}
+}
+
+// reset makes stopped throttle limit reads again, paused throttle is resumed
+func (t *throttle) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.stopped:
+		t.stopped = make(chan struct{})
+	default:
+	}
+	if t.resumed != nil {
+		close(t.resumed)
+		t.resumed = nil
+	}
+	t.next = time.Time{}
+}
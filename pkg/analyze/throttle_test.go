@@ -0,0 +1,126 @@
+package analyze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/common"
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	th := newThrottle()
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		th.wait()
+	}
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	th.setLimit(50)
+	assert.Equal(t, 50, th.getLimit())
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		th.wait()
+	}
+	// the first read starts right away, the others every 20 ms
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+
+	th.setLimit(-1)
+	assert.Equal(t, 0, th.getLimit())
+}
+
+func TestThrottleStop(t *testing.T) {
+	th := newThrottle()
+	th.setLimit(1)
+	th.wait()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		th.stop()
+	}()
+	start := time.Now()
+	th.wait()
+	th.wait()
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// reset throttle limits reads again
+	th.reset()
+	th.wait()
+	start = time.Now()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		th.stop()
+	}()
+	th.wait()
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+}
+
+func TestAnalyzeDirThrottled(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := CreateAnalyzer()
+	analyzer.SetDirsPerSecondLimit(20)
+	start := time.Now()
+	dir := analyzer.AnalyzeDir("test_dir", func(_, _ string) bool { return false }, false).(*Dir)
+	analyzer.GetDone().Wait()
+
+	// three dirs are read 50 ms apart
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, "nested", dir.Files[0].GetName())
+}
+
+func TestCancelThrottledAnalysis(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	for name, analyzer := range map[string]interface {
+		common.Analyzer
+		SetDirsPerSecondLimit(int)
+	}{
+		"parallel":   CreateAnalyzer(),
+		"sequential": CreateSeqAnalyzer(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			analyzer.SetDirsPerSecondLimit(1)
+			time.AfterFunc(50*time.Millisecond, analyzer.Cancel)
+
+			start := time.Now()
+			dir := analyzer.AnalyzeDir("test_dir", func(_, _ string) bool { return false }, false)
+			analyzer.GetDone().Wait()
+
+			// cancelled analysis does not wait for the throttle
+			assert.Less(t, time.Since(start), 500*time.Millisecond)
+			assert.Equal(t, "test_dir", dir.GetName())
+		})
+	}
+}
+
+func TestThrottlePause(t *testing.T) {
+	th := newThrottle()
+	th.setPaused(true)
+
+	waited := make(chan struct{})
+	go func() {
+		th.wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("paused throttle let the read start")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	th.setPaused(false)
+	<-waited
+
+	// stop releases reads of paused throttle, reset resumes it
+	th.setPaused(true)
+	th.stop()
+	th.wait()
+	th.reset()
+	start := time.Now()
+	th.wait()
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
@@ -1,7 +1,10 @@
 package analyze
 
 import (
+	"container/heap"
 	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/dundee/gdu/v5/pkg/fs"
 )
@@ -37,6 +40,27 @@ func CollectTopFiles(dir fs.Item, count int) fs.Files {
 	return topList.Items
 }
 
+// CollectTopDirs returns count of the largest directories of the tree by apparent size
+// sorted descending, the root dir itself is included if includeRoot is set
+func CollectTopDirs(dir fs.Item, count int, includeRoot bool) fs.Files {
+	topList := NewTopList(count)
+	if includeRoot {
+		topList.Add(dir)
+	}
+	walkSubdirs(dir, topList)
+	sort.Sort(sort.Reverse(fs.ByApparentSize(topList.Items)))
+	return topList.Items
+}
+
+func walkSubdirs(dir fs.Item, topList *TopList) {
+	for _, item := range dir.GetFiles() {
+		if item.IsDir() {
+			topList.Add(item)
+			walkSubdirs(item, topList)
+		}
+	}
+}
+
 func walkDir(dir fs.Item, topList *TopList) {
 	for _, item := range dir.GetFiles() {
 		if item.IsDir() {
@@ -46,3 +70,73 @@ func walkDir(dir fs.Item, topList *TopList) {
 		}
 	}
 }
+
+// topFilesHeap is min-heap of files ordered by apparent size
+type topFilesHeap fs.Files
+
+func (h topFilesHeap) Len() int           { return len(h) }
+func (h topFilesHeap) Less(i, j int) bool { return h[i].GetSize() < h[j].GetSize() }
+func (h topFilesHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *topFilesHeap) Push(x any) { *h = append(*h, x.(fs.Item)) }
+
+func (h *topFilesHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return last
+}
+
+// topFilesTracker keeps the largest files seen during analysis.
+// It is safe to call add from multiple goroutines.
+type topFilesTracker struct {
+	m     sync.Mutex
+	count int
+	files topFilesHeap
+	// min is size of the smallest tracked file once the heap is full, -1 before
+	min atomic.Int64
+}
+
+func newTopFilesTracker(count int) *topFilesTracker {
+	t := &topFilesTracker{
+		count: count,
+		files: make(topFilesHeap, 0, count),
+	}
+	t.min.Store(-1)
+	return t
+}
+
+// add adds file to the tracked files if it is larger than the smallest one,
+// nil tracker does nothing
+func (t *topFilesTracker) add(file fs.Item) {
+	if t == nil || file.GetSize() <= t.min.Load() {
+		return
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	heap.Push(&t.files, file)
+	if len(t.files) > t.count {
+		heap.Pop(&t.files)
+	}
+	if len(t.files) == t.count {
+		t.min.Store(t.files[0].GetSize())
+	}
+}
+
+// get returns tracked files sorted by apparent size descending
+func (t *topFilesTracker) get() fs.Files {
+	if t == nil {
+		return nil
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	files := make(fs.Files, len(t.files))
+	copy(files, t.files)
+	sort.Sort(sort.Reverse(fs.ByApparentSize(files)))
+	return files
+}
@@ -39,6 +39,26 @@ func TestCollectTopFiles1(t *testing.T) {
 	assert.Equal(t, int64(5), topFiles[0].GetSize())
 }
 
+func TestCollectTopDirs(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	dir := CreateAnalyzer().AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	)
+	dir.UpdateStats(make(fs.HardLinkedItems))
+
+	topDirs := CollectTopDirs(dir, 2, true)
+	assert.Equal(t, 2, len(topDirs))
+	assert.Equal(t, "test_dir", topDirs[0].GetName())
+	assert.Equal(t, "nested", topDirs[1].GetName())
+
+	topDirs = CollectTopDirs(dir, 5, false)
+	assert.Equal(t, 2, len(topDirs))
+	assert.Equal(t, "nested", topDirs[0].GetName())
+	assert.Equal(t, "subnested", topDirs[1].GetName())
+}
+
 func TestAdd2(t *testing.T) {
 	topList := NewTopList(2)
 	topList.Add(&File{Size: 1, Name: "file1"})
@@ -67,3 +87,51 @@ func TestAdd3(t *testing.T) {
 	assert.Equal(t, "file4", topList.Items[1].GetName())
 	assert.Equal(t, "file3", topList.Items[2].GetName())
 }
+
+func TestTrackTopFiles(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := CreateAnalyzer()
+	assert.Nil(t, analyzer.GetTopFiles())
+
+	analyzer.SetTrackTopFiles(1)
+	analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	)
+
+	topFiles := analyzer.GetTopFiles()
+	assert.Equal(t, 1, len(topFiles))
+	assert.Equal(t, "test_dir/nested/subnested/file", topFiles[0].GetPath())
+	assert.Equal(t, int64(5), topFiles[0].GetSize())
+}
+
+func TestTrackTopFilesSeq(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := CreateSeqAnalyzer()
+	analyzer.SetTrackTopFiles(5)
+	analyzer.AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	)
+
+	topFiles := analyzer.GetTopFiles()
+	assert.Equal(t, 2, len(topFiles))
+	assert.Equal(t, "file", topFiles[0].GetName())
+	assert.Equal(t, "file2", topFiles[1].GetName())
+}
+
+func TestTopFilesTracker(t *testing.T) {
+	tracker := newTopFilesTracker(3)
+	for _, size := range []int64{4, 1, 8, 3, 9, 2, 7} {
+		tracker.add(&File{Size: size})
+	}
+
+	sizes := make([]int64, 0, 3)
+	for _, file := range tracker.get() {
+		sizes = append(sizes, file.GetSize())
+	}
+	assert.Equal(t, []int64{9, 8, 7}, sizes)
+	assert.Equal(t, int64(7), tracker.min.Load())
+}
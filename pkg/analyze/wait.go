@@ -5,15 +5,17 @@ import "sync"
 // A WaitGroup waits for a collection of goroutines to finish.
 // In contrast to sync.WaitGroup Add method can be called from a goroutine.
 type WaitGroup struct {
-	wait   sync.Mutex
-	value  int
 	access sync.Mutex
+	value  int
+	done   chan struct{} // closed when value drops to zero
 	cancel chan struct{}
 }
 
-// Init prepares the WaitGroup for usage, locks
+// Init prepares the WaitGroup for usage
 func (s *WaitGroup) Init() *WaitGroup {
-	s.wait.Lock()
+	s.access.Lock()
+	defer s.access.Unlock()
+	s.done = make(chan struct{})
 	if s.cancel == nil {
 		s.cancel = make(chan struct{})
 	}
@@ -23,55 +25,59 @@ func (s *WaitGroup) Init() *WaitGroup {
 // Add increments value
 func (s *WaitGroup) Add(value int) {
 	s.access.Lock()
+	defer s.access.Unlock()
+	// done channel of the previous round was closed when value dropped to zero
+	if s.value <= 0 && s.value+value > 0 {
+		s.done = make(chan struct{})
+	}
 	s.value += value
-	s.access.Unlock()
 }
 
-// Done decrements the value by one, if value is 0, lock is released
+// Done decrements the value by one, waiters are released once the value is 0
 func (s *WaitGroup) Done() {
 	s.access.Lock()
+	defer s.access.Unlock()
 	s.value--
-	s.check()
-	s.access.Unlock()
+	if s.value == 0 {
+		close(s.done)
+	}
 }
 
-// Wait blocks until value is 0 or context is cancelled
+// Wait blocks until value is 0 or the WaitGroup is cancelled
 func (s *WaitGroup) Wait() {
 	s.access.Lock()
-	isValue := s.value > 0
+	if s.value <= 0 {
+		s.access.Unlock()
+		return
+	}
+	done, cancel := s.done, s.cancel
 	s.access.Unlock()
-	if isValue {
-		// Try to wait for lock or cancellation
-		go func() {
-			<-s.cancel
-			s.wait.Unlock()
-		}()
-		s.wait.Lock()
+
+	select {
+	case <-done:
+	case <-cancel:
 	}
 }
 
-// Cancel cancels waiting and releases all locks
+// Cancel cancels waiting and releases all waiters
 func (s *WaitGroup) Cancel() {
+	s.access.Lock()
+	defer s.access.Unlock()
 	close(s.cancel)
 }
 
-// Reset resets the WaitGroup state
+// Reset resets the WaitGroup state, current waiters are released
 func (s *WaitGroup) Reset() {
 	s.access.Lock()
+	defer s.access.Unlock()
 	s.value = 0
-	// Create new cancel channel
 	if s.cancel != nil {
-		close(s.cancel)
+		select {
+		case <-s.cancel:
+		default:
+			close(s.cancel)
+		}
 	}
 	s.cancel = make(chan struct{})
-	s.wait.TryLock()
-	s.wait.Unlock()
-	s.access.Unlock()
-}
-
-func (s *WaitGroup) check() {
-	if s.value == 0 {
-		s.wait.TryLock()
-		s.wait.Unlock()
-	}
+	s.done = make(chan struct{})
 }
@@ -0,0 +1,79 @@
+package analyze
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitReturns returns true if Wait of the wait group returns within a second
+func waitReturns(wait *WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wait.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func TestWait(t *testing.T) {
+	wait := (&WaitGroup{}).Init()
+	wait.Add(1)
+	go wait.Done()
+
+	assert.True(t, waitReturns(wait))
+}
+
+func TestWaitCancelled(t *testing.T) {
+	wait := (&WaitGroup{}).Init()
+	wait.Add(1)
+	wait.Cancel()
+
+	assert.True(t, waitReturns(wait))
+}
+
+func TestWaitAfterValueDroppedToZero(t *testing.T) {
+	wait := (&WaitGroup{}).Init()
+	wait.Add(1)
+	wait.Done()
+	assert.True(t, waitReturns(wait))
+
+	// the group waits again once it is added to
+	wait.Add(1)
+	assert.False(t, waitReturns(wait))
+	wait.Done()
+	assert.True(t, waitReturns(wait))
+}
+
+func TestWaitCancelledDoesNotLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		wait := (&WaitGroup{}).Init()
+		wait.Add(1)
+		wait.Cancel()
+		wait.Wait()
+	}
+
+	assert.Less(t, runtime.NumGoroutine(), before+10)
+}
+
+func TestWaitReset(t *testing.T) {
+	wait := (&WaitGroup{}).Init()
+	wait.Add(1)
+	wait.Cancel()
+	wait.Reset()
+
+	assert.True(t, waitReturns(wait))
+	wait.Add(1)
+	assert.False(t, waitReturns(wait))
+	wait.Done()
+	assert.True(t, waitReturns(wait))
+}
@@ -0,0 +1,568 @@
+// Package client implements client of the gdu Unix socket server
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dundee/gdu/v5/pkg/server"
+)
+
+// Default settings of reconnecting
+const (
+	DefaultMaxRetries = 5
+	DefaultMinBackoff = 50 * time.Millisecond
+	DefaultMaxBackoff = 2 * time.Second
+)
+
+// DefaultMaxMessageSize is the largest response accepted by default
+const DefaultMaxMessageSize = 1 << 30
+
+// waitForScanInterval is time between progress requests of WaitForScan
+const waitForScanInterval = 100 * time.Millisecond
+
+// ErrClosed is returned by calls of closed client
+var ErrClosed = errors.New("client is closed")
+
+// idempotentMethods are repeated on a new connection when the connection drops
+// after the request was sent, other requests are repeated only if they were not sent
+var idempotentMethods = map[string]bool{
+	"ping":           true,
+	"progress":       true,
+	"status":         true,
+	"metrics":        true,
+	"directory":      true,
+	"list":           true,
+	"ancestors":      true,
+	"tree":           true,
+	"estimate":       true,
+	"mounts":         true,
+	"duplicates":     true,
+	"empty_dirs":     true,
+	"count_by_depth": true,
+	"list_alerts":    true,
+	"top_files":      true,
+	"top_dirs":       true,
+	"export":         true,
+	"export_ncdu":    true,
+}
+
+// Client sends requests to the server over a connection and matches responses to them by id.
+// It is safe for concurrent use, calls of multiple goroutines share the connection.
+//
+// Client created by Dial connects again when the connection drops.
+// State of the connection on the server side, like subscriptions, is not restored.
+type Client struct {
+	// dial opens a new connection, nil if the client cannot reconnect
+	dial    func() (net.Conn, error)
+	opts    Options
+	writeMu sync.Mutex
+	// dialMu makes calls reconnect one at a time
+	dialMu sync.Mutex
+
+	// mu guards the fields below
+	mu   sync.Mutex
+	conn net.Conn
+	// pending holds channels of calls waiting for response with the id
+	pending map[string]chan *response
+	lastID  uint64
+	// err is set once reading from the connection fails,
+	// calls fail with it until the client reconnects
+	err    error
+	closed bool
+}
+
+// Options are settings of reconnecting, zero values use the defaults
+type Options struct {
+	// NoReconnect makes calls fail once the connection drops
+	NoReconnect bool
+	// MaxRetries is number of times a call connects again before it fails
+	MaxRetries int
+	// MinBackoff is delay before the first reconnect, it doubles with every
+	// following attempt up to MaxBackoff. Random jitter of up to half of the
+	// delay is subtracted so clients dropped at once do not reconnect at once.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxMessageSize is the largest response accepted, the connection is dropped
+	// when length of a response is over it. DefaultMaxMessageSize is used if zero.
+	MaxMessageSize int
+}
+
+// Error is a failed request reported by the server
+type Error struct {
+	Message string
+	// Code is one of server.ErrCode* values, empty for errors without a code
+	Code string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return e.Code + ": " + e.Message
+}
+
+// ScanOptions are settings of a scan, zero values use the server defaults
+type ScanOptions struct {
+	Concurrency        int
+	Throttle           int
+	ConstGC            bool
+	GCPercent          int
+	IgnoreHidden       bool
+	IgnoreFilePatterns []string
+	MemoryLimit        int64
+	TrackTopFiles      int
+	// Timeout is rounded up to whole seconds
+	Timeout time.Duration
+	Watch   bool
+}
+
+// response is a frame received from the server, pushed events have Event set and no ID
+type response struct {
+	ID      string          `json:"id"`
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   string          `json:"error"`
+	Code    string          `json:"code"`
+	Event   string          `json:"event"`
+
+	// err is set instead of the fields above when the connection dropped before the response came
+	err error
+}
+
+// connError is failure of the connection, sent is set if the request may have reached the server
+type connError struct {
+	err  error
+	sent bool
+}
+
+func (e *connError) Error() string {
+	return e.err.Error()
+}
+
+func (e *connError) Unwrap() error {
+	return e.err
+}
+
+// New returns client sending requests over the connection, it does not reconnect
+func New(conn net.Conn) *Client {
+	return newClient(conn, Options{})
+}
+
+func newClient(conn net.Conn, opts Options) *Client {
+	if opts.MaxMessageSize == 0 {
+		opts.MaxMessageSize = DefaultMaxMessageSize
+	}
+	c := &Client{
+		opts:    opts,
+		conn:    conn,
+		pending: make(map[string]chan *response),
+	}
+	go c.readLoop(conn, bufio.NewReader(conn))
+	return c
+}
+
+// Dial connects to the server listening on the Unix socket
+func Dial(socketPath string) (*Client, error) {
+	return DialWithOptions(socketPath, Options{})
+}
+
+// DialWithOptions connects to the server listening on the Unix socket with custom settings of reconnecting
+func DialWithOptions(socketPath string, opts Options) (*Client, error) {
+	dial := func() (net.Conn, error) {
+		return net.Dial("unix", socketPath)
+	}
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	}
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+
+	c := newClient(conn, opts)
+	c.dial = dial
+	return c, nil
+}
+
+// Close closes the connection, later calls fail with ErrClosed
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return c.conn.Close()
+}
+
+// Scan starts scanning the path, use Progress to find out when it finishes
+func (c *Client) Scan(path string, opts ScanOptions) error {
+	return c.ScanContext(context.Background(), path, opts)
+}
+
+// ScanContext is Scan with context limiting time of the call
+func (c *Client) ScanContext(ctx context.Context, path string, opts ScanOptions) error {
+	params := opts.params()
+	params["path"] = path
+	return c.CallContext(ctx, "scan", params, nil)
+}
+
+// ScanPaths starts scanning multiple paths, roots of the paths are children
+// of the virtual root of the scanned tree. Paths must not overlap.
+func (c *Client) ScanPaths(paths []string, opts ScanOptions) error {
+	return c.ScanPathsContext(context.Background(), paths, opts)
+}
+
+// ScanPathsContext is ScanPaths with context limiting time of the call
+func (c *Client) ScanPathsContext(ctx context.Context, paths []string, opts ScanOptions) error {
+	params := opts.params()
+	params["paths"] = paths
+	return c.CallContext(ctx, "scan", params, nil)
+}
+
+// Progress returns progress of the running scan
+func (c *Client) Progress() (server.ProgressResponse, error) {
+	return c.ProgressContext(context.Background())
+}
+
+// ProgressContext is Progress with context limiting time of the call
+func (c *Client) ProgressContext(ctx context.Context) (server.ProgressResponse, error) {
+	var progress server.ProgressResponse
+	err := c.CallContext(ctx, "progress", nil, &progress)
+	return progress, err
+}
+
+// Cancel cancels the running scan
+func (c *Client) Cancel() error {
+	return c.CancelContext(context.Background())
+}
+
+// CancelContext is Cancel with context limiting time of the call
+func (c *Client) CancelContext(ctx context.Context) error {
+	return c.CallContext(ctx, "cancel", nil, nil)
+}
+
+// Directory returns the dir of the scanned tree with its children up to the depth,
+// empty path returns the scanned root
+func (c *Client) Directory(path string, depth int) (server.DirInfo, error) {
+	return c.DirectoryContext(context.Background(), path, depth)
+}
+
+// DirectoryContext is Directory with context limiting time of the call
+func (c *Client) DirectoryContext(ctx context.Context, path string, depth int) (server.DirInfo, error) {
+	params := map[string]interface{}{"depth": depth}
+	if path != "" {
+		params["path"] = path
+	}
+
+	var info server.DirInfo
+	err := c.CallContext(ctx, "directory", params, &info)
+	return info, err
+}
+
+// Export writes the scanned tree in the format to the output file on the server
+func (c *Client) Export(format, output string) (server.ExportResponse, error) {
+	return c.ExportContext(context.Background(), format, output)
+}
+
+// ExportContext is Export with context limiting time of the call
+func (c *Client) ExportContext(ctx context.Context, format, output string) (server.ExportResponse, error) {
+	var resp server.ExportResponse
+	err := c.CallContext(ctx, "export", map[string]interface{}{"format": format, "output": output}, &resp)
+	return resp, err
+}
+
+// WaitForScan polls progress until no scan is running and returns the final progress
+func (c *Client) WaitForScan(ctx context.Context) (server.ProgressResponse, error) {
+	ticker := time.NewTicker(waitForScanInterval)
+	defer ticker.Stop()
+
+	for {
+		progress, err := c.ProgressContext(ctx)
+		if err != nil || !progress.IsScanning {
+			return progress, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return progress, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Call sends request of the method and decodes data of its response into result.
+// Result can be nil if the data are not needed.
+// Failure reported by the server is returned as *Error.
+func (c *Client) Call(method string, params map[string]interface{}, result interface{}) error {
+	return c.CallContext(context.Background(), method, params, result)
+}
+
+// CallContext is Call which stops waiting for the response when the context is done.
+// Response arriving later is dropped.
+func (c *Client) CallContext(ctx context.Context, method string, params map[string]interface{}, result interface{}) error {
+	resp, err := c.roundTrip(ctx, method, params)
+	for attempt := 0; c.shouldRetry(method, err, attempt); attempt++ {
+		if err := c.backoff(ctx, attempt); err != nil {
+			return fmt.Errorf("%s request: %w", method, err)
+		}
+		c.reconnect()
+		resp, err = c.roundTrip(ctx, method, params)
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return &Error{Message: resp.Error, Code: resp.Code}
+	}
+	if result == nil || len(resp.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Data, result); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	return nil
+}
+
+// roundTrip sends the request over the current connection and waits for its response
+func (c *Client) roundTrip(ctx context.Context, method string, params map[string]interface{}) (*response, error) {
+	id, ch, conn, err := c.register()
+	if err != nil {
+		return nil, err
+	}
+
+	req := server.Request{ID: id, Method: method, Params: params}
+	// deadline of the context bounds the request on the server too
+	if deadline, ok := ctx.Deadline(); ok {
+		req.TimeoutMs = max(time.Until(deadline).Milliseconds(), 1)
+	}
+	if err := c.send(conn, req); err != nil {
+		c.unregister(id)
+		return nil, &connError{err: fmt.Errorf("failed to send %s request: %w", method, err), sent: true}
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.err != nil {
+			return nil, &connError{err: fmt.Errorf("failed to read %s response: %w", method, resp.err), sent: true}
+		}
+		return resp, nil
+	case <-ctx.Done():
+		c.unregister(id)
+		return nil, fmt.Errorf("%s request: %w", method, ctx.Err())
+	}
+}
+
+// shouldRetry returns true if the call failed because of dropped connection and can be repeated
+func (c *Client) shouldRetry(method string, err error, attempt int) bool {
+	var connErr *connError
+	if !errors.As(err, &connErr) || c.dial == nil || c.opts.NoReconnect || attempt >= c.opts.MaxRetries {
+		return false
+	}
+	return !connErr.sent || idempotentMethods[method]
+}
+
+// backoff waits before reconnect attempt
+func (c *Client) backoff(ctx context.Context, attempt int) error {
+	delay := c.opts.MinBackoff << attempt
+	if delay <= 0 || delay > c.opts.MaxBackoff {
+		delay = c.opts.MaxBackoff
+	}
+	delay -= rand.N(delay/2 + 1)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reconnect replaces dropped connection with a new one.
+// Failure to connect is kept as error of the client and returned by the next call.
+func (c *Client) reconnect() {
+	c.dialMu.Lock()
+	defer c.dialMu.Unlock()
+
+	c.mu.Lock()
+	dropped := c.err != nil && !c.closed
+	c.mu.Unlock()
+	if !dropped {
+		// another call has reconnected meanwhile
+		return
+	}
+
+	conn, err := c.dial()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.err = err
+		return
+	}
+	if c.closed {
+		conn.Close()
+		return
+	}
+	c.conn = conn
+	c.err = nil
+	go c.readLoop(conn, bufio.NewReader(conn))
+}
+
+// register generates id of a new call and returns channel its response is delivered to
+// and connection to send the request over
+func (c *Client) register() (string, chan *response, net.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return "", nil, nil, ErrClosed
+	}
+	if c.err != nil {
+		return "", nil, nil, &connError{err: c.err}
+	}
+	c.lastID++
+	id := strconv.FormatUint(c.lastID, 10)
+	ch := make(chan *response, 1)
+	c.pending[id] = ch
+	return id, ch, c.conn, nil
+}
+
+func (c *Client) unregister(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// send writes the request as length-prefixed frame
+func (c *Client) send(conn net.Conn, req server.Request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 4, 4+len(data)+1)
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	frame = append(frame, data...)
+	frame = append(frame, '\n')
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = conn.Write(frame)
+	return err
+}
+
+// readLoop delivers responses to the calls waiting for them until reading of the connection fails,
+// pushed events and responses nobody waits for are skipped
+func (c *Client) readLoop(conn net.Conn, reader *bufio.Reader) {
+	var err error
+	for {
+		var data []byte
+		if data, err = readFrame(reader, c.opts.MaxMessageSize); err != nil {
+			break
+		}
+
+		var resp response
+		if err = json.Unmarshal(data, &resp); err != nil {
+			break
+		}
+		if resp.Event != "" {
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- &resp
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != conn {
+		return
+	}
+	c.err = err
+	for id, ch := range c.pending {
+		ch <- &response{err: err}
+		delete(c.pending, id)
+	}
+}
+
+// readFrame reads body of length-prefixed frame, frames longer than maxSize are rejected
+func readFrame(reader *bufio.Reader, maxSize int) ([]byte, error) {
+	var lengthBytes [4]byte
+	if _, err := io.ReadFull(reader, lengthBytes[:]); err != nil {
+		return nil, err
+	}
+
+	length := int(binary.BigEndian.Uint32(lengthBytes[:]))
+	if length > maxSize {
+		return nil, fmt.Errorf("frame length %d exceeds max message size %d", length, maxSize)
+	}
+	data := make([]byte, length+1)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	if data[len(data)-1] != '\n' {
+		return nil, fmt.Errorf("frame does not end with newline")
+	}
+	return data[:len(data)-1], nil
+}
+
+// params returns scan params of the options, zero values are left out
+func (o ScanOptions) params() map[string]interface{} {
+	params := map[string]interface{}{}
+	if o.Concurrency != 0 {
+		params["concurrency"] = o.Concurrency
+	}
+	if o.Throttle != 0 {
+		params["throttle"] = o.Throttle
+	}
+	if o.ConstGC {
+		params["const_gc"] = true
+	}
+	if o.GCPercent != 0 {
+		params["gc_percent"] = o.GCPercent
+	}
+	if o.IgnoreHidden {
+		params["ignore_hidden"] = true
+	}
+	if len(o.IgnoreFilePatterns) > 0 {
+		params["ignore_file_patterns"] = o.IgnoreFilePatterns
+	}
+	if o.MemoryLimit != 0 {
+		params["memory_limit"] = o.MemoryLimit
+	}
+	if o.TrackTopFiles != 0 {
+		params["track_top_files"] = o.TrackTopFiles
+	}
+	if o.Timeout != 0 {
+		// server takes whole seconds, shorter timeouts are rounded up so they are not dropped
+		params["timeout_sec"] = int(math.Ceil(o.Timeout.Seconds()))
+	}
+	if o.Watch {
+		params["watch"] = true
+	}
+	return params
+}
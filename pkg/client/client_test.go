@@ -0,0 +1,395 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/dundee/gdu/v5/pkg/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// startServer starts socket server and returns client connected to it
+func startServer(t *testing.T) *Client {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	srv, err := server.NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, srv.Start())
+	}()
+	t.Cleanup(func() { srv.Stop() })
+
+	c, err := Dial(socketPath)
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// fakeServer answers every request with name of its method,
+// requests of the drop method are not answered and close the connection
+type fakeServer struct {
+	listener net.Listener
+	drop     string
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func startFakeServer(t *testing.T, socketPath, drop string) *fakeServer {
+	listener, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+
+	s := &fakeServer{listener: listener, drop: drop}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		data, err := readFrame(reader, DefaultMaxMessageSize)
+		if err != nil {
+			return
+		}
+		var req server.Request
+		if json.Unmarshal(data, &req) != nil || req.Method == s.drop {
+			return
+		}
+		if writeResponse(conn, server.Response{
+			ID: req.ID, Success: true, Data: map[string]string{"method": req.Method},
+		}) != nil {
+			return
+		}
+	}
+}
+
+// stop kills the server with all its connections
+func (s *fakeServer) stop() {
+	s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// accepted returns number of connections accepted by the server
+func (s *fakeServer) accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// writeResponse writes the response as length-prefixed frame
+func writeResponse(conn net.Conn, resp server.Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 4, 4+len(data)+1)
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	frame = append(append(frame, data...), '\n')
+	_, err = conn.Write(frame)
+	return err
+}
+
+func TestScanAndDirectory(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	c := startServer(t)
+
+	// events pushed between responses are skipped
+	assert.NoError(t, c.Call("subscribe", nil, nil))
+
+	assert.NoError(t, c.Scan("test_dir", ScanOptions{IgnoreHidden: true}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	progress, err := c.WaitForScan(ctx)
+	assert.NoError(t, err)
+	assert.False(t, progress.IsScanning)
+	assert.Equal(t, 5, progress.ItemCount)
+
+	info, err := c.Directory("", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "test_dir", info.Name)
+	assert.Len(t, info.Children, 1)
+	assert.Len(t, info.Children[0].Children, 2)
+
+	info, err = c.Directory("test_dir/nested/subnested", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "subnested", info.Name)
+
+	assert.NoError(t, c.Cancel())
+}
+
+func TestScanPaths(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	c := startServer(t)
+	assert.NoError(t, c.ScanPaths([]string{"test_dir/nested/subnested", t.TempDir()}, ScanOptions{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.WaitForScan(ctx)
+	assert.NoError(t, err)
+
+	info, err := c.Directory("", 1)
+	assert.NoError(t, err)
+	assert.Len(t, info.Children, 2)
+	assert.Equal(t, int64(5+2*4096), info.Size)
+
+	assert.Error(t, c.ScanPaths([]string{"test_dir", "test_dir/nested"}, ScanOptions{}))
+}
+
+func TestError(t *testing.T) {
+	c := startServer(t)
+
+	_, err := c.Directory("", 1)
+	var serverErr *Error
+	assert.True(t, errors.As(err, &serverErr))
+	assert.Equal(t, "No scan completed", serverErr.Message)
+
+	err = c.Call("nope", nil, nil)
+	assert.True(t, errors.As(err, &serverErr))
+	assert.Equal(t, server.ErrCodeUnknownMethod, serverErr.Code)
+	assert.Contains(t, err.Error(), server.ErrCodeUnknownMethod)
+}
+
+func TestConcurrentCalls(t *testing.T) {
+	c := startServer(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				progress, err := c.Progress()
+				assert.NoError(t, err)
+				assert.False(t, progress.IsScanning)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestResponsesOutOfOrder(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	c := New(clientConn)
+	defer c.Close()
+
+	// fake server answers two requests in reverse order
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		var reqs []server.Request
+		for i := 0; i < 2; i++ {
+			data, err := readFrame(reader, DefaultMaxMessageSize)
+			assert.NoError(t, err)
+			var req server.Request
+			assert.NoError(t, json.Unmarshal(data, &req))
+			reqs = append(reqs, req)
+		}
+		for i := len(reqs) - 1; i >= 0; i-- {
+			assert.NoError(t, writeResponse(serverConn, server.Response{
+				ID: reqs[i].ID, Success: true, Data: map[string]string{"method": reqs[i].Method},
+			}))
+		}
+		serverConn.Close()
+	}()
+
+	var wg sync.WaitGroup
+	for _, method := range []string{"ping", "status"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result map[string]string
+			assert.NoError(t, c.Call(method, nil, &result))
+			assert.Equal(t, method, result["method"])
+		}()
+	}
+	wg.Wait()
+
+	// connection is closed by the server now
+	assert.Error(t, c.Call("ping", nil, nil))
+}
+
+func TestCallTimeout(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	c := New(clientConn)
+	defer c.Close()
+
+	// fake server reads requests and never answers
+	go func() {
+		_, _ = io.Copy(io.Discard, serverConn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.ProgressContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	c.mu.Lock()
+	assert.Empty(t, c.pending)
+	c.mu.Unlock()
+}
+
+func TestReconnect(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	srv := startFakeServer(t, socketPath, "cancel")
+
+	c, err := DialWithOptions(socketPath, Options{
+		MaxRetries: 20, MinBackoff: 5 * time.Millisecond, MaxBackoff: 20 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	var result map[string]string
+	assert.NoError(t, c.Call("status", nil, &result))
+	assert.Equal(t, "status", result["method"])
+
+	// server is killed and comes back a moment later
+	srv.stop()
+	restarted := make(chan *fakeServer)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		restarted <- startFakeServer(t, socketPath, "cancel")
+	}()
+
+	result = nil
+	assert.NoError(t, c.Call("status", nil, &result))
+	assert.Equal(t, "status", result["method"])
+	srv = <-restarted
+	defer srv.stop()
+	assert.Equal(t, 1, srv.accepted())
+
+	// request which is not idempotent is not repeated once it was sent
+	assert.Error(t, c.Cancel())
+	assert.Equal(t, 1, srv.accepted())
+
+	// but the next call connects again
+	assert.NoError(t, c.Call("ping", nil, nil))
+	assert.Equal(t, 2, srv.accepted())
+
+	assert.NoError(t, c.Close())
+	assert.ErrorIs(t, c.Call("ping", nil, nil), ErrClosed)
+}
+
+func TestNoReconnect(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	srv := startFakeServer(t, socketPath, "")
+
+	c, err := DialWithOptions(socketPath, Options{NoReconnect: true})
+	assert.NoError(t, err)
+	defer c.Close()
+	assert.NoError(t, c.Call("ping", nil, nil))
+
+	srv.stop()
+	srv = startFakeServer(t, socketPath, "")
+	defer srv.stop()
+
+	assert.Error(t, c.Call("ping", nil, nil))
+	assert.Error(t, c.Call("ping", nil, nil))
+	assert.Equal(t, 0, srv.accepted())
+}
+
+func TestWaitForScanTimeout(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	c := New(clientConn)
+	defer c.Close()
+
+	// fake server is scanning forever
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for {
+			data, err := readFrame(reader, DefaultMaxMessageSize)
+			if err != nil {
+				return
+			}
+			var req server.Request
+			assert.NoError(t, json.Unmarshal(data, &req))
+			assert.NoError(t, writeResponse(serverConn, server.Response{
+				ID: req.ID, Success: true, Data: server.ProgressResponse{IsScanning: true, ItemCount: 3},
+			}))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	progress, err := c.WaitForScan(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, progress.IsScanning)
+}
+
+func TestReadFrameTooLong(t *testing.T) {
+	frame := func(length uint32, body string) *bufio.Reader {
+		data := binary.BigEndian.AppendUint32(nil, length)
+		return bufio.NewReader(strings.NewReader(string(data) + body))
+	}
+
+	data, err := readFrame(frame(2, "{}\n"), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+	_, err = readFrame(frame(3, "{ }\n"), 2)
+	assert.ErrorContains(t, err, "exceeds max message size")
+	_, err = readFrame(frame(math.MaxUint32, ""), DefaultMaxMessageSize)
+	assert.ErrorContains(t, err, "exceeds max message size")
+
+	// client drops connection sending too long response
+	clientConn, serverConn := net.Pipe()
+	c := New(clientConn)
+	defer c.Close()
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		if _, err := readFrame(reader, DefaultMaxMessageSize); err == nil {
+			serverConn.Write(binary.BigEndian.AppendUint32(nil, math.MaxUint32))
+		}
+	}()
+	assert.ErrorContains(t, c.Call("ping", nil, nil), "exceeds max message size")
+}
+
+func TestScanOptionsParams(t *testing.T) {
+	assert.Empty(t, ScanOptions{}.params())
+	assert.Equal(t, map[string]interface{}{
+		"concurrency":          2,
+		"throttle":             100,
+		"gc_percent":           50,
+		"ignore_file_patterns": []string{"*.log"},
+		"timeout_sec":          90,
+		"watch":                true,
+	}, ScanOptions{
+		Concurrency:        2,
+		Throttle:           100,
+		GCPercent:          50,
+		IgnoreFilePatterns: []string{"*.log"},
+		Timeout:            90 * time.Second,
+		Watch:              true,
+	}.params())
+
+	// timeouts are rounded up to whole seconds
+	assert.Equal(t, 1, ScanOptions{Timeout: 500 * time.Millisecond}.params()["timeout_sec"])
+	assert.Equal(t, 91, ScanOptions{Timeout: 90*time.Second + time.Millisecond}.params()["timeout_sec"])
+}
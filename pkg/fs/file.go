@@ -17,6 +17,9 @@ type Item interface {
 	GetType() string
 	GetUsage() int64
 	GetMtime() time.Time
+	GetAtime() time.Time
+	GetCtime() time.Time
+	GetOwner() (uid, gid uint32)
 	GetItemCount() int
 	GetParent() Item
 	SetParent(Item)
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+	log "github.com/sirupsen/logrus"
+)
+
+// EventAlert is pushed when an alert starts or stops firing
+const EventAlert = "alert"
+
+// alertsFile is name of the file in the storage dir alerts are persisted in
+const alertsFile = "alerts.json"
+
+// growthWindow is the period growth of an alert path is measured over
+const growthWindow = 24 * time.Hour
+
+// Alert is a size threshold of a path evaluated after every completed scan.
+// At least one of the limits is set.
+type Alert struct {
+	ID              string `json:"id"`
+	Path            string `json:"path"`
+	MaxSize         int64  `json:"max_size_bytes,omitempty"`
+	MaxGrowthPerDay int64  `json:"max_growth_bytes_per_day,omitempty"`
+}
+
+// AlertStatus is an alert with the result of its last evaluation
+type AlertStatus struct {
+	Alert
+	Firing bool `json:"firing"`
+	// Reason describes the exceeded limit while the alert fires
+	Reason string `json:"reason,omitempty"`
+	// Size is size of the path found by the last evaluation
+	Size int64 `json:"size"`
+	// GrowthPerDay is growth of the path since start of the growth window,
+	// it is not extrapolated when the window is shorter than a day
+	GrowthPerDay int64 `json:"growth_per_day"`
+	EvaluatedAt  int64 `json:"evaluated_at,omitempty"`
+	FiredAt      int64 `json:"fired_at,omitempty"`
+}
+
+// AlertWebhookPayload is posted to the webhook when an alert starts or stops firing
+type AlertWebhookPayload struct {
+	Event string      `json:"event"`
+	Alert AlertStatus `json:"alert"`
+}
+
+// AlertsResponse represents list of alerts
+type AlertsResponse struct {
+	Alerts []AlertStatus `json:"alerts"`
+}
+
+// alertState is an alert with data kept between evaluations
+type alertState struct {
+	AlertStatus
+	// BaselineSize and BaselineAt start the growth window
+	BaselineSize int64 `json:"baseline_size"`
+	BaselineAt   int64 `json:"baseline_at,omitempty"`
+}
+
+// alertStore holds alerts and persists them to file when the path is set
+type alertStore struct {
+	mu     sync.Mutex
+	path   string
+	lastID int
+	alerts map[string]*alertState
+}
+
+// persistedAlerts is content of the alerts file
+type persistedAlerts struct {
+	LastID int           `json:"last_id"`
+	Alerts []*alertState `json:"alerts"`
+}
+
+// newAlertStore creates store persisted in the file at path, empty path keeps alerts in memory only.
+// Alerts saved by previous run are loaded.
+func newAlertStore(path string) *alertStore {
+	store := &alertStore{path: path, alerts: make(map[string]*alertState)}
+	if path == "" {
+		return store
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Errorf("Failed to read alerts: %v", err)
+		}
+		return store
+	}
+	var saved persistedAlerts
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Errorf("Failed to decode alerts from %s: %v", path, err)
+		return store
+	}
+	store.lastID = saved.LastID
+	for _, alert := range saved.Alerts {
+		store.alerts[alert.ID] = alert
+	}
+	return store
+}
+
+// set adds the alert or replaces the one with the same ID, new ID is assigned when it is empty
+func (st *alertStore) set(alert Alert) (Alert, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if alert.ID == "" {
+		st.lastID++
+		alert.ID = strconv.Itoa(st.lastID)
+	} else if _, ok := st.alerts[alert.ID]; !ok {
+		return Alert{}, fmt.Errorf("alert %s not found", alert.ID)
+	}
+	st.alerts[alert.ID] = &alertState{AlertStatus: AlertStatus{Alert: alert}}
+	return alert, st.save()
+}
+
+// delete removes the alert, false is returned if there is none with the ID
+func (st *alertStore) delete(id string) (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.alerts[id]; !ok {
+		return false, nil
+	}
+	delete(st.alerts, id)
+	return true, st.save()
+}
+
+// list returns alerts sorted by ID, only the firing ones if firingOnly is set
+func (st *alertStore) list(firingOnly bool) []AlertStatus {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	alerts := make([]AlertStatus, 0, len(st.alerts))
+	for _, alert := range st.alerts {
+		if firingOnly && !alert.Firing {
+			continue
+		}
+		alerts = append(alerts, alert.AlertStatus)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i].ID, alerts[j].ID
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	return alerts
+}
+
+// evaluate checks alerts against sizes found in the tree and returns alerts
+// which started or stopped firing. Alerts of paths not found are left unchanged.
+func (st *alertStore) evaluate(find func(path string) fs.Item, now time.Time) []AlertStatus {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var changed []AlertStatus
+	for _, alert := range st.alerts {
+		item := find(alert.Path)
+		if item == nil {
+			continue
+		}
+		if alert.evaluate(item.GetSize(), now) {
+			changed = append(changed, alert.AlertStatus)
+		}
+	}
+	if len(st.alerts) > 0 {
+		if err := st.save(); err != nil {
+			log.Errorf("Failed to save alerts: %v", err)
+		}
+	}
+	return changed
+}
+
+// evaluate updates the state by the current size and returns true if firing changed
+func (a *alertState) evaluate(size int64, now time.Time) bool {
+	if a.BaselineAt == 0 {
+		a.BaselineSize, a.BaselineAt = size, now.Unix()
+	}
+
+	// growth is averaged over windows longer than a day
+	elapsed := now.Sub(time.Unix(a.BaselineAt, 0))
+	growth := size - a.BaselineSize
+	if elapsed > growthWindow {
+		growth = int64(float64(growth) * float64(growthWindow) / float64(elapsed))
+	}
+
+	a.Size, a.GrowthPerDay, a.EvaluatedAt = size, growth, now.Unix()
+	switch {
+	case a.MaxSize > 0 && size > a.MaxSize:
+		a.Reason = fmt.Sprintf("size %d exceeds limit %d", size, a.MaxSize)
+	case a.MaxGrowthPerDay > 0 && growth > a.MaxGrowthPerDay:
+		a.Reason = fmt.Sprintf("growth %d per day exceeds limit %d", growth, a.MaxGrowthPerDay)
+	default:
+		a.Reason = ""
+	}
+
+	// next window starts after the current one is over
+	if elapsed >= growthWindow {
+		a.BaselineSize, a.BaselineAt = size, now.Unix()
+	}
+
+	firing := a.Reason != ""
+	if firing == a.Firing {
+		return false
+	}
+	a.Firing = firing
+	a.FiredAt = 0
+	if firing {
+		a.FiredAt = now.Unix()
+	}
+	return true
+}
+
+// save writes alerts to the file, caller must hold st.mu
+func (st *alertStore) save() error {
+	if st.path == "" {
+		return nil
+	}
+
+	saved := persistedAlerts{LastID: st.lastID, Alerts: make([]*alertState, 0, len(st.alerts))}
+	for _, alert := range st.alerts {
+		saved.Alerts = append(saved.Alerts, alert)
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(st.path), 0o700); err != nil {
+		return err
+	}
+
+	// the file is replaced at once, so a crash does not leave it half written
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+// evaluateAlerts checks alerts against the completed tree and notifies
+// subscribers and the webhook about alerts which started or stopped firing
+func (s *Server) evaluateAlerts() {
+	s.mu.RLock()
+	if s.completedDir == nil {
+		s.mu.RUnlock()
+		return
+	}
+	root := s.completedDir
+	changed := s.alerts.evaluate(func(path string) fs.Item {
+		// paths outside of the scanned roots are not searched for
+		if !underRoots(root, path) {
+			return nil
+		}
+		return s.findItem(path)
+	}, time.Now())
+	wh := s.webhook
+	s.mu.RUnlock()
+
+	for _, alert := range changed {
+		if alert.Firing {
+			log.Warnf("Alert %s of %s fires: %s", alert.ID, alert.Path, alert.Reason)
+		} else {
+			log.Infof("Alert %s of %s stopped firing", alert.ID, alert.Path)
+		}
+		s.events.publish(Event{Event: EventAlert, Data: alert})
+		if wh != nil {
+			go wh.notify(AlertWebhookPayload{Event: EventAlert, Alert: alert})
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlerts(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	sub := s.server.events.subscribe([]string{EventAlert})
+	defer s.server.events.unsubscribe(sub)
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"set_alert","params":{"path":"test_dir/nested","max_size_bytes":1}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, Alert{ID: "1", Path: "test_dir/nested", MaxSize: 1}, resp.Data)
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"set_alert","params":{"path":"test_dir","max_size_bytes":1000000000}}`))
+	assert.True(t, resp.Success, resp.Error)
+
+	s.server.scan("test_dir", scanOptions{})
+
+	select {
+	case event := <-sub.events:
+		alert := event.Data.(AlertStatus)
+		assert.Equal(t, "1", alert.ID)
+		assert.True(t, alert.Firing)
+		assert.Contains(t, alert.Reason, "exceeds limit 1")
+	case <-time.After(time.Second):
+		t.Fatal("alert event not pushed")
+	}
+
+	status := s.status()
+	assert.Len(t, status.Alerts, 1)
+	assert.Equal(t, "1", status.Alerts[0].ID)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"list_alerts"}`))
+	assert.True(t, resp.Success)
+	alerts := resp.Data.(AlertsResponse).Alerts
+	assert.Len(t, alerts, 2)
+	assert.False(t, alerts[1].Firing)
+	assert.Equal(t, s.server.completedDir.GetSize(), alerts[1].Size)
+
+	// raised limit is evaluated against the scanned tree at once
+	resp = s.processRequest([]byte(`{"id":"4","method":"set_alert","params":{"id":"1","path":"test_dir/nested","max_size_bytes":1000000000}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Empty(t, s.status().Alerts)
+
+	resp = s.processRequest([]byte(`{"id":"5","method":"delete_alert","params":{"id":"1"}}`))
+	assert.True(t, resp.Success)
+	resp = s.processRequest([]byte(`{"id":"6","method":"delete_alert","params":{"id":"1"}}`))
+	assert.False(t, resp.Success)
+	assert.Len(t, s.server.alerts.list(false), 1)
+
+	resp = s.processRequest([]byte(`{"id":"7","method":"set_alert","params":{"path":"test_dir"}}`))
+	assert.False(t, resp.Success)
+	resp = s.processRequest([]byte(`{"id":"8","method":"set_alert","params":{"id":"9","path":"test_dir","max_size_bytes":1}}`))
+	assert.False(t, resp.Success)
+}
+
+func TestAlertGrowth(t *testing.T) {
+	// baseline is kept in whole seconds
+	now := time.Unix(1700000000, 0)
+	alert := &alertState{AlertStatus: AlertStatus{Alert: Alert{MaxGrowthPerDay: 100}}}
+
+	assert.False(t, alert.evaluate(1000, now))
+	assert.False(t, alert.evaluate(1050, now.Add(time.Hour)))
+	assert.True(t, alert.evaluate(1200, now.Add(2*time.Hour)))
+	assert.Equal(t, int64(200), alert.GrowthPerDay)
+	assert.True(t, alert.Firing)
+
+	// growth over two days is averaged and the next window starts
+	assert.True(t, alert.evaluate(1150, now.Add(48*time.Hour)))
+	assert.Equal(t, int64(75), alert.GrowthPerDay)
+	assert.Equal(t, int64(1150), alert.BaselineSize)
+}
+
+func TestAlertsPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage", alertsFile)
+
+	store := newAlertStore(path)
+	alert, err := store.set(Alert{Path: "/data", MaxGrowthPerDay: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", alert.ID)
+
+	store = newAlertStore(path)
+	assert.Equal(t, []AlertStatus{{Alert: alert}}, store.list(false))
+
+	alert, err = store.set(Alert{Path: "/data", MaxSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, "2", alert.ID)
+}
+
+func TestAlertWebhookPayload(t *testing.T) {
+	data, err := json.Marshal(AlertWebhookPayload{Event: EventAlert, Alert: AlertStatus{
+		Alert:  Alert{ID: "1", Path: "/data", MaxSize: 10},
+		Firing: true,
+		Size:   20,
+	}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"event":"alert","alert":{"id":"1","path":"/data","max_size_bytes":10,
+		"firing":true,"size":20,"growth_per_day":0}}`, string(data))
+}
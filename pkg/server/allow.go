@@ -0,0 +1,144 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errOutsideBaseDir is returned for paths leading out of the base dir
+var errOutsideBaseDir = errors.New("path is outside of the base dir")
+
+// errUnrestrictedOutput is returned for output files when no allowed path or base dir limits where they are written
+var errUnrestrictedOutput = errors.New("output file requires allowed paths or base dir to be configured")
+
+// resolvePath returns absolute path with symlinks evaluated
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// isUnder returns true if path is equal to root or inside of it
+func isUnder(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// escapesRoot returns true if path leads out of root via ".." elements
+func escapesRoot(root, path string) bool {
+	if !strings.Contains(path, "..") {
+		return false
+	}
+	return !isUnder(root, filepath.Clean(path))
+}
+
+// ValidateAllowedPaths returns error if any of the paths can't be resolved to a root allowed to be scanned
+func ValidateAllowedPaths(paths []string) error {
+	_, err := resolveAllowedPaths(paths)
+	return err
+}
+
+// resolveAllowedPaths resolves roots of paths which can be scanned
+func resolveAllowedPaths(paths []string) ([]string, error) {
+	allowed := make([]string, 0, len(paths))
+	for _, path := range paths {
+		resolved, err := resolvePath(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed path %s: %w", path, err)
+		}
+		allowed = append(allowed, resolved)
+	}
+	return allowed, nil
+}
+
+// setAllowedPaths resolves roots of paths which can be scanned
+func (s *Server) setAllowedPaths(paths []string) error {
+	allowed, err := resolveAllowedPaths(paths)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allowedPaths = allowed
+	return nil
+}
+
+// checkPathAllowed returns error if path is not under any of the allowed roots,
+// all paths are allowed when no root is set
+func (s *Server) checkPathAllowed(path string) error {
+	s.mu.RLock()
+	allowed := s.allowedPaths
+	s.mu.RUnlock()
+
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return fmt.Errorf("path %s is not allowed: %w", path, err)
+	}
+	for _, root := range allowed {
+		if isUnder(root, resolved) {
+			return nil
+		}
+	}
+	return fmt.Errorf("path %s is not allowed", path)
+}
+
+// checkOutputAllowed returns error if file can't be written to path,
+// files are written only to dirs under the allowed roots or the base dir
+func (s *Server) checkOutputAllowed(path string) error {
+	s.mu.RLock()
+	restricted := len(s.allowedPaths) > 0 || s.baseDir != ""
+	s.mu.RUnlock()
+
+	if !restricted {
+		return errUnrestrictedOutput
+	}
+	// the file itself may not exist yet
+	return s.checkPathAllowed(filepath.Dir(path))
+}
+
+// resolveBaseDir returns absolute path of the base dir, it has to be an existing directory
+func resolveBaseDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid base dir %s: %w", dir, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("invalid base dir %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("invalid base dir %s: not a directory", dir)
+	}
+	return abs, nil
+}
+
+// resolveBasePath joins relative path with the base dir and checks that the result stays in it.
+// Path is returned unchanged when no base dir is set.
+func (s *Server) resolveBasePath(path string) (string, error) {
+	if s.baseDir == "" {
+		return path, nil
+	}
+
+	if filepath.IsAbs(path) {
+		path = filepath.Clean(path)
+	} else {
+		path = filepath.Join(s.baseDir, path)
+	}
+	if !isUnder(s.baseDir, path) {
+		return "", errOutsideBaseDir
+	}
+	return path, nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUnder(t *testing.T) {
+	assert.True(t, isUnder("/home", "/home"))
+	assert.True(t, isUnder("/home", "/home/user"))
+	assert.True(t, isUnder("/", "/etc"))
+	assert.True(t, isUnder("/home", "/home/..data"))
+	assert.False(t, isUnder("/home", "/homework"))
+	assert.False(t, isUnder("/home", "/"))
+	assert.False(t, isUnder("/home/user", "/home/other"))
+}
+
+func TestEscapesRoot(t *testing.T) {
+	assert.False(t, escapesRoot("test_dir", "test_dir/nested"))
+	assert.False(t, escapesRoot("test_dir", "test_dir/nested/../nested"))
+	assert.True(t, escapesRoot("test_dir", "test_dir/.."))
+	assert.True(t, escapesRoot("test_dir", "test_dir/../etc"))
+}
+
+func TestAllowedPaths(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	err := os.Symlink("..", "test_dir/nested/up")
+	assert.NoError(t, err)
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	assert.NoError(t, s.server.checkPathAllowed("/etc"))
+
+	err = s.SetAllowedPaths([]string{"test_dir/nested"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.server.checkPathAllowed("test_dir/nested"))
+	assert.NoError(t, s.server.checkPathAllowed("test_dir/nested/subnested/"))
+	assert.Error(t, s.server.checkPathAllowed("test_dir"))
+	assert.Error(t, s.server.checkPathAllowed("test_dir/nested/.."))
+	assert.Error(t, s.server.checkPathAllowed("test_dir/nested/up"))
+	assert.Error(t, s.server.checkPathAllowed("test_dir/nested/missing"))
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"scan","params":{"path":"test_dir"}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeForbidden, resp.Code)
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"estimate","params":{"path":"/etc"}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeForbidden, resp.Code)
+
+	abs, err := filepath.Abs("test_dir/nested")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{abs}, s.status().AllowedPaths)
+
+	err = s.SetAllowedPaths([]string{"test_dir/missing"})
+	assert.Error(t, err)
+}
+
+func TestDirectoryEscapingRoot(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir/nested", scanOptions{})
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"directory","params":{"path":"nested/.."}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeForbidden, resp.Code)
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"directory","params":{"path":"nested/subnested/../.."}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeForbidden, resp.Code)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"directory","params":{"path":"nested/subnested"}}`))
+	assert.True(t, resp.Success)
+}
+
+func TestBaseDir(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	base, err := filepath.Abs("test_dir")
+	assert.NoError(t, err)
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.baseDir = base
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"scan","params":{"path":"nested"}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Eventually(t, func() bool {
+		gen, _ := s.server.generation()
+		return gen == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"directory","params":{"path":"nested/subnested"}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, filepath.Join(base, "nested/subnested"), resp.Data.(DirInfo).Path)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"list","params":{"path":"nested"}}`))
+	assert.True(t, resp.Success, resp.Error)
+
+	for _, req := range []string{
+		`{"id":"4","method":"scan","params":{"path":"../.."}}`,
+		`{"id":"5","method":"estimate","params":{"path":"/etc"}}`,
+		`{"id":"6","method":"directory","params":{"path":"nested/../../x"}}`,
+		`{"id":"7","method":"move","params":{"from":"nested/file2","to":"../file2"}}`,
+	} {
+		resp = s.processRequest([]byte(req))
+		assert.False(t, resp.Success, req)
+		assert.Equal(t, ErrCodeForbidden, resp.Code, req)
+	}
+}
+
+func TestBaseDirOption(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+
+	_, err := NewUnixSocketServerWithOptions(socketPath, false, "", Options{BaseDir: "/no/such/dir"})
+	assert.ErrorContains(t, err, "invalid base dir")
+}
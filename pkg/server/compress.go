@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression methods clients can ask for
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// compressThreshold is size of body above which responses are compressed when asked for.
+// Body of compressed frame starts with magic number of the compression format instead of
+// '{' or MessagePack map header, so uncompressed frames keep their layout.
+const compressThreshold = 64 * 1024
+
+var gzipPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(io.Discard) },
+}
+
+var zstdPool = sync.Pool{
+	New: func() interface{} {
+		// error is returned only for invalid options
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return w
+	},
+}
+
+// validCompression returns error if compression method is not supported
+func validCompression(method string) error {
+	switch method {
+	case "", CompressGzip, CompressZstd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression: %s", method)
+	}
+}
+
+// compressFrame returns new frame with body of the frame compressed by the method
+func compressFrame(frame *bytes.Buffer, method string) (*bytes.Buffer, error) {
+	buf := framePool.Get().(*bytes.Buffer)
+	buf.Reset()
+	buf.Write(make([]byte, frameHeaderSize))
+
+	data := frame.Bytes()[frameHeaderSize : frameHeaderSize+frameDataLen(frame)]
+	var err error
+	switch method {
+	case CompressGzip:
+		w := gzipPool.Get().(*gzip.Writer)
+		w.Reset(buf)
+		if _, err = w.Write(data); err == nil {
+			err = w.Close()
+		}
+		gzipPool.Put(w)
+	case CompressZstd:
+		w := zstdPool.Get().(*zstd.Encoder)
+		w.Reset(buf)
+		if _, err = w.Write(data); err == nil {
+			err = w.Close()
+		}
+		zstdPool.Put(w)
+	default:
+		err = fmt.Errorf("unsupported compression: %s", method)
+	}
+	if err != nil {
+		releaseFrame(buf)
+		return nil, fmt.Errorf("failed to compress response: %w", err)
+	}
+
+	buf.WriteByte('\n')
+	setFrameLength(buf)
+	return buf, nil
+}
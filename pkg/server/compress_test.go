@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/pkg/analyze"
+	"github.com/dundee/gdu/v5/pkg/fs"
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// largeTreeServer returns server with scanned tree which directory response is larger than compressThreshold
+func largeTreeServer() *UnixSocketServer {
+	root := &analyze.Dir{File: &analyze.File{Name: "root"}}
+	for i := 0; i < 2000; i++ {
+		root.AddFile(&analyze.File{Name: fmt.Sprintf("file-%04d", i), Parent: root, Size: int64(i)})
+	}
+	root.UpdateStats(make(fs.HardLinkedItems))
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.completedDir = root
+	s.server.pathIndex = buildPathIndex(root)
+	return s
+}
+
+// roundTrip sends response of the request through connection and returns the received frame body
+func roundTrip(t *testing.T, s *UnixSocketServer, req string) []byte {
+	client, srv := net.Pipe()
+	defer client.Close()
+	c := &connection{conn: srv, logger: log.NewEntry(log.StandardLogger())}
+
+	resp := s.serveRequest(c, []byte(req))
+	go func() {
+		assert.NoError(t, c.sendResponse(resp, time.Now(), 0))
+		srv.Close()
+	}()
+
+	frame, err := readSocketFrame(client)
+	assert.NoError(t, err)
+	return frame
+}
+
+func TestCompressLargeResponse(t *testing.T) {
+	s := largeTreeServer()
+	plain := roundTrip(t, s, `{"id":"1","method":"directory","params":{"depth":1}}`)
+	assert.Equal(t, byte('{'), plain[0])
+	assert.Greater(t, len(plain), compressThreshold)
+
+	gzipped := roundTrip(t, s, `{"id":"1","method":"directory","params":{"depth":1},"compress":"gzip"}`)
+	assert.Equal(t, []byte{0x1f, 0x8b}, gzipped[:2])
+	assert.Less(t, len(gzipped), len(plain)/2)
+	r, err := gzip.NewReader(bytes.NewReader(gzipped))
+	assert.NoError(t, err)
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, plain, data)
+
+	zstded := roundTrip(t, s, `{"id":"1","method":"directory","params":{"depth":1},"compress":"zstd"}`)
+	assert.Equal(t, []byte{0x28, 0xb5, 0x2f, 0xfd}, zstded[:4])
+	d, err := zstd.NewReader(bytes.NewReader(zstded))
+	assert.NoError(t, err)
+	defer d.Close()
+	data, err = io.ReadAll(d)
+	assert.NoError(t, err)
+	assert.Equal(t, plain, data)
+}
+
+func TestCompressThreshold(t *testing.T) {
+	s := largeTreeServer()
+
+	// small response is sent uncompressed even when asked for
+	frame := roundTrip(t, s, `{"id":"1","method":"directory","params":{"depth":0},"compress":"gzip"}`)
+	var resp Response
+	assert.NoError(t, json.Unmarshal(frame, &resp))
+	assert.True(t, resp.Success)
+
+	frame = roundTrip(t, s, `{"id":"2","method":"ping","compress":"brotli"}`)
+	assert.NoError(t, json.Unmarshal(frame, &resp))
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "unsupported compression")
+}
+
+func TestSendResponseEncodingFailure(t *testing.T) {
+	client, srv := net.Pipe()
+	defer client.Close()
+	c := &connection{conn: srv, logger: log.NewEntry(log.StandardLogger())}
+
+	go func() {
+		resp := &Response{ID: "7", Success: true, Data: math.NaN()}
+		assert.NoError(t, c.sendResponse(resp, time.Now(), 0))
+		// connection stays usable
+		assert.NoError(t, c.sendResponse(&Response{ID: "8", Success: true}, time.Now(), 0))
+	}()
+
+	var resp Response
+	frame, err := readSocketFrame(client)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(frame, &resp))
+	assert.Equal(t, "7", resp.ID)
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeEncoding, resp.Code)
+	assert.Contains(t, resp.Error, "failed to marshal response")
+
+	frame, err = readSocketFrame(client)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(frame, &resp))
+	assert.Equal(t, "8", resp.ID)
+	assert.True(t, resp.Success)
+}
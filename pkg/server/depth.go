@@ -0,0 +1,32 @@
+package server
+
+import "github.com/dundee/gdu/v5/pkg/fs"
+
+// DepthCount represents number of items at one depth below the scanned root
+type DepthCount struct {
+	Depth int `json:"depth"`
+	Files int `json:"files"`
+	Dirs  int `json:"dirs"`
+}
+
+// countByDepth counts files and dirs at every depth of the tree, the root is at depth 0
+func countByDepth(root fs.Item) []DepthCount {
+	counts := make([]DepthCount, 0)
+	countItem(root, 0, &counts)
+	return counts
+}
+
+func countItem(item fs.Item, depth int, counts *[]DepthCount) {
+	if depth == len(*counts) {
+		*counts = append(*counts, DepthCount{Depth: depth})
+	}
+	if !item.IsDir() {
+		(*counts)[depth].Files++
+		return
+	}
+
+	(*counts)[depth].Dirs++
+	for _, child := range item.GetFiles() {
+		countItem(child, depth+1, counts)
+	}
+}
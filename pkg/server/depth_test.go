@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountByDepth(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"count_by_depth"}`))
+	assert.False(t, resp.Success)
+
+	s.server.scan("test_dir", scanOptions{})
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"count_by_depth"}`))
+	assert.True(t, resp.Success)
+	assert.Equal(t, []DepthCount{
+		{Depth: 0, Dirs: 1},
+		{Depth: 1, Dirs: 1},
+		{Depth: 2, Dirs: 1, Files: 1},
+		{Depth: 3, Files: 1},
+	}, resp.Data)
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+	log "github.com/sirupsen/logrus"
+)
+
+// DuplicateGroup represents files with identical content
+type DuplicateGroup struct {
+	Size   int64    `json:"size"`
+	Wasted int64    `json:"wasted"`
+	Hash   string   `json:"hash"`
+	Paths  []string `json:"paths"`
+}
+
+// findDuplicates groups files in the tree by size and then by content hash.
+// Only files of at least minSize bytes are hashed.
+// Groups are sorted by wasted space descending.
+// Walk and hashing stop with error of the budget context once it is done.
+func findDuplicates(root fs.Item, minSize int64, budget *walkBudget) ([]DuplicateGroup, error) {
+	bySize := make(map[int64][]string)
+	seenInodes := make(map[uint64]struct{})
+	if err := collectFilesBySize(root, minSize, bySize, seenInodes, budget); err != nil {
+		return nil, err
+	}
+
+	var candidates []string
+	for _, paths := range bySize {
+		if len(paths) > 1 {
+			candidates = append(candidates, paths...)
+		}
+	}
+
+	hashes, err := hashFiles(budget.ctx, candidates)
+	budget.examined += int64(len(hashes))
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		size int64
+		hash string
+	}
+	byContent := make(map[key][]string)
+	for size, paths := range bySize {
+		if len(paths) < 2 {
+			continue
+		}
+		for _, path := range paths {
+			hash, ok := hashes[path]
+			if !ok {
+				continue
+			}
+			k := key{size, hash}
+			byContent[k] = append(byContent[k], path)
+		}
+	}
+
+	groups := make([]DuplicateGroup, 0)
+	for k, paths := range byContent {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+		groups = append(groups, DuplicateGroup{
+			Size:   k.size,
+			Wasted: k.size * int64(len(paths)-1),
+			Hash:   k.hash,
+			Paths:  paths,
+		})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Wasted != groups[j].Wasted {
+			return groups[i].Wasted > groups[j].Wasted
+		}
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+	return groups, nil
+}
+
+// collectFilesBySize collects paths of regular files grouped by size,
+// hard links to already seen inode are skipped
+func collectFilesBySize(
+	item fs.Item, minSize int64, bySize map[int64][]string, seenInodes map[uint64]struct{}, budget *walkBudget,
+) error {
+	for _, child := range item.GetFiles() {
+		if err := budget.step(); err != nil {
+			return err
+		}
+		if child.IsDir() {
+			if err := collectFilesBySize(child, minSize, bySize, seenInodes, budget); err != nil {
+				return err
+			}
+			continue
+		}
+		if child.GetFlag() == '@' || child.GetSize() < minSize || child.GetSize() == 0 {
+			continue
+		}
+		if inode := child.GetMultiLinkedInode(); inode > 0 {
+			if _, ok := seenInodes[inode]; ok {
+				continue
+			}
+			seenInodes[inode] = struct{}{}
+		}
+		bySize[child.GetSize()] = append(bySize[child.GetSize()], child.GetPath())
+	}
+	return nil
+}
+
+// hashFiles computes content hashes of files in parallel,
+// files which cannot be read are left out.
+// Files not hashed yet are skipped once the context is done, its error is returned then.
+func hashFiles(ctx context.Context, paths []string) (map[string]string, error) {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		hashes = make(map[string]string, len(paths))
+		jobs   = make(chan string)
+	)
+
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				hash, err := hashFile(path)
+				if err != nil {
+					log.Warnf("Failed to hash file: %v", err)
+					continue
+				}
+				mu.Lock()
+				hashes[path] = hash
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- path
+	}
+	close(jobs)
+	wg.Wait()
+
+	return hashes, ctx.Err()
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
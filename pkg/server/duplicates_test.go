@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFindDuplicates tests grouping of files with identical content
+func TestFindDuplicates(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a/big1":   "0123456789",
+		"b/big2":   "0123456789",
+		"big3":     "0123456789",
+		"same_len": "abcdefghij",
+		"small1":   "xy",
+		"a/small2": "xy",
+		"unique":   "unique content",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	s := NewServer(false, "")
+	s.scan(root, scanOptions{})
+
+	groups, err := findDuplicates(s.completedDir, 1, &walkBudget{ctx: context.Background()})
+	assert.NoError(t, err)
+	assert.Len(t, groups, 2)
+
+	assert.Equal(t, int64(10), groups[0].Size)
+	assert.Equal(t, int64(20), groups[0].Wasted)
+	assert.Equal(t, []string{
+		filepath.Join(root, "a/big1"),
+		filepath.Join(root, "b/big2"),
+		filepath.Join(root, "big3"),
+	}, groups[0].Paths)
+
+	assert.Equal(t, int64(2), groups[1].Wasted)
+	assert.Len(t, groups[1].Paths, 2)
+
+	groups, err = findDuplicates(s.completedDir, 5, &walkBudget{ctx: context.Background()})
+	assert.NoError(t, err)
+	assert.Len(t, groups, 1)
+}
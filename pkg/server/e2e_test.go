@@ -0,0 +1,131 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/dundee/gdu/v5/pkg/client"
+	"github.com/dundee/gdu/v5/pkg/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// startServer starts socket server in temp dir and returns its socket path
+func startServer(t *testing.T) string {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	srv, err := server.NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, srv.Start())
+	}()
+	t.Cleanup(func() { srv.Stop() })
+	return socketPath
+}
+
+// dial returns client connected to the server
+func dial(t *testing.T, socketPath string) *client.Client {
+	c, err := client.Dial(socketPath)
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// TestUnixSocketServerEndToEnd tests complete end-to-end flow with real Unix socket
+func TestUnixSocketServerEndToEnd(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	c := dial(t, startServer(t))
+
+	// progress before scan
+	progress, err := c.Progress()
+	assert.NoError(t, err)
+	assert.False(t, progress.IsScanning)
+
+	assert.NoError(t, c.Scan("test_dir", client.ScanOptions{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	progress, err = c.WaitForScan(ctx)
+	assert.NoError(t, err)
+	assert.False(t, progress.IsScanning)
+	assert.Equal(t, 5, progress.ItemCount)
+
+	// directory is available once the scan completes
+	dir, err := c.Directory("", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "test_dir", dir.Name)
+	assert.True(t, dir.IsDir)
+	assert.Greater(t, dir.ItemCount, 0)
+	assert.Len(t, dir.Children, 1)
+
+	// cancel after the scan is done is handled gracefully
+	assert.NoError(t, c.Cancel())
+}
+
+// TestSocketErrorHandling tests error handling over socket
+func TestSocketErrorHandling(t *testing.T) {
+	c := dial(t, startServer(t))
+
+	var serverErr *client.Error
+	err := c.Call("invalid_method", nil, nil)
+	assert.True(t, errors.As(err, &serverErr))
+	assert.Contains(t, serverErr.Message, "Unknown method")
+	assert.Equal(t, server.ErrCodeUnknownMethod, serverErr.Code)
+
+	err = c.Call("scan", map[string]interface{}{}, nil)
+	assert.True(t, errors.As(err, &serverErr))
+	assert.Contains(t, serverErr.Message, "missing parameter")
+
+	err = c.Call("scan", map[string]interface{}{"path": 123}, nil)
+	assert.True(t, errors.As(err, &serverErr))
+	assert.Contains(t, serverErr.Message, "must be string")
+}
+
+// TestSocketMultipleSequentialRequests tests multiple sequential requests on same connection
+func TestSocketMultipleSequentialRequests(t *testing.T) {
+	c := dial(t, startServer(t))
+
+	for i := 0; i < 5; i++ {
+		_, err := c.Progress()
+		assert.NoError(t, err)
+	}
+}
+
+// TestSocketConnectionClose tests graceful connection close
+func TestSocketConnectionClose(t *testing.T) {
+	socketPath := startServer(t)
+
+	// Connect and immediately close
+	conn, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	conn.Close()
+
+	// New connection should work
+	c := dial(t, socketPath)
+	_, err = c.Progress()
+	assert.NoError(t, err)
+}
+
+// TestSocketStatus tests the status method reports open connections
+func TestSocketStatus(t *testing.T) {
+	socketPath := startServer(t)
+	c := dial(t, socketPath)
+	c2 := dial(t, socketPath)
+
+	// make sure the second connection has been accepted
+	_, err := c2.Progress()
+	assert.NoError(t, err)
+
+	var status server.StatusResponse
+	assert.NoError(t, c.Call("status", nil, &status))
+	assert.Equal(t, int64(2), status.Connections)
+	assert.False(t, status.IsScanning)
+	assert.False(t, status.UseStorage)
+	assert.Empty(t, status.StoragePath)
+	assert.GreaterOrEqual(t, status.Uptime, int64(0))
+}
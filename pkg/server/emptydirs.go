@@ -0,0 +1,39 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+)
+
+// findEmptyDirs returns sorted paths of dirs flagged as empty by the scan.
+// With nested set, dirs containing nothing but other empty dirs are returned as well.
+func findEmptyDirs(root fs.Item, nested bool) []string {
+	paths := make([]string, 0)
+	collectEmptyDirs(root, nested, &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+// collectEmptyDirs appends empty dirs of the subtree to paths,
+// returns true if the item itself is empty dir
+func collectEmptyDirs(item fs.Item, nested bool, paths *[]string) bool {
+	if !item.IsDir() {
+		return false
+	}
+
+	files := item.GetFiles()
+	// dir which could not be read is not known to be empty
+	onlyEmpty := item.GetFlag() == ' ' && len(files) > 0
+	for _, child := range files {
+		if !collectEmptyDirs(child, nested, paths) {
+			onlyEmpty = false
+		}
+	}
+
+	if item.GetFlag() == 'e' || (nested && onlyEmpty) {
+		*paths = append(*paths, item.GetPath())
+		return true
+	}
+	return false
+}
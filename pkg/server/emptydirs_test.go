@@ -0,0 +1,38 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindEmptyDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"empty", "nested/a", "nested/b/c", "full/empty"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0o755))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "full", "file"), []byte("x"), 0o600))
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan(root, scanOptions{})
+
+	assert.Equal(t, []string{
+		filepath.Join(root, "empty"),
+		filepath.Join(root, "full/empty"),
+		filepath.Join(root, "nested/a"),
+		filepath.Join(root, "nested/b/c"),
+	}, findEmptyDirs(s.server.completedDir, false))
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"empty_dirs","params":{"nested":true}}`))
+	assert.True(t, resp.Success)
+	assert.Equal(t, []string{
+		filepath.Join(root, "empty"),
+		filepath.Join(root, "full/empty"),
+		filepath.Join(root, "nested"),
+		filepath.Join(root, "nested/a"),
+		filepath.Join(root, "nested/b"),
+		filepath.Join(root, "nested/b/c"),
+	}, resp.Data)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// encoding is format of request and response bodies of a connection
+type encoding int
+
+const (
+	encodingJSON encoding = iota
+	encodingMsgpack
+)
+
+// Names of encodings clients can switch to by set_encoding
+const (
+	EncodingJSON    = "json"
+	EncodingMsgpack = "msgpack"
+)
+
+// parseEncoding returns encoding of the name
+func parseEncoding(name string) (encoding, error) {
+	switch name {
+	case EncodingJSON:
+		return encodingJSON, nil
+	case EncodingMsgpack:
+		return encodingMsgpack, nil
+	default:
+		return encodingJSON, fmt.Errorf("unsupported encoding: %s", name)
+	}
+}
+
+// decodeRequest decodes request body.
+// MessagePack uses the JSON field names, numbers in params are decoded as in JSON.
+func decodeRequest(enc encoding, data []byte, req *Request) error {
+	if enc == encodingJSON {
+		return json.Unmarshal(data, req)
+	}
+
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+	dec.Reset(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	dec.UseLooseInterfaceDecoding(true)
+	return dec.Decode(req)
+}
+
+// encodeBody writes value encoded by enc to w
+func encodeBody(w io.Writer, enc encoding, v interface{}) error {
+	if enc == encodingJSON {
+		return json.NewEncoder(w).Encode(v)
+	}
+
+	e := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(e)
+	e.Reset(w)
+	e.SetCustomStructTag("json")
+	e.UseCompactInts(true)
+	return e.Encode(v)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	data, err := msgpack.Marshal(map[string]interface{}{
+		"id":     "1",
+		"method": "directory",
+		"params": map[string]interface{}{"path": "a", "depth": 2, "events": []string{"x"}},
+	})
+	assert.NoError(t, err)
+
+	var req Request
+	assert.NoError(t, decodeRequest(encodingMsgpack, data, &req))
+	assert.Equal(t, "1", req.ID)
+	assert.Equal(t, "directory", req.Method)
+	depth, err := getIntParam(req.Params, "depth", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, depth)
+	events, err := getStringSliceParam(req.Params, "events")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"x"}, events)
+
+	frame, err := encodeFrame(&Response{
+		ID:      "1",
+		Success: true,
+		Data:    DirInfo{Name: "a", Path: "/a", Size: 10, Children: []DirInfo{{Name: "b"}}},
+	}, encodingMsgpack)
+	assert.NoError(t, err)
+	defer releaseFrame(frame)
+
+	b := frame.Bytes()
+	assert.Equal(t, uint32(frameDataLen(frame)), binary.BigEndian.Uint32(b))
+	assert.Equal(t, byte('\n'), b[len(b)-1])
+
+	// field names match the JSON ones, empty fields are omitted the same way
+	var fields map[string]interface{}
+	assert.NoError(t, msgpack.Unmarshal(b[frameHeaderSize:len(b)-1], &fields))
+	assert.Equal(t, "1", fields["id"])
+	assert.Equal(t, true, fields["success"])
+	assert.NotContains(t, fields, "error")
+	info := fields["data"].(map[string]interface{})
+	assert.Equal(t, "/a", info["path"])
+	assert.EqualValues(t, 10, info["size"])
+	assert.Len(t, info["children"], 1)
+}
+
+func TestSetEncodingInvalid(t *testing.T) {
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	resp := s.processRequest([]byte(`{"id":"1","method":"set_encoding","params":{"encoding":"xml"}}`))
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "unsupported encoding")
+}
+
+func TestMixedEncodings(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, server.Start())
+	}()
+	defer server.Stop()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		conn, err := net.Dial("unix", socketPath)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		// response to set_encoding is still JSON
+		assert.NoError(t, sendSocketRequest(conn, Request{
+			ID: "enc", Method: "set_encoding", Params: map[string]interface{}{"encoding": EncodingMsgpack},
+		}))
+		resp, err := readSocketResponse(conn)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success, resp.Error)
+
+		for i := 0; i < 50; i++ {
+			data, err := msgpack.Marshal(map[string]interface{}{"id": "m", "method": "status"})
+			assert.NoError(t, err)
+			assert.NoError(t, writeSocketFrame(conn, data))
+
+			frame, err := readSocketFrame(conn)
+			assert.NoError(t, err)
+			var resp struct {
+				ID      string                 `msgpack:"id"`
+				Success bool                   `msgpack:"success"`
+				Data    map[string]interface{} `msgpack:"data"`
+			}
+			assert.NoError(t, msgpack.Unmarshal(frame, &resp))
+			assert.Equal(t, "m", resp.ID)
+			assert.True(t, resp.Success)
+			assert.Contains(t, resp.Data, "uptime_sec")
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		conn, err := net.Dial("unix", socketPath)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		for i := 0; i < 50; i++ {
+			assert.NoError(t, sendSocketRequest(conn, Request{ID: "j", Method: "status"}))
+			resp, err := readSocketResponse(conn)
+			assert.NoError(t, err)
+			assert.Equal(t, "j", resp.ID)
+			assert.True(t, resp.Success)
+		}
+	}()
+
+	wg.Wait()
+}
+
+func writeSocketFrame(conn net.Conn, data []byte) error {
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(data)+1)
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	frame = append(frame, data...)
+	frame = append(frame, '\n')
+	_, err := conn.Write(frame)
+	return err
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Names of events pushed to subscribed clients
+const (
+	// EventScanComplete is pushed when a scan finishes and its tree is swapped in
+	EventScanComplete = "scan_complete"
+	// EventProgress is pushed while a scan runs, at most once per progress interval
+	// and once more with the final totals when the scan finishes
+	EventProgress = "progress"
+)
+
+// DefaultProgressInterval is the default minimal time between two progress events
+const DefaultProgressInterval = 250 * time.Millisecond
+
+// eventBuffer is number of events queued for a subscriber before new ones are dropped
+const eventBuffer = 64
+
+// Event is a frame pushed to subscribed clients without a request
+type Event struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// subscription receives events of the selected names, all events if no name is selected
+type subscription struct {
+	events chan Event
+	names  map[string]bool
+}
+
+func (sub *subscription) wants(name string) bool {
+	return len(sub.names) == 0 || sub.names[name]
+}
+
+// eventHub delivers events to subscriptions
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[*subscription]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[*subscription]struct{})}
+}
+
+// subscribe registers subscription to events with given names
+func (h *eventHub) subscribe(names []string) *subscription {
+	sub := &subscription{
+		events: make(chan Event, eventBuffer),
+		names:  make(map[string]bool, len(names)),
+	}
+	for _, name := range names {
+		sub.names[name] = true
+	}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// addNames extends subscription with events of given names,
+// subscription to all events is left unchanged
+func (h *eventHub) addNames(sub *subscription, names ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(sub.names) == 0 {
+		return
+	}
+	for _, name := range names {
+		sub.names[name] = true
+	}
+}
+
+// unsubscribe removes subscription and closes its channel
+func (h *eventHub) unsubscribe(sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	close(sub.events)
+}
+
+// publish sends event to all interested subscriptions.
+// Slow subscriber does not block the publisher, the event is dropped for it instead.
+func (h *eventHub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		if !sub.wants(event.Event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			log.Warnf("Subscriber is not reading, dropping %s event", event.Event)
+		}
+	}
+}
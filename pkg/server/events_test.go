@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventHub(t *testing.T) {
+	hub := newEventHub()
+	all := hub.subscribe(nil)
+	other := hub.subscribe([]string{"other"})
+
+	hub.publish(Event{Event: EventScanComplete})
+
+	assert.Equal(t, EventScanComplete, (<-all.events).Event)
+	assert.Empty(t, other.events)
+
+	hub.unsubscribe(all)
+	hub.unsubscribe(all)
+	_, ok := <-all.events
+	assert.False(t, ok)
+
+	// full subscriber does not block publishing
+	for i := 0; i < eventBuffer+1; i++ {
+		hub.publish(Event{Event: "other"})
+	}
+	assert.Len(t, other.events, eventBuffer)
+}
+
+func TestSubscribeScanComplete(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, server.Start())
+	}()
+	defer server.Stop()
+
+	conn, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	err = sendSocketRequest(conn, Request{ID: "1", Method: "subscribe", Params: map[string]interface{}{
+		"events": []string{EventScanComplete},
+	}})
+	assert.NoError(t, err)
+	resp, err := readSocketResponse(conn)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success, resp.Error)
+
+	err = sendSocketRequest(conn, Request{ID: "2", Method: "scan", Params: map[string]interface{}{"path": "test_dir"}})
+	assert.NoError(t, err)
+
+	// response of the scan request and the event can come in any order
+	var event struct {
+		Event string  `json:"event"`
+		Data  DirInfo `json:"data"`
+	}
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for i := 0; i < 2; i++ {
+		frame, err := readSocketFrame(conn)
+		assert.NoError(t, err)
+		var fields map[string]interface{}
+		assert.NoError(t, json.Unmarshal(frame, &fields))
+		if _, ok := fields["event"]; ok {
+			assert.NoError(t, json.Unmarshal(frame, &event))
+		}
+	}
+
+	assert.Equal(t, EventScanComplete, event.Event)
+	assert.Equal(t, "test_dir", event.Data.Path)
+	assert.Equal(t, int64(7+4096*3), event.Data.Size)
+	assert.Equal(t, uint64(1), event.Data.ScanGeneration)
+	assert.Empty(t, event.Data.Children)
+}
+
+func TestSubscribeWithoutConnection(t *testing.T) {
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	resp := s.processRequest([]byte(`{"id":"1","method":"subscribe"}`))
+	assert.False(t, resp.Success)
+}
+
+func readSocketFrame(conn net.Conn) ([]byte, error) {
+	lengthBytes := make([]byte, 4)
+	if _, err := io.ReadFull(conn, lengthBytes); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(lengthBytes)+1)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return nil, err
+	}
+	return data[:len(data)-1], nil
+}
+
+func TestProgressInterval(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.SetProgressInterval(time.Hour)
+	sub := s.server.events.subscribe([]string{EventProgress})
+	defer s.server.events.unsubscribe(sub)
+
+	s.server.scan("test_dir", scanOptions{})
+
+	// first update is pushed at once, the others are coalesced into the final one
+	assert.LessOrEqual(t, len(sub.events), 2)
+	var last ProgressResponse
+	for len(sub.events) > 0 {
+		last = (<-sub.events).Data.(ProgressResponse)
+	}
+	assert.Equal(t, s.server.progressResponse().ItemCount, last.ItemCount)
+	assert.NotZero(t, last.ItemCount)
+}
@@ -0,0 +1,339 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dundee/gdu/v5/build"
+	"github.com/dundee/gdu/v5/internal/common"
+	"github.com/dundee/gdu/v5/pkg/fs"
+	log "github.com/sirupsen/logrus"
+)
+
+// exportFormats are formats supported by export
+var exportFormats = map[string]bool{"csv": true, "tsv": true, "du": true, "ncdu": true, "sqlite": true}
+
+// checkExportFormat returns error if the format is not supported
+func checkExportFormat(format string) error {
+	if !exportFormats[format] {
+		return fmt.Errorf("unsupported export format %q, use csv, tsv, du, ncdu or sqlite", format)
+	}
+	return nil
+}
+
+// maxResponseExportSize is the largest export sent in the response,
+// larger exports have to be written to a file with output
+const maxResponseExportSize = 16 * 1024 * 1024
+
+// errExportTooLarge is returned once export grows over its size limit
+var errExportTooLarge = errors.New("export is too large for the response, write it to a file with output")
+
+// exportOptions holds settings of an export
+type exportOptions struct {
+	format string
+	// maxDepth limits depth of listed items, negative means unlimited
+	maxDepth int
+	// human formats sizes of du format like du -h
+	human bool
+	// dirsOnly leaves files out of table formats
+	dirsOnly bool
+	// rows counts rows written by table formats, can be nil
+	rows *atomic.Int64
+	// overwrite lets export to file replace existing output
+	overwrite bool
+	// limit is the max size of the export in bytes, zero means unlimited
+	limit int
+}
+
+// ExportResponse represents export written to a file on the server
+type ExportResponse struct {
+	Output string `json:"output"`
+	Rows   int64  `json:"rows,omitempty"`
+}
+
+// exportNcdu serializes the tree into ncdu's JSON export format,
+// the same format gdu writes with the -o flag. It stops once the context is done
+// or the export grows over the limit, zero limit means unlimited.
+func exportNcdu(ctx context.Context, dir fs.Item, limit int) (json.RawMessage, error) {
+	var buff bytes.Buffer
+	if err := writeNcdu(&ctxWriter{ctx: ctx, w: &limitWriter{w: &buff, n: limit}}, dir); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(buff.Bytes()), nil
+}
+
+func writeNcdu(w io.Writer, dir fs.Item) error {
+	header := `[1,2,{"progname":"gdu","progver":"` + build.Version +
+		`","timestamp":` + strconv.FormatInt(time.Now().Unix(), 10) + "},\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	if err := dir.EncodeJSON(w, true); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// exportTable writes rows of path, type, size, usage, item count, mtime and depth
+// of all items down to the max depth, separated by the comma
+func exportTable(w io.Writer, root fs.Item, comma rune, opts exportOptions) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write([]string{"path", "type", "size", "usage", "item_count", "mtime", "depth"}); err != nil {
+		return err
+	}
+	if err := writeTableRows(cw, root, 0, opts); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeTableRows writes row of the item and its children,
+// rows are buffered by the csv writer and flushed to w once the buffer fills up
+func writeTableRows(cw *csv.Writer, item fs.Item, depth int, opts exportOptions) error {
+	if !item.IsDir() && opts.dirsOnly {
+		return nil
+	}
+
+	var mtime int64
+	if !item.GetMtime().IsZero() {
+		mtime = item.GetMtime().Unix()
+	}
+
+	err := cw.Write([]string{
+		item.GetPath(),
+		itemType(item),
+		strconv.FormatInt(item.GetSize(), 10),
+		strconv.FormatInt(item.GetUsage(), 10),
+		strconv.Itoa(item.GetItemCount()),
+		strconv.FormatInt(mtime, 10),
+		strconv.Itoa(depth),
+	})
+	if err != nil {
+		return err
+	}
+	if opts.rows != nil {
+		opts.rows.Add(1)
+	}
+
+	if !item.IsDir() || depth == opts.maxDepth {
+		return nil
+	}
+	for _, child := range item.GetFiles() {
+		if err := writeTableRows(cw, child, depth+1, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportDu writes line of disk usage and path of every dir down to maxDepth
+// in the format of du, subdirs are listed before their parent.
+// Negative maxDepth means unlimited.
+func exportDu(w io.Writer, item fs.Item, maxDepth int, human bool) error {
+	if !item.IsDir() {
+		return nil
+	}
+	if maxDepth != 0 {
+		for _, child := range item.GetFiles() {
+			if err := exportDu(w, child, maxDepth-1, human); err != nil {
+				return err
+			}
+		}
+	}
+
+	size := strconv.FormatInt(item.GetUsage(), 10)
+	if human {
+		size = duSize(item.GetUsage())
+	}
+	_, err := fmt.Fprintf(w, "%s\t%s\n", size, item.GetPath())
+	return err
+}
+
+// duSize formats size the way du -h does, rounding up to one decimal
+// below 10 and to whole units above, so the output can be sorted with sort -h
+func duSize(size int64) string {
+	units := []struct {
+		size   float64
+		suffix string
+	}{
+		{common.Ei, "E"}, {common.Pi, "P"}, {common.Ti, "T"},
+		{common.Gi, "G"}, {common.Mi, "M"}, {common.Ki, "K"},
+	}
+
+	for _, unit := range units {
+		if float64(size) < unit.size {
+			continue
+		}
+		value := float64(size) / unit.size
+		if value < 10 {
+			value = math.Ceil(value*10) / 10
+			if value < 10 {
+				return strconv.FormatFloat(value, 'f', 1, 64) + unit.suffix
+			}
+		}
+		return strconv.FormatFloat(math.Ceil(value), 'f', 0, 64) + unit.suffix
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// writeExport writes the tree in format of the options
+func writeExport(w io.Writer, root fs.Item, opts exportOptions) error {
+	switch opts.format {
+	case "ncdu":
+		return writeNcdu(w, root)
+	case "csv":
+		return exportTable(w, root, ',', opts)
+	case "tsv":
+		return exportTable(w, root, '\t', opts)
+	case "du":
+		return exportDu(w, root, opts.maxDepth, opts.human)
+	case "sqlite":
+		return errors.New("sqlite export can only be written to output file")
+	default:
+		return checkExportFormat(opts.format)
+	}
+}
+
+// export serializes the tree in format of the options,
+// it stops once the context is done or the export grows over the limit of the options
+func export(ctx context.Context, root fs.Item, opts exportOptions) (interface{}, error) {
+	if opts.format == "ncdu" {
+		return exportNcdu(ctx, root, opts.limit)
+	}
+
+	var buff bytes.Buffer
+	if err := writeExport(&ctxWriter{ctx: ctx, w: &limitWriter{w: &buff, n: opts.limit}}, root, opts); err != nil {
+		return nil, err
+	}
+	return buff.String(), nil
+}
+
+// exportToFile streams the tree to the output file, rows written so far are reported by progress.
+// Only one export to file runs at a time, it can be cancelled by cancelExport or by the context.
+// The export is written to a temporary file next to the output, which is renamed to the output
+// once the export succeeds. Existing output is replaced only if overwrite is set.
+// Rows written are returned also when the export fails.
+func (s *Server) exportToFile(ctx context.Context, output string, root fs.Item, opts exportOptions) (ExportResponse, error) {
+	if err := checkExportFormat(opts.format); err != nil {
+		return ExportResponse{}, err
+	}
+	if !s.exporting.CompareAndSwap(false, true) {
+		return ExportResponse{}, errors.New("export is already running")
+	}
+	defer s.exporting.Store(false)
+	s.exportRows.Store(0)
+	opts.rows = &s.exportRows
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.exportMu.Lock()
+	s.exportCancel = cancel
+	s.exportMu.Unlock()
+	defer func() {
+		s.exportMu.Lock()
+		s.exportCancel = nil
+		s.exportMu.Unlock()
+	}()
+
+	if !opts.overwrite {
+		if _, err := os.Lstat(output); err == nil {
+			return ExportResponse{}, fmt.Errorf("%s already exists", output)
+		} else if !os.IsNotExist(err) {
+			return ExportResponse{}, err
+		}
+	}
+
+	// tree is not changed while it is written
+	s.editMu.RLock()
+	err := writeFileAtomic(output, func(file *os.File) error {
+		if opts.format == "sqlite" {
+			if err := file.Close(); err != nil {
+				return err
+			}
+			return exportSQLite(ctx, file.Name(), root, opts)
+		}
+		return writeExport(&ctxWriter{ctx: ctx, w: file}, root, opts)
+	})
+	s.editMu.RUnlock()
+	return ExportResponse{Output: output, Rows: s.exportRows.Load()}, err
+}
+
+// cancelExport cancels running export to file, false is returned when no export is running
+func (s *Server) cancelExport() bool {
+	s.exportMu.Lock()
+	defer s.exportMu.Unlock()
+	if s.exportCancel == nil {
+		return false
+	}
+	s.exportCancel()
+	return true
+}
+
+// writeFileAtomic writes temporary file in the dir of path by the write function
+// and renames it to path, the temporary file is removed when writing fails.
+// The write function may close the file.
+func writeFileAtomic(path string, write func(*os.File) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+	defer func() {
+		if rmErr := os.Remove(tmp); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+			log.Warnf("Failed to remove temporary file of export: %v", rmErr)
+		}
+	}()
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ctxWriter fails writes once the context is done
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// limitWriter fails writes which would make the output larger than n bytes,
+// zero n means unlimited
+type limitWriter struct {
+	w       io.Writer
+	n       int
+	written int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.n > 0 && w.written+len(p) > w.n {
+		return 0, errExportTooLarge
+	}
+	n, err := w.w.Write(p)
+	w.written += n
+	return n, err
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/dundee/gdu/v5/pkg/analyze"
+	"github.com/dundee/gdu/v5/pkg/fs"
+	"github.com/dundee/gdu/v5/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportNcdu(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	dir := analyze.CreateAnalyzer().AnalyzeDir(
+		"test_dir", func(_, _ string) bool { return false }, false,
+	)
+	dir.UpdateStats(make(fs.HardLinkedItems))
+
+	data, err := exportNcdu(context.Background(), dir, 0)
+	assert.NoError(t, err)
+
+	var parsed []interface{}
+	assert.NoError(t, json.Unmarshal(data, &parsed))
+	assert.Equal(t, float64(1), parsed[0])
+	assert.Equal(t, float64(2), parsed[1])
+	assert.Equal(t, "gdu", parsed[2].(map[string]interface{})["progname"])
+
+	imported, err := report.ReadAnalysis(bytes.NewReader(data))
+	assert.NoError(t, err)
+	imported.UpdateStats(make(fs.HardLinkedItems))
+	assert.Equal(t, "test_dir", imported.GetName())
+	assert.Equal(t, dir.GetItemCount(), imported.GetItemCount())
+	assert.Equal(t, dir.GetUsage(), imported.GetUsage())
+}
+
+func TestExportNcduHardLinks(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "a"), 0o755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "b"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a", "data"), make([]byte, 10000), 0o600))
+	assert.NoError(t, os.Link(filepath.Join(root, "a", "data"), filepath.Join(root, "b", "link")))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "b", "other"), []byte("x"), 0o600))
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan(root, scanOptions{})
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"export","params":{"format":"ncdu"}}`))
+	assert.True(t, resp.Success)
+	data := resp.Data.(json.RawMessage)
+
+	// both links carry the same inode so ncdu counts the file once
+	var inodes []float64
+	var walk func(item interface{})
+	walk = func(item interface{}) {
+		switch v := item.(type) {
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case map[string]interface{}:
+			if v["hlnkc"] == true {
+				inodes = append(inodes, v["ino"].(float64))
+			}
+		}
+	}
+	var parsed []interface{}
+	assert.NoError(t, json.Unmarshal(data, &parsed))
+	walk(parsed[3])
+	assert.Len(t, inodes, 2)
+	assert.Equal(t, inodes[0], inodes[1])
+
+	imported, err := report.ReadAnalysis(bytes.NewReader(data))
+	assert.NoError(t, err)
+	imported.UpdateStats(make(fs.HardLinkedItems))
+	dir := s.server.completedDir
+	assert.Equal(t, dir.GetItemCount(), imported.GetItemCount())
+	assert.Equal(t, dir.GetSize(), imported.GetSize())
+	assert.Equal(t, dir.GetUsage(), imported.GetUsage())
+}
+
+func TestExportCSV(t *testing.T) {
+	root := &analyze.Dir{
+		File:     &analyze.File{Name: "root", Size: 4101, Usage: 8192},
+		BasePath: "/",
+	}
+	nested := &analyze.Dir{File: &analyze.File{Name: "a,b", Parent: root, Size: 4101}}
+	root.AddFile(nested)
+	nested.AddFile(&analyze.File{Name: "file", Parent: nested, Size: 5})
+	root.ItemCount = 3
+	nested.ItemCount = 2
+
+	var buff bytes.Buffer
+	err := exportTable(&buff, root, ',', exportOptions{maxDepth: -1})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "path,type,size,usage,item_count,mtime,depth", lines[0])
+	assert.Equal(t, "/root,dir,4101,8192,3,0,0", lines[1])
+	assert.Equal(t, `"/root/a,b",dir,4101,0,2,0,1`, lines[2])
+	assert.Equal(t, `"/root/a,b/file",file,5,0,1,0,2`, lines[3])
+
+	buff.Reset()
+	err = exportTable(&buff, root, ',', exportOptions{maxDepth: 1})
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(buff.String()), "\n"), 3)
+
+	data, err := export(context.Background(), root, exportOptions{format: "tsv", maxDepth: -1, dirsOnly: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "path\ttype\tsize\tusage\titem_count\tmtime\tdepth\n"+
+		"/root\tdir\t4101\t8192\t3\t0\t0\n"+
+		"/root/a,b\tdir\t4101\t0\t2\t0\t1\n", data)
+
+	_, err = export(context.Background(), root, exportOptions{format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestExportToFile(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "tree.csv")
+	// files are written only where allowed paths let them
+	resp := s.processRequest([]byte(`{"id":"1","method":"export","params":{"format":"csv","output":"` + output + `"}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeForbidden, resp.Code)
+	assert.NoError(t, s.SetAllowedPaths([]string{dir}))
+
+	resp = s.processRequest([]byte(`{"id":"1","method":"export","params":{"format":"csv","output":"` + output + `"}}`))
+	assert.True(t, resp.Success)
+	assert.Equal(t, ExportResponse{Output: output, Rows: 5}, resp.Data)
+
+	data, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 6)
+
+	progress := s.server.progressResponse()
+	assert.False(t, progress.IsExporting)
+	assert.Equal(t, int64(5), progress.ExportedRows)
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"export","params":{"format":"xml","output":"` + output + `"}}`))
+	assert.False(t, resp.Success)
+
+	// existing file is kept unless overwrite is set
+	assert.NoError(t, os.WriteFile(output, []byte("keep"), 0o600))
+	resp = s.processRequest([]byte(`{"id":"2","method":"export","params":{"format":"csv","output":"` + output + `"}}`))
+	assert.False(t, resp.Success)
+	data, err = os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "keep", string(data))
+	resp = s.processRequest([]byte(`{"id":"2","method":"export","params":{"format":"csv","output":"` + output + `","overwrite":true}}`))
+	assert.True(t, resp.Success, resp.Error)
+	data, err = os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 6)
+
+	// failed export leaves neither the output nor its temporary file
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.server.exportToFile(ctx, filepath.Join(dir, "cancelled.csv"), s.server.completedDir, exportOptions{format: "csv"})
+	assert.ErrorIs(t, err, context.Canceled)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	s.readOnly = true
+	resp = s.processRequest([]byte(`{"id":"3","method":"export","params":{"format":"csv","output":"` + output + `"}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeReadOnly, resp.Code)
+}
+
+func TestExportDu(t *testing.T) {
+	root := &analyze.Dir{
+		File:     &analyze.File{Name: "root", Usage: 3 << 20},
+		BasePath: "/",
+	}
+	nested := &analyze.Dir{File: &analyze.File{Name: "nested", Parent: root, Usage: 12 << 10}}
+	root.AddFile(nested)
+	subnested := &analyze.Dir{File: &analyze.File{Name: "subnested", Parent: nested, Usage: 4096}}
+	nested.AddFile(subnested)
+	nested.AddFile(&analyze.File{Name: "file", Parent: nested, Usage: 8192})
+
+	data, err := export(context.Background(), root, exportOptions{format: "du", maxDepth: -1, human: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "4.0K\t/root/nested/subnested\n12K\t/root/nested\n3.0M\t/root\n", data)
+
+	data, err = export(context.Background(), root, exportOptions{format: "du", maxDepth: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "12288\t/root/nested\n3145728\t/root\n", data)
+}
+
+func TestDuSize(t *testing.T) {
+	assert.Equal(t, "0", duSize(0))
+	assert.Equal(t, "1023", duSize(1023))
+	assert.Equal(t, "1.0K", duSize(1024))
+	assert.Equal(t, "1.1K", duSize(1025))
+	assert.Equal(t, "10K", duSize(9*1024+1000))
+	assert.Equal(t, "11K", duSize(10*1024+1))
+	assert.Equal(t, "4.2G", duSize(4200<<20))
+}
+
+func TestExportLimit(t *testing.T) {
+	root := &analyze.Dir{File: &analyze.File{Name: "/root"}, BasePath: "/"}
+	attachItem(root, &analyze.File{Name: "file", Size: 5})
+
+	for _, format := range []string{"csv", "tsv", "du", "ncdu"} {
+		_, err := export(context.Background(), root, exportOptions{format: format, maxDepth: -1, limit: 5})
+		assert.ErrorIs(t, err, errExportTooLarge, format)
+
+		_, err = export(context.Background(), root, exportOptions{format: format, maxDepth: -1, limit: 4096})
+		assert.NoError(t, err, format)
+	}
+}
+
+func TestExportTooLargeForResponse(t *testing.T) {
+	root := &analyze.Dir{File: &analyze.File{Name: "/root"}, BasePath: "/"}
+	name := strings.Repeat("x", 1000)
+	for i := 0; i < maxResponseExportSize/len(name)+1; i++ {
+		attachItem(root, &analyze.File{Name: name + strconv.Itoa(i), Size: int64(i)})
+	}
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.completedDir = root
+
+	for _, req := range []string{
+		`{"id":"1","method":"export","params":{"format":"csv"}}`,
+		`{"id":"2","method":"export_ncdu"}`,
+	} {
+		resp := s.processRequest([]byte(req))
+		assert.False(t, resp.Success)
+		assert.Equal(t, ErrCodeTooLarge, resp.Code)
+		assert.Contains(t, resp.Error, "output")
+	}
+
+	resp := s.processRequest([]byte(`{"id":"3","method":"export","params":{"format":"csv","max_depth":0}}`))
+	assert.True(t, resp.Success)
+}
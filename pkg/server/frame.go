@@ -0,0 +1,55 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// frameHeaderSize is size of the big-endian length prefix of a frame
+const frameHeaderSize = 4
+
+// maxPooledFrame is capacity of frame buffer above which it is not reused,
+// so a single huge response does not keep its memory for the server lifetime
+const maxPooledFrame = 1 << 20
+
+var framePool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// encodeFrame encodes value as a whole frame: length prefix, body and newline,
+// so the frame can be sent by a single write.
+// The buffer should be returned by releaseFrame once it is written.
+func encodeFrame(v interface{}, enc encoding) (*bytes.Buffer, error) {
+	buf := framePool.Get().(*bytes.Buffer)
+	buf.Reset()
+	buf.Write(make([]byte, frameHeaderSize))
+
+	if err := encodeBody(buf, enc, v); err != nil {
+		releaseFrame(buf)
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	// JSON encoder appends the newline ending the frame
+	if enc != encodingJSON {
+		buf.WriteByte('\n')
+	}
+	setFrameLength(buf)
+	return buf, nil
+}
+
+// frameDataLen returns length of body in the frame
+func frameDataLen(buf *bytes.Buffer) int {
+	return buf.Len() - frameHeaderSize - 1
+}
+
+// setFrameLength writes length of body in the frame into its prefix
+func setFrameLength(buf *bytes.Buffer) {
+	binary.BigEndian.PutUint32(buf.Bytes(), uint32(frameDataLen(buf)))
+}
+
+func releaseFrame(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledFrame {
+		framePool.Put(buf)
+	}
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeFrame(t *testing.T) {
+	resp := &Response{ID: "1", Success: true, Data: map[string]string{"path": "<a&b>"}}
+	data, err := json.Marshal(resp)
+	assert.NoError(t, err)
+
+	frame, err := encodeFrame(resp, encodingJSON)
+	assert.NoError(t, err)
+	defer releaseFrame(frame)
+
+	b := frame.Bytes()
+	assert.Equal(t, uint32(len(data)), binary.BigEndian.Uint32(b))
+	assert.Equal(t, data, b[frameHeaderSize:len(b)-1])
+	assert.Equal(t, byte('\n'), b[len(b)-1])
+}
+
+func TestEncodeFrameError(t *testing.T) {
+	_, err := encodeFrame(&Response{Data: make(chan int)}, encodingJSON)
+	assert.ErrorContains(t, err, "failed to marshal response")
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"net"
+	"time"
+
+	gdugrpc "github.com/dundee/gdu/v5/pkg/server/grpc"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// defaultProgressInterval is time between progress messages when the client does not set it
+const defaultProgressInterval = 250 * time.Millisecond
+
+// GRPCServer serves GduService over gRPC, it is a thin adapter executing requests
+// the same way as socket connections, so the business logic stays in one place
+type GRPCServer struct {
+	gdugrpc.UnimplementedGduServiceServer
+
+	addr       string
+	methods    *UnixSocketServer
+	grpcServer *grpc.Server
+}
+
+// NewGRPCServer creates gRPC server listening on addr and sharing state of the socket server.
+// Read-only mode and request timeout of the socket server apply to gRPC requests as well.
+func NewGRPCServer(addr string, socketServer *UnixSocketServer) *GRPCServer {
+	g := &GRPCServer{
+		addr:       addr,
+		methods:    socketServer.gateway(),
+		grpcServer: grpc.NewServer(grpc.MaxRecvMsgSize(maxHTTPBody)),
+	}
+	gdugrpc.RegisterGduServiceServer(g.grpcServer, g)
+	return g
+}
+
+// Start serves gRPC requests until the server is stopped
+func (g *GRPCServer) Start() error {
+	listener, err := net.Listen("tcp", g.addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Serving gRPC on %s", g.addr)
+	return g.Serve(listener)
+}
+
+// Serve serves gRPC requests accepted by the listener
+func (g *GRPCServer) Serve(listener net.Listener) error {
+	return g.grpcServer.Serve(listener)
+}
+
+// Stop stops the server, waiting for running requests
+func (g *GRPCServer) Stop() {
+	g.grpcServer.GracefulStop()
+}
+
+// Scan starts scanning the path
+func (g *GRPCServer) Scan(ctx context.Context, req *gdugrpc.ScanRequest) (*gdugrpc.ScanResponse, error) {
+	params := map[string]interface{}{
+		"path":            req.GetPath(),
+		"concurrency":     int(req.GetConcurrency()),
+		"const_gc":        req.GetConstGc(),
+		"ignore_hidden":   req.GetIgnoreHidden(),
+		"memory_limit":    int(req.GetMemoryLimit()),
+		"track_top_files": int(req.GetTrackTopFiles()),
+		"timeout_sec":     int(req.GetTimeoutSec()),
+		"watch":           req.GetWatch(),
+	}
+	if patterns := req.GetIgnoreFilePatterns(); len(patterns) > 0 {
+		items := make([]interface{}, len(patterns))
+		for i, pattern := range patterns {
+			items[i] = pattern
+		}
+		params["ignore_file_patterns"] = items
+	}
+
+	resp, err := g.call(ctx, "scan", params)
+	if err != nil {
+		return nil, err
+	}
+	return &gdugrpc.ScanResponse{Started: resp.Data.(ScanResponse).Started}, nil
+}
+
+// Progress sends progress of the running scan in intervals, the last message is sent when the scan is not running
+func (g *GRPCServer) Progress(req *gdugrpc.ProgressRequest, stream grpc.ServerStreamingServer[gdugrpc.ProgressResponse]) error {
+	interval := defaultProgressInterval
+	if req.GetIntervalMs() > 0 {
+		interval = time.Duration(req.GetIntervalMs()) * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		progress := g.methods.server.progressResponse()
+		if err := stream.Send(&gdugrpc.ProgressResponse{
+			IsScanning:  progress.IsScanning,
+			CurrentItem: progress.CurrentItemName,
+			ItemCount:   int64(progress.ItemCount),
+			FileCount:   int64(progress.FileCount),
+			DirCount:    int64(progress.DirCount),
+			TotalSize:   progress.TotalSize,
+			TimedOut:    progress.TimedOut,
+		}); err != nil {
+			return err
+		}
+		if !progress.IsScanning {
+			return nil
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cancel cancels the running scan
+func (g *GRPCServer) Cancel(ctx context.Context, _ *gdugrpc.CancelRequest) (*gdugrpc.CancelResponse, error) {
+	if _, err := g.call(ctx, "cancel", nil); err != nil {
+		return nil, err
+	}
+	return &gdugrpc.CancelResponse{Cancelled: true}, nil
+}
+
+// GetDirectory returns dir of the scanned tree
+func (g *GRPCServer) GetDirectory(ctx context.Context, req *gdugrpc.GetDirectoryRequest) (*gdugrpc.DirInfo, error) {
+	params := map[string]interface{}{
+		"depth":         int(req.GetDepth()),
+		"min_size":      int(req.GetMinSize()),
+		"include_times": req.GetIncludeTimes(),
+		"include_owner": req.GetIncludeOwner(),
+	}
+	if req.GetPath() != "" {
+		params["path"] = req.GetPath()
+	}
+
+	resp, err := g.call(ctx, "directory", params)
+	if err != nil {
+		return nil, err
+	}
+	return toGRPCDirInfo(resp.Data.(DirInfo)), nil
+}
+
+// TopFiles returns the largest files of the scanned tree
+func (g *GRPCServer) TopFiles(ctx context.Context, req *gdugrpc.TopFilesRequest) (*gdugrpc.TopFilesResponse, error) {
+	params := map[string]interface{}{}
+	if req.GetCount() != 0 {
+		params["count"] = int(req.GetCount())
+	}
+
+	resp, err := g.call(ctx, "top_files", params)
+	if err != nil {
+		return nil, err
+	}
+	top := resp.Data.(TopFilesResponse)
+	files := make([]*gdugrpc.TopFile, 0, len(top.Files))
+	for _, file := range top.Files {
+		files = append(files, &gdugrpc.TopFile{Path: file.Path, Size: file.Size})
+	}
+	return &gdugrpc.TopFilesResponse{Files: files, Precomputed: top.Precomputed}, nil
+}
+
+// call executes the method until the context of the call is done,
+// failed response is returned as gRPC status error
+func (g *GRPCServer) call(ctx context.Context, method string, params map[string]interface{}) (*Response, error) {
+	remote := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+	c := &connection{logger: log.WithField("remote_addr", remote)}
+
+	resp := g.methods.dispatch(ctx, c, &Request{Method: method, Params: params})
+	if resp.Success {
+		return resp, nil
+	}
+
+	code := codes.Unknown
+	switch resp.Code {
+	case ErrCodeForbidden:
+		code = codes.PermissionDenied
+	case ErrCodeReadOnly:
+		code = codes.FailedPrecondition
+	case ErrCodeTimeout:
+		code = codes.DeadlineExceeded
+	}
+	return nil, status.Error(code, resp.Error)
+}
+
+// toGRPCDirInfo converts DirInfo with its children to the gRPC message
+func toGRPCDirInfo(info DirInfo) *gdugrpc.DirInfo {
+	msg := &gdugrpc.DirInfo{
+		Id:             info.ID,
+		Name:           info.Name,
+		Path:           info.Path,
+		Size:           info.Size,
+		PhysicalSize:   info.PhysicalSize,
+		ItemCount:      int64(info.ItemCount),
+		Flag:           info.Flag,
+		Mtime:          info.Mtime,
+		IsDir:          info.IsDir,
+		Device:         info.Device,
+		Inode:          info.Inode,
+		Atime:          info.Atime,
+		Ctime:          info.Ctime,
+		Uid:            info.UID,
+		Gid:            info.GID,
+		LastUpdated:    info.LastUpdated,
+		Dirty:          info.Dirty,
+		ScanGeneration: info.ScanGeneration,
+		ScannedAt:      info.ScannedAt,
+		Truncated:      info.Truncated,
+		HiddenCount:    int64(info.HiddenCount),
+		HiddenSize:     info.HiddenSize,
+	}
+	for _, child := range info.Children {
+		msg.Children = append(msg.Children, toGRPCDirInfo(child))
+	}
+	return msg
+}
@@ -0,0 +1,999 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: gdu.proto
+
+// Package gdu.v1 defines gRPC transport of the gdu scan server.
+// Messages mirror JSON shapes of the Unix socket protocol.
+
+package gdugrpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ScanRequest struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Path               string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Concurrency        int32                  `protobuf:"varint,2,opt,name=concurrency,proto3" json:"concurrency,omitempty"`
+	ConstGc            bool                   `protobuf:"varint,3,opt,name=const_gc,json=constGc,proto3" json:"const_gc,omitempty"`
+	IgnoreHidden       bool                   `protobuf:"varint,4,opt,name=ignore_hidden,json=ignoreHidden,proto3" json:"ignore_hidden,omitempty"`
+	IgnoreFilePatterns []string               `protobuf:"bytes,5,rep,name=ignore_file_patterns,json=ignoreFilePatterns,proto3" json:"ignore_file_patterns,omitempty"`
+	MemoryLimit        int64                  `protobuf:"varint,6,opt,name=memory_limit,json=memoryLimit,proto3" json:"memory_limit,omitempty"`
+	TrackTopFiles      int32                  `protobuf:"varint,7,opt,name=track_top_files,json=trackTopFiles,proto3" json:"track_top_files,omitempty"`
+	TimeoutSec         int32                  `protobuf:"varint,8,opt,name=timeout_sec,json=timeoutSec,proto3" json:"timeout_sec,omitempty"`
+	Watch              bool                   `protobuf:"varint,9,opt,name=watch,proto3" json:"watch,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *ScanRequest) Reset() {
+	*x = ScanRequest{}
+	mi := &file_gdu_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanRequest) ProtoMessage() {}
+
+func (x *ScanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanRequest.ProtoReflect.Descriptor instead.
+func (*ScanRequest) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ScanRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ScanRequest) GetConcurrency() int32 {
+	if x != nil {
+		return x.Concurrency
+	}
+	return 0
+}
+
+func (x *ScanRequest) GetConstGc() bool {
+	if x != nil {
+		return x.ConstGc
+	}
+	return false
+}
+
+func (x *ScanRequest) GetIgnoreHidden() bool {
+	if x != nil {
+		return x.IgnoreHidden
+	}
+	return false
+}
+
+func (x *ScanRequest) GetIgnoreFilePatterns() []string {
+	if x != nil {
+		return x.IgnoreFilePatterns
+	}
+	return nil
+}
+
+func (x *ScanRequest) GetMemoryLimit() int64 {
+	if x != nil {
+		return x.MemoryLimit
+	}
+	return 0
+}
+
+func (x *ScanRequest) GetTrackTopFiles() int32 {
+	if x != nil {
+		return x.TrackTopFiles
+	}
+	return 0
+}
+
+func (x *ScanRequest) GetTimeoutSec() int32 {
+	if x != nil {
+		return x.TimeoutSec
+	}
+	return 0
+}
+
+func (x *ScanRequest) GetWatch() bool {
+	if x != nil {
+		return x.Watch
+	}
+	return false
+}
+
+type ScanResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Started       bool                   `protobuf:"varint,1,opt,name=started,proto3" json:"started,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScanResponse) Reset() {
+	*x = ScanResponse{}
+	mi := &file_gdu_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanResponse) ProtoMessage() {}
+
+func (x *ScanResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanResponse.ProtoReflect.Descriptor instead.
+func (*ScanResponse) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ScanResponse) GetStarted() bool {
+	if x != nil {
+		return x.Started
+	}
+	return false
+}
+
+type ProgressRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// interval_ms is time between two messages, 250 ms if not set
+	IntervalMs    int32 `protobuf:"varint,1,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProgressRequest) Reset() {
+	*x = ProgressRequest{}
+	mi := &file_gdu_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProgressRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProgressRequest) ProtoMessage() {}
+
+func (x *ProgressRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProgressRequest.ProtoReflect.Descriptor instead.
+func (*ProgressRequest) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ProgressRequest) GetIntervalMs() int32 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+type ProgressResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IsScanning    bool                   `protobuf:"varint,1,opt,name=is_scanning,json=isScanning,proto3" json:"is_scanning,omitempty"`
+	CurrentItem   string                 `protobuf:"bytes,2,opt,name=current_item,json=currentItem,proto3" json:"current_item,omitempty"`
+	ItemCount     int64                  `protobuf:"varint,3,opt,name=item_count,json=itemCount,proto3" json:"item_count,omitempty"`
+	FileCount     int64                  `protobuf:"varint,4,opt,name=file_count,json=fileCount,proto3" json:"file_count,omitempty"`
+	DirCount      int64                  `protobuf:"varint,5,opt,name=dir_count,json=dirCount,proto3" json:"dir_count,omitempty"`
+	TotalSize     int64                  `protobuf:"varint,6,opt,name=total_size,json=totalSize,proto3" json:"total_size,omitempty"`
+	TimedOut      bool                   `protobuf:"varint,7,opt,name=timed_out,json=timedOut,proto3" json:"timed_out,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProgressResponse) Reset() {
+	*x = ProgressResponse{}
+	mi := &file_gdu_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProgressResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProgressResponse) ProtoMessage() {}
+
+func (x *ProgressResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProgressResponse.ProtoReflect.Descriptor instead.
+func (*ProgressResponse) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ProgressResponse) GetIsScanning() bool {
+	if x != nil {
+		return x.IsScanning
+	}
+	return false
+}
+
+func (x *ProgressResponse) GetCurrentItem() string {
+	if x != nil {
+		return x.CurrentItem
+	}
+	return ""
+}
+
+func (x *ProgressResponse) GetItemCount() int64 {
+	if x != nil {
+		return x.ItemCount
+	}
+	return 0
+}
+
+func (x *ProgressResponse) GetFileCount() int64 {
+	if x != nil {
+		return x.FileCount
+	}
+	return 0
+}
+
+func (x *ProgressResponse) GetDirCount() int64 {
+	if x != nil {
+		return x.DirCount
+	}
+	return 0
+}
+
+func (x *ProgressResponse) GetTotalSize() int64 {
+	if x != nil {
+		return x.TotalSize
+	}
+	return 0
+}
+
+func (x *ProgressResponse) GetTimedOut() bool {
+	if x != nil {
+		return x.TimedOut
+	}
+	return false
+}
+
+type CancelRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelRequest) Reset() {
+	*x = CancelRequest{}
+	mi := &file_gdu_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelRequest) ProtoMessage() {}
+
+func (x *CancelRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelRequest.ProtoReflect.Descriptor instead.
+func (*CancelRequest) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{4}
+}
+
+type CancelResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cancelled     bool                   `protobuf:"varint,1,opt,name=cancelled,proto3" json:"cancelled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelResponse) Reset() {
+	*x = CancelResponse{}
+	mi := &file_gdu_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelResponse) ProtoMessage() {}
+
+func (x *CancelResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelResponse.ProtoReflect.Descriptor instead.
+func (*CancelResponse) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CancelResponse) GetCancelled() bool {
+	if x != nil {
+		return x.Cancelled
+	}
+	return false
+}
+
+type GetDirectoryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// path of the dir, the scanned root if empty
+	Path          string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Depth         int32  `protobuf:"varint,2,opt,name=depth,proto3" json:"depth,omitempty"`
+	MinSize       int64  `protobuf:"varint,3,opt,name=min_size,json=minSize,proto3" json:"min_size,omitempty"`
+	IncludeTimes  bool   `protobuf:"varint,4,opt,name=include_times,json=includeTimes,proto3" json:"include_times,omitempty"`
+	IncludeOwner  bool   `protobuf:"varint,5,opt,name=include_owner,json=includeOwner,proto3" json:"include_owner,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDirectoryRequest) Reset() {
+	*x = GetDirectoryRequest{}
+	mi := &file_gdu_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDirectoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDirectoryRequest) ProtoMessage() {}
+
+func (x *GetDirectoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDirectoryRequest.ProtoReflect.Descriptor instead.
+func (*GetDirectoryRequest) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetDirectoryRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *GetDirectoryRequest) GetDepth() int32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *GetDirectoryRequest) GetMinSize() int64 {
+	if x != nil {
+		return x.MinSize
+	}
+	return 0
+}
+
+func (x *GetDirectoryRequest) GetIncludeTimes() bool {
+	if x != nil {
+		return x.IncludeTimes
+	}
+	return false
+}
+
+func (x *GetDirectoryRequest) GetIncludeOwner() bool {
+	if x != nil {
+		return x.IncludeOwner
+	}
+	return false
+}
+
+type DirInfo struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name           string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Path           string                 `protobuf:"bytes,3,opt,name=path,proto3" json:"path,omitempty"`
+	Size           int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	PhysicalSize   int64                  `protobuf:"varint,5,opt,name=physical_size,json=physicalSize,proto3" json:"physical_size,omitempty"`
+	ItemCount      int64                  `protobuf:"varint,6,opt,name=item_count,json=itemCount,proto3" json:"item_count,omitempty"`
+	Flag           string                 `protobuf:"bytes,7,opt,name=flag,proto3" json:"flag,omitempty"`
+	Mtime          int64                  `protobuf:"varint,8,opt,name=mtime,proto3" json:"mtime,omitempty"`
+	IsDir          bool                   `protobuf:"varint,9,opt,name=is_dir,json=isDir,proto3" json:"is_dir,omitempty"`
+	Device         uint64                 `protobuf:"varint,10,opt,name=device,proto3" json:"device,omitempty"`
+	Inode          uint64                 `protobuf:"varint,11,opt,name=inode,proto3" json:"inode,omitempty"`
+	Atime          int64                  `protobuf:"varint,12,opt,name=atime,proto3" json:"atime,omitempty"`
+	Ctime          int64                  `protobuf:"varint,13,opt,name=ctime,proto3" json:"ctime,omitempty"`
+	Uid            *uint32                `protobuf:"varint,14,opt,name=uid,proto3,oneof" json:"uid,omitempty"`
+	Gid            *uint32                `protobuf:"varint,15,opt,name=gid,proto3,oneof" json:"gid,omitempty"`
+	LastUpdated    int64                  `protobuf:"varint,16,opt,name=last_updated,json=lastUpdated,proto3" json:"last_updated,omitempty"`
+	Dirty          bool                   `protobuf:"varint,17,opt,name=dirty,proto3" json:"dirty,omitempty"`
+	ScanGeneration uint64                 `protobuf:"varint,18,opt,name=scan_generation,json=scanGeneration,proto3" json:"scan_generation,omitempty"`
+	ScannedAt      int64                  `protobuf:"varint,19,opt,name=scanned_at,json=scannedAt,proto3" json:"scanned_at,omitempty"`
+	Truncated      bool                   `protobuf:"varint,20,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	HiddenCount    int64                  `protobuf:"varint,21,opt,name=hidden_count,json=hiddenCount,proto3" json:"hidden_count,omitempty"`
+	HiddenSize     int64                  `protobuf:"varint,22,opt,name=hidden_size,json=hiddenSize,proto3" json:"hidden_size,omitempty"`
+	Children       []*DirInfo             `protobuf:"bytes,23,rep,name=children,proto3" json:"children,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *DirInfo) Reset() {
+	*x = DirInfo{}
+	mi := &file_gdu_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DirInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DirInfo) ProtoMessage() {}
+
+func (x *DirInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DirInfo.ProtoReflect.Descriptor instead.
+func (*DirInfo) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DirInfo) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DirInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *DirInfo) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *DirInfo) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *DirInfo) GetPhysicalSize() int64 {
+	if x != nil {
+		return x.PhysicalSize
+	}
+	return 0
+}
+
+func (x *DirInfo) GetItemCount() int64 {
+	if x != nil {
+		return x.ItemCount
+	}
+	return 0
+}
+
+func (x *DirInfo) GetFlag() string {
+	if x != nil {
+		return x.Flag
+	}
+	return ""
+}
+
+func (x *DirInfo) GetMtime() int64 {
+	if x != nil {
+		return x.Mtime
+	}
+	return 0
+}
+
+func (x *DirInfo) GetIsDir() bool {
+	if x != nil {
+		return x.IsDir
+	}
+	return false
+}
+
+func (x *DirInfo) GetDevice() uint64 {
+	if x != nil {
+		return x.Device
+	}
+	return 0
+}
+
+func (x *DirInfo) GetInode() uint64 {
+	if x != nil {
+		return x.Inode
+	}
+	return 0
+}
+
+func (x *DirInfo) GetAtime() int64 {
+	if x != nil {
+		return x.Atime
+	}
+	return 0
+}
+
+func (x *DirInfo) GetCtime() int64 {
+	if x != nil {
+		return x.Ctime
+	}
+	return 0
+}
+
+func (x *DirInfo) GetUid() uint32 {
+	if x != nil && x.Uid != nil {
+		return *x.Uid
+	}
+	return 0
+}
+
+func (x *DirInfo) GetGid() uint32 {
+	if x != nil && x.Gid != nil {
+		return *x.Gid
+	}
+	return 0
+}
+
+func (x *DirInfo) GetLastUpdated() int64 {
+	if x != nil {
+		return x.LastUpdated
+	}
+	return 0
+}
+
+func (x *DirInfo) GetDirty() bool {
+	if x != nil {
+		return x.Dirty
+	}
+	return false
+}
+
+func (x *DirInfo) GetScanGeneration() uint64 {
+	if x != nil {
+		return x.ScanGeneration
+	}
+	return 0
+}
+
+func (x *DirInfo) GetScannedAt() int64 {
+	if x != nil {
+		return x.ScannedAt
+	}
+	return 0
+}
+
+func (x *DirInfo) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *DirInfo) GetHiddenCount() int64 {
+	if x != nil {
+		return x.HiddenCount
+	}
+	return 0
+}
+
+func (x *DirInfo) GetHiddenSize() int64 {
+	if x != nil {
+		return x.HiddenSize
+	}
+	return 0
+}
+
+func (x *DirInfo) GetChildren() []*DirInfo {
+	if x != nil {
+		return x.Children
+	}
+	return nil
+}
+
+type TopFilesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// count of files, 10 if not set
+	Count         int32 `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopFilesRequest) Reset() {
+	*x = TopFilesRequest{}
+	mi := &file_gdu_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopFilesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopFilesRequest) ProtoMessage() {}
+
+func (x *TopFilesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopFilesRequest.ProtoReflect.Descriptor instead.
+func (*TopFilesRequest) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TopFilesRequest) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type TopFile struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Size          int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopFile) Reset() {
+	*x = TopFile{}
+	mi := &file_gdu_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopFile) ProtoMessage() {}
+
+func (x *TopFile) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopFile.ProtoReflect.Descriptor instead.
+func (*TopFile) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *TopFile) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *TopFile) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type TopFilesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Files         []*TopFile             `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	Precomputed   bool                   `protobuf:"varint,2,opt,name=precomputed,proto3" json:"precomputed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopFilesResponse) Reset() {
+	*x = TopFilesResponse{}
+	mi := &file_gdu_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopFilesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopFilesResponse) ProtoMessage() {}
+
+func (x *TopFilesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gdu_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopFilesResponse.ProtoReflect.Descriptor instead.
+func (*TopFilesResponse) Descriptor() ([]byte, []int) {
+	return file_gdu_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *TopFilesResponse) GetFiles() []*TopFile {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+func (x *TopFilesResponse) GetPrecomputed() bool {
+	if x != nil {
+		return x.Precomputed
+	}
+	return false
+}
+
+var File_gdu_proto protoreflect.FileDescriptor
+
+const file_gdu_proto_rawDesc = "" +
+	"\n" +
+	"\tgdu.proto\x12\x06gdu.v1\"\xb7\x02\n" +
+	"\vScanRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12 \n" +
+	"\vconcurrency\x18\x02 \x01(\x05R\vconcurrency\x12\x19\n" +
+	"\bconst_gc\x18\x03 \x01(\bR\aconstGc\x12#\n" +
+	"\rignore_hidden\x18\x04 \x01(\bR\fignoreHidden\x120\n" +
+	"\x14ignore_file_patterns\x18\x05 \x03(\tR\x12ignoreFilePatterns\x12!\n" +
+	"\fmemory_limit\x18\x06 \x01(\x03R\vmemoryLimit\x12&\n" +
+	"\x0ftrack_top_files\x18\a \x01(\x05R\rtrackTopFiles\x12\x1f\n" +
+	"\vtimeout_sec\x18\b \x01(\x05R\n" +
+	"timeoutSec\x12\x14\n" +
+	"\x05watch\x18\t \x01(\bR\x05watch\"(\n" +
+	"\fScanResponse\x12\x18\n" +
+	"\astarted\x18\x01 \x01(\bR\astarted\"2\n" +
+	"\x0fProgressRequest\x12\x1f\n" +
+	"\vinterval_ms\x18\x01 \x01(\x05R\n" +
+	"intervalMs\"\xed\x01\n" +
+	"\x10ProgressResponse\x12\x1f\n" +
+	"\vis_scanning\x18\x01 \x01(\bR\n" +
+	"isScanning\x12!\n" +
+	"\fcurrent_item\x18\x02 \x01(\tR\vcurrentItem\x12\x1d\n" +
+	"\n" +
+	"item_count\x18\x03 \x01(\x03R\titemCount\x12\x1d\n" +
+	"\n" +
+	"file_count\x18\x04 \x01(\x03R\tfileCount\x12\x1b\n" +
+	"\tdir_count\x18\x05 \x01(\x03R\bdirCount\x12\x1d\n" +
+	"\n" +
+	"total_size\x18\x06 \x01(\x03R\ttotalSize\x12\x1b\n" +
+	"\ttimed_out\x18\a \x01(\bR\btimedOut\"\x0f\n" +
+	"\rCancelRequest\".\n" +
+	"\x0eCancelResponse\x12\x1c\n" +
+	"\tcancelled\x18\x01 \x01(\bR\tcancelled\"\xa4\x01\n" +
+	"\x13GetDirectoryRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x14\n" +
+	"\x05depth\x18\x02 \x01(\x05R\x05depth\x12\x19\n" +
+	"\bmin_size\x18\x03 \x01(\x03R\aminSize\x12#\n" +
+	"\rinclude_times\x18\x04 \x01(\bR\fincludeTimes\x12#\n" +
+	"\rinclude_owner\x18\x05 \x01(\bR\fincludeOwner\"\x82\x05\n" +
+	"\aDirInfo\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04path\x18\x03 \x01(\tR\x04path\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\x12#\n" +
+	"\rphysical_size\x18\x05 \x01(\x03R\fphysicalSize\x12\x1d\n" +
+	"\n" +
+	"item_count\x18\x06 \x01(\x03R\titemCount\x12\x12\n" +
+	"\x04flag\x18\a \x01(\tR\x04flag\x12\x14\n" +
+	"\x05mtime\x18\b \x01(\x03R\x05mtime\x12\x15\n" +
+	"\x06is_dir\x18\t \x01(\bR\x05isDir\x12\x16\n" +
+	"\x06device\x18\n" +
+	" \x01(\x04R\x06device\x12\x14\n" +
+	"\x05inode\x18\v \x01(\x04R\x05inode\x12\x14\n" +
+	"\x05atime\x18\f \x01(\x03R\x05atime\x12\x14\n" +
+	"\x05ctime\x18\r \x01(\x03R\x05ctime\x12\x15\n" +
+	"\x03uid\x18\x0e \x01(\rH\x00R\x03uid\x88\x01\x01\x12\x15\n" +
+	"\x03gid\x18\x0f \x01(\rH\x01R\x03gid\x88\x01\x01\x12!\n" +
+	"\flast_updated\x18\x10 \x01(\x03R\vlastUpdated\x12\x14\n" +
+	"\x05dirty\x18\x11 \x01(\bR\x05dirty\x12'\n" +
+	"\x0fscan_generation\x18\x12 \x01(\x04R\x0escanGeneration\x12\x1d\n" +
+	"\n" +
+	"scanned_at\x18\x13 \x01(\x03R\tscannedAt\x12\x1c\n" +
+	"\ttruncated\x18\x14 \x01(\bR\ttruncated\x12!\n" +
+	"\fhidden_count\x18\x15 \x01(\x03R\vhiddenCount\x12\x1f\n" +
+	"\vhidden_size\x18\x16 \x01(\x03R\n" +
+	"hiddenSize\x12+\n" +
+	"\bchildren\x18\x17 \x03(\v2\x0f.gdu.v1.DirInfoR\bchildrenB\x06\n" +
+	"\x04_uidB\x06\n" +
+	"\x04_gid\"'\n" +
+	"\x0fTopFilesRequest\x12\x14\n" +
+	"\x05count\x18\x01 \x01(\x05R\x05count\"1\n" +
+	"\aTopFile\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\"[\n" +
+	"\x10TopFilesResponse\x12%\n" +
+	"\x05files\x18\x01 \x03(\v2\x0f.gdu.v1.TopFileR\x05files\x12 \n" +
+	"\vprecomputed\x18\x02 \x01(\bR\vprecomputed2\xb6\x02\n" +
+	"\n" +
+	"GduService\x121\n" +
+	"\x04Scan\x12\x13.gdu.v1.ScanRequest\x1a\x14.gdu.v1.ScanResponse\x12?\n" +
+	"\bProgress\x12\x17.gdu.v1.ProgressRequest\x1a\x18.gdu.v1.ProgressResponse0\x01\x127\n" +
+	"\x06Cancel\x12\x15.gdu.v1.CancelRequest\x1a\x16.gdu.v1.CancelResponse\x12<\n" +
+	"\fGetDirectory\x12\x1b.gdu.v1.GetDirectoryRequest\x1a\x0f.gdu.v1.DirInfo\x12=\n" +
+	"\bTopFiles\x12\x17.gdu.v1.TopFilesRequest\x1a\x18.gdu.v1.TopFilesResponseB2Z0github.com/dundee/gdu/v5/pkg/server/grpc;gdugrpcb\x06proto3"
+
+var (
+	file_gdu_proto_rawDescOnce sync.Once
+	file_gdu_proto_rawDescData []byte
+)
+
+func file_gdu_proto_rawDescGZIP() []byte {
+	file_gdu_proto_rawDescOnce.Do(func() {
+		file_gdu_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_gdu_proto_rawDesc), len(file_gdu_proto_rawDesc)))
+	})
+	return file_gdu_proto_rawDescData
+}
+
+var file_gdu_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_gdu_proto_goTypes = []any{
+	(*ScanRequest)(nil),         // 0: gdu.v1.ScanRequest
+	(*ScanResponse)(nil),        // 1: gdu.v1.ScanResponse
+	(*ProgressRequest)(nil),     // 2: gdu.v1.ProgressRequest
+	(*ProgressResponse)(nil),    // 3: gdu.v1.ProgressResponse
+	(*CancelRequest)(nil),       // 4: gdu.v1.CancelRequest
+	(*CancelResponse)(nil),      // 5: gdu.v1.CancelResponse
+	(*GetDirectoryRequest)(nil), // 6: gdu.v1.GetDirectoryRequest
+	(*DirInfo)(nil),             // 7: gdu.v1.DirInfo
+	(*TopFilesRequest)(nil),     // 8: gdu.v1.TopFilesRequest
+	(*TopFile)(nil),             // 9: gdu.v1.TopFile
+	(*TopFilesResponse)(nil),    // 10: gdu.v1.TopFilesResponse
+}
+var file_gdu_proto_depIdxs = []int32{
+	7,  // 0: gdu.v1.DirInfo.children:type_name -> gdu.v1.DirInfo
+	9,  // 1: gdu.v1.TopFilesResponse.files:type_name -> gdu.v1.TopFile
+	0,  // 2: gdu.v1.GduService.Scan:input_type -> gdu.v1.ScanRequest
+	2,  // 3: gdu.v1.GduService.Progress:input_type -> gdu.v1.ProgressRequest
+	4,  // 4: gdu.v1.GduService.Cancel:input_type -> gdu.v1.CancelRequest
+	6,  // 5: gdu.v1.GduService.GetDirectory:input_type -> gdu.v1.GetDirectoryRequest
+	8,  // 6: gdu.v1.GduService.TopFiles:input_type -> gdu.v1.TopFilesRequest
+	1,  // 7: gdu.v1.GduService.Scan:output_type -> gdu.v1.ScanResponse
+	3,  // 8: gdu.v1.GduService.Progress:output_type -> gdu.v1.ProgressResponse
+	5,  // 9: gdu.v1.GduService.Cancel:output_type -> gdu.v1.CancelResponse
+	7,  // 10: gdu.v1.GduService.GetDirectory:output_type -> gdu.v1.DirInfo
+	10, // 11: gdu.v1.GduService.TopFiles:output_type -> gdu.v1.TopFilesResponse
+	7,  // [7:12] is the sub-list for method output_type
+	2,  // [2:7] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_gdu_proto_init() }
+func file_gdu_proto_init() {
+	if File_gdu_proto != nil {
+		return
+	}
+	file_gdu_proto_msgTypes[7].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_gdu_proto_rawDesc), len(file_gdu_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_gdu_proto_goTypes,
+		DependencyIndexes: file_gdu_proto_depIdxs,
+		MessageInfos:      file_gdu_proto_msgTypes,
+	}.Build()
+	File_gdu_proto = out.File
+	file_gdu_proto_goTypes = nil
+	file_gdu_proto_depIdxs = nil
+}
@@ -0,0 +1,290 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: gdu.proto
+
+// Package gdu.v1 defines gRPC transport of the gdu scan server.
+// Messages mirror JSON shapes of the Unix socket protocol.
+
+package gdugrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	GduService_Scan_FullMethodName         = "/gdu.v1.GduService/Scan"
+	GduService_Progress_FullMethodName     = "/gdu.v1.GduService/Progress"
+	GduService_Cancel_FullMethodName       = "/gdu.v1.GduService/Cancel"
+	GduService_GetDirectory_FullMethodName = "/gdu.v1.GduService/GetDirectory"
+	GduService_TopFiles_FullMethodName     = "/gdu.v1.GduService/TopFiles"
+)
+
+// GduServiceClient is the client API for GduService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GduServiceClient interface {
+	// Scan starts scanning the path, use Progress to follow it
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanResponse, error)
+	// Progress streams progress of the running scan until it finishes
+	Progress(ctx context.Context, in *ProgressRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProgressResponse], error)
+	// Cancel cancels the running scan, the last completed tree is kept
+	Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error)
+	// GetDirectory returns dir of the scanned tree with children up to the depth
+	GetDirectory(ctx context.Context, in *GetDirectoryRequest, opts ...grpc.CallOption) (*DirInfo, error)
+	// TopFiles returns the largest files of the scanned tree
+	TopFiles(ctx context.Context, in *TopFilesRequest, opts ...grpc.CallOption) (*TopFilesResponse, error)
+}
+
+type gduServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGduServiceClient(cc grpc.ClientConnInterface) GduServiceClient {
+	return &gduServiceClient{cc}
+}
+
+func (c *gduServiceClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ScanResponse)
+	err := c.cc.Invoke(ctx, GduService_Scan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gduServiceClient) Progress(ctx context.Context, in *ProgressRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProgressResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GduService_ServiceDesc.Streams[0], GduService_Progress_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ProgressRequest, ProgressResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GduService_ProgressClient = grpc.ServerStreamingClient[ProgressResponse]
+
+func (c *gduServiceClient) Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelResponse)
+	err := c.cc.Invoke(ctx, GduService_Cancel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gduServiceClient) GetDirectory(ctx context.Context, in *GetDirectoryRequest, opts ...grpc.CallOption) (*DirInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DirInfo)
+	err := c.cc.Invoke(ctx, GduService_GetDirectory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gduServiceClient) TopFiles(ctx context.Context, in *TopFilesRequest, opts ...grpc.CallOption) (*TopFilesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TopFilesResponse)
+	err := c.cc.Invoke(ctx, GduService_TopFiles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GduServiceServer is the server API for GduService service.
+// All implementations must embed UnimplementedGduServiceServer
+// for forward compatibility.
+type GduServiceServer interface {
+	// Scan starts scanning the path, use Progress to follow it
+	Scan(context.Context, *ScanRequest) (*ScanResponse, error)
+	// Progress streams progress of the running scan until it finishes
+	Progress(*ProgressRequest, grpc.ServerStreamingServer[ProgressResponse]) error
+	// Cancel cancels the running scan, the last completed tree is kept
+	Cancel(context.Context, *CancelRequest) (*CancelResponse, error)
+	// GetDirectory returns dir of the scanned tree with children up to the depth
+	GetDirectory(context.Context, *GetDirectoryRequest) (*DirInfo, error)
+	// TopFiles returns the largest files of the scanned tree
+	TopFiles(context.Context, *TopFilesRequest) (*TopFilesResponse, error)
+	mustEmbedUnimplementedGduServiceServer()
+}
+
+// UnimplementedGduServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGduServiceServer struct{}
+
+func (UnimplementedGduServiceServer) Scan(context.Context, *ScanRequest) (*ScanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedGduServiceServer) Progress(*ProgressRequest, grpc.ServerStreamingServer[ProgressResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Progress not implemented")
+}
+func (UnimplementedGduServiceServer) Cancel(context.Context, *CancelRequest) (*CancelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cancel not implemented")
+}
+func (UnimplementedGduServiceServer) GetDirectory(context.Context, *GetDirectoryRequest) (*DirInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDirectory not implemented")
+}
+func (UnimplementedGduServiceServer) TopFiles(context.Context, *TopFilesRequest) (*TopFilesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TopFiles not implemented")
+}
+func (UnimplementedGduServiceServer) mustEmbedUnimplementedGduServiceServer() {}
+func (UnimplementedGduServiceServer) testEmbeddedByValue()                    {}
+
+// UnsafeGduServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GduServiceServer will
+// result in compilation errors.
+type UnsafeGduServiceServer interface {
+	mustEmbedUnimplementedGduServiceServer()
+}
+
+func RegisterGduServiceServer(s grpc.ServiceRegistrar, srv GduServiceServer) {
+	// If the following call pancis, it indicates UnimplementedGduServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&GduService_ServiceDesc, srv)
+}
+
+func _GduService_Scan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GduServiceServer).Scan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GduService_Scan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GduServiceServer).Scan(ctx, req.(*ScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GduService_Progress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ProgressRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GduServiceServer).Progress(m, &grpc.GenericServerStream[ProgressRequest, ProgressResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GduService_ProgressServer = grpc.ServerStreamingServer[ProgressResponse]
+
+func _GduService_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GduServiceServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GduService_Cancel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GduServiceServer).Cancel(ctx, req.(*CancelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GduService_GetDirectory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDirectoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GduServiceServer).GetDirectory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GduService_GetDirectory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GduServiceServer).GetDirectory(ctx, req.(*GetDirectoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GduService_TopFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TopFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GduServiceServer).TopFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GduService_TopFiles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GduServiceServer).TopFiles(ctx, req.(*TopFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// GduService_ServiceDesc is the grpc.ServiceDesc for GduService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GduService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gdu.v1.GduService",
+	HandlerType: (*GduServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Scan",
+			Handler:    _GduService_Scan_Handler,
+		},
+		{
+			MethodName: "Cancel",
+			Handler:    _GduService_Cancel_Handler,
+		},
+		{
+			MethodName: "GetDirectory",
+			Handler:    _GduService_GetDirectory_Handler,
+		},
+		{
+			MethodName: "TopFiles",
+			Handler:    _GduService_TopFiles_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Progress",
+			Handler:       _GduService_Progress_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gdu.proto",
+}
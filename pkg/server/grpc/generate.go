@@ -0,0 +1,4 @@
+// Package gdugrpc contains gRPC service definition of the scan server and code generated from it
+package gdugrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gdu.proto
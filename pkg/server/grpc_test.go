@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	gdugrpc "github.com/dundee/gdu/v5/pkg/server/grpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCServer(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	srv := NewServer(false, "")
+	assert.NoError(t, srv.setAllowedPaths([]string{"test_dir"}))
+	g := NewGRPCServer("", &UnixSocketServer{server: srv})
+	listener := bufconn.Listen(1 << 20)
+	go func() {
+		assert.NoError(t, g.Serve(listener))
+	}()
+	defer g.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := gdugrpc.NewGduServiceClient(conn)
+	ctx := context.Background()
+
+	_, err = client.GetDirectory(ctx, &gdugrpc.GetDirectoryRequest{})
+	assert.Equal(t, codes.Unknown, status.Code(err))
+
+	_, err = client.Scan(ctx, &gdugrpc.ScanRequest{Path: "/etc"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	scan, err := client.Scan(ctx, &gdugrpc.ScanRequest{Path: "test_dir", IgnoreFilePatterns: []string{"*.log"}})
+	assert.NoError(t, err)
+	assert.True(t, scan.GetStarted())
+
+	// stream ends with progress of finished scan
+	stream, err := client.Progress(ctx, &gdugrpc.ProgressRequest{IntervalMs: 10})
+	assert.NoError(t, err)
+	var last *gdugrpc.ProgressResponse
+	for {
+		progress, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		last = progress
+	}
+	assert.NotNil(t, last)
+	assert.False(t, last.GetIsScanning())
+
+	// scan may not have started yet when the stream began
+	var dir *gdugrpc.DirInfo
+	assert.Eventually(t, func() bool {
+		dir, err = client.GetDirectory(ctx, &gdugrpc.GetDirectoryRequest{Path: "test_dir/nested", Depth: 2})
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "nested", dir.GetName())
+	assert.Len(t, dir.GetChildren(), 2)
+	assert.Equal(t, int64(7+4096*2), dir.GetSize())
+
+	top, err := client.TopFiles(ctx, &gdugrpc.TopFilesRequest{Count: 1})
+	assert.NoError(t, err)
+	assert.Len(t, top.GetFiles(), 1)
+	assert.Equal(t, int64(5), top.GetFiles()[0].GetSize())
+
+	cancelled, err := client.Cancel(ctx, &gdugrpc.CancelRequest{})
+	assert.NoError(t, err)
+	assert.True(t, cancelled.GetCancelled())
+}
+
+func TestGRPCServerCallContext(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	socketServer := &UnixSocketServer{server: NewServer(false, "")}
+	socketServer.server.scan("test_dir", scanOptions{})
+	g := NewGRPCServer("", socketServer)
+
+	_, err := g.call(context.Background(), "tree", nil)
+	assert.NoError(t, err)
+
+	// deadline of the call stops the method
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = g.call(ctx, "tree", nil)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// read-only mode of the socket server applies to gRPC requests
+	socketServer.readOnly = true
+	_, err = NewGRPCServer("", socketServer).call(context.Background(), "move", nil)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
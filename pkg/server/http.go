@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxHTTPBody is the largest request body accepted by the HTTP server
+const maxHTTPBody = 1 << 20
+
+// HTTPServer serves scanning and browsing methods of Server over HTTP,
+// responses have the same JSON shapes as data of Unix socket responses.
+// All methods of the socket protocol are available over WebSocket on /ws.
+type HTTPServer struct {
+	// methods are executed the same way as requests of socket connections
+	methods    *UnixSocketServer
+	httpServer *http.Server
+}
+
+// HTTPError is body of failed HTTP request
+type HTTPError struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// NewHTTPServer creates HTTP server listening on addr and sharing state of the socket server,
+// so both run together using the same Server. Read-only mode and request timeout
+// of the socket server apply to HTTP and WebSocket requests as well.
+func NewHTTPServer(addr string, socketServer *UnixSocketServer) *HTTPServer {
+	h := &HTTPServer{methods: socketServer.gateway()}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /scan", h.handleScan)
+	mux.HandleFunc("GET /progress", h.handleMethod("progress"))
+	mux.HandleFunc("POST /cancel", h.handleMethod("cancel"))
+	mux.HandleFunc("GET /directory", h.handleDirectory)
+	mux.HandleFunc("GET /healthz", h.handleHealth)
+	mux.HandleFunc("GET /ws", h.handleWebSocket)
+
+	h.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    1 << 16,
+	}
+	return h
+}
+
+// SetRateLimit limits rate of requests of every WebSocket connection, zero rate disables limiting.
+// It has to be called before Start.
+func (h *HTTPServer) SetRateLimit(limit RateLimit) error {
+	return h.methods.SetRateLimit(limit)
+}
+
+// Handler returns HTTP handler of the server
+func (h *HTTPServer) Handler() http.Handler {
+	return h.httpServer.Handler
+}
+
+// Start serves HTTP requests until the server is stopped
+func (h *HTTPServer) Start() error {
+	log.Printf("Serving HTTP on %s", h.httpServer.Addr)
+	if err := h.httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop stops the HTTP server, waiting for running requests up to 5 seconds
+func (h *HTTPServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return h.httpServer.Shutdown(ctx)
+}
+
+// handleScan starts scan with params given as JSON object in the body
+func (h *HTTPServer) handleScan(w http.ResponseWriter, r *http.Request) {
+	var params map[string]interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHTTPBody)).Decode(&params); err != nil {
+		writeHTTPJSON(w, http.StatusBadRequest, HTTPError{Error: "Invalid JSON: " + err.Error()})
+		return
+	}
+	h.serve(w, r, "scan", params)
+}
+
+// handleDirectory returns tree of the dir given by path, depth and human query parameters
+func (h *HTTPServer) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := map[string]interface{}{}
+	if path := query.Get("path"); path != "" {
+		params["path"] = path
+	}
+	if value := query.Get("depth"); value != "" {
+		depth, err := strconv.Atoi(value)
+		if err != nil {
+			writeHTTPJSON(w, http.StatusBadRequest, HTTPError{Error: "parameter depth must be integer"})
+			return
+		}
+		params["depth"] = depth
+	}
+	if value := query.Get("human"); value != "" {
+		human, err := strconv.ParseBool(value)
+		if err != nil {
+			writeHTTPJSON(w, http.StatusBadRequest, HTTPError{Error: "parameter human must be boolean"})
+			return
+		}
+		params["human"] = human
+	}
+	h.serve(w, r, "directory", params)
+}
+
+// handleMethod returns handler of method without params
+func (h *HTTPServer) handleMethod(method string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, method, nil)
+	}
+}
+
+func (h *HTTPServer) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeHTTPJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// serve executes method and writes data of the response, or error with status matching its code
+func (h *HTTPServer) serve(w http.ResponseWriter, r *http.Request, method string, params map[string]interface{}) {
+	c := &connection{logger: log.WithField("remote_addr", r.RemoteAddr)}
+	resp := h.methods.dispatch(r.Context(), c, &Request{Method: method, Params: params})
+	if resp.Success {
+		writeHTTPJSON(w, http.StatusOK, resp.Data)
+		return
+	}
+
+	status := http.StatusBadRequest
+	if resp.Code == ErrCodeForbidden {
+		status = http.StatusForbidden
+	}
+	writeHTTPJSON(w, status, HTTPError{Error: resp.Error, Code: resp.Code})
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debugf("Error writing HTTP response: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func getHTTPJSON(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	return resp.StatusCode
+}
+
+func TestHTTPServer(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	srv := NewServer(false, "")
+	assert.NoError(t, srv.setAllowedPaths([]string{"test_dir"}))
+	ts := httptest.NewServer(NewHTTPServer("", &UnixSocketServer{server: srv}).Handler())
+	defer ts.Close()
+
+	var health map[string]string
+	assert.Equal(t, http.StatusOK, getHTTPJSON(t, ts.URL+"/healthz", &health))
+	assert.Equal(t, "ok", health["status"])
+
+	var failure HTTPError
+	assert.Equal(t, http.StatusBadRequest, getHTTPJSON(t, ts.URL+"/directory", &failure))
+	assert.Equal(t, "No scan completed", failure.Error)
+
+	resp, err := http.Post(ts.URL+"/scan", "application/json", strings.NewReader(`{"path":"/etc"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&failure))
+	assert.Equal(t, ErrCodeForbidden, failure.Code)
+	resp.Body.Close()
+
+	resp, err = http.Post(ts.URL+"/scan", "application/json", strings.NewReader(`{"path":"test_dir"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.Eventually(t, func() bool {
+		var progress ProgressResponse
+		getHTTPJSON(t, ts.URL+"/progress", &progress)
+		return !progress.IsScanning && srv.findItem("test_dir") != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var info DirInfo
+	assert.Equal(t, http.StatusOK, getHTTPJSON(t, ts.URL+"/directory?path=test_dir/nested&depth=1", &info))
+	assert.Equal(t, "nested", info.Name)
+	assert.Len(t, info.Children, 2)
+
+	assert.Equal(t, http.StatusBadRequest, getHTTPJSON(t, ts.URL+"/directory?depth=x", &failure))
+
+	resp, err = http.Get(ts.URL + "/scan")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestHTTPAndSocketShareServer(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	socketServer, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, socketServer.Start())
+	}()
+	defer socketServer.Stop()
+
+	ts := httptest.NewServer(NewHTTPServer("", socketServer).Handler())
+	defer ts.Close()
+
+	conn, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				var progress ProgressResponse
+				assert.Equal(t, http.StatusOK, getHTTPJSON(t, ts.URL+"/progress", &progress))
+				var info map[string]interface{}
+				getHTTPJSON(t, ts.URL+"/directory?depth=2", &info)
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		socketServer.server.scan("test_dir", scanOptions{})
+		assert.NoError(t, sendSocketRequest(conn, Request{ID: "d", Method: "directory"}))
+		resp, err := readSocketResponse(conn)
+		assert.NoError(t, err)
+		assert.True(t, resp.Success)
+	}
+	close(done)
+	wg.Wait()
+
+	// scan started over HTTP is seen by socket clients
+	httpResp, err := http.Post(ts.URL+"/scan", "application/json", strings.NewReader(`{"path":"test_dir/nested"}`))
+	assert.NoError(t, err)
+	httpResp.Body.Close()
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, sendSocketRequest(conn, Request{ID: "d", Method: "directory"}))
+		resp, err := readSocketResponse(conn)
+		assert.NoError(t, err)
+		data, _ := resp.Data.(map[string]interface{})
+		return data["name"] == "nested"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHTTPServerPolicy(t *testing.T) {
+	socketServer := &UnixSocketServer{server: NewServer(false, ""), readOnly: true}
+	socketServer.SetRequestTimeout(time.Millisecond)
+
+	// HTTP requests are limited the same as requests of the socket
+	h := NewHTTPServer("", socketServer)
+	assert.True(t, h.methods.readOnly)
+	assert.Equal(t, time.Millisecond, h.methods.requestTimeout(&Request{}))
+	assert.Equal(t, time.Millisecond, h.methods.requestTimeout(&Request{TimeoutMs: 1000}))
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dundee/gdu/v5/internal/common"
+)
+
+// FilePattern describes how a file ignore pattern is matched
+type FilePattern struct {
+	Pattern string `json:"pattern"`
+	// MatchOn is "path" for patterns containing a path separator, "name" otherwise
+	MatchOn string `json:"match_on"`
+}
+
+// parseFilePatterns validates glob patterns and decides
+// whether they are matched against file name or full path
+func parseFilePatterns(patterns []string) ([]FilePattern, error) {
+	parsed := make([]FilePattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+
+		matchOn := "name"
+		if strings.ContainsRune(pattern, filepath.Separator) {
+			matchOn = "path"
+		}
+		parsed = append(parsed, FilePattern{Pattern: pattern, MatchOn: matchOn})
+	}
+	return parsed, nil
+}
+
+// createFileIgnoreFunc returns function matching files against the patterns,
+// nil is returned when there are no patterns
+func createFileIgnoreFunc(patterns []FilePattern) common.ShouldFileBeIgnored {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	return func(name, path string) bool {
+		for _, p := range patterns {
+			subject := name
+			if p.MatchOn == "path" {
+				subject = path
+			}
+			if ok, _ := filepath.Match(p.Pattern, subject); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
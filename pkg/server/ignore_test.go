@@ -0,0 +1,55 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilePatterns(t *testing.T) {
+	patterns, err := parseFilePatterns([]string{"*.log", "/var/tmp/core.*"})
+	assert.NoError(t, err)
+	assert.Equal(t, []FilePattern{
+		{Pattern: "*.log", MatchOn: "name"},
+		{Pattern: "/var/tmp/core.*", MatchOn: "path"},
+	}, patterns)
+
+	_, err = parseFilePatterns([]string{"[a-"})
+	assert.Error(t, err)
+}
+
+func TestCreateFileIgnoreFunc(t *testing.T) {
+	assert.Nil(t, createFileIgnoreFunc(nil))
+
+	patterns, err := parseFilePatterns([]string{"*.log", "/var/tmp/core.*"})
+	assert.NoError(t, err)
+	ignore := createFileIgnoreFunc(patterns)
+
+	assert.True(t, ignore("app.log", "/home/app/app.log"))
+	assert.True(t, ignore("core.123", "/var/tmp/core.123"))
+	assert.False(t, ignore("core.123", "/home/app/core.123"))
+	assert.False(t, ignore("app.txt", "/home/app/app.txt"))
+}
+
+func TestApplyIgnoreDefaults(t *testing.T) {
+	s := NewServer(false, "")
+	s.defaultIgnoreHidden = true
+	s.defaultIgnoreFiles = []FilePattern{{Pattern: "*.tmp", MatchOn: "name"}}
+
+	opts, err := getScanOptions(nil)
+	assert.NoError(t, err)
+	s.applyIgnoreDefaults(&opts, nil)
+	assert.True(t, opts.ignoreHidden)
+	assert.Equal(t, s.defaultIgnoreFiles, opts.ignoreFiles)
+
+	// options given by the request take precedence
+	params := map[string]interface{}{
+		"ignore_hidden":        false,
+		"ignore_file_patterns": []interface{}{"*.log"},
+	}
+	opts, err = getScanOptions(params)
+	assert.NoError(t, err)
+	s.applyIgnoreDefaults(&opts, params)
+	assert.False(t, opts.ignoreHidden)
+	assert.Equal(t, []FilePattern{{Pattern: "*.log", MatchOn: "name"}}, opts.ignoreFiles)
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// jsonrpcVersion is value of the jsonrpc member of JSON-RPC 2.0 messages
+const jsonrpcVersion = "2.0"
+
+// JSON-RPC error numbers. Errors with structured code of the native protocol
+// use numbers from the range reserved for implementation-defined server errors,
+// the native code is kept in data of the error.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+	rpcForbidden      = -32001
+	rpcReadOnly       = -32002
+	rpcDuplicateID    = -32003
+	rpcTimeout        = -32004
+	rpcRateLimited    = -32005
+)
+
+// rpcErrorNumbers maps error codes of the native protocol to JSON-RPC error numbers
+var rpcErrorNumbers = map[string]int{
+	ErrCodeUnknownMethod: rpcMethodNotFound,
+	ErrCodeForbidden:     rpcForbidden,
+	ErrCodeReadOnly:      rpcReadOnly,
+	ErrCodeDuplicateID:   rpcDuplicateID,
+	ErrCodeTimeout:       rpcTimeout,
+	ErrCodeRateLimited:   rpcRateLimited,
+}
+
+// rpcRequest is a JSON-RPC 2.0 call, call without id is a notification
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	// TimeoutMs is time budget of the call, extension of JSON-RPC
+	TimeoutMs int64 `json:"timeout_ms,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response, either Result or Error is set
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// rpcNotification is an event pushed to JSON-RPC client
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// isJSONRPC returns true if the request, or any call of the batch, is a JSON-RPC 2.0 call
+func isJSONRPC(data []byte) bool {
+	var probe struct {
+		JSONRPC string `json:"jsonrpc"`
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var calls []json.RawMessage
+		if err := json.Unmarshal(data, &calls); err != nil {
+			return false
+		}
+		for _, call := range calls {
+			if json.Unmarshal(call, &probe) == nil && probe.JSONRPC == jsonrpcVersion {
+				return true
+			}
+		}
+		return false
+	}
+
+	return json.Unmarshal(data, &probe) == nil && probe.JSONRPC == jsonrpcVersion
+}
+
+// serveJSONRPC processes a JSON-RPC call or batch of calls and writes the responses.
+// Nothing is written for notifications. Meta and compression of responses are not available in this mode.
+func (s *UnixSocketServer) serveJSONRPC(c *connection, data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		if resp := s.serveCall(c, data); resp != nil {
+			return c.send(resp)
+		}
+		return nil
+	}
+
+	var calls []json.RawMessage
+	if err := json.Unmarshal(data, &calls); err != nil {
+		return c.send(rpcFailure(nil, rpcParseError, "Parse error: "+err.Error()))
+	}
+	if len(calls) == 0 {
+		return c.send(rpcFailure(nil, rpcInvalidRequest, "Invalid Request: empty batch"))
+	}
+
+	// calls of the batch are all in flight until the responses are sent,
+	// reused id would make the responses ambiguous
+	inFlight := make(map[string]bool, len(calls))
+	responses := make([]*rpcResponse, 0, len(calls))
+	for _, call := range calls {
+		if id := batchCallID(call); id != "" {
+			if inFlight[id] {
+				resp := rpcFailure(json.RawMessage(id), rpcDuplicateID, "Request id is already in flight: "+id)
+				resp.Error.Data = map[string]string{"code": ErrCodeDuplicateID}
+				responses = append(responses, resp)
+				continue
+			}
+			inFlight[id] = true
+		}
+		if resp := s.serveCall(c, call); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return c.send(responses)
+}
+
+// serveCall executes single JSON-RPC call, nil is returned for notifications
+func (s *UnixSocketServer) serveCall(c *connection, data []byte) *rpcResponse {
+	var call rpcRequest
+	if err := json.Unmarshal(data, &call); err != nil {
+		c.logger.Warnf("Invalid JSON-RPC request: %v", err)
+		if !json.Valid(data) {
+			return rpcFailure(nil, rpcParseError, "Parse error: "+err.Error())
+		}
+		return rpcFailure(nil, rpcInvalidRequest, "Invalid Request: "+err.Error())
+	}
+	if call.JSONRPC != jsonrpcVersion || call.Method == "" {
+		return rpcFailure(call.ID, rpcInvalidRequest, "Invalid Request: jsonrpc must be 2.0 and method must be set")
+	}
+
+	req := Request{ID: rpcIDString(call.ID), Method: call.Method, TimeoutMs: call.TimeoutMs}
+	if len(call.Params) > 0 && string(call.Params) != "null" {
+		if err := json.Unmarshal(call.Params, &req.Params); err != nil {
+			if call.ID == nil {
+				return nil
+			}
+			return rpcFailure(call.ID, rpcInvalidParams, "Invalid params: params must be an object")
+		}
+	}
+
+	resp := s.dispatch(context.Background(), c, &req)
+	if call.ID == nil {
+		return nil
+	}
+	if !resp.Success {
+		number, ok := rpcErrorNumbers[resp.Code]
+		if !ok {
+			number = rpcServerError
+		}
+		failure := rpcFailure(call.ID, number, resp.Error)
+		if resp.Code != "" {
+			failure.Error.Data = map[string]string{"code": resp.Code}
+		}
+		return failure
+	}
+
+	result := resp.Data
+	if result == nil {
+		// result is required in successful response
+		result = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: jsonrpcVersion, ID: call.ID, Result: result}
+}
+
+// batchCallID returns id of the call as raw JSON, empty for notifications, null ids and invalid calls
+func batchCallID(data []byte) string {
+	var call struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if json.Unmarshal(data, &call) != nil || call.ID == nil || string(call.ID) == "null" {
+		return ""
+	}
+	return string(call.ID)
+}
+
+// rpcFailure returns JSON-RPC error response, nil id is sent as null
+func rpcFailure(id json.RawMessage, code int, message string) *rpcResponse {
+	return &rpcResponse{
+		JSONRPC: jsonrpcVersion,
+		ID:      id,
+		Error:   &rpcError{Code: code, Message: message},
+	}
+}
+
+// rpcIDString returns id of the call as used by the native protocol in logs
+func rpcIDString(id json.RawMessage) string {
+	var str string
+	if json.Unmarshal(id, &str) == nil {
+		return str
+	}
+	return string(id)
+}
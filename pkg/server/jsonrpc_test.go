@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonrpcCall sends raw JSON-RPC request and returns the raw response
+func jsonrpcCall(t *testing.T, conn net.Conn, req string) []byte {
+	assert.NoError(t, writeSocketFrame(conn, []byte(req)))
+	frame, err := readSocketFrame(conn)
+	assert.NoError(t, err)
+	return frame
+}
+
+func TestJSONRPC(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	server, err := NewUnixSocketServerWithOptions(socketPath, false, "", Options{ReadOnly: true})
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, server.Start())
+	}()
+	defer server.Stop()
+
+	conn, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(jsonrpcCall(t, conn, `{"jsonrpc":"2.0","id":1,"method":"ping"}`), &resp))
+	assert.Equal(t, "2.0", resp["jsonrpc"])
+	assert.Equal(t, float64(1), resp["id"])
+	assert.Contains(t, resp, "result")
+	assert.NotContains(t, resp, "error")
+
+	resp = nil
+	assert.NoError(t, json.Unmarshal(jsonrpcCall(t, conn, `{"jsonrpc":"2.0","id":"a","method":"nope"}`), &resp))
+	assert.Equal(t, "a", resp["id"])
+	assert.NotContains(t, resp, "result")
+	rpcErr := resp["error"].(map[string]interface{})
+	assert.Equal(t, float64(rpcMethodNotFound), rpcErr["code"])
+	assert.Equal(t, ErrCodeUnknownMethod, rpcErr["data"].(map[string]interface{})["code"])
+
+	resp = nil
+	assert.NoError(t, json.Unmarshal(jsonrpcCall(t, conn, `{"jsonrpc":"2.0","id":2,"method":"delete","params":{"path":"/x"}}`), &resp))
+	assert.Equal(t, float64(rpcReadOnly), resp["error"].(map[string]interface{})["code"])
+
+	resp = nil
+	assert.NoError(t, json.Unmarshal(jsonrpcCall(t, conn, `{"jsonrpc":"2.0","id":3,"method":"status","params":[1]}`), &resp))
+	assert.Equal(t, float64(rpcInvalidParams), resp["error"].(map[string]interface{})["code"])
+
+	resp = nil
+	assert.NoError(t, json.Unmarshal(jsonrpcCall(t, conn, `{"jsonrpc":"2.0","id":4,"method":"set_encoding","params":{"encoding":"msgpack"}}`), &resp))
+	assert.Equal(t, float64(rpcServerError), resp["error"].(map[string]interface{})["code"])
+
+	resp = nil
+	assert.NoError(t, json.Unmarshal(jsonrpcCall(t, conn, `{"jsonrpc":"2.0","id":5,`), &resp))
+	assert.Nil(t, resp["id"])
+	assert.Equal(t, float64(rpcParseError), resp["error"].(map[string]interface{})["code"])
+
+	// notifications in the batch get no response
+	var batch []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(jsonrpcCall(t, conn, `[
+		{"jsonrpc":"2.0","id":6,"method":"status"},
+		{"jsonrpc":"2.0","method":"ping"},
+		{"jsonrpc":"1.0","id":7,"method":"ping"},
+		{"jsonrpc":"2.0","id":null,"method":"ping"}
+	]`), &batch))
+	assert.Len(t, batch, 3)
+	assert.Equal(t, float64(6), batch[0]["id"])
+	assert.Contains(t, batch[0]["result"], "uptime_sec")
+	assert.Equal(t, float64(rpcInvalidRequest), batch[1]["error"].(map[string]interface{})["code"])
+	assert.Equal(t, float64(7), batch[1]["id"])
+	assert.Nil(t, batch[2]["id"])
+	assert.Contains(t, batch[2], "result")
+
+	// id reused while the batch is in flight is rejected, null ids are not tracked
+	batch = nil
+	assert.NoError(t, json.Unmarshal(jsonrpcCall(t, conn, `[
+		{"jsonrpc":"2.0","id":8,"method":"ping"},
+		{"jsonrpc":"2.0","id":8,"method":"status"},
+		{"jsonrpc":"2.0","id":"8","method":"ping"},
+		{"jsonrpc":"2.0","id":null,"method":"ping"},
+		{"jsonrpc":"2.0","id":null,"method":"ping"}
+	]`), &batch))
+	assert.Len(t, batch, 5)
+	assert.Contains(t, batch[0], "result")
+	rpcErr = batch[1]["error"].(map[string]interface{})
+	assert.Equal(t, float64(8), batch[1]["id"])
+	assert.Equal(t, float64(rpcDuplicateID), rpcErr["code"])
+	assert.Equal(t, ErrCodeDuplicateID, rpcErr["data"].(map[string]interface{})["code"])
+	assert.Contains(t, batch[2], "result")
+	assert.Contains(t, batch[3], "result")
+	assert.Contains(t, batch[4], "result")
+
+	// native protocol stays the default for other connections
+	native, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	defer native.Close()
+	assert.NoError(t, sendSocketRequest(native, Request{ID: "n", Method: "ping"}))
+	nativeResp, err := readSocketResponse(native)
+	assert.NoError(t, err)
+	assert.Equal(t, "n", nativeResp.ID)
+	assert.True(t, nativeResp.Success)
+}
+
+func TestIsJSONRPC(t *testing.T) {
+	assert.True(t, isJSONRPC([]byte(` {"jsonrpc":"2.0","id":1,"method":"ping"}`)))
+	assert.True(t, isJSONRPC([]byte(`[{"jsonrpc":"2.0","method":"ping"}]`)))
+	assert.False(t, isJSONRPC([]byte(`{"id":"1","method":"ping"}`)))
+	assert.False(t, isJSONRPC([]byte(`[]`)))
+	assert.False(t, isJSONRPC([]byte(`{`)))
+}
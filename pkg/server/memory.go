@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// memoryCheckInterval is time between two checks of memory usage of the running scan
+	memoryCheckInterval = time.Second
+	// memoryHighWater is part of the ceiling above which memory is freed and the scan is paused
+	memoryHighWater = 0.9
+	// memoryLowWater is part of the ceiling below which paused scan is resumed
+	memoryLowWater = 0.8
+	// memoryPauseChecks is number of checks the scan stays paused over the high-water mark before it is aborted
+	memoryPauseChecks = 10
+)
+
+// Actions taken by memory guard, counted in metrics
+const (
+	memoryActionGC    = "gc"
+	memoryActionPause = "pause"
+	memoryActionAbort = "abort"
+)
+
+// memoryActions are all actions of memory guard in order they are taken
+var memoryActions = []string{memoryActionGC, memoryActionPause, memoryActionAbort}
+
+// GC modes of scans
+const (
+	gcModeManaged     = "managed"
+	gcModeMemoryLimit = "memory_limit"
+	gcModeConst       = "const"
+)
+
+// scanGCMode returns how GC runs during the scan, the same as the analyzer sets it up
+func scanGCMode(opts scanOptions) string {
+	switch {
+	case opts.constGC:
+		return gcModeConst
+	case opts.memoryLimit > 0:
+		return gcModeMemoryLimit
+	default:
+		return gcModeManaged
+	}
+}
+
+// memoryUsage returns memory the runtime holds from the OS, the same as the runtime memory limit counts
+func memoryUsage() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys - stats.HeapReleased
+}
+
+// setMemoryCeiling sets the runtime memory limit to the ceiling, zero removes the limit
+func setMemoryCeiling(ceiling int64) {
+	if ceiling > 0 {
+		debug.SetMemoryLimit(ceiling)
+	} else {
+		debug.SetMemoryLimit(math.MaxInt64)
+	}
+}
+
+// memoryGuard keeps memory usage of the server under its ceiling while a scan runs.
+// Crossing the high-water mark forces GC first, then pauses reading of dirs
+// and finally aborts the scan when the memory can't be freed.
+type memoryGuard struct {
+	s       *Server
+	ceiling uint64
+	// usage and free are replaced in tests
+	usage func() uint64
+	free  func()
+	// paused is set while reading of dirs is paused, pausedChecks counts checks made since then
+	paused       bool
+	pausedChecks int
+}
+
+func newMemoryGuard(s *Server, ceiling int64) *memoryGuard {
+	return &memoryGuard{
+		s:       s,
+		ceiling: uint64(ceiling),
+		usage:   memoryUsage,
+		free:    debug.FreeOSMemory,
+	}
+}
+
+// run checks memory usage periodically until the context is done or the scan is aborted
+func (g *memoryGuard) run(ctx context.Context) {
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+	defer g.resume()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !g.check() {
+				return
+			}
+		}
+	}
+}
+
+// check takes action when memory usage is over the high-water mark,
+// false is returned once the scan was aborted
+func (g *memoryGuard) check() bool {
+	high := uint64(float64(g.ceiling) * memoryHighWater)
+	low := uint64(float64(g.ceiling) * memoryLowWater)
+
+	usage := g.usage()
+	if g.paused {
+		g.pausedChecks++
+		if usage >= high {
+			// memory of dirs read so far may still be freed
+			g.free()
+			usage = g.usage()
+		}
+		switch {
+		case usage < low:
+			log.Infof("Memory usage %d MiB is below %d MiB, resuming scan", usage>>20, low>>20)
+			g.resume()
+		case usage >= g.ceiling || (usage >= high && g.pausedChecks >= memoryPauseChecks):
+			g.abort(usage)
+			return false
+		}
+		return true
+	}
+
+	if usage < high {
+		return true
+	}
+	log.Warnf("Memory usage %d MiB is over high-water mark %d MiB, forcing GC", usage>>20, high>>20)
+	g.s.metrics.observeMemoryAction(memoryActionGC)
+	g.free()
+	if usage = g.usage(); usage < high {
+		return true
+	}
+
+	log.Warnf("Memory usage %d MiB is still over high-water mark %d MiB, pausing scan", usage>>20, high>>20)
+	g.s.metrics.observeMemoryAction(memoryActionPause)
+	g.paused = true
+	g.pausedChecks = 0
+	g.setPaused(true)
+	g.s.mu.Lock()
+	g.s.memoryWarning = fmt.Sprintf(
+		"scan paused, memory usage %d MiB is over %d%% of ceiling %d MiB",
+		usage>>20, int(memoryHighWater*100), g.ceiling>>20,
+	)
+	g.s.mu.Unlock()
+	g.s.events.publish(Event{Event: EventProgress, Data: g.s.progressResponse()})
+	return true
+}
+
+// resume lets paused scan read dirs again
+func (g *memoryGuard) resume() {
+	if !g.paused {
+		return
+	}
+	g.paused = false
+	g.setPaused(false)
+	g.s.mu.Lock()
+	g.s.memoryWarning = ""
+	g.s.mu.Unlock()
+}
+
+// setPaused pauses or resumes reading of dirs if the analyzer supports it
+func (g *memoryGuard) setPaused(paused bool) {
+	if a, ok := g.s.analyzer.(interface{ SetPaused(bool) }); ok {
+		a.SetPaused(paused)
+	}
+}
+
+// abort cancels the running scan, its tree is dropped to free the memory
+func (g *memoryGuard) abort(usage uint64) {
+	message := fmt.Sprintf("scan aborted, memory usage %d MiB exceeded ceiling %d MiB", usage>>20, g.ceiling>>20)
+	log.Errorf("Memory usage %d MiB can't be brought under %d MiB, aborting scan", usage>>20, g.ceiling>>20)
+	g.s.metrics.observeMemoryAction(memoryActionAbort)
+
+	g.s.mu.Lock()
+	g.paused = false
+	g.s.memoryWarning = ""
+	g.s.memoryError = message
+	if g.s.cancelFunc != nil {
+		g.s.cancelFunc()
+		g.s.cancelFunc = nil
+	}
+	g.s.mu.Unlock()
+	// cancellation also releases reads waiting for the pause to end
+	g.s.analyzer.Cancel()
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"net/http/httptest"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/common"
+	"github.com/dundee/gdu/v5/internal/testanalyze"
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/dundee/gdu/v5/pkg/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryGuardFreesMemory(t *testing.T) {
+	s := NewServer(false, "")
+	usage := uint64(95 << 20)
+	g := newMemoryGuard(s, 100<<20)
+	g.usage = func() uint64 { return usage }
+	g.free = func() { usage = 50 << 20 }
+
+	assert.True(t, g.check())
+	assert.False(t, g.paused)
+	assert.Empty(t, s.progressResponse().MemoryWarning)
+	assert.Equal(t, uint64(1), s.metrics.memoryActions[memoryActionGC])
+	assert.Equal(t, uint64(0), s.metrics.memoryActions[memoryActionPause])
+}
+
+func TestMemoryGuardPausesScan(t *testing.T) {
+	s := NewServer(false, "")
+	usage := uint64(95 << 20)
+	g := newMemoryGuard(s, 100<<20)
+	g.usage = func() uint64 { return usage }
+	g.free = func() {}
+
+	assert.True(t, g.check())
+	assert.True(t, g.paused)
+	assert.Contains(t, s.progressResponse().MemoryWarning, "scan paused")
+
+	// usage between the marks keeps the scan paused
+	usage = 85 << 20
+	assert.True(t, g.check())
+	assert.True(t, g.paused)
+
+	usage = 70 << 20
+	assert.True(t, g.check())
+	assert.False(t, g.paused)
+	assert.Empty(t, s.progressResponse().MemoryWarning)
+	assert.Equal(t, uint64(1), s.metrics.memoryActions[memoryActionPause])
+}
+
+func TestMemoryGuardAbortsScan(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	// slow scan is still running when the guard checks memory
+	go s.server.scan("test_dir", scanOptions{throttle: 2})
+	assert.Eventually(t, func() bool {
+		s.server.mu.RLock()
+		defer s.server.mu.RUnlock()
+		return s.server.cancelFunc != nil
+	}, time.Second, time.Millisecond)
+	s.server.mu.RLock()
+	done := s.server.scanDone
+	s.server.mu.RUnlock()
+
+	g := newMemoryGuard(s.server, 100<<20)
+	g.usage = func() uint64 { return 95 << 20 }
+	g.free = func() {}
+	assert.True(t, g.check())
+	for i := 1; i < memoryPauseChecks; i++ {
+		assert.True(t, g.check())
+	}
+	assert.False(t, g.check())
+	<-done
+
+	progress := s.server.progressResponse()
+	assert.False(t, progress.IsScanning)
+	assert.Equal(t, ErrCodeMemoryLimit, progress.ErrorCode)
+	assert.Contains(t, progress.Error, "memory usage 95 MiB exceeded ceiling 100 MiB")
+	assert.Empty(t, progress.MemoryWarning)
+	assert.Nil(t, s.server.completedDir)
+
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `gdu_memory_actions_total{action="gc"} 1`)
+	assert.Contains(t, rec.Body.String(), `gdu_memory_actions_total{action="pause"} 1`)
+	assert.Contains(t, rec.Body.String(), `gdu_memory_actions_total{action="abort"} 1`)
+
+	// the next scan starts without the error
+	s.server.scan("test_dir", scanOptions{})
+	assert.Empty(t, s.server.progressResponse().ErrorCode)
+	assert.NotNil(t, s.server.completedDir)
+}
+
+func TestSetMaxMemory(t *testing.T) {
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	defer s.SetMaxMemory(0)
+
+	s.SetMaxMemory(1 << 30)
+	assert.Equal(t, int64(1<<30), s.server.maxMemory)
+
+	// GC of the scan can't let the heap grow over the ceiling
+	opts := scanOptions{memoryLimit: 2 << 30}
+	assert.True(t, s.server.beginScan(&opts))
+	assert.Equal(t, int64(1<<30), opts.memoryLimit)
+
+	s.SetMaxMemory(-1)
+	assert.Equal(t, int64(0), s.server.maxMemory)
+}
+
+// gcAnalyzer records GC settings the scan runs with
+type gcAnalyzer struct {
+	*testanalyze.MockedAnalyzer
+	constGC   bool
+	gcPercent int
+}
+
+func (a *gcAnalyzer) AnalyzeDir(path string, ignore common.ShouldDirBeIgnored, constGC bool) fs.Item {
+	a.constGC = constGC
+	a.gcPercent = debug.SetGCPercent(100)
+	debug.SetGCPercent(a.gcPercent)
+	return a.MockedAnalyzer.AnalyzeDir(path, ignore, constGC)
+}
+
+func TestScanGC(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	analyzer := &gcAnalyzer{MockedAnalyzer: &testanalyze.MockedAnalyzer{}}
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.analyzer = analyzer
+	scan := func(params string) StatusResponse {
+		t.Helper()
+		resp := s.processRequest([]byte(`{"id":"1","method":"scan","params":{"path":"test_dir"` + params + `}}`))
+		assert.True(t, resp.Success, resp.Error)
+		s.server.mu.RLock()
+		done := s.server.scanDone
+		s.server.mu.RUnlock()
+		<-done
+		return s.status()
+	}
+
+	status := scan("")
+	assert.False(t, analyzer.constGC)
+	assert.Equal(t, "managed", status.GCMode)
+	status = scan(`,"memory_limit":1073741824`)
+	assert.Equal(t, "memory_limit", status.GCMode)
+	status = scan(`,"const_gc":true`)
+	assert.True(t, analyzer.constGC)
+	assert.Equal(t, "const", status.GCMode)
+
+	// GOGC is set only for the time of the scan
+	prevPercent := debug.SetGCPercent(100)
+	defer debug.SetGCPercent(prevPercent)
+	status = scan(`,"gc_percent":42`)
+	assert.True(t, analyzer.constGC)
+	assert.Equal(t, 42, analyzer.gcPercent)
+	assert.Equal(t, "const", status.GCMode)
+	assert.Equal(t, 42, status.GCPercent)
+	assert.Equal(t, 100, debug.SetGCPercent(100))
+
+	// defaults of the server apply to scans not setting the params
+	s.SetScanGC(true, 0)
+	scan("")
+	assert.True(t, analyzer.constGC)
+	scan(`,"const_gc":false`)
+	assert.False(t, analyzer.constGC)
+	s.SetScanGC(false, 30)
+	status = scan("")
+	assert.Equal(t, 30, analyzer.gcPercent)
+	assert.Equal(t, 30, status.GCPercent)
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"scan","params":{"path":"test_dir","gc_percent":-1}}`))
+	assert.False(t, resp.Success)
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+)
+
+// requestBuckets are upper bounds of request duration histogram in seconds
+var requestBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// scanBuckets are upper bounds of scan duration histogram in seconds
+var scanBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}
+
+// histogram counts observations in cumulative buckets
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes histogram in Prometheus text format, labels are added to every sample
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, wrapLabels(labels), formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, wrapLabels(labels), h.count)
+}
+
+// requestKey identifies counter of requests
+type requestKey struct {
+	method  string
+	success bool
+}
+
+// metrics collects counters of the server exposed in Prometheus text format
+type metrics struct {
+	mu               sync.Mutex
+	requests         map[requestKey]uint64
+	requestDurations map[string]*histogram
+	scans            uint64
+	scanDuration     *histogram
+	scanItems        uint64
+	scanBytes        uint64
+	analyzerErrors   uint64
+	scanErrors       uint64
+	memoryActions    map[string]uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:         make(map[requestKey]uint64),
+		requestDurations: make(map[string]*histogram),
+		scanDuration:     newHistogram(scanBuckets),
+		memoryActions:    make(map[string]uint64),
+	}
+}
+
+// observeRequest records processed request
+func (m *metrics) observeRequest(method string, success bool, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{method: method, success: success}]++
+	h, ok := m.requestDurations[method]
+	if !ok {
+		h = newHistogram(requestBuckets)
+		m.requestDurations[method] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// observeScan records finished scan of the tree
+func (m *metrics) observeScan(dir fs.Item, duration time.Duration) {
+	errors := 0
+	walkDirs(dir, func(item fs.Item) {
+		if item.GetFlag() == '!' {
+			errors++
+		}
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scans++
+	m.scanDuration.observe(duration.Seconds())
+	m.scanItems += uint64(dir.GetItemCount())
+	m.scanBytes += uint64(dir.GetSize())
+	m.analyzerErrors += uint64(errors)
+}
+
+// observeScanError records scan whose root could not be read or which was aborted
+func (m *metrics) observeScanError() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scanErrors++
+}
+
+// observeMemoryAction records action taken because memory usage crossed the high-water mark
+func (m *metrics) observeMemoryAction(action string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.memoryActions[action]++
+}
+
+// write writes all metrics in Prometheus text format
+func (m *metrics) write(w io.Writer, activeConnections int64, scanning bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return !keys[i].success && keys[j].success
+	})
+	fmt.Fprintln(w, "# HELP gdu_requests_total Number of processed requests.")
+	fmt.Fprintln(w, "# TYPE gdu_requests_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "gdu_requests_total{method=%q,success=\"%t\"} %d\n", key.method, key.success, m.requests[key])
+	}
+
+	methods := make([]string, 0, len(m.requestDurations))
+	for method := range m.requestDurations {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	fmt.Fprintln(w, "# HELP gdu_request_duration_seconds Time spent processing requests.")
+	fmt.Fprintln(w, "# TYPE gdu_request_duration_seconds histogram")
+	for _, method := range methods {
+		m.requestDurations[method].write(w, "gdu_request_duration_seconds", fmt.Sprintf("method=%q", method))
+	}
+
+	fmt.Fprintln(w, "# HELP gdu_active_connections Number of open client connections.")
+	fmt.Fprintln(w, "# TYPE gdu_active_connections gauge")
+	fmt.Fprintf(w, "gdu_active_connections %d\n", activeConnections)
+
+	inProgress := 0
+	if scanning {
+		inProgress = 1
+	}
+	fmt.Fprintln(w, "# HELP gdu_scan_in_progress Whether a scan is running.")
+	fmt.Fprintln(w, "# TYPE gdu_scan_in_progress gauge")
+	fmt.Fprintf(w, "gdu_scan_in_progress %d\n", inProgress)
+
+	fmt.Fprintln(w, "# HELP gdu_scans_total Number of finished scans.")
+	fmt.Fprintln(w, "# TYPE gdu_scans_total counter")
+	fmt.Fprintf(w, "gdu_scans_total %d\n", m.scans)
+
+	fmt.Fprintln(w, "# HELP gdu_scan_duration_seconds Duration of finished scans.")
+	fmt.Fprintln(w, "# TYPE gdu_scan_duration_seconds histogram")
+	m.scanDuration.write(w, "gdu_scan_duration_seconds", "")
+
+	fmt.Fprintln(w, "# HELP gdu_scan_items_total Number of items found by finished scans.")
+	fmt.Fprintln(w, "# TYPE gdu_scan_items_total counter")
+	fmt.Fprintf(w, "gdu_scan_items_total %d\n", m.scanItems)
+
+	fmt.Fprintln(w, "# HELP gdu_scan_bytes_total Apparent size of items found by finished scans.")
+	fmt.Fprintln(w, "# TYPE gdu_scan_bytes_total counter")
+	fmt.Fprintf(w, "gdu_scan_bytes_total %d\n", m.scanBytes)
+
+	fmt.Fprintln(w, "# HELP gdu_analyzer_errors_total Number of directories which could not be read.")
+	fmt.Fprintln(w, "# TYPE gdu_analyzer_errors_total counter")
+	fmt.Fprintf(w, "gdu_analyzer_errors_total %d\n", m.analyzerErrors)
+
+	fmt.Fprintln(w, "# HELP gdu_scan_errors_total Number of scans whose root could not be read or which were aborted.")
+	fmt.Fprintln(w, "# TYPE gdu_scan_errors_total counter")
+	fmt.Fprintf(w, "gdu_scan_errors_total %d\n", m.scanErrors)
+
+	fmt.Fprintln(w, "# HELP gdu_memory_actions_total Actions taken because memory usage of a scan crossed the high-water mark.")
+	fmt.Fprintln(w, "# TYPE gdu_memory_actions_total counter")
+	for _, action := range memoryActions {
+		fmt.Fprintf(w, "gdu_memory_actions_total{action=%q} %d\n", action, m.memoryActions[action])
+	}
+}
+
+// MetricsHandler returns HTTP handler serving metrics in Prometheus text format
+func (s *UnixSocketServer) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.writeMetrics(w)
+	})
+}
+
+// MetricsResponse holds metrics of the server in Prometheus text format
+type MetricsResponse struct {
+	Metrics string `json:"metrics"`
+}
+
+// writeMetrics writes metrics of the server in Prometheus text format
+func (s *UnixSocketServer) writeMetrics(w io.Writer) {
+	s.server.mu.RLock()
+	scanning := s.server.isScanning
+	s.server.mu.RUnlock()
+	s.server.metrics.write(w, s.active.Load(), scanning)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
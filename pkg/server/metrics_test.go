@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{1, 5})
+	h.observe(0.5)
+	h.observe(2)
+	h.observe(10)
+
+	var b strings.Builder
+	h.write(&b, "x", `method="a"`)
+	assert.Equal(t, `x_bucket{method="a",le="1"} 1
+x_bucket{method="a",le="5"} 2
+x_bucket{method="a",le="+Inf"} 3
+x_sum{method="a"} 12.5
+x_count{method="a"} 3
+`, b.String())
+}
+
+func TestMetrics(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.active.Add(2)
+	s.server.scan("test_dir", scanOptions{})
+	s.processRequest([]byte(`{"id":"1","method":"status"}`))
+	s.processRequest([]byte(`{"id":"2","method":"directory","params":{"path":"missing"}}`))
+	s.processRequest([]byte(`{"id":"3","method":"whatever"}`))
+
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, body, `gdu_requests_total{method="status",success="true"} 1`)
+	assert.Contains(t, body, `gdu_requests_total{method="directory",success="false"} 1`)
+	assert.Contains(t, body, `gdu_requests_total{method="unknown",success="false"} 1`)
+	assert.NotContains(t, body, "whatever")
+	assert.Contains(t, body, `gdu_request_duration_seconds_count{method="status"} 1`)
+	assert.Contains(t, body, "gdu_active_connections 2\n")
+	assert.Contains(t, body, "gdu_scans_total 1\n")
+	assert.Contains(t, body, "gdu_scan_duration_seconds_count 1\n")
+	assert.Contains(t, body, "gdu_scan_items_total 5\n")
+	assert.Contains(t, body, "gdu_scan_bytes_total 12295\n")
+	assert.Contains(t, body, "gdu_analyzer_errors_total 0\n")
+	assert.Contains(t, body, "gdu_scan_errors_total 0\n")
+	assert.Contains(t, body, "gdu_scan_in_progress 0\n")
+}
+
+func TestMetricsMethod(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.active.Add(1)
+	s.server.scan("test_dir", scanOptions{})
+	s.server.scan("missing", scanOptions{})
+	s.server.mu.Lock()
+	s.server.isScanning = true
+	s.server.mu.Unlock()
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"metrics"}`))
+	assert.True(t, resp.Success)
+	metrics := resp.Data.(MetricsResponse).Metrics
+	assert.Contains(t, metrics, "# TYPE gdu_scans_total counter\n")
+	assert.Contains(t, metrics, "gdu_scans_total 2\n")
+	assert.Contains(t, metrics, "gdu_scan_errors_total 1\n")
+	assert.Contains(t, metrics, "gdu_active_connections 1\n")
+	assert.Contains(t, metrics, "gdu_scan_in_progress 1\n")
+
+	// the method serves the same metrics as HTTP endpoint
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `gdu_requests_total{method="metrics",success="true"} 1`)
+}
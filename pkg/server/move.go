@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/dundee/gdu/v5/pkg/analyze"
+	"github.com/dundee/gdu/v5/pkg/fs"
+)
+
+// errOutsideRoot is returned for paths which are not in the scanned tree
+var errOutsideRoot = errors.New("path is outside of the scanned root")
+
+// moveItem renames item on path from to path to and moves it in the scanned tree.
+// Existing item on path to is replaced only if overwrite is set.
+func (s *Server) moveItem(from, to string, overwrite bool) (DirInfo, error) {
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.completedDir == nil {
+		return DirInfo{}, errors.New("no scan completed")
+	}
+
+	root := s.completedDir
+	from, to = filepath.Clean(from), filepath.Clean(to)
+	if !underRoots(root, from) || !underRoots(root, to) {
+		return DirInfo{}, errOutsideRoot
+	}
+	if slices.Contains(rootPaths(root), from) {
+		return DirInfo{}, errors.New("scanned root cannot be moved")
+	}
+
+	item := s.findItem(from)
+	if item == nil {
+		return DirInfo{}, fmt.Errorf("%s not found in the scanned tree", from)
+	}
+	oldParent, ok := item.GetParent().(*analyze.Dir)
+	if !ok {
+		return DirInfo{}, fmt.Errorf("%s cannot be moved in the scanned tree", from)
+	}
+	newParent, ok := s.findItem(filepath.Dir(to)).(*analyze.Dir)
+	if !ok {
+		return DirInfo{}, fmt.Errorf("%s not found in the scanned tree", filepath.Dir(to))
+	}
+
+	if _, err := os.Lstat(to); err == nil {
+		if !overwrite {
+			return DirInfo{}, fmt.Errorf("%s already exists", to)
+		}
+	} else if !os.IsNotExist(err) {
+		return DirInfo{}, err
+	}
+
+	if err := os.Rename(from, to); err != nil {
+		return DirInfo{}, err
+	}
+
+	if replaced := s.findItem(to); replaced != nil && replaced != item {
+		s.detachItem(replaced)
+	}
+	s.detachItem(item)
+
+	switch v := item.(type) {
+	case *analyze.Dir:
+		v.Name = filepath.Base(to)
+	case *analyze.File:
+		v.Name = filepath.Base(to)
+	}
+	attachItem(newParent, item)
+	rebaseDirs(item)
+	indexItem(item, s.pathIndex)
+
+	if s.updates != nil {
+		now := time.Now()
+		s.updates.touch(oldParent.GetPath(), now)
+		s.updates.touch(to, now)
+	}
+
+	return convertToDirInfo(item, 0, dirInfoOptions{}), nil
+}
+
+// detachItem removes item from its parent and from the path index.
+// Caller must hold s.mu.
+func (s *Server) detachItem(item fs.Item) {
+	if parent, ok := item.GetParent().(*analyze.Dir); ok {
+		parent.RemoveFile(item)
+	}
+	walkItems(item, func(item fs.Item) {
+		delete(s.pathIndex, item.GetPath())
+	})
+}
+
+// rebaseDirs updates base paths of the moved dir and its subdirs,
+// base path is set on dirs of trees scanned from absolute path
+func rebaseDirs(item fs.Item) {
+	walkDirs(item, func(item fs.Item) {
+		if dir, ok := item.(*analyze.Dir); ok && dir.BasePath != "" {
+			dir.BasePath = dir.Parent.GetPath()
+		}
+	})
+}
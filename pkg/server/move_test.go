@@ -0,0 +1,132 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoveFile(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+
+	resp := s.processRequest([]byte(
+		`{"id":"1","method":"move","params":{"from":"test_dir/nested/file2","to":"test_dir/nested/subnested/moved"}}`,
+	))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, "test_dir/nested/subnested/moved", resp.Data.(DirInfo).Path)
+
+	_, err := os.Stat("test_dir/nested/subnested/moved")
+	assert.NoError(t, err)
+
+	s.server.mu.RLock()
+	defer s.server.mu.RUnlock()
+
+	assert.Nil(t, s.server.pathIndex["test_dir/nested/file2"])
+	assert.NotNil(t, s.server.pathIndex["test_dir/nested/subnested/moved"])
+	assert.Equal(t, int64(7+4096*3), s.server.completedDir.GetSize())
+	assert.Equal(t, 5, s.server.completedDir.GetItemCount())
+
+	subnested := s.server.findItem("test_dir/nested/subnested")
+	assert.Equal(t, int64(7+4096), subnested.GetSize())
+	assert.Equal(t, 3, subnested.GetItemCount())
+	assert.Equal(t, int64(7+4096*2), s.server.findItem("test_dir/nested").GetSize())
+}
+
+func TestMoveDirScannedFromAbsolutePath(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	root, err := filepath.Abs("test_dir")
+	assert.NoError(t, err)
+
+	s := NewServer(false, "")
+	s.scan(root, scanOptions{})
+
+	from := filepath.Join(root, "nested", "subnested")
+	to := filepath.Join(root, "moved")
+	info, err := s.moveItem(from, to, false)
+	assert.NoError(t, err)
+	assert.Equal(t, to, info.Path)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	file := s.findItem(filepath.Join(to, "file"))
+	assert.NotNil(t, file)
+	assert.Equal(t, filepath.Join(to, "file"), file.GetPath())
+	assert.Nil(t, s.findItem(filepath.Join(from, "file")))
+	assert.Equal(t, int64(7+4096*3), s.completedDir.GetSize())
+	assert.Equal(t, int64(2+4096), s.findItem(filepath.Join(root, "nested")).GetSize())
+}
+
+func TestMoveExistingTarget(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	s.scan("test_dir", scanOptions{})
+
+	_, err := s.moveItem("test_dir/nested/file2", "test_dir/nested/subnested/file", false)
+	assert.ErrorContains(t, err, "already exists")
+
+	_, err = s.moveItem("test_dir/nested/file2", "test_dir/nested/subnested/file", true)
+	assert.NoError(t, err)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// the replaced file is gone from the tree
+	assert.Equal(t, int64(2+4096*3), s.completedDir.GetSize())
+	assert.Equal(t, 4, s.completedDir.GetItemCount())
+	assert.Len(t, s.findItem("test_dir/nested/subnested").GetFiles(), 1)
+}
+
+func TestMoveOutsideOfRoot(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+
+	resp := s.processRequest([]byte(
+		`{"id":"1","method":"move","params":{"from":"test_dir/nested/file2","to":"test_dir/../file2"}}`,
+	))
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeForbidden, resp.Code)
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"move","params":{"from":"test_dir","to":"test_dir/x"}}`))
+	assert.False(t, resp.Success)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"move","params":{"from":"test_dir/missing","to":"test_dir/x"}}`))
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "not found")
+}
+
+func TestMoveInReadOnlyMode(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, ""), readOnly: true}
+	s.server.scan("test_dir", scanOptions{})
+
+	resp := s.processRequest([]byte(
+		`{"id":"1","method":"move","params":{"from":"test_dir/nested/file2","to":"test_dir/nested/moved"}}`,
+	))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "server is read-only", resp.Error)
+	assert.Equal(t, ErrCodeReadOnly, resp.Code)
+
+	_, err := os.Stat("test_dir/nested/file2")
+	assert.NoError(t, err)
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"status"}`))
+	assert.True(t, resp.Success)
+	assert.True(t, resp.Data.(StatusResponse).ReadOnly)
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+)
+
+// PartialDirInfo represents directory information which may be still being scanned
+type PartialDirInfo struct {
+	DirInfo
+	Complete bool `json:"complete"`
+}
+
+// partialRoot returns root of the tree being built by the running scan,
+// nil if the analyzer doesn't publish it or no directory was read yet
+func (s *Server) partialRoot() fs.Item {
+	a, ok := s.analyzer.(interface{ GetPartialRoot() fs.Item })
+	if !ok {
+		return nil
+	}
+	return a.GetPartialRoot()
+}
+
+// partialDirInfo returns snapshot of the tree being built by the running scan,
+// false is returned if the path has not been read yet
+func (s *Server) partialDirInfo(path string, depth int, opts dirInfoOptions) (PartialDirInfo, bool) {
+	root := s.partialRoot()
+	if root == nil {
+		return PartialDirInfo{}, false
+	}
+
+	s.treeMu.RLock()
+	defer s.treeMu.RUnlock()
+
+	item := root
+	if path != "" {
+		item = findPartialItem(root, path)
+	}
+	if item == nil {
+		return PartialDirInfo{}, false
+	}
+
+	return PartialDirInfo{DirInfo: snapshotDirInfo(item, depth, opts)}, true
+}
+
+// snapshotDirInfo converts tree which is still being built to DirInfo.
+// Sizes and item counts of directories are summed from the items added so far.
+// Caller must hold s.treeMu for reading.
+func snapshotDirInfo(item fs.Item, depth int, opts dirInfoOptions) DirInfo {
+	info := convertToDirInfo(item, 0, dirInfoOptions{
+		includeTimes: opts.includeTimes,
+		includeOwner: opts.includeOwner,
+		human:        opts.human,
+		types:        opts.types,
+	})
+
+	if !item.IsDir() {
+		return info
+	}
+
+	info.ItemCount, info.Size, info.PhysicalSize = snapshotStats(item)
+	if opts.human {
+		info.setHumanSizes()
+	}
+
+	files := item.GetFilesLocked()
+	if depth <= 0 {
+		info.Truncated = opts.capped && len(files) > 0
+		return info
+	}
+
+	for _, child := range files {
+		childInfo := snapshotDirInfo(child, depth-1, opts)
+		size := childInfo.Size
+		if opts.usage {
+			size = childInfo.PhysicalSize
+		}
+		if size < opts.minSize {
+			info.HiddenCount++
+			info.HiddenSize += size
+			continue
+		}
+		info.Children = append(info.Children, childInfo)
+	}
+	return info
+}
+
+// snapshotStats sums item count, size and usage of the items added to the dir so far
+func snapshotStats(item fs.Item) (itemCount int, size, usage int64) {
+	if !item.IsDir() {
+		return 1, item.GetSize(), item.GetUsage()
+	}
+
+	itemCount, size, usage = 1, 4096, 4096
+	if isVirtualRoot(item) {
+		itemCount, size, usage = 0, 0, 0
+	}
+	for _, child := range item.GetFilesLocked() {
+		count, childSize, childUsage := snapshotStats(child)
+		itemCount += count
+		size += childSize
+		usage += childUsage
+	}
+	return itemCount, size, usage
+}
+
+// findPartialItem finds item by path in tree which is still being built
+func findPartialItem(root fs.Item, path string) fs.Item {
+	rootPath := root.GetPath()
+	if rootPath == path {
+		return root
+	}
+	if !root.IsDir() || !strings.HasPrefix(path, rootPath) {
+		return nil
+	}
+
+	for _, child := range root.GetFilesLocked() {
+		if found := findPartialItem(child, path); found != nil {
+			return found
+		}
+	}
+	return nil
+}
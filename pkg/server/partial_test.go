@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartialDirInfo(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	_, ok := s.partialDirInfo("", 1, dirInfoOptions{})
+	assert.False(t, ok)
+
+	// tree with stats not updated yet, as it is during the scan
+	s.analyzer.AnalyzeDir("test_dir", func(_, _ string) bool { return false }, false)
+
+	info, ok := s.partialDirInfo("", 1, dirInfoOptions{capped: true})
+	assert.True(t, ok)
+	assert.False(t, info.Complete)
+	assert.Equal(t, "test_dir", info.Name)
+	assert.Equal(t, 5, info.ItemCount)
+	assert.Equal(t, int64(7+4096*3), info.Size)
+	assert.Len(t, info.Children, 1)
+	assert.Equal(t, 4, info.Children[0].ItemCount)
+	assert.True(t, info.Children[0].Truncated)
+
+	info, ok = s.partialDirInfo("test_dir/nested/subnested", 1, dirInfoOptions{})
+	assert.True(t, ok)
+	assert.Equal(t, int64(5+4096), info.Size)
+	assert.Equal(t, "file", info.Children[0].Name)
+
+	_, ok = s.partialDirInfo("test_dir/missing", 1, dirInfoOptions{})
+	assert.False(t, ok)
+}
@@ -3,18 +3,26 @@ package server
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dundee/gdu/v5/internal/common"
+	"github.com/dundee/gdu/v5/pkg/analyze"
 	"github.com/dundee/gdu/v5/pkg/fs"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
 )
 
 // Request represents a client request
@@ -22,6 +30,12 @@ type Request struct {
 	ID     string                 `json:"id"`
 	Method string                 `json:"method"`
 	Params map[string]interface{} `json:"params"`
+	// IncludeMeta adds timing of the request to the response
+	IncludeMeta bool `json:"include_meta,omitempty"`
+	// Compress is compression method (gzip or zstd) used for responses larger than 64 KiB
+	Compress string `json:"compress,omitempty"`
+	// TimeoutMs is time budget of the request, long-running methods fail with ErrCodeTimeout once it passes
+	TimeoutMs int64 `json:"timeout_ms,omitempty"`
 }
 
 // Response represents a server response
@@ -30,53 +44,341 @@ type Response struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"`
+	Meta    *Meta       `json:"meta,omitempty"`
+
+	// includeMeta is set when the client asked for Meta
+	includeMeta bool
+	// compress is compression method the client accepts for large responses
+	compress string
+}
+
+// Meta holds timing of the request measured by the server
+type Meta struct {
+	ReceivedAt   time.Time `json:"received_at"`
+	ProcessingMs float64   `json:"processing_ms"`
+	EncodeMs     float64   `json:"encode_ms"`
+	// ResponseBytes is size of the encoded response without the meta object
+	ResponseBytes int `json:"response_bytes"`
 }
 
+// Error codes of failed requests
+const (
+	// ErrCodeForbidden is error code of requests for paths which are not allowed
+	ErrCodeForbidden = "ERR_FORBIDDEN"
+	// ErrCodeReadOnly is error code of mutating requests to read-only server
+	ErrCodeReadOnly = "ERR_READ_ONLY"
+	// ErrCodeUnknownMethod is error code of requests for methods the server does not have
+	ErrCodeUnknownMethod = "ERR_UNKNOWN_METHOD"
+	// ErrCodeDuplicateID is error code of requests reusing id of a request still in flight
+	ErrCodeDuplicateID = "ERR_DUPLICATE_ID"
+	// ErrCodeEncoding is error code of responses whose data could not be encoded
+	ErrCodeEncoding = "ERR_ENCODING"
+	// ErrCodeTimeout is error code of requests which ran out of their time budget
+	ErrCodeTimeout = "ERR_TIMEOUT"
+	// ErrCodeMemoryLimit is error code of scans aborted because memory of the server went over its ceiling
+	ErrCodeMemoryLimit = "ERR_MEMORY_LIMIT"
+	// ErrCodeTooLarge is error code of exports too large to be sent in the response
+	ErrCodeTooLarge = "ERR_TOO_LARGE"
+)
+
+// DefaultMaxMessageSize is the largest request accepted by default
+const DefaultMaxMessageSize = 100 * 1024 * 1024
+
+// maxMessageSizeLimit caps the configurable message size, length prefix of larger messages
+// could begin with '{' or '[' and be confused with newline-delimited JSON
+const maxMessageSizeLimit = 1 << 30
+
 // UnixSocketServer provides Unix socket server with length-prefixed JSON protocol
 type UnixSocketServer struct {
 	server      *Server
 	socketPath  string
 	listener    net.Listener
 	connections sync.WaitGroup
+	// active is number of currently open connections
+	active atomic.Int64
+	// lastConnID is ID of the last accepted connection, used in logs
+	lastConnID atomic.Uint64
+	// readOnly rejects methods changing the filesystem
+	readOnly bool
+	// defaultTimeout is time budget of requests, it caps budget set by clients. Zero means unlimited.
+	defaultTimeout time.Duration
+	// isGateway is set on dispatcher of HTTP, WebSocket and gRPC requests,
+	// gatewayWrites lets them call methods writing to the filesystem
+	isGateway     bool
+	gatewayWrites bool
+	// rateLimit limits requests of every connection, conns are connections with rate limit
+	rateLimit RateLimit
+	connsMu   sync.Mutex
+	conns     map[*connection]struct{}
+}
+
+// mutatingMethods are methods changing the filesystem, they are rejected in read-only mode
+var mutatingMethods = map[string]bool{
+	"move":   true,
+	"delete": true,
+	"import": true,
+}
+
+// gatewayRestricted returns true if the request changes the filesystem or makes the server write
+// to files or URLs given by the client. Such requests are rejected on network gateways
+// unless the operator allows them.
+func gatewayRestricted(req *Request) bool {
+	switch req.Method {
+	case "set_webhook":
+		return true
+	case "export":
+		_, ok := req.Params["output"]
+		return ok
+	}
+	return mutatingMethods[req.Method]
 }
 
-// NewUnixSocketServer creates a new Unix socket server
+// NewUnixSocketServer creates a new Unix socket server accessible only by the current user.
+// Socket file left by a server which is not running anymore is replaced,
+// ErrSocketInUse is returned if another server still listens on it.
+// Path beginning with '@' binds socket in the abstract namespace, which is supported only on Linux.
 func NewUnixSocketServer(socketPath string, useStorage bool, storagePath string) (*UnixSocketServer, error) {
-	// Remove existing socket file if any
-	if _, err := os.Stat(socketPath); err == nil {
-		if err := os.Remove(socketPath); err != nil {
-			return nil, fmt.Errorf("failed to remove existing socket: %w", err)
+	return NewUnixSocketServerWithOptions(socketPath, useStorage, storagePath, Options{})
+}
+
+// NewUnixSocketServerWithOptions creates a new Unix socket server with the given options
+func NewUnixSocketServerWithOptions(
+	socketPath string, useStorage bool, storagePath string, opts Options,
+) (*UnixSocketServer, error) {
+	mode := opts.SocketMode
+	if mode == 0 {
+		mode = DefaultSocketMode
+	}
+	if err := validateSocketMode(mode); err != nil {
+		return nil, err
+	}
+	var baseDir string
+	if opts.BaseDir != "" {
+		var err error
+		if baseDir, err = resolveBaseDir(opts.BaseDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.MaxMessageSize < 0 || opts.MaxMessageSize > maxMessageSizeLimit {
+		return nil, fmt.Errorf("max message size must be between 0 and %d", maxMessageSizeLimit)
+	}
+	var ignoreFiles []FilePattern
+	if len(opts.IgnoreFilePatterns) > 0 {
+		var err error
+		if ignoreFiles, err = parseFilePatterns(opts.IgnoreFilePatterns); err != nil {
+			return nil, err
 		}
 	}
+	if useStorage && (opts.IgnoreHidden || len(ignoreFiles) > 0) {
+		return nil, errors.New("ignoring hidden files and file patterns is not supported with persistent storage")
+	}
 
-	listener, err := net.Listen("unix", socketPath)
+	var (
+		listener net.Listener
+		err      error
+	)
+	if IsAbstractSocket(socketPath) {
+		listener, err = listenAbstract(socketPath, opts.SocketGroup)
+	} else if err = removeStaleSocket(socketPath); err == nil {
+		listener, err = listenUnix(socketPath, mode, opts.SocketGroup)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create unix socket: %w", err)
+		return nil, err
 	}
 
-	// Set permissions (allow current user to access)
-	if err := os.Chmod(socketPath, 0700); err != nil {
-		listener.Close()
-		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	server := NewServer(useStorage, storagePath)
+	server.baseDir = baseDir
+	if opts.MaxMessageSize > 0 {
+		server.maxMessageSize = opts.MaxMessageSize
 	}
+	server.defaultIgnoreHidden = opts.IgnoreHidden
+	server.defaultIgnoreFiles = ignoreFiles
 
 	return &UnixSocketServer{
-		server:     NewServer(useStorage, storagePath),
+		server:     server,
 		socketPath: socketPath,
 		listener:   listener,
+		readOnly:   opts.ReadOnly,
 	}, nil
 }
 
+// Server returns state of the server, so it can be shared with HTTP server
+func (s *UnixSocketServer) Server() *Server {
+	return s.server
+}
+
+// gateway returns dispatcher of requests coming over HTTP, WebSocket or gRPC sharing state of the server.
+// Read-only mode and request timeout of the socket server apply to it as well,
+// connections of the gateway have their own rate limits.
+func (s *UnixSocketServer) gateway() *UnixSocketServer {
+	return &UnixSocketServer{
+		server:         s.server,
+		readOnly:       s.readOnly,
+		defaultTimeout: s.defaultTimeout,
+		isGateway:      true,
+		gatewayWrites:  s.gatewayWrites,
+	}
+}
+
+// SetGatewayWrites lets HTTP, WebSocket and gRPC clients move items, export to files
+// and set webhook. They are rejected by default as the gateways don't authenticate clients.
+// It has to be called before the gateways are created.
+func (s *UnixSocketServer) SetGatewayWrites(allow bool) {
+	s.gatewayWrites = allow
+}
+
+// SetScanConcurrency sets default number of directories read in parallel during scan,
+// non-positive value uses the analyzer default
+func (s *UnixSocketServer) SetScanConcurrency(n int) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	s.server.concurrency = n
+}
+
+// SetScanThrottle caps number of directories read per second by every scan,
+// scans can set only a lower limit. Non-positive value removes the cap.
+func (s *UnixSocketServer) SetScanThrottle(n int) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	s.server.maxThrottle = max(n, 0)
+}
+
+// SetMaxMemory sets ceiling of memory of the server process in bytes and the runtime memory limit to it.
+// Scans going over its high-water mark are paused and eventually aborted. Non-positive value removes the ceiling.
+func (s *UnixSocketServer) SetMaxMemory(limit int64) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	s.server.maxMemory = max(limit, 0)
+	setMemoryCeiling(s.server.maxMemory)
+}
+
+// SetScanGC sets GC settings of scans not setting const_gc or gc_percent.
+// With constGC GC settings are kept during scans instead of disabling GC,
+// positive gcPercent sets GOGC for the time of scans and implies constGC.
+func (s *UnixSocketServer) SetScanGC(constGC bool, gcPercent int) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	s.server.defaultConstGC = constGC
+	s.server.defaultGCPercent = max(gcPercent, 0)
+}
+
+// SetMaxDepth sets ceiling of depth requested by clients,
+// non-positive value disables the ceiling
+func (s *UnixSocketServer) SetMaxDepth(n int) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	s.server.maxDepth = n
+}
+
+// SetAllowedPaths restricts paths which can be scanned to the given roots and their subdirs,
+// empty list allows all paths
+func (s *UnixSocketServer) SetAllowedPaths(paths []string) error {
+	return s.server.setAllowedPaths(paths)
+}
+
+// SetWebhook sets webhook called when a scan completes or is cancelled, empty URL disables it
+func (s *UnixSocketServer) SetWebhook(config WebhookConfig) error {
+	return s.server.setWebhook(config)
+}
+
+// SetRequestTimeout sets time budget of every request, clients can only set a shorter one.
+// Zero means unlimited. It has to be called before Start.
+func (s *UnixSocketServer) SetRequestTimeout(d time.Duration) {
+	s.defaultTimeout = d
+}
+
+// SetProgressInterval sets minimal time between two progress events pushed to subscribers,
+// updates coming faster are coalesced. Zero pushes every update.
+func (s *UnixSocketServer) SetProgressInterval(d time.Duration) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	s.server.progressInterval = d
+}
+
+// SetWatchLimit sets max number of directories watched in watch mode
+func (s *UnixSocketServer) SetWatchLimit(n int) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	s.server.watchLimit = n
+}
+
+// status returns health information of the server
+func (s *UnixSocketServer) status() StatusResponse {
+	progress := s.server.progressResponse()
+
+	status := StatusResponse{
+		Uptime:      int64(time.Since(s.server.startTime).Seconds()),
+		Connections: s.active.Load(),
+		IsScanning:  progress.IsScanning,
+		Progress:    progress,
+		UseStorage:  s.server.useStorage,
+		ReadOnly:    s.readOnly,
+		BaseDir:     s.server.baseDir,
+	}
+	if s.server.useStorage {
+		status.StoragePath = s.server.storagePath
+	}
+	status.Watching, status.WatchedDirs = s.server.watchInfo()
+	status.ScanGeneration, status.ScannedAt = s.server.generation()
+	startedAt, finishedAt, duration := s.server.scanTimes()
+	if !startedAt.IsZero() {
+		status.ScanStartedAt = startedAt.Unix()
+		status.ScanDurationMs = duration.Milliseconds()
+	}
+	if !finishedAt.IsZero() {
+		status.ScanFinishedAt = finishedAt.Unix()
+	}
+
+	s.server.mu.RLock()
+	status.AllowedPaths = s.server.allowedPaths
+	status.GCMode = s.server.scanGCMode
+	status.GCPercent = s.server.scanGCPercent
+	s.server.mu.RUnlock()
+	status.RateLimits = s.rateLimits()
+	status.Alerts = s.server.alerts.list(true)
+	return status
+}
+
 // Start starts the Unix socket server
 func (s *UnixSocketServer) Start() error {
 	log.Printf("Starting Unix socket server on %s", s.socketPath)
 	log.Printf("Protocol: Length-prefixed JSON (4-byte length + JSON + newline)")
+	log.Printf("Connections starting with '{' use newline-delimited JSON without length prefix")
+	log.Printf("JSON-RPC 2.0 is used by connections whose first request has \"jsonrpc\":\"2.0\"")
 	log.Println("")
 	log.Println("API Methods:")
-	log.Println("  scan       - Start scanning a path")
-	log.Println("  progress   - Get current scanning progress")
-	log.Println("  cancel     - Cancel current scan")
-	log.Println("  directory  - Get directory information")
+	log.Println("  scan        - Start scanning a path")
+	log.Println("  progress    - Get current scanning progress")
+	log.Println("  cancel      - Cancel current scan and export")
+	log.Println("  set_concurrency - Change concurrency of running scan")
+	log.Println("  directory   - Get directory information")
+	log.Println("  list        - List names of directory children")
+	log.Println("  ancestors   - Get dirs from the scanned root down to a path")
+	log.Println("  tree        - Render scanned tree as text")
+	log.Println("  move        - Move or rename item of scanned tree")
+	log.Println("  estimate    - Quickly estimate size of a path")
+	log.Println("  mounts      - List mounted filesystems")
+	log.Println("  duplicates  - Find files with identical content")
+	log.Println("  empty_dirs  - Find empty directories")
+	log.Println("  count_by_depth - Count files and directories at each depth")
+	log.Println("  ping        - Check that the server is alive")
+	log.Println("  set_webhook - Set URL notified when a scan finishes")
+	log.Println("  set_alert   - Alert when size or daily growth of a path exceeds limit")
+	log.Println("  list_alerts - List alerts and their state")
+	log.Println("  delete_alert - Delete alert")
+	log.Println("  set_encoding - Switch connection to json or msgpack encoding")
+	log.Println("  status      - Get server health information")
+	log.Println("  metrics     - Get server metrics in Prometheus text format")
+	log.Println("  top_files   - Get the largest files")
+	log.Println("  top_dirs    - Get the largest directories")
+	log.Println("  export      - Export scanned tree as csv, tsv, du, ncdu or sqlite")
+	log.Println("  export_ncdu - Export scanned tree in ncdu JSON format")
+	log.Println("  watch       - Update scanned tree by filesystem events and push changes")
+	log.Println("  unwatch     - Stop updating scanned tree by filesystem events")
+	log.Println("  subscribe   - Receive pushed events (progress, scan_complete, tree_update, alert)")
+	log.Println("  unsubscribe - Stop receiving pushed events")
 	log.Println("")
 	log.Println("Example request: {\"id\":\"1\",\"method\":\"progress\",\"params\":{}}")
 	log.Println("")
@@ -87,11 +389,12 @@ func (s *UnixSocketServer) Start() error {
 			if strings.Contains(err.Error(), "closed") {
 				return nil
 			}
-			log.Printf("Accept error: %v", err)
+			log.Errorf("Accept error: %v", err)
 			continue
 		}
 
 		s.connections.Add(1)
+		s.active.Add(1)
 		go s.handleConnection(conn)
 	}
 }
@@ -100,6 +403,8 @@ func (s *UnixSocketServer) Start() error {
 func (s *UnixSocketServer) Stop() error {
 	log.Println("Shutting down Unix socket server...")
 
+	s.server.stopWatch()
+
 	if s.listener != nil {
 		if err := s.listener.Close(); err != nil {
 			return err
@@ -109,9 +414,11 @@ func (s *UnixSocketServer) Stop() error {
 	// Wait for all connections to finish
 	s.connections.Wait()
 
-	// Remove socket file
-	if err := os.Remove(s.socketPath); err != nil {
-		log.Printf("Warning: failed to remove socket file: %v", err)
+	// Remove socket file, abstract socket disappears with the listener
+	if !IsAbstractSocket(s.socketPath) {
+		if err := os.Remove(s.socketPath); err != nil {
+			log.Warnf("Failed to remove socket file: %v", err)
+		}
 	}
 
 	log.Println("Server stopped")
@@ -121,186 +428,1326 @@ func (s *UnixSocketServer) Stop() error {
 // handleConnection handles a single client connection
 func (s *UnixSocketServer) handleConnection(conn net.Conn) {
 	defer s.connections.Done()
+	defer s.active.Add(-1)
 	defer conn.Close()
 
-	remoteAddr := conn.RemoteAddr().String()
-	log.Printf("New connection from %s", remoteAddr)
+	id := s.lastConnID.Add(1)
+	logger := log.WithField("conn_id", id)
+	logger.Debugf("New connection from %s", conn.RemoteAddr().String())
+	defer logger.Debug("Connection closed")
+
+	c := &connection{conn: conn, logger: logger, id: id}
+	defer c.unsubscribe()
+	s.trackConnection(c)
+	defer s.untrackConnection(c)
 
 	reader := bufio.NewReader(conn)
 
+	// JSON request starts with '{' or '[', as first byte of length prefix
+	// it would mean length larger than maxMessageSizeLimit, so the framings cannot be confused
+	first, err := reader.Peek(1)
+	if err != nil {
+		return
+	}
+	if first[0] == '{' || first[0] == '[' {
+		c.ndjson = true
+		s.readLines(c, reader, s.server.maxMessageSize)
+		return
+	}
+	s.readFrames(c, reader)
+}
+
+// readFrames serves length-prefixed requests of the connection,
+// frame of invalid length closes the connection as the next frame can't be found
+func (s *UnixSocketServer) readFrames(c *connection, reader *bufio.Reader) {
+	// buffers are reused by all requests of the connection,
+	// data buffer grows to the largest request received so far
+	var lengthBytes [4]byte
+	var buf []byte
+
 	for {
 		// Read length prefix (4 bytes, big-endian)
-		lengthBytes := make([]byte, 4)
-		if _, err := io.ReadFull(reader, lengthBytes); err != nil {
+		if _, err := io.ReadFull(reader, lengthBytes[:]); err != nil {
 			if err != io.EOF {
-				log.Printf("Error reading length: %v", err)
+				c.logger.Errorf("Error reading length: %v", err)
 			}
 			return
 		}
 
-		length := binary.BigEndian.Uint32(lengthBytes)
-		if length == 0 || length > 100*1024*1024 { // Max 100MB
-			log.Printf("Invalid message length: %d", length)
-			continue
+		length := binary.BigEndian.Uint32(lengthBytes[:])
+		if length == 0 || length > uint32(s.server.maxMessageSize) {
+			c.logger.Warnf("Invalid message length: %d", length)
+			return
 		}
 
 		// Read JSON data
-		data := make([]byte, length)
+		if uint32(cap(buf)) < length {
+			buf = make([]byte, length)
+		}
+		data := buf[:length]
 		if _, err := io.ReadFull(reader, data); err != nil {
-			log.Printf("Error reading data: %v", err)
+			c.logger.Errorf("Error reading data: %v", err)
 			return
 		}
 
 		// Read and verify newline
 		newline, err := reader.ReadByte()
 		if err != nil || newline != '\n' {
-			log.Printf("Invalid newline: %v", err)
+			c.logger.Errorf("Invalid newline: %v", err)
+			return
+		}
+
+		if err := s.respond(c, data); err != nil {
+			if err != errLimitClose {
+				c.logger.Errorf("Error sending response: %v", err)
+			}
 			return
 		}
+	}
+}
+
+// readLines serves newline-delimited JSON requests of the connection,
+// line longer than maxLen closes the connection
+func (s *UnixSocketServer) readLines(c *connection, reader *bufio.Reader, maxLen int) {
+	var buf []byte
 
-		// Process request
-		response := s.processRequest(data)
+	for {
+		buf = buf[:0]
+		for {
+			chunk, err := reader.ReadSlice('\n')
+			if len(buf)+len(chunk) > maxLen+1 {
+				c.logger.Warnf("Request line longer than %d bytes", maxLen)
+				return
+			}
+			buf = append(buf, chunk...)
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err != nil {
+				if err != io.EOF {
+					c.logger.Errorf("Error reading line: %v", err)
+				}
+				return
+			}
+			break
+		}
 
-		// Send response
-		if err := s.sendResponse(conn, response); err != nil {
-			log.Printf("Error sending response: %v", err)
+		data := bytes.TrimSpace(buf)
+		if len(data) == 0 {
+			continue
+		}
+		if err := s.respond(c, data); err != nil {
+			if err != errLimitClose {
+				c.logger.Errorf("Error sending response: %v", err)
+			}
 			return
 		}
 	}
 }
 
+// respond processes request received on the connection and writes the response
+func (s *UnixSocketServer) respond(c *connection, data []byte) error {
+	if !c.detected {
+		c.detected = true
+		c.jsonrpc = c.encoding == encodingJSON && isJSONRPC(data)
+	}
+
+	receivedAt := time.Now()
+	if c.jsonrpc {
+		return c.checkClosing(s.serveJSONRPC(c, data))
+	}
+	response := s.serveRequest(c, data)
+	return c.checkClosing(c.sendResponse(response, receivedAt, time.Since(receivedAt)))
+}
+
 // processRequest processes a request and returns a response
 func (s *UnixSocketServer) processRequest(data []byte) *Response {
+	return s.serveRequest(&connection{logger: log.NewEntry(log.StandardLogger())}, data)
+}
+
+// serveRequest processes a request received on the connection
+func (s *UnixSocketServer) serveRequest(c *connection, data []byte) *Response {
 	var req Request
-	if err := json.Unmarshal(data, &req); err != nil {
+	if err := decodeRequest(c.encoding, data, &req); err != nil {
+		c.logger.Warnf("Invalid request: %v", err)
+		if c.encoding == encodingJSON {
+			return &Response{
+				ID:      "",
+				Success: false,
+				Error:   fmt.Sprintf("Invalid JSON: %v", err),
+			}
+		}
 		return &Response{
 			ID:      "",
 			Success: false,
-			Error:   fmt.Sprintf("Invalid JSON: %v", err),
+			Error:   fmt.Sprintf("Invalid MessagePack: %v", err),
 		}
 	}
 
-	log.Printf("[%s] %s", req.ID, req.Method)
+	return s.dispatch(context.Background(), c, &req)
+}
+
+// dispatch executes decoded request, records it in metrics and logs it on debug level.
+// The request stops once the parent context is done or its time budget runs out.
+func (s *UnixSocketServer) dispatch(parent context.Context, c *connection, req *Request) *Response {
+	if err := validCompression(req.Compress); err != nil {
+		return &Response{
+			ID:      req.ID,
+			Success: false,
+			Error:   err.Error(),
+		}
+	}
+
+	ctx := parent
+	if timeout := s.requestTimeout(req); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if resp := s.allow(c, req); resp != nil {
+		return resp
+	}
+
+	start := time.Now()
+	resp := s.handleRequest(ctx, c, req)
+	resp.includeMeta = req.IncludeMeta
+	resp.compress = req.Compress
+	duration := time.Since(start)
+
+	// methods are chosen by clients, unknown ones share one label to keep number of series bounded
+	method := req.Method
+	if resp.Code == ErrCodeUnknownMethod {
+		method = "unknown"
+	}
+	s.server.metrics.observeRequest(method, resp.Success, duration)
+
+	if c.logger.Logger.IsLevelEnabled(log.DebugLevel) {
+		c.logger.WithFields(log.Fields{
+			"request_id":  req.ID,
+			"method":      req.Method,
+			"duration_ms": durationMs(duration),
+			"success":     resp.Success,
+		}).Debug("Request processed")
+	}
+	return resp
+}
 
+// handleRequest executes method of the request.
+// Long-running methods stop once the context is done.
+func (s *UnixSocketServer) handleRequest(ctx context.Context, c *connection, req *Request) *Response {
 	resp := &Response{
 		ID:      req.ID,
 		Success: true,
 	}
 
+	if s.readOnly && mutatingMethods[req.Method] {
+		resp.Success = false
+		resp.Error = "server is read-only"
+		resp.Code = ErrCodeReadOnly
+		return resp
+	}
+	if s.isGateway && !s.gatewayWrites && gatewayRestricted(req) {
+		resp.Success = false
+		resp.Error = fmt.Sprintf("method %s writing to the filesystem is not allowed over network gateway", req.Method)
+		resp.Code = ErrCodeForbidden
+		return resp
+	}
+
 	switch req.Method {
 	case "scan":
-		path, err := getStringParam(req.Params, "path")
+		paths, err := getScanPaths(req.Params)
 		if err != nil {
 			resp.Success = false
 			resp.Error = err.Error()
-		} else {
-			go s.server.scan(path)
-			resp.Data = map[string]bool{"started": true}
+			break
+		}
+		var code string
+		for i, path := range paths {
+			if paths[i], code, err = s.server.checkScanPath(path); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			resp.Code = code
+			break
+		}
+		if len(paths) > 1 {
+			if _, ok := s.server.analyzer.(multiPathAnalyzer); !ok {
+				resp.Success = false
+				resp.Error = "scan of multiple paths is not supported with persistent storage"
+				break
+			}
+			if err := checkOverlap(paths); err != nil {
+				resp.Success = false
+				resp.Error = err.Error()
+				break
+			}
+		}
+		opts, err := getScanOptions(req.Params)
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		s.server.applyIgnoreDefaults(&opts, req.Params)
+		s.server.applyGCDefaults(&opts, req.Params)
+		if opts.watch && s.server.useStorage {
+			resp.Success = false
+			resp.Error = "watch mode is not supported with persistent storage"
+			break
+		}
+		if param := opts.storageUnsupported(); param != "" && s.server.useStorage {
+			resp.Success = false
+			resp.Error = fmt.Sprintf("parameter %s is not supported with persistent storage", param)
+			break
+		}
+		if opts.watch && len(paths) > 1 {
+			resp.Success = false
+			resp.Error = "watch mode is not supported with multiple paths"
+			break
+		}
+
+		// scan is reported as running already to requests following this one
+		if s.server.beginScan(&opts) {
+			go s.server.runScan(paths, opts)
+		}
+		resp.Data = ScanResponse{
+			Started:            true,
+			IgnoreFilePatterns: opts.ignoreFiles,
 		}
 
 	case "progress":
-		s.server.mu.RLock()
-		isScanning := s.server.isScanning
-		progress := s.server.progress
-		s.server.mu.RUnlock()
+		resp.Data = s.server.progressResponse()
 
-		resp.Data = ProgressResponse{
-			IsScanning:      isScanning,
-			CurrentItemName: progress.CurrentItemName,
-			ItemCount:       progress.ItemCount,
-			TotalSize:       progress.TotalSize,
-		}
+	case "ping":
+		// liveness check, answers before any scan and without taking server locks
+		resp.Data = map[string]bool{"pong": true}
+
+	case "status":
+		resp.Data = s.status()
+
+	case "metrics":
+		var buff strings.Builder
+		s.writeMetrics(&buff)
+		resp.Data = MetricsResponse{Metrics: buff.String()}
 
 	case "cancel":
+		// export holds the tree lock, it has to stop first
+		exportCancelled := s.server.cancelExport()
+		if keepPartial, _ := getBoolParam(req.Params, "keep_partial", false); keepPartial {
+			partialKept := s.server.cancelKeepingPartial(ctx)
+			resp.Data = map[string]bool{"cancelled": true, "export_cancelled": exportCancelled, "partial_kept": partialKept}
+			break
+		}
 		s.server.mu.Lock()
 		if s.server.cancelFunc != nil {
 			s.server.cancelFunc()
 			s.server.analyzer.Cancel()
 			s.server.cancelFunc = nil
 		}
-		s.server.isScanning = false
-		s.server.progress = common.CurrentProgress{}  // Clear progress state
-		s.server.currentDir = nil                     // Clear scan results
+		scanning := s.server.isScanning
+		done := s.server.scanDone
+		s.server.progress = common.CurrentProgress{} // Clear progress state
+		s.server.pendingDir = nil                    // Result of the last finished scan is kept
 		s.server.mu.Unlock()
 
-		resp.Data = map[string]bool{"cancelled": true}
+		// the scan stays running until it stops using the analyzer,
+		// so a scan requested after the cancel does not share it
+		if scanning {
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+		}
 
-	case "directory":
-		path, _ := getStringParam(req.Params, "path")
-		depth, _ := getIntParam(req.Params, "depth", 0)
+		resp.Data = map[string]bool{"cancelled": true, "export_cancelled": exportCancelled}
 
-		s.server.mu.RLock()
-		if s.server.currentDir == nil {
-			s.server.mu.RUnlock()
+	case "set_concurrency":
+		if _, ok := req.Params["value"]; !ok {
 			resp.Success = false
-			resp.Error = "No scan completed"
+			resp.Error = "missing parameter: value"
+			break
+		}
+		value, err := getIntParam(req.Params, "value", 0)
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
 			break
 		}
+		value = max(value, 1)
 
-		var dir fs.Item
-		if path == "" {
-			dir = s.server.currentDir
+		if s.server.setConcurrency(value) {
+			resp.Data = map[string]int{"concurrency": value}
 		} else {
-			dir = findDirectory(s.server.currentDir, path)
+			resp.Success = false
+			resp.Error = "No scan in progress"
 		}
-		s.server.mu.RUnlock()
 
-		if dir == nil {
+	case "set_alert":
+		var alert Alert
+		path, err := getStringParam(req.Params, "path")
+		if err == nil && path == "" {
+			err = fmt.Errorf("parameter path must not be empty")
+		}
+		if err != nil {
 			resp.Success = false
-			resp.Error = "Directory not found"
-		} else {
-			resp.Data = convertToDirInfo(dir, depth)
+			resp.Error = err.Error()
+			break
 		}
+		if path, err = s.server.resolveBasePath(path); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			resp.Code = ErrCodeForbidden
+			break
+		}
+		alert.Path = filepath.Clean(path)
+		if _, ok := req.Params["id"]; ok {
+			alert.ID, err = getStringParam(req.Params, "id")
+		}
+		var maxSize, maxGrowth int
+		if err == nil {
+			maxSize, err = getIntParam(req.Params, "max_size_bytes", 0)
+		}
+		if err == nil {
+			maxGrowth, err = getIntParam(req.Params, "max_growth_bytes_per_day", 0)
+		}
+		if err == nil && (maxSize < 0 || maxGrowth < 0) {
+			err = fmt.Errorf("alert limits must not be negative")
+		}
+		if err == nil && maxSize == 0 && maxGrowth == 0 {
+			err = fmt.Errorf("parameter max_size_bytes or max_growth_bytes_per_day is required")
+		}
+		if err == nil {
+			alert.MaxSize, alert.MaxGrowthPerDay = int64(maxSize), int64(maxGrowth)
+			alert, err = s.server.alerts.set(alert)
+		}
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		// the new alert is checked against the tree scanned already
+		s.server.evaluateAlerts()
+		resp.Data = alert
 
-	default:
-		resp.Success = false
-		resp.Error = fmt.Sprintf("Unknown method: %s", req.Method)
-	}
-
-	return resp
-}
-
-// sendResponse sends a response to the client
-func (s *UnixSocketServer) sendResponse(conn net.Conn, resp *Response) error {
-	// Marshal response to JSON
-	data, err := json.Marshal(resp)
-	if err != nil {
-		return fmt.Errorf("failed to marshal response: %w", err)
-	}
-
-	// Send length prefix (4 bytes, big-endian)
-	length := uint32(len(data))
-	lengthBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(lengthBytes, length)
-
-	if err := writeAll(conn, lengthBytes); err != nil {
-		return err
-	}
+	case "list_alerts":
+		resp.Data = AlertsResponse{Alerts: s.server.alerts.list(false)}
 
-	// Send JSON data
-	if err := writeAll(conn, data); err != nil {
-		return err
-	}
+	case "delete_alert":
+		id, err := getStringParam(req.Params, "id")
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		deleted, err := s.server.alerts.delete(id)
+		if err == nil && !deleted {
+			err = fmt.Errorf("alert %s not found", id)
+		}
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		resp.Data = map[string]bool{"deleted": true}
 
-	// Send newline
-	return writeAll(conn, []byte{'\n'})
-}
+	case "set_webhook":
+		var config WebhookConfig
+		var err error
+		if _, ok := req.Params["url"]; ok {
+			config.URL, err = getStringParam(req.Params, "url")
+		}
+		if _, ok := req.Params["secret"]; ok && err == nil {
+			config.Secret, err = getStringParam(req.Params, "secret")
+		}
+		var timeout int
+		if err == nil {
+			timeout, err = getIntParam(req.Params, "timeout_sec", 0)
+		}
+		if err == nil {
+			config.Timeout = time.Duration(timeout) * time.Second
+			err = s.server.setWebhook(config)
+		}
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		resp.Data = map[string]bool{"enabled": config.URL != ""}
 
-// writeAll writes all data to the connection, handling short writes
-func writeAll(conn net.Conn, data []byte) error {
-	total := 0
-	for total < len(data) {
-		n, err := conn.Write(data[total:])
-		total += n
+	case "set_encoding":
+		name, err := getStringParam(req.Params, "encoding")
 		if err != nil {
-			return err
+			resp.Success = false
+			resp.Error = err.Error()
+			break
 		}
-	}
-	return nil
-}
+		enc, err := parseEncoding(name)
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		if c.textOnly() && enc != encodingJSON {
+			resp.Success = false
+			resp.Error = "JSON-RPC, newline-delimited and WebSocket connections can use only json encoding"
+			break
+		}
+		// this response still uses the current encoding
+		c.pendingEncoding = &enc
+		resp.Data = map[string]string{"encoding": name}
 
-// getStringParam gets a string parameter from params map
-func getStringParam(params map[string]interface{}, key string) (string, error) {
+	case "watch":
+		if s.server.useStorage {
+			resp.Success = false
+			resp.Error = "watch mode is not supported with persistent storage"
+			break
+		}
+		if err := s.server.startWatch(); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		// changes are pushed to the connection which asked for them
+		if c.canPush() {
+			c.subscribeTo(s.server.events, EventTreeUpdate)
+		}
+		_, watched := s.server.watchInfo()
+		resp.Data = map[string]interface{}{"watching": true, "watched_dirs": watched}
+
+	case "unwatch":
+		s.server.stopWatch()
+		resp.Data = map[string]bool{"watching": false}
+
+	case "subscribe":
+		if !c.canPush() {
+			resp.Success = false
+			resp.Error = "Subscriptions need a socket or WebSocket connection"
+			break
+		}
+		events, err := getStringSliceParam(req.Params, "events")
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		c.subscribe(s.server.events, events)
+		resp.Data = map[string]interface{}{"subscribed": true, "events": events}
+
+	case "unsubscribe":
+		c.unsubscribe()
+		resp.Data = map[string]bool{"subscribed": false}
+
+	case "directory":
+		path, _ := getStringParam(req.Params, "path")
+		if path != "" {
+			var err error
+			if path, err = s.server.resolveBasePath(path); err != nil {
+				resp.Success = false
+				resp.Error = err.Error()
+				resp.Code = ErrCodeForbidden
+				break
+			}
+		}
+		depth, _ := getIntParam(req.Params, "depth", 0)
+		opts := dirInfoOptions{}
+		depth, opts.capped = s.server.clampDepth(depth)
+		opts.includeTimes, _ = getBoolParam(req.Params, "include_times", false)
+		opts.includeOwner, _ = getBoolParam(req.Params, "include_owner", false)
+		opts.human, _ = getBoolParam(req.Params, "human", false)
+		opts.percent, _ = getBoolParam(req.Params, "percent", false)
+		opts.cumulative, _ = getBoolParam(req.Params, "cumulative", false)
+		opts.types, _ = getBoolParam(req.Params, "include_types", false)
+		allowPartial, _ := getBoolParam(req.Params, "allow_partial", false)
+		minSize, err := getIntParam(req.Params, "min_size", 0)
+		if err == nil && minSize < 0 {
+			err = fmt.Errorf("parameter min_size must not be negative")
+		}
+		if _, ok := req.Params["size_mode"]; ok && err == nil {
+			var mode string
+			if mode, err = getStringParam(req.Params, "size_mode"); err == nil {
+				opts.usage, err = parseSizeMode(mode)
+			}
+		}
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		opts.minSize = int64(minSize)
+
+		s.server.mu.RLock()
+		isScanning := s.server.isScanning
+		s.server.mu.RUnlock()
+
+		if allowPartial && isScanning {
+			if root := s.server.partialRoot(); root != nil && escapesRoots(root, path) {
+				resp.Success = false
+				resp.Error = "Path escapes scanned root"
+				resp.Code = ErrCodeForbidden
+				break
+			}
+			if info, ok := s.server.partialDirInfo(path, depth, opts); ok {
+				resp.Data = info
+			} else {
+				resp.Success = false
+				resp.Error = "Directory not found"
+			}
+			break
+		}
+
+		s.server.mu.RLock()
+		if s.server.completedDir == nil {
+			s.server.mu.RUnlock()
+			resp.Success = false
+			resp.Error = "No scan completed"
+			break
+		}
+		if escapesRoots(s.server.completedDir, path) {
+			s.server.mu.RUnlock()
+			resp.Success = false
+			resp.Error = "Path escapes scanned root"
+			resp.Code = ErrCodeForbidden
+			break
+		}
+
+		var dir fs.Item
+		if path == "" {
+			dir = s.server.completedDir
+		} else {
+			dir = s.server.findItem(path)
+		}
+		opts.updates = s.server.updates
+
+		// tree can be changed by watch mode, convert it under the lock
+		var info DirInfo
+		if dir != nil {
+			info = convertToDirInfo(dir, depth, opts)
+			info.ScanGeneration = s.server.scanGeneration
+			info.ScannedAt = s.server.scannedAt.Unix()
+		}
+		s.server.mu.RUnlock()
+
+		if dir == nil {
+			resp.Success = false
+			resp.Error = "Directory not found"
+		} else if allowPartial {
+			// tree kept after cancelled scan is finished but not complete
+			resp.Data = PartialDirInfo{
+				DirInfo:  info,
+				Complete: info.Complete == nil,
+			}
+		} else {
+			resp.Data = info
+		}
+
+	case "list":
+		path, _ := getStringParam(req.Params, "path")
+		if path != "" {
+			var err error
+			if path, err = s.server.resolveBasePath(path); err != nil {
+				resp.Success = false
+				resp.Error = err.Error()
+				resp.Code = ErrCodeForbidden
+				break
+			}
+		}
+
+		s.server.mu.RLock()
+		if s.server.completedDir == nil {
+			s.server.mu.RUnlock()
+			resp.Success = false
+			resp.Error = "No scan completed"
+			break
+		}
+		if escapesRoots(s.server.completedDir, path) {
+			s.server.mu.RUnlock()
+			resp.Success = false
+			resp.Error = "Path escapes scanned root"
+			resp.Code = ErrCodeForbidden
+			break
+		}
+
+		dir := s.server.completedDir
+		if path != "" {
+			dir = s.server.findItem(path)
+		}
+		switch {
+		case dir == nil:
+			resp.Success = false
+			resp.Error = "Directory not found"
+		case !dir.IsDir():
+			resp.Success = false
+			resp.Error = "Not a directory"
+		default:
+			resp.Data = listDir(dir)
+		}
+		s.server.mu.RUnlock()
+
+	case "ancestors":
+		path, err := getStringParam(req.Params, "path")
+		if err == nil {
+			path, err = s.server.resolveBasePath(path)
+		}
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			if errors.Is(err, errOutsideBaseDir) {
+				resp.Code = ErrCodeForbidden
+			}
+			break
+		}
+		opts := dirInfoOptions{}
+		opts.human, _ = getBoolParam(req.Params, "human", false)
+
+		s.server.mu.RLock()
+		root := s.server.completedDir
+		var item fs.Item
+		if root != nil && !escapesRoots(root, path) {
+			item = s.server.findItem(path)
+		}
+		if item != nil {
+			resp.Data = ancestors(root, item, opts)
+		}
+		s.server.mu.RUnlock()
+
+		switch {
+		case root == nil:
+			resp.Success = false
+			resp.Error = "No scan completed"
+		case item == nil:
+			resp.Success = false
+			resp.Error = "Item not found"
+		}
+
+	case "tree":
+		path, _ := getStringParam(req.Params, "path")
+		if path != "" {
+			var err error
+			if path, err = s.server.resolveBasePath(path); err != nil {
+				resp.Success = false
+				resp.Error = err.Error()
+				resp.Code = ErrCodeForbidden
+				break
+			}
+		}
+		opts := treeOptions{}
+		maxDepth, err := getIntParam(req.Params, "max_depth", defaultTreeDepth)
+		if err == nil && maxDepth < 0 {
+			err = fmt.Errorf("parameter max_depth must not be negative")
+		}
+		if err == nil {
+			opts.human, err = getBoolParam(req.Params, "human", true)
+		}
+		if _, ok := req.Params["size_mode"]; ok && err == nil {
+			var mode string
+			if mode, err = getStringParam(req.Params, "size_mode"); err == nil {
+				opts.usage, err = parseSizeMode(mode)
+			}
+		}
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		opts.maxDepth, _ = s.server.clampDepth(maxDepth)
+
+		s.server.mu.RLock()
+		root := s.server.completedDir
+		var item fs.Item
+		if root != nil && !escapesRoots(root, path) {
+			item = root
+			if path != "" {
+				item = s.server.findItem(path)
+			}
+		}
+		var tree string
+		if item != nil {
+			tree, err = renderTree(ctx, item, opts)
+		}
+		s.server.mu.RUnlock()
+
+		switch {
+		case root == nil:
+			resp.Success = false
+			resp.Error = "No scan completed"
+		case item == nil:
+			resp.Success = false
+			resp.Error = "Item not found"
+		case isTimeout(err):
+			resp.setTimeout(0, nil)
+		case err != nil:
+			resp.Success = false
+			resp.Error = err.Error()
+		default:
+			resp.Data = TreeResponse{Tree: tree}
+		}
+
+	case "move":
+		from, err := getStringParam(req.Params, "from")
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		to, err := getStringParam(req.Params, "to")
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		overwrite, err := getBoolParam(req.Params, "overwrite", false)
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		if s.server.useStorage {
+			resp.Success = false
+			resp.Error = "move is not supported with persistent storage"
+			break
+		}
+		if from, err = s.server.resolveBasePath(from); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			resp.Code = ErrCodeForbidden
+			break
+		}
+		if to, err = s.server.resolveBasePath(to); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			resp.Code = ErrCodeForbidden
+			break
+		}
+		if err := s.server.checkPathAllowed(from); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			resp.Code = ErrCodeForbidden
+			break
+		}
+		if err := s.server.checkPathAllowed(filepath.Dir(to)); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			resp.Code = ErrCodeForbidden
+			break
+		}
+
+		info, err := s.server.moveItem(from, to, overwrite)
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			if errors.Is(err, errOutsideRoot) {
+				resp.Code = ErrCodeForbidden
+			}
+		} else {
+			resp.Data = info
+		}
+
+	case "estimate":
+		path, err := getStringParam(req.Params, "path")
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		if path, err = s.server.resolveBasePath(path); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			resp.Code = ErrCodeForbidden
+			break
+		}
+		if err := s.server.checkPathAllowed(path); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			resp.Code = ErrCodeForbidden
+			break
+		}
+		depth, _ := getIntParam(req.Params, "depth", 2)
+		depth, _ = s.server.clampDepth(min(depth, maxEstimateDepth))
+
+		budget := &walkBudget{ctx: ctx}
+		estimation, err := estimate(path, depth, budget)
+		if isTimeout(err) {
+			resp.setTimeout(budget.examined, estimation)
+		} else if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+		} else {
+			resp.Data = estimation
+		}
+
+	case "duplicates":
+		minSize, err := getIntParam(req.Params, "min_size", 1)
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+
+		budget := &walkBudget{ctx: ctx}
+		s.server.mu.RLock()
+		root := s.server.completedDir
+		if root != nil {
+			resp.Data, err = findDuplicates(root, int64(minSize), budget)
+		}
+		s.server.mu.RUnlock()
+
+		if root == nil {
+			resp.Success = false
+			resp.Error = "No scan completed"
+		} else if isTimeout(err) {
+			resp.setTimeout(budget.examined, nil)
+		}
+
+	case "count_by_depth":
+		s.server.mu.RLock()
+		root := s.server.completedDir
+		if root != nil {
+			resp.Data = countByDepth(root)
+		}
+		s.server.mu.RUnlock()
+
+		if root == nil {
+			resp.Success = false
+			resp.Error = "No scan completed"
+		}
+
+	case "empty_dirs":
+		nested, err := getBoolParam(req.Params, "nested", false)
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+
+		s.server.mu.RLock()
+		root := s.server.completedDir
+		if root != nil {
+			resp.Data = findEmptyDirs(root, nested)
+		}
+		s.server.mu.RUnlock()
+
+		if root == nil {
+			resp.Success = false
+			resp.Error = "No scan completed"
+		}
+
+	case "top_files":
+		count, err := getIntParam(req.Params, "count", 10)
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		if count <= 0 {
+			resp.Success = false
+			resp.Error = "parameter count must be positive"
+			break
+		}
+
+		budget := &walkBudget{ctx: ctx}
+		top, ok, err := s.server.largestFiles(count, budget)
+		if !ok {
+			resp.Success = false
+			resp.Error = "No scan completed"
+		} else if isTimeout(err) {
+			// largest files found before the deadline
+			resp.setTimeout(budget.examined, top)
+		} else {
+			resp.Data = top
+		}
+
+	case "top_dirs":
+		count, err := getIntParam(req.Params, "count", 10)
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		if count <= 0 {
+			resp.Success = false
+			resp.Error = "parameter count must be positive"
+			break
+		}
+		excludeRoot, err := getBoolParam(req.Params, "exclude_root", false)
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+
+		if top, ok := s.server.largestDirs(count, excludeRoot); ok {
+			resp.Data = top
+		} else {
+			resp.Success = false
+			resp.Error = "No scan completed"
+		}
+
+	case "export":
+		opts := exportOptions{}
+		var err error
+		if opts.format, err = getStringParam(req.Params, "format"); err == nil {
+			err = checkExportFormat(opts.format)
+		}
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		if opts.maxDepth, err = getIntParam(req.Params, "max_depth", -1); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		if opts.human, err = getBoolParam(req.Params, "human", true); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+		if opts.dirsOnly, err = getBoolParam(req.Params, "dirs_only", false); err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			break
+		}
+
+		// export is written to the output file on the server instead of the response
+		var output string
+		if _, ok := req.Params["output"]; ok {
+			if s.readOnly {
+				resp.Success = false
+				resp.Error = "server is read-only"
+				resp.Code = ErrCodeReadOnly
+				break
+			}
+			if output, err = getStringParam(req.Params, "output"); err != nil {
+				resp.Success = false
+				resp.Error = err.Error()
+				break
+			}
+			if output, err = s.server.resolveBasePath(output); err == nil {
+				err = s.server.checkOutputAllowed(output)
+			}
+			if err != nil {
+				resp.Success = false
+				resp.Error = err.Error()
+				resp.Code = ErrCodeForbidden
+				break
+			}
+			if opts.overwrite, err = getBoolParam(req.Params, "overwrite", false); err != nil {
+				resp.Success = false
+				resp.Error = err.Error()
+				break
+			}
+		}
+
+		var data interface{}
+		var rows atomic.Int64
+		s.server.mu.RLock()
+		root := s.server.completedDir
+		s.server.mu.RUnlock()
+
+		if root != nil && output == "" {
+			// the tree is serialized holding only the lock against its changes,
+			// the response is limited, larger exports have to be written to output
+			opts.rows = &rows
+			opts.limit = maxResponseExportSize
+			s.server.editMu.RLock()
+			data, err = export(ctx, root, opts)
+			s.server.editMu.RUnlock()
+		}
+
+		// export to file can take long, it holds only the lock against changes of the tree
+		if root != nil && output != "" {
+			var exported ExportResponse
+			exported, err = s.server.exportToFile(ctx, output, root, opts)
+			data = exported
+			rows.Store(exported.Rows)
+		}
+
+		if root == nil {
+			resp.Success = false
+			resp.Error = "No scan completed"
+		} else if isTimeout(err) {
+			resp.setTimeout(rows.Load(), nil)
+		} else if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			if errors.Is(err, errExportTooLarge) {
+				resp.Code = ErrCodeTooLarge
+			}
+		} else {
+			resp.Data = data
+		}
+
+	case "export_ncdu":
+		s.server.mu.RLock()
+		root := s.server.completedDir
+		s.server.mu.RUnlock()
+		var (
+			data interface{}
+			err  error
+		)
+		if root != nil {
+			s.server.editMu.RLock()
+			data, err = exportNcdu(ctx, root, maxResponseExportSize)
+			s.server.editMu.RUnlock()
+		}
+
+		if root == nil {
+			resp.Success = false
+			resp.Error = "No scan completed"
+		} else if isTimeout(err) {
+			resp.setTimeout(0, nil)
+		} else if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+			if errors.Is(err, errExportTooLarge) {
+				resp.Code = ErrCodeTooLarge
+			}
+		} else {
+			resp.Data = data
+		}
+
+	case "mounts":
+		mounts, err := s.server.mounts()
+		if err != nil {
+			resp.Success = false
+			resp.Error = err.Error()
+		} else {
+			resp.Data = mounts
+		}
+
+	default:
+		resp.Success = false
+		resp.Error = fmt.Sprintf("Unknown method: %s", req.Method)
+		resp.Code = ErrCodeUnknownMethod
+	}
+
+	return resp
+}
+
+// connection is a client connection, responses and pushed events are written to it one at a time
+type connection struct {
+	conn    net.Conn
+	logger  *log.Entry
+	id      uint64
+	writeMu sync.Mutex
+	// encoding of bodies, changed only by the reading goroutine while holding writeMu
+	encoding encoding
+	// pendingEncoding is switched to once the response to set_encoding is written
+	pendingEncoding *encoding
+	// detected is set once the protocol of the connection is known from its first request,
+	// jsonrpc is set when the client speaks JSON-RPC 2.0 instead of the native protocol
+	detected bool
+	jsonrpc  bool
+	// ndjson is set when requests and responses are newline-delimited JSON without length prefix
+	ndjson bool
+	// ws is set instead of conn for WebSocket connections, every frame is sent as text message
+	ws *websocket.Conn
+	// hub and sub are set while the connection is subscribed to events
+	hub        *eventHub
+	sub        *subscription
+	forwarding sync.WaitGroup
+	// bucket limits rate of requests, nil if they are not limited
+	bucket *tokenBucket
+	// requests counts requests when their number is capped,
+	// closing is set once request over the limit was rejected and the connection has to be closed
+	requests atomic.Uint64
+	closing  atomic.Bool
+}
+
+// send writes frame with the value to the client, it is encoded under the write lock
+// so pushed events never use encoding the client has not switched to yet
+func (c *connection) send(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	frame, err := encodeFrame(v, c.encoding)
+	if err != nil {
+		return err
+	}
+	defer releaseFrame(frame)
+	return c.write(frame)
+}
+
+// write writes the frame to the client, caller must hold writeMu.
+// Newline-delimited connections get the body without length prefix,
+// WebSocket connections get the body as text message.
+func (c *connection) write(frame *bytes.Buffer) error {
+	switch {
+	case c.ws != nil:
+		b := frame.Bytes()
+		if err := c.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+			return err
+		}
+		return c.ws.WriteMessage(websocket.TextMessage, b[frameHeaderSize:len(b)-1])
+	case c.ndjson:
+		return writeAll(c.conn, frame.Bytes()[frameHeaderSize:])
+	default:
+		return writeAll(c.conn, frame.Bytes())
+	}
+}
+
+// canPush returns true if events can be pushed to the client
+func (c *connection) canPush() bool {
+	return c.conn != nil || c.ws != nil
+}
+
+// textOnly returns true if the connection cannot carry binary bodies
+func (c *connection) textOnly() bool {
+	return c.jsonrpc || c.ndjson || c.ws != nil
+}
+
+// subscribe starts pushing events with given names to the client, replacing previous subscription
+func (c *connection) subscribe(hub *eventHub, names []string) {
+	c.unsubscribe()
+
+	c.hub = hub
+	c.sub = hub.subscribe(names)
+	c.forwarding.Add(1)
+	go c.forward(c.sub)
+}
+
+// subscribeTo adds events with given names to the subscription of the connection
+func (c *connection) subscribeTo(hub *eventHub, names ...string) {
+	if c.sub == nil {
+		c.subscribe(hub, names)
+		return
+	}
+	hub.addNames(c.sub, names...)
+}
+
+// unsubscribe stops pushing events and waits until no more events are written
+func (c *connection) unsubscribe() {
+	if c.sub == nil {
+		return
+	}
+	c.hub.unsubscribe(c.sub)
+	c.forwarding.Wait()
+	c.hub, c.sub = nil, nil
+}
+
+// forward writes events of the subscription to the client until it is unsubscribed
+func (c *connection) forward(sub *subscription) {
+	defer c.forwarding.Done()
+
+	for event := range sub.events {
+		var v interface{} = event
+		if c.jsonrpc {
+			v = rpcNotification{JSONRPC: jsonrpcVersion, Method: event.Event, Params: event.Data}
+		}
+		if err := c.send(v); err != nil {
+			c.logger.Debugf("Error sending %s event: %v", event.Event, err)
+		}
+	}
+}
+
+// sendResponse writes response to the client, with timing of the request
+// and compressed if the client asked for it
+func (c *connection) sendResponse(resp *Response, receivedAt time.Time, processing time.Duration) error {
+	start := time.Now()
+	frame, err := encodeFrame(resp, c.encoding)
+	if err != nil {
+		// data which cannot be encoded must not break the connection, the client gets error instead
+		c.logger.Warnf("Failed to encode response of request %s: %v", resp.ID, err)
+		resp = &Response{
+			ID:          resp.ID,
+			Error:       err.Error(),
+			Code:        ErrCodeEncoding,
+			includeMeta: resp.includeMeta,
+		}
+		if frame, err = encodeFrame(resp, c.encoding); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		releaseFrame(frame)
+	}()
+
+	if resp.includeMeta {
+		meta := &Meta{
+			ReceivedAt:    receivedAt,
+			ProcessingMs:  durationMs(processing),
+			EncodeMs:      durationMs(time.Since(start)),
+			ResponseBytes: frameDataLen(frame),
+		}
+		if c.encoding == encodingJSON {
+			if err := appendMeta(frame, meta); err != nil {
+				return err
+			}
+		} else {
+			// MessagePack map cannot be extended in place, the response is encoded again
+			resp.Meta = meta
+			withMeta, err := encodeFrame(resp, c.encoding)
+			if err != nil {
+				return err
+			}
+			releaseFrame(frame)
+			frame = withMeta
+		}
+	}
+	// compressed body is binary, responses of text connections are never compressed
+	if resp.compress != "" && !c.textOnly() && frameDataLen(frame) > compressThreshold {
+		compressed, err := compressFrame(frame, resp.compress)
+		if err != nil {
+			return err
+		}
+		releaseFrame(frame)
+		frame = compressed
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.write(frame); err != nil {
+		return err
+	}
+	if c.pendingEncoding != nil {
+		c.encoding = *c.pendingEncoding
+		c.pendingEncoding = nil
+	}
+	return nil
+}
+
+// appendMeta adds timing of the request to the JSON encoded response,
+// so the response does not need to be encoded again
+func appendMeta(frame *bytes.Buffer, m *Meta) error {
+	meta, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response meta: %w", err)
+	}
+
+	// replace closing brace of the response object and the newline with the meta field
+	frame.Truncate(frame.Len() - 2)
+	frame.WriteString(`,"meta":`)
+	frame.Write(meta)
+	frame.WriteString("}\n")
+	setFrameLength(frame)
+	return nil
+}
+
+// durationMs returns duration in milliseconds with microsecond precision
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// writeAll writes all data to the connection, handling short writes
+func writeAll(conn net.Conn, data []byte) error {
+	total := 0
+	for total < len(data) {
+		n, err := conn.Write(data[total:])
+		total += n
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getStringParam gets a string parameter from params map
+func getStringParam(params map[string]interface{}, key string) (string, error) {
 	if params == nil {
 		return "", fmt.Errorf("missing parameter: %s", key)
 	}
@@ -318,6 +1765,180 @@ func getStringParam(params map[string]interface{}, key string) (string, error) {
 	return str, nil
 }
 
+// getStringSliceParam gets an optional array of strings from params map
+func getStringSliceParam(params map[string]interface{}, key string) ([]string, error) {
+	if params == nil {
+		return nil, nil
+	}
+
+	val, ok := params[key]
+	if !ok {
+		return nil, nil
+	}
+
+	items, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter %s must be array of strings", key)
+	}
+
+	strs := make([]string, 0, len(items))
+	for _, item := range items {
+		str, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("parameter %s must be array of strings", key)
+		}
+		strs = append(strs, str)
+	}
+
+	return strs, nil
+}
+
+// getBoolParam gets a boolean parameter from params map
+func getBoolParam(params map[string]interface{}, key string, defaultValue bool) (bool, error) {
+	if params == nil {
+		return defaultValue, nil
+	}
+
+	val, ok := params[key]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	b, ok := val.(bool)
+	if !ok {
+		return defaultValue, fmt.Errorf("parameter %s must be boolean", key)
+	}
+
+	return b, nil
+}
+
+// getScanOptions gets scan settings from params map
+// storageUnsupported returns name of the param of a set option the analyzer
+// with persistent storage does not apply, empty if there is none
+func (opts scanOptions) storageUnsupported() string {
+	switch {
+	case opts.ignoreHidden:
+		return "ignore_hidden"
+	case len(opts.ignoreFiles) > 0:
+		return "ignore_file_patterns"
+	case opts.trackTopFiles > 0:
+		return "track_top_files"
+	case opts.blockSize > 0:
+		return "block_size"
+	case opts.linkTargets:
+		return "include_types"
+	case opts.sortResults != "":
+		return "sort_results"
+	default:
+		return ""
+	}
+}
+
+func getScanOptions(params map[string]interface{}) (scanOptions, error) {
+	var (
+		opts scanOptions
+		err  error
+	)
+
+	if opts.concurrency, err = getIntParam(params, "concurrency", 0); err != nil {
+		return opts, err
+	}
+	if opts.throttle, err = getIntParam(params, "throttle", 0); err != nil {
+		return opts, err
+	}
+	if opts.throttle < 0 {
+		return opts, fmt.Errorf("parameter throttle must not be negative")
+	}
+	if opts.constGC, err = getBoolParam(params, "const_gc", false); err != nil {
+		return opts, err
+	}
+	if opts.gcPercent, err = getIntParam(params, "gc_percent", 0); err != nil {
+		return opts, err
+	}
+	if opts.gcPercent < 0 {
+		return opts, fmt.Errorf("parameter gc_percent must not be negative")
+	}
+	if opts.ignoreHidden, err = getBoolParam(params, "ignore_hidden", false); err != nil {
+		return opts, err
+	}
+	memoryLimit, err := getIntParam(params, "memory_limit", 0)
+	if err != nil {
+		return opts, err
+	}
+	if memoryLimit < 0 {
+		return opts, fmt.Errorf("parameter memory_limit must not be negative")
+	}
+	opts.memoryLimit = int64(memoryLimit)
+
+	patterns, err := getStringSliceParam(params, "ignore_file_patterns")
+	if err != nil {
+		return opts, err
+	}
+	if len(patterns) > 0 {
+		if opts.ignoreFiles, err = parseFilePatterns(patterns); err != nil {
+			return opts, err
+		}
+	}
+
+	if opts.trackTopFiles, err = getIntParam(params, "track_top_files", 0); err != nil {
+		return opts, err
+	}
+	if opts.trackTopFiles < 0 {
+		return opts, fmt.Errorf("parameter track_top_files must not be negative")
+	}
+
+	blockSize, err := getIntParam(params, "block_size", 0)
+	if err != nil {
+		return opts, err
+	}
+	if blockSize < 0 {
+		return opts, fmt.Errorf("parameter block_size must not be negative")
+	}
+	opts.blockSize = int64(blockSize)
+
+	if opts.linkTargets, err = getBoolParam(params, "include_types", false); err != nil {
+		return opts, err
+	}
+
+	if _, ok := params["sort_results"]; ok {
+		if opts.sortResults, err = getStringParam(params, "sort_results"); err != nil {
+			return opts, err
+		}
+		switch opts.sortResults {
+		case analyze.SortResultsByName, analyze.SortResultsBySize:
+		default:
+			return opts, fmt.Errorf("parameter sort_results must be name or size")
+		}
+	}
+
+	timeout, err := getIntParam(params, "timeout_sec", 0)
+	if err != nil {
+		return opts, err
+	}
+	if timeout < 0 {
+		return opts, fmt.Errorf("parameter timeout_sec must not be negative")
+	}
+	opts.timeout = time.Duration(timeout) * time.Second
+
+	if opts.watch, err = getBoolParam(params, "watch", false); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// parseSizeMode returns true if the mode compares physical sizes instead of apparent ones
+func parseSizeMode(mode string) (bool, error) {
+	switch mode {
+	case "apparent":
+		return false, nil
+	case "usage":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported size_mode %q, use apparent or usage", mode)
+	}
+}
+
 // getIntParam gets an integer parameter from params map
 func getIntParam(params map[string]interface{}, key string, defaultValue int) (int, error) {
 	if params == nil {
@@ -339,5 +1960,13 @@ func getIntParam(params map[string]interface{}, key string, defaultValue int) (i
 		return i, nil
 	}
 
+	// Try as int64 and uint64 (MessagePack numbers)
+	if i, ok := val.(int64); ok {
+		return int(i), nil
+	}
+	if i, ok := val.(uint64); ok {
+		return int(i), nil
+	}
+
 	return defaultValue, fmt.Errorf("parameter %s must be integer", key)
 }
@@ -1,12 +1,18 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"io"
 	"net"
+	"path/filepath"
 	"testing"
+	"time"
 
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -180,6 +186,90 @@ func TestIntParameterExtraction(t *testing.T) {
 	}
 }
 
+// TestScanOptionsExtraction tests parsing of scan settings
+func TestScanOptionsExtraction(t *testing.T) {
+	opts, err := getScanOptions(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, scanOptions{}, opts)
+
+	opts, err = getScanOptions(map[string]interface{}{
+		"concurrency":   float64(4),
+		"const_gc":      true,
+		"memory_limit":  float64(1 << 30),
+		"timeout_sec":   float64(30),
+		"ignore_hidden": true,
+		"block_size":    float64(4096),
+		"include_types": true,
+		"sort_results":  "name",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, scanOptions{
+		concurrency:  4,
+		constGC:      true,
+		memoryLimit:  1 << 30,
+		timeout:      30 * time.Second,
+		ignoreHidden: true,
+		blockSize:    4096,
+		linkTargets:  true,
+		sortResults:  "name",
+	}, opts)
+
+	_, err = getScanOptions(map[string]interface{}{"const_gc": "yes"})
+	assert.Error(t, err)
+
+	_, err = getScanOptions(map[string]interface{}{"memory_limit": float64(-1)})
+	assert.Error(t, err)
+
+	_, err = getScanOptions(map[string]interface{}{"timeout_sec": float64(-1)})
+	assert.Error(t, err)
+
+	_, err = getScanOptions(map[string]interface{}{"track_top_files": float64(-1)})
+	assert.Error(t, err)
+
+	_, err = getScanOptions(map[string]interface{}{"block_size": float64(-1)})
+	assert.Error(t, err)
+
+	_, err = getScanOptions(map[string]interface{}{"sort_results": "mtime"})
+	assert.ErrorContains(t, err, "sort_results must be name or size")
+
+	opts, err = getScanOptions(map[string]interface{}{
+		"ignore_file_patterns": []interface{}{"*.log"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []FilePattern{{Pattern: "*.log", MatchOn: "name"}}, opts.ignoreFiles)
+
+	_, err = getScanOptions(map[string]interface{}{"ignore_file_patterns": "*.log"})
+	assert.Error(t, err)
+
+	_, err = getScanOptions(map[string]interface{}{"ignore_file_patterns": []interface{}{"[a-"}})
+	assert.Error(t, err)
+}
+
+func TestScanOptionsWithStorage(t *testing.T) {
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.useStorage = true
+
+	for _, params := range []string{
+		`"ignore_hidden":true`,
+		`"ignore_file_patterns":["*.log"]`,
+		`"track_top_files":10`,
+		`"block_size":4096`,
+		`"include_types":true`,
+		`"sort_results":"name"`,
+	} {
+		resp := s.processRequest([]byte(`{"id":"1","method":"scan","params":{"path":"/tmp",` + params + `}}`))
+		assert.False(t, resp.Success, params)
+		assert.Contains(t, resp.Error, "not supported with persistent storage", params)
+	}
+
+	// server defaults the storage would not apply are refused on start
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	_, err := NewUnixSocketServerWithOptions(socketPath, true, t.TempDir(), Options{IgnoreHidden: true})
+	assert.ErrorContains(t, err, "not supported with persistent storage")
+	_, err = NewUnixSocketServerWithOptions(socketPath, true, t.TempDir(), Options{IgnoreFilePatterns: []string{"*.log"}})
+	assert.ErrorContains(t, err, "not supported with persistent storage")
+}
+
 // TestServerInitialization tests server creation with different configurations
 func TestServerInitialization(t *testing.T) {
 	t.Run("with storage enabled", func(t *testing.T) {
@@ -201,6 +291,18 @@ func TestServerInitialization(t *testing.T) {
 	})
 }
 
+func TestPing(t *testing.T) {
+	s := &UnixSocketServer{server: NewServer(false, "")}
+
+	// long request holds the server lock
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"ping"}`))
+	assert.True(t, resp.Success)
+	assert.Equal(t, map[string]bool{"pong": true}, resp.Data)
+}
+
 // handleTestConnection is a simplified connection handler for testing
 func handleTestConnection(conn net.Conn, server *Server) {
 	defer conn.Close()
@@ -275,3 +377,222 @@ func sendTestResponse(conn net.Conn, resp *Response) error {
 
 	return nil
 }
+
+func TestRequestLogging(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	c := &connection{logger: logger.WithField("conn_id", uint64(7))}
+
+	s.serveRequest(c, []byte(`{"id":"1","method":"status"}`))
+	assert.Empty(t, hook.AllEntries(), "requests are not logged on info level")
+
+	logger.SetLevel(log.DebugLevel)
+	s.serveRequest(c, []byte(`{"id":"2","method":"status"}`))
+
+	last := hook.LastEntry()
+	assert.Equal(t, log.DebugLevel, last.Level)
+	assert.Equal(t, uint64(7), last.Data["conn_id"])
+	assert.Equal(t, "2", last.Data["request_id"])
+	assert.Equal(t, "status", last.Data["method"])
+	assert.Contains(t, last.Data, "duration_ms")
+}
+
+func TestResponseMeta(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, server.Start())
+	}()
+	defer server.Stop()
+
+	conn, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	readFields := func(req Request) map[string]interface{} {
+		assert.NoError(t, sendSocketRequest(conn, req))
+		frame, err := readSocketFrame(conn)
+		assert.NoError(t, err)
+		var fields map[string]interface{}
+		assert.NoError(t, json.Unmarshal(frame, &fields))
+		return fields
+	}
+
+	fields := readFields(Request{ID: "1", Method: "status"})
+	assert.NotContains(t, fields, "meta")
+
+	fields = readFields(Request{ID: "2", Method: "status", IncludeMeta: true})
+	assert.Equal(t, "2", fields["id"])
+	assert.Equal(t, true, fields["success"])
+	meta, ok := fields["meta"].(map[string]interface{})
+	assert.True(t, ok)
+	assert.Contains(t, meta, "received_at")
+	assert.Contains(t, meta, "processing_ms")
+	assert.Contains(t, meta, "encode_ms")
+	assert.Greater(t, meta["response_bytes"], float64(0))
+
+	_, err = time.Parse(time.RFC3339Nano, meta["received_at"].(string))
+	assert.NoError(t, err)
+}
+
+func TestFramingDetection(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, server.Start())
+	}()
+	defer server.Stop()
+
+	framed, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	defer framed.Close()
+	assert.NoError(t, sendSocketRequest(framed, Request{ID: "f", Method: "ping"}))
+	resp, err := readSocketResponse(framed)
+	assert.NoError(t, err)
+	assert.Equal(t, "f", resp.ID)
+	assert.True(t, resp.Success)
+
+	lines, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	defer lines.Close()
+	_, err = lines.Write([]byte("{\"id\":\"1\",\"method\":\"ping\"}\n\n" +
+		"{\"id\":\"2\",\"method\":\"status\",\"include_meta\":true}\r\n" +
+		"{\"id\":\"3\",\"method\":\"set_encoding\",\"params\":{\"encoding\":\"msgpack\"}}\n"))
+	assert.NoError(t, err)
+
+	reader := bufio.NewReader(lines)
+	for _, id := range []string{"1", "2", "3"} {
+		line, err := reader.ReadBytes('\n')
+		assert.NoError(t, err)
+		var fields map[string]interface{}
+		assert.NoError(t, json.Unmarshal(line, &fields))
+		assert.Equal(t, id, fields["id"])
+		switch id {
+		case "2":
+			assert.Contains(t, fields, "meta")
+		case "3":
+			assert.Equal(t, false, fields["success"])
+		}
+	}
+}
+
+func TestPipelinedRequests(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, server.Start())
+	}()
+	defer server.Stop()
+
+	conn, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// all requests are written before any response is read,
+	// responses come in order of the requests
+	var batch []byte
+	for _, id := range []string{"1", "2", "3", "4"} {
+		data, err := json.Marshal(Request{ID: id, Method: "ping"})
+		assert.NoError(t, err)
+		frame := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+		batch = append(append(batch, frame...), append(data, '\n')...)
+	}
+	_, err = conn.Write(batch)
+	assert.NoError(t, err)
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		resp, err := readSocketResponse(conn)
+		assert.NoError(t, err)
+		assert.Equal(t, id, resp.ID)
+		assert.True(t, resp.Success)
+	}
+}
+
+func TestLineTooLong(t *testing.T) {
+	client, srv := net.Pipe()
+	defer client.Close()
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	c := &connection{conn: srv, logger: log.NewEntry(log.StandardLogger()), ndjson: true}
+
+	go func() {
+		s.readLines(c, bufio.NewReader(srv), 8192)
+		srv.Close()
+	}()
+
+	// request fits in the limit, the longer line closes the connection
+	_, err := client.Write([]byte("{\"id\":\"1\",\"method\":\"ping\"}\n"))
+	assert.NoError(t, err)
+	line, err := bufio.NewReader(client).ReadBytes('\n')
+	assert.NoError(t, err)
+	assert.Contains(t, string(line), `"success":true`)
+
+	chunk := bytes.Repeat([]byte("x"), 1024)
+	for i := 0; i < 16; i++ {
+		if _, err = client.Write(chunk); err != nil {
+			break
+		}
+	}
+	assert.Error(t, err)
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	client, srv := net.Pipe()
+	defer client.Close()
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.maxMessageSize = 64
+	c := &connection{conn: srv, logger: log.NewEntry(log.StandardLogger())}
+
+	go func() {
+		s.readFrames(c, bufio.NewReader(srv))
+		srv.Close()
+	}()
+
+	assert.NoError(t, sendSocketRequest(client, Request{ID: "1", Method: "ping"}))
+	resp, err := readSocketResponse(client)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	// payload of the larger frame is not read as the next request, the connection is closed
+	data, err := json.Marshal(Request{ID: "2", Method: "ping"})
+	assert.NoError(t, err)
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	payload := append(append(frame, append(data, '\n')...), bytes.Repeat([]byte("x"), 100)...)
+	_, err = client.Write(binary.BigEndian.AppendUint32(nil, uint32(len(payload))))
+	assert.NoError(t, err)
+	_, err = client.Write(payload)
+	assert.Error(t, err)
+	_, err = readSocketResponse(client)
+	assert.Error(t, err)
+}
+
+func BenchmarkRoundTrip(b *testing.B) {
+	socketPath := filepath.Join(b.TempDir(), "gdu.sock")
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	go server.Start() // nolint: errcheck // Why: stopped at the end of the benchmark
+	defer server.Stop()
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	req := Request{ID: "1", Method: "ping"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := sendSocketRequest(conn, req); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := readSocketFrame(conn); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCodeRateLimited is error code of requests rejected because their connection exceeded its rate limit
+const ErrCodeRateLimited = "ERR_RATE_LIMITED"
+
+// RateLimit configures token bucket limiting requests of every connection.
+// Each request takes tokens by weight of its method, bucket is refilled by Rate tokens per second
+// up to Burst tokens. Request finding the bucket short of tokens is rejected.
+// Independently of the rate, number of requests of a connection can be capped by MaxRequests.
+type RateLimit struct {
+	// Rate is number of tokens added per second, zero disables limiting
+	Rate float64
+	// Burst is capacity of the bucket, it is at least one
+	Burst float64
+	// Weights are numbers of tokens taken by methods, methods not listed take one
+	Weights map[string]float64
+	// MaxRequests is number of requests one connection can send, zero means unlimited
+	MaxRequests uint64
+	// CloseOnLimit closes the connection once response rejecting its request is sent
+	CloseOnLimit bool
+}
+
+// errLimitClose is returned by respond once the connection exceeded its limit and has to be closed
+var errLimitClose = errors.New("connection exceeded its request limit")
+
+// RateLimitedResponse is data of response to request rejected by rate limit
+type RateLimitedResponse struct {
+	// RetryAfterMs is time until the bucket holds enough tokens for the request
+	RetryAfterMs int64 `json:"retry_after_ms"`
+}
+
+// ConnectionRateLimit is state of rate limit of one connection
+type ConnectionRateLimit struct {
+	ConnID   uint64  `json:"conn_id"`
+	Tokens   float64 `json:"tokens"`
+	Rejected uint64  `json:"rejected"`
+	// Requests is number of requests received on the connection when their number is capped
+	Requests uint64 `json:"requests,omitempty"`
+}
+
+// validate checks the limit, it fills default burst of one second
+func (l *RateLimit) validate() error {
+	if l.Rate < 0 || l.Burst < 0 {
+		return fmt.Errorf("rate limit and burst must not be negative")
+	}
+	if l.Rate == 0 {
+		return nil
+	}
+	if l.Burst == 0 {
+		l.Burst = math.Max(l.Rate, 1)
+	}
+	if l.Burst < 1 {
+		return fmt.Errorf("rate limit burst must be at least 1")
+	}
+	for method, weight := range l.Weights {
+		if weight <= 0 {
+			return fmt.Errorf("weight of method %s must be positive", method)
+		}
+	}
+	return nil
+}
+
+// weight returns number of tokens taken by the method, weights larger than the burst are capped by it
+func (l *RateLimit) weight(method string) float64 {
+	weight, ok := l.Weights[method]
+	if !ok {
+		weight = 1
+	}
+	return math.Min(weight, l.Burst)
+}
+
+// tokenBucket holds tokens of one connection
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	rejected uint64
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: limit.Rate, burst: limit.Burst, tokens: limit.Burst, last: now}
+}
+
+// refill adds tokens for time passed since the last refill, caller must hold b.mu
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// take removes n tokens from the bucket. When there are not enough of them,
+// nothing is taken and time until they are refilled is returned.
+func (b *tokenBucket) take(n float64, now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	if b.tokens >= n {
+		b.tokens -= n
+		return true, 0
+	}
+	b.rejected++
+	wait := time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// state returns number of tokens available now and number of rejected requests
+func (b *tokenBucket) state(now time.Time) (float64, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	return b.tokens, b.rejected
+}
+
+// SetRateLimit limits rate of requests of every connection opened afterwards,
+// zero rate disables limiting. It has to be called before Start.
+func (s *UnixSocketServer) SetRateLimit(limit RateLimit) error {
+	if err := limit.validate(); err != nil {
+		return err
+	}
+	s.rateLimit = limit
+	return nil
+}
+
+// trackConnection gives the connection its token bucket and registers it to be listed by status,
+// untrackConnection has to be called once the connection is closed
+func (s *UnixSocketServer) trackConnection(c *connection) {
+	if s.rateLimit.Rate == 0 && s.rateLimit.MaxRequests == 0 {
+		return
+	}
+	if s.rateLimit.Rate > 0 {
+		c.bucket = newTokenBucket(s.rateLimit, time.Now())
+	}
+
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[*connection]struct{})
+	}
+	s.conns[c] = struct{}{}
+}
+
+func (s *UnixSocketServer) untrackConnection(c *connection) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.conns, c)
+}
+
+// allow counts the request and takes tokens for it from bucket of its connection,
+// response rejecting the request is returned when the connection exceeded its limits
+func (s *UnixSocketServer) allow(c *connection, req *Request) *Response {
+	if limit := s.rateLimit.MaxRequests; limit > 0 && c.requests.Add(1) > limit {
+		c.logger.Debugf("Request %s rejected, connection exceeded %d requests", req.Method, limit)
+		return s.reject(c, req, "request limit of the connection exceeded", nil)
+	}
+
+	if c.bucket == nil {
+		return nil
+	}
+	ok, wait := c.bucket.take(s.rateLimit.weight(req.Method), time.Now())
+	if ok {
+		return nil
+	}
+	retryAfter := max(int64(math.Ceil(float64(wait)/float64(time.Millisecond))), 1)
+	c.logger.Debugf("Request %s rejected by rate limit, retry after %d ms", req.Method, retryAfter)
+	return s.reject(c, req, "rate limit exceeded", RateLimitedResponse{RetryAfterMs: retryAfter})
+}
+
+// reject returns response rejecting request over limit of its connection,
+// the connection is marked to be closed once the response is sent if the limit says so
+func (s *UnixSocketServer) reject(c *connection, req *Request, message string, data interface{}) *Response {
+	if s.rateLimit.CloseOnLimit {
+		c.closing.Store(true)
+	}
+	return &Response{
+		ID:      req.ID,
+		Success: false,
+		Error:   message,
+		Code:    ErrCodeRateLimited,
+		Data:    data,
+	}
+}
+
+// rateLimits returns state of rate limits of open connections ordered by connection ID
+func (s *UnixSocketServer) rateLimits() []ConnectionRateLimit {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	now := time.Now()
+	limits := make([]ConnectionRateLimit, 0, len(s.conns))
+	for c := range s.conns {
+		limit := ConnectionRateLimit{ConnID: c.id, Requests: c.requests.Load()}
+		if c.bucket != nil {
+			limit.Tokens, limit.Rejected = c.bucket.state(now)
+		}
+		limits = append(limits, limit)
+	}
+	sort.Slice(limits, func(i, j int) bool { return limits[i].ConnID < limits[j].ConnID })
+	return limits
+}
+
+// checkClosing returns errLimitClose when the response was sent and the connection
+// has to be closed for exceeding its limit, error of sending the response is returned unchanged
+func (c *connection) checkClosing(err error) error {
+	if err == nil && c.closing.Load() {
+		c.logger.Warn("Closing connection which exceeded its request limit")
+		return errLimitClose
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	bucket := newTokenBucket(RateLimit{Rate: 2, Burst: 2}, now)
+
+	ok, _ := bucket.take(1, now)
+	assert.True(t, ok)
+	ok, _ = bucket.take(1, now)
+	assert.True(t, ok)
+	ok, wait := bucket.take(1, now)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = bucket.take(1, now.Add(500*time.Millisecond))
+	assert.True(t, ok)
+
+	// bucket is not refilled above its capacity
+	tokens, rejected := bucket.state(now.Add(time.Hour))
+	assert.Equal(t, 2.0, tokens)
+	assert.Equal(t, uint64(1), rejected)
+}
+
+func TestRateLimitedRequests(t *testing.T) {
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	assert.NoError(t, s.SetRateLimit(RateLimit{
+		Rate:    1,
+		Burst:   2,
+		Weights: map[string]float64{"ping": 0.5, "directory": 5},
+	}))
+
+	c := &connection{logger: log.NewEntry(log.StandardLogger()), id: 7}
+	s.trackConnection(c)
+
+	for i := 0; i < 4; i++ {
+		resp := s.dispatch(context.Background(), c, &Request{ID: "1", Method: "ping"})
+		assert.True(t, resp.Success, resp.Error)
+	}
+	resp := s.dispatch(context.Background(), c, &Request{ID: "2", Method: "ping"})
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeRateLimited, resp.Code)
+	retryAfter := resp.Data.(RateLimitedResponse).RetryAfterMs
+	assert.Greater(t, retryAfter, int64(0))
+	assert.LessOrEqual(t, retryAfter, int64(500))
+
+	limits := s.status().RateLimits
+	assert.Len(t, limits, 1)
+	assert.Equal(t, uint64(7), limits[0].ConnID)
+	assert.Equal(t, uint64(1), limits[0].Rejected)
+
+	// other connections have their own bucket
+	other := &connection{logger: log.NewEntry(log.StandardLogger()), id: 8}
+	s.trackConnection(other)
+	// weight above the burst takes the whole bucket
+	resp = s.dispatch(context.Background(), other, &Request{ID: "3", Method: "directory"})
+	assert.NotEqual(t, ErrCodeRateLimited, resp.Code)
+
+	s.untrackConnection(c)
+	s.untrackConnection(other)
+	assert.Empty(t, s.status().RateLimits)
+}
+
+func TestRateLimitValidate(t *testing.T) {
+	s := &UnixSocketServer{}
+	assert.Error(t, s.SetRateLimit(RateLimit{Rate: -1}))
+	assert.Error(t, s.SetRateLimit(RateLimit{Rate: 1, Burst: 0.5}))
+	assert.Error(t, s.SetRateLimit(RateLimit{Rate: 1, Weights: map[string]float64{"ping": 0}}))
+
+	assert.NoError(t, s.SetRateLimit(RateLimit{Rate: 10}))
+	assert.Equal(t, 10.0, s.rateLimit.Burst)
+
+	// limiting is disabled by zero rate
+	assert.NoError(t, s.SetRateLimit(RateLimit{}))
+	c := &connection{}
+	s.trackConnection(c)
+	assert.Nil(t, c.bucket)
+}
+
+func TestMaxRequests(t *testing.T) {
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	assert.NoError(t, s.SetRateLimit(RateLimit{MaxRequests: 2}))
+
+	c := &connection{logger: log.NewEntry(log.StandardLogger()), id: 3}
+	s.trackConnection(c)
+	defer s.untrackConnection(c)
+	assert.Nil(t, c.bucket)
+
+	for i := 0; i < 2; i++ {
+		resp := s.dispatch(context.Background(), c, &Request{ID: "1", Method: "ping"})
+		assert.True(t, resp.Success, resp.Error)
+	}
+	resp := s.dispatch(context.Background(), c, &Request{ID: "2", Method: "ping"})
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeRateLimited, resp.Code)
+	assert.Nil(t, resp.Data)
+	assert.False(t, c.closing.Load())
+
+	limits := s.status().RateLimits
+	assert.Equal(t, []ConnectionRateLimit{{ConnID: 3, Requests: 3}}, limits)
+}
+
+func TestCloseOnLimit(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	assert.NoError(t, server.SetRateLimit(RateLimit{MaxRequests: 1, CloseOnLimit: true}))
+	go func() {
+		assert.NoError(t, server.Start())
+	}()
+	defer server.Stop()
+
+	conn, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.NoError(t, sendSocketRequest(conn, Request{ID: "1", Method: "ping"}))
+	resp, err := readSocketResponse(conn)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success, resp.Error)
+
+	// the rejection is sent before the connection is closed
+	assert.NoError(t, sendSocketRequest(conn, Request{ID: "2", Method: "ping"}))
+	resp, err = readSocketResponse(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrCodeRateLimited, resp.Code)
+
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = readSocketResponse(conn)
+	assert.ErrorIs(t, err, io.EOF)
+}
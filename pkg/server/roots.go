@@ -0,0 +1,136 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dundee/gdu/v5/internal/common"
+	"github.com/dundee/gdu/v5/pkg/analyze"
+	"github.com/dundee/gdu/v5/pkg/fs"
+)
+
+// multiPathAnalyzer is implemented by analyzers able to scan multiple paths in one scan
+type multiPathAnalyzer interface {
+	AnalyzeDirs(paths []string, ignore common.ShouldDirBeIgnored, constGC bool) fs.Item
+}
+
+// getScanPaths returns paths of dirs to be scanned given either by path or by paths parameter
+func getScanPaths(params map[string]interface{}) ([]string, error) {
+	paths, err := getStringSliceParam(params, "paths")
+	if err != nil {
+		return nil, err
+	}
+	if paths == nil {
+		path, err := getStringParam(params, "path")
+		if err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	}
+
+	if _, ok := params["path"]; ok {
+		return nil, fmt.Errorf("parameters path and paths cannot be used together")
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("parameter paths must not be empty")
+	}
+	return paths, nil
+}
+
+// checkScanPath resolves path of dir to be scanned and checks that it is an allowed dir.
+// Error code is returned along with error of path which is not allowed.
+func (s *Server) checkScanPath(path string) (string, string, error) {
+	path, err := s.resolveBasePath(path)
+	if err != nil {
+		return "", ErrCodeForbidden, err
+	}
+	if err := s.checkPathAllowed(path); err != nil {
+		return "", ErrCodeForbidden, err
+	}
+	// scan of a file would end with empty dir flagged as unreadable
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+	if !info.IsDir() {
+		return "", "", fmt.Errorf("path %s is not a directory", path)
+	}
+	return path, "", nil
+}
+
+// checkOverlap returns error when some of the paths is the same as another one or inside of it,
+// items of such paths would be counted twice
+func checkOverlap(paths []string) error {
+	abs := make([]string, len(paths))
+	for i, path := range paths {
+		var err error
+		if abs[i], err = filepath.Abs(path); err != nil {
+			return err
+		}
+	}
+	for i := range abs {
+		for j := range abs {
+			if i != j && isUnder(abs[i], abs[j]) {
+				return fmt.Errorf("paths %s and %s overlap", paths[i], paths[j])
+			}
+		}
+	}
+	return nil
+}
+
+// isVirtualRoot returns true if the item is virtual root of scan of multiple paths
+func isVirtualRoot(item fs.Item) bool {
+	dir, ok := item.(*analyze.Dir)
+	return ok && dir.Virtual
+}
+
+// rootPaths returns paths of the scanned roots of the tree,
+// roots of scan of multiple paths are children of its virtual root
+func rootPaths(root fs.Item) []string {
+	if !isVirtualRoot(root) {
+		return []string{root.GetPath()}
+	}
+	files := root.GetFilesLocked()
+	paths := make([]string, 0, len(files))
+	for _, item := range files {
+		paths = append(paths, item.GetPath())
+	}
+	return paths
+}
+
+// underRoots returns true if path is equal to one of the scanned roots of the tree or inside of it
+func underRoots(root fs.Item, path string) bool {
+	for _, rootPath := range rootPaths(root) {
+		if isUnder(rootPath, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapesRoots returns true if path leads out of the scanned roots of the tree via ".." elements
+func escapesRoots(root fs.Item, path string) bool {
+	for _, rootPath := range rootPaths(root) {
+		if !escapesRoot(rootPath, path) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanError returns errors of the scanned roots which could not be read joined together,
+// empty string is returned when all of them were read
+func scanError(paths []string, dir fs.Item) string {
+	if !isVirtualRoot(dir) {
+		return rootError(paths[0], dir)
+	}
+	var messages []string
+	for _, root := range dir.GetFiles() {
+		if message := rootError(root.GetPath(), root); message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetScanPaths(t *testing.T) {
+	paths, err := getScanPaths(map[string]interface{}{"path": "/a"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/a"}, paths)
+
+	paths, err = getScanPaths(map[string]interface{}{"paths": []interface{}{"/a", "/b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/a", "/b"}, paths)
+
+	_, err = getScanPaths(map[string]interface{}{"path": "/a", "paths": []interface{}{"/b"}})
+	assert.Error(t, err)
+	_, err = getScanPaths(map[string]interface{}{"paths": []interface{}{}})
+	assert.Error(t, err)
+	_, err = getScanPaths(nil)
+	assert.Error(t, err)
+}
+
+func TestCheckOverlap(t *testing.T) {
+	assert.NoError(t, checkOverlap([]string{"/home/a", "/home/b", "/homework"}))
+	assert.Error(t, checkOverlap([]string{"/home", "/home/a"}))
+	assert.Error(t, checkOverlap([]string{"/home/a", "/home"}))
+	assert.Error(t, checkOverlap([]string{"test_dir", "test_dir/"}))
+}
+
+func TestScanMultiplePaths(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+	other := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(other, "file3"), []byte("abc"), 0o600))
+	nested, err := filepath.Abs("test_dir/nested")
+	assert.NoError(t, err)
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	resp := s.processRequest([]byte(`{"id":"1","method":"scan","params":{"paths":["test_dir/nested","test_dir"]}}`))
+	assert.False(t, resp.Success)
+	resp = s.processRequest([]byte(`{"id":"2","method":"scan","params":{"paths":["test_dir","` + other + `"],"watch":true}}`))
+	assert.False(t, resp.Success)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"scan","params":{"paths":["test_dir/nested","` + other + `"]}}`))
+	assert.True(t, resp.Success, resp.Error)
+	s.server.mu.RLock()
+	done := s.server.scanDone
+	s.server.mu.RUnlock()
+	<-done
+
+	// stats of the virtual root are sums of stats of the roots
+	resp = s.processRequest([]byte(`{"id":"4","method":"directory","params":{"depth":1}}`))
+	assert.True(t, resp.Success, resp.Error)
+	root := resp.Data.(DirInfo)
+	assert.Equal(t, "", root.Path)
+	assert.Equal(t, int64(8199+4099), root.Size)
+	assert.Equal(t, 6, root.ItemCount)
+	assert.Len(t, root.Children, 2)
+
+	resp = s.processRequest([]byte(`{"id":"5","method":"directory","params":{"path":"` + filepath.Join(nested, "subnested") + `"}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, int64(4101), resp.Data.(DirInfo).Size)
+
+	resp = s.processRequest([]byte(`{"id":"6","method":"directory","params":{"path":"` + filepath.Join(other, "file3") + `"}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, int64(3), resp.Data.(DirInfo).Size)
+
+	// paths leading out of all roots are rejected
+	resp = s.processRequest([]byte(`{"id":"7","method":"directory","params":{"path":"` + nested + `/../.."}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeForbidden, resp.Code)
+	resp = s.processRequest([]byte(`{"id":"8","method":"tree","params":{"max_depth":1,"human":false}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, ""+
+		"12298  \n"+
+		" 8199  ├── "+nested+"/\n"+
+		" 4099  └── "+other+"/\n",
+		resp.Data.(TreeResponse).Tree)
+}
@@ -3,26 +3,105 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dundee/gdu/v5/internal/common"
 	"github.com/dundee/gdu/v5/pkg/analyze"
+	"github.com/dundee/gdu/v5/pkg/device"
 	"github.com/dundee/gdu/v5/pkg/fs"
+	log "github.com/sirupsen/logrus"
 )
 
 // Server provides shared state and functionality for directory analysis
 type Server struct {
-	analyzer      common.Analyzer
-	mu            sync.RWMutex
-	currentDir    fs.Item
-	progress      common.CurrentProgress
-	isScanning    bool
-	cancelFunc    context.CancelFunc
+	analyzer       common.Analyzer
+	mu             sync.RWMutex
+	treeMu         sync.RWMutex // guards tree of the running scan against stats update
+	completedDir   fs.Item      // tree of the last finished scan served to clients
+	pendingDir     fs.Item      // tree of the running scan being finalized
+	scanGeneration uint64       // number of scans which have finished
+	scannedAt      time.Time
+	scanStartedAt  time.Time // start of reading of the last scan
+	scanFinishedAt time.Time // end of reading of the last scan, zero while it runs
+	pathIndex      map[string]fs.Item
+	topFiles       fs.Files
+	topLimit       int         // number of files tracked in topFiles
+	treeOpts       scanOptions // options of the scan of completedDir, watch mode reads new items with them
+	updates        *treeUpdates
+	watch          *treeWatcher
+	watchLimit     int
+	progress       common.CurrentProgress
+	isScanning     bool
+	timedOut       bool
+	partialKept    bool          // scan was cancelled keeping the tree read so far
+	scanDone       chan struct{} // closed when the running scan finishes
+	scanError      string        // why the root of the last scan could not be read, empty if it was
+	cancelFunc     context.CancelFunc
+	concurrency    int
+	maxDepth       int
+	devices        device.DevicesInfoGetter
+	startTime      time.Time
+	useStorage     bool
+	storagePath    string
+	allowedPaths   []string // resolved roots of paths which can be scanned, empty allows all
+	baseDir        string   // relative paths of requests are resolved against it, set only on creation
+	events         *eventHub
+	metrics        *metrics
+	exporting      atomic.Bool  // export to file is running
+	exportRows     atomic.Int64 // rows written by the running or the last export to file
+	exportMu       sync.Mutex   // guards exportCancel
+	exportCancel   context.CancelFunc
+	// editMu is held for writing while the completed tree is changed in place
+	// and for reading by export to file, which walks the tree without holding mu
+	editMu  sync.RWMutex
+	webhook *webhook // called when scan finishes, nil if not configured
+	alerts  *alertStore
+	// progressInterval is minimal time between two progress events, zero pushes every update
+	progressInterval time.Duration
+	// maxMessageSize is the largest request accepted
+	maxMessageSize int
+	// defaultIgnoreHidden and defaultIgnoreFiles apply to scans not setting ignore_hidden or ignore_file_patterns
+	defaultIgnoreHidden bool
+	defaultIgnoreFiles  []FilePattern
+	// maxThrottle caps directories read per second by every scan, zero is unlimited.
+	// scanThrottle is limit of the running or the last scan.
+	maxThrottle  int
+	scanThrottle int
+	// maxMemory is ceiling of memory of the server process in bytes, zero is unlimited
+	maxMemory int64
+	// memoryWarning is set while the running scan is paused because of memory usage,
+	// memoryError is why the last scan was aborted when it went over the ceiling
+	memoryWarning string
+	memoryError   string
+	// defaultConstGC and defaultGCPercent apply to scans not setting const_gc or gc_percent
+	defaultConstGC   bool
+	defaultGCPercent int
+	// scanGCMode and scanGCPercent are GC settings of the running or the last scan
+	scanGCMode    string
+	scanGCPercent int
 }
 
+// DefaultMaxDepth is the default ceiling of depth requested by clients
+const DefaultMaxDepth = 256
+
 // NewServer creates a new server with shared analyzer
 func NewServer(useStorage bool, storagePath string) *Server {
 	var analyzer common.Analyzer
+	var alertsPath string
 
 	if useStorage {
 		// Use stored analyzer with persistent storage
@@ -30,28 +109,80 @@ func NewServer(useStorage bool, storagePath string) *Server {
 			storagePath = "/tmp/gdu-storage"
 		}
 		analyzer = analyze.CreateStoredAnalyzer(storagePath)
+		alertsPath = filepath.Join(storagePath, alertsFile)
 	} else {
 		// Fall back to parallel analyzer
 		analyzer = analyze.CreateAnalyzer()
 	}
 
 	return &Server{
-		analyzer: analyzer,
-		progress: common.CurrentProgress{},
+		analyzer:    analyzer,
+		progress:    common.CurrentProgress{},
+		maxDepth:    DefaultMaxDepth,
+		devices:     device.Getter,
+		watchLimit:  DefaultWatchLimit,
+		startTime:   time.Now(),
+		useStorage:  useStorage,
+		storagePath: storagePath,
+		events:      newEventHub(),
+		metrics:     newMetrics(),
+		alerts:      newAlertStore(alertsPath),
+
+		progressInterval: DefaultProgressInterval,
+		maxMessageSize:   DefaultMaxMessageSize,
 	}
 }
 
 // DirInfo represents directory information for JSON serialization
+//
+// Size is apparent size and PhysicalSize is allocated size, both summed over the whole
+// subtree including 4096 bytes of every dir. Hard linked file is counted only at its
+// first link found by the scan, other links add nothing to their dirs.
 type DirInfo struct {
-	Name         string    `json:"name"`
-	Path         string    `json:"path"`
-	Size         int64     `json:"size"`
-	PhysicalSize int64     `json:"physical_size"`
-	ItemCount    int       `json:"item_count"`
-	Flag         string    `json:"flag"`
-	Mtime        int64     `json:"mtime"`
-	IsDir        bool      `json:"is_dir"`
-	Children     []DirInfo `json:"children,omitempty"`
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	Path         string  `json:"path"`
+	Size         int64   `json:"size"`
+	PhysicalSize int64   `json:"physical_size"`
+	ItemCount    int     `json:"item_count"`
+	Flag         string  `json:"flag"`
+	Mtime        int64   `json:"mtime"`
+	IsDir        bool    `json:"is_dir"`
+	Type         string  `json:"type"`
+	Device       uint64  `json:"device,omitempty"`
+	Inode        uint64  `json:"inode,omitempty"`
+	Atime        int64   `json:"atime,omitempty"`
+	Ctime        int64   `json:"ctime,omitempty"`
+	UID          *uint32 `json:"uid,omitempty"`
+	GID          *uint32 `json:"gid,omitempty"`
+	LastUpdated  int64   `json:"last_updated,omitempty"`
+	Dirty        bool    `json:"dirty,omitempty"`
+	// LinkTarget and Broken are set on symlinks when types are requested
+	// and link targets were read by the scan
+	LinkTarget string `json:"link_target,omitempty"`
+	Broken     bool   `json:"broken,omitempty"`
+	// Complete is false when the scan was cancelled before the dir or some of its subdirs
+	// were read, sizes and item count are lower bounds then and human sizes are prefixed by >=
+	Complete *bool `json:"complete,omitempty"`
+	// Flags are reasons of flag of the dir: read_error, partial, empty or cancelled,
+	// ErrorMessage is the first error met while reading the dir
+	Flags        []string `json:"flags,omitempty"`
+	ErrorMessage string   `json:"error_message,omitempty"`
+	// ScanGeneration and ScannedAt are set on the requested dir only
+	ScanGeneration uint64 `json:"scan_generation,omitempty"`
+	ScannedAt      int64  `json:"scanned_at,omitempty"`
+	Truncated      bool   `json:"truncated,omitempty"`
+	// HiddenCount and HiddenSize sum children left out by min_size, sizes are in the requested size mode
+	HiddenCount int   `json:"hidden_count,omitempty"`
+	HiddenSize  int64 `json:"hidden_size,omitempty"`
+	// PercentOfParent is share of the child in size of its parent, set by percent param.
+	// CumulativePercent is share of the child and of larger siblings listed before it, set by cumulative param.
+	PercentOfParent   *float64 `json:"percent_of_parent,omitempty"`
+	CumulativePercent *float64 `json:"cumulative_percent,omitempty"`
+	// SizeHuman and PhysicalSizeHuman are the sizes formatted with binary prefixes, set by human param
+	SizeHuman         string    `json:"size_human,omitempty"`
+	PhysicalSizeHuman string    `json:"physical_size_human,omitempty"`
+	Children          []DirInfo `json:"children,omitempty"`
 }
 
 // ProgressResponse represents progress information
@@ -59,26 +190,492 @@ type ProgressResponse struct {
 	IsScanning      bool   `json:"is_scanning"`
 	CurrentItemName string `json:"current_item"`
 	ItemCount       int    `json:"item_count"`
+	FileCount       int    `json:"file_count"`
+	DirCount        int    `json:"dir_count"`
 	TotalSize       int64  `json:"total_size"`
+	TimedOut        bool   `json:"timed_out"`
+	// Throttle is number of directories the running or the last scan may read per second, zero if unlimited
+	Throttle int `json:"throttle,omitempty"`
+	// VanishedCount is number of entries deleted during the scan after their dir was read
+	VanishedCount int `json:"vanished_count,omitempty"`
+	// FDExhaustedCount is number of times opening of a dir failed because file descriptors ran out,
+	// the scan then reads fewer dirs at once. Raising the open files limit avoids it.
+	FDExhaustedCount int `json:"fd_exhausted_count,omitempty"`
+	// Error is set when the root of the last scan could not be read or the scan was aborted
+	Error string `json:"error,omitempty"`
+	// ErrorCode is ERR_MEMORY_LIMIT when the scan was aborted because the server ran out of its memory ceiling
+	ErrorCode string `json:"error_code,omitempty"`
+	// MemoryWarning is set while the scan is paused until memory of the server is freed
+	MemoryWarning string `json:"memory_warning,omitempty"`
+	// IsExporting and ExportedRows report running export to file
+	IsExporting  bool  `json:"is_exporting,omitempty"`
+	ExportedRows int64 `json:"exported_rows,omitempty"`
+}
+
+// ancestors returns info of the item and of its parent dirs ordered from the root down to the item,
+// children are not included. Tree lock must be held by the caller.
+func ancestors(root, item fs.Item, opts dirInfoOptions) []DirInfo {
+	var chain []DirInfo
+	for item != nil {
+		info := convertToDirInfo(item, 0, opts)
+		info.Children = nil
+		chain = append(chain, info)
+		if item == root {
+			break
+		}
+		item = item.GetParent()
+	}
+	slices.Reverse(chain)
+	return chain
+}
+
+// listDir returns names of immediate children of dir,
+// tree lock must be held by the caller
+func listDir(dir fs.Item) []ListEntry {
+	files := dir.GetFiles()
+	entries := make([]ListEntry, 0, len(files))
+	for _, item := range files {
+		entries = append(entries, ListEntry{Name: item.GetName(), IsDir: item.IsDir()})
+	}
+	return entries
+}
+
+// largestDirs returns the largest directories of the scanned tree,
+// false is returned when no scan completed
+func (s *Server) largestDirs(count int, excludeRoot bool) (TopDirsResponse, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.completedDir == nil {
+		return TopDirsResponse{}, false
+	}
+
+	dirs := analyze.CollectTopDirs(s.completedDir, count, !excludeRoot)
+	res := TopDirsResponse{Dirs: make([]DirInfo, 0, len(dirs))}
+	for _, dir := range dirs {
+		res.Dirs = append(res.Dirs, convertToDirInfo(dir, 0, dirInfoOptions{}))
+	}
+	return res, true
+}
+
+// setConcurrency changes number of directories read in parallel by the running scan,
+// false is returned when no scan is running
+func (s *Server) setConcurrency(n int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.isScanning {
+		return false
+	}
+	if a, ok := s.analyzer.(interface{ SetConcurrency(int) }); ok {
+		a.SetConcurrency(n)
+	}
+	return true
+}
+
+// scanTimes returns start and end of reading of the last scan and its duration,
+// duration of running scan is time elapsed since its start
+func (s *Server) scanTimes() (startedAt, finishedAt time.Time, duration time.Duration) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	startedAt, finishedAt = s.scanStartedAt, s.scanFinishedAt
+	switch {
+	case startedAt.IsZero():
+	case finishedAt.IsZero():
+		duration = time.Since(startedAt)
+	default:
+		duration = finishedAt.Sub(startedAt)
+	}
+	return startedAt, finishedAt, duration
+}
+
+// generation returns number of finished scans and time the last one finished
+func (s *Server) generation() (uint64, int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.scanGeneration == 0 {
+		return 0, 0
+	}
+	return s.scanGeneration, s.scannedAt.Unix()
+}
+
+// progressResponse returns snapshot of the scan progress
+func (s *Server) progressResponse() ProgressResponse {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var errorCode string
+	if s.memoryError != "" {
+		errorCode = ErrCodeMemoryLimit
+	}
+	return ProgressResponse{
+		IsScanning:       s.isScanning,
+		CurrentItemName:  s.progress.CurrentItemName,
+		ItemCount:        s.progress.ItemCount,
+		FileCount:        s.progress.FileCount,
+		DirCount:         s.progress.DirCount,
+		TotalSize:        s.progress.TotalSize,
+		TimedOut:         s.timedOut,
+		Throttle:         s.scanThrottle,
+		VanishedCount:    s.progress.VanishedCount,
+		FDExhaustedCount: s.progress.FDExhaustedCount,
+		Error:            s.scanError,
+		ErrorCode:        errorCode,
+		MemoryWarning:    s.memoryWarning,
+		IsExporting:      s.exporting.Load(),
+		ExportedRows:     s.exportRows.Load(),
+	}
+}
+
+// StatusResponse represents health information of the server
+type StatusResponse struct {
+	Uptime      int64            `json:"uptime_sec"`
+	Connections int64            `json:"connections"`
+	IsScanning  bool             `json:"is_scanning"`
+	Progress    ProgressResponse `json:"progress"`
+	UseStorage  bool             `json:"use_storage"`
+	StoragePath string           `json:"storage_path,omitempty"`
+	ReadOnly    bool             `json:"read_only"`
+	BaseDir     string           `json:"base_dir,omitempty"`
+	Watching    bool             `json:"watching"`
+	WatchedDirs int              `json:"watched_dirs"`
+	// ScanGeneration is incremented every time a new scan result is available
+	ScanGeneration uint64   `json:"scan_generation"`
+	ScannedAt      int64    `json:"scanned_at,omitempty"`
+	AllowedPaths   []string `json:"allowed_paths,omitempty"`
+	// ScanStartedAt and ScanFinishedAt bound reading of the last scan,
+	// ScanDurationMs is time it took or time it runs for
+	ScanStartedAt  int64 `json:"scan_started_at,omitempty"`
+	ScanFinishedAt int64 `json:"scan_finished_at,omitempty"`
+	ScanDurationMs int64 `json:"scan_duration_ms,omitempty"`
+	// GCMode is how GC runs during the running or the last scan: managed when it is disabled
+	// and tuned by free memory, memory_limit when it is disabled up to the scan memory limit
+	// and const when GC settings are kept. GCPercent is GOGC set for the scan.
+	GCMode    string `json:"gc_mode,omitempty"`
+	GCPercent int    `json:"gc_percent,omitempty"`
+	// Alerts lists alerts which currently fire
+	Alerts []AlertStatus `json:"alerts,omitempty"`
+	// RateLimits lists state of rate limits of open connections when rate limiting is enabled
+	RateLimits []ConnectionRateLimit `json:"rate_limits,omitempty"`
+}
+
+// ScanResponse represents acknowledgement of started scan
+type ScanResponse struct {
+	Started            bool          `json:"started"`
+	IgnoreFilePatterns []FilePattern `json:"ignore_file_patterns,omitempty"`
+}
+
+// TopFile represents one of the largest files
+type TopFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// ListEntry represents immediate child of a directory in the compact listing
+type ListEntry struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir"`
+}
+
+// TopDirsResponse represents the largest directories of the scanned tree
+type TopDirsResponse struct {
+	Dirs []DirInfo `json:"dirs"`
+}
+
+// TopFilesResponse represents the largest files of the scanned tree
+type TopFilesResponse struct {
+	Files []TopFile `json:"files"`
+	// Precomputed is set when the files were tracked during the scan
+	Precomputed bool `json:"precomputed"`
+}
+
+// largestFiles returns count largest files of the scanned tree.
+// Files tracked during the scan are used if enough of them were tracked,
+// the tree is walked otherwise. Walk stopped by the budget returns files found so far with its error.
+func (s *Server) largestFiles(count int, budget *walkBudget) (TopFilesResponse, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	root := s.completedDir
+	files := s.topFiles
+	limit := s.topLimit
+
+	if root == nil {
+		return TopFilesResponse{}, false, nil
+	}
+
+	res := TopFilesResponse{Files: make([]TopFile, 0, count)}
+	var err error
+	if limit >= count {
+		res.Precomputed = true
+	} else {
+		topList := analyze.NewTopList(count)
+		err = collectTopFiles(root, topList, budget)
+		files = topList.Items
+		sort.Sort(sort.Reverse(fs.ByApparentSize(files)))
+	}
+
+	for i, file := range files {
+		if i >= count {
+			break
+		}
+		res.Files = append(res.Files, TopFile{Path: file.GetPath(), Size: file.GetSize()})
+	}
+	return res, true, err
+}
+
+// collectTopFiles adds files of the dir and its subdirs to the list
+func collectTopFiles(dir fs.Item, topList *analyze.TopList, budget *walkBudget) error {
+	for _, item := range dir.GetFiles() {
+		if err := budget.step(); err != nil {
+			return err
+		}
+		if item.IsDir() {
+			if err := collectTopFiles(item, topList, budget); err != nil {
+				return err
+			}
+		} else {
+			topList.Add(item)
+		}
+	}
+	return nil
+}
+
+// MountInfo represents mounted filesystem
+type MountInfo struct {
+	Device     string `json:"device"`
+	MountPoint string `json:"mount_point"`
+	Fstype     string `json:"fstype"`
+	Size       int64  `json:"size"`
+	Free       int64  `json:"free"`
+}
+
+// mounts lists mounted devices with their usage
+func (s *Server) mounts() ([]MountInfo, error) {
+	devices, err := s.devices.GetDevicesInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := make([]MountInfo, 0, len(devices))
+	for _, dev := range devices {
+		mounts = append(mounts, MountInfo{
+			Device:     dev.Name,
+			MountPoint: dev.MountPoint,
+			Fstype:     dev.Fstype,
+			Size:       dev.Size,
+			Free:       dev.Free,
+		})
+	}
+	return mounts, nil
+}
+
+// EstimateResponse represents approximate size of a path
+type EstimateResponse struct {
+	ItemCount int   `json:"item_count"`
+	Size      int64 `json:"size"`
+	Depth     int   `json:"depth"`
+	Partial   bool  `json:"partial"`
+}
+
+// maxEstimateDepth caps depth of estimate, it has to stay quick, deeper counting is a job for scan
+const maxEstimateDepth = 8
+
+// estimate counts entries under path down to given depth without building a tree.
+// Partial is set when some directories were not descended into.
+// Counting stops once the context of the budget is done, the estimate so far is returned with the error.
+func estimate(path string, depth int, budget *walkBudget) (EstimateResponse, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return EstimateResponse{}, err
+	}
+
+	res := EstimateResponse{Depth: depth, ItemCount: 1}
+	if !info.IsDir() {
+		res.Size = info.Size()
+		return res, nil
+	}
+
+	err = estimateDir(path, depth, &res, budget)
+	if err != nil {
+		res.Partial = true
+	}
+	return res, err
+}
+
+func estimateDir(path string, depth int, res *EstimateResponse, budget *walkBudget) error {
+	if depth <= 0 {
+		res.Partial = true
+		return nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range entries {
+		if err := budget.step(); err != nil {
+			return err
+		}
+		res.ItemCount++
+		if entry.IsDir() {
+			if err := estimateDir(filepath.Join(path, entry.Name()), depth-1, res, budget); err != nil {
+				return err
+			}
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			res.Size += info.Size()
+		}
+	}
+	return nil
+}
+
+// scanOptions holds settings of a single scan
+type scanOptions struct {
+	// concurrency is max number of directories read in parallel, non-positive uses the server default
+	concurrency int
+	// throttle is max number of directories read per second, zero uses the server limit.
+	// Scans cannot read faster than the server limit.
+	throttle int
+	// constGC keeps GC settings untouched during the scan
+	constGC bool
+	// gcPercent sets GOGC for the time of the scan and implies constGC, zero keeps the current value
+	gcPercent int
+	// memoryLimit is heap size up to which GC is disabled, zero means GC is tuned by free memory
+	memoryLimit int64
+	// ignoreHidden skips files and directories beginning with dot
+	ignoreHidden bool
+	// ignoreFiles are patterns of files left out of the scan
+	ignoreFiles []FilePattern
+	// trackTopFiles is number of the largest files tracked during the scan, zero disables the tracking
+	trackTopFiles int
+	// watch keeps the tree updated by filesystem events after the scan
+	watch bool
+	// timeout is wall-clock budget after which the scan is cancelled, zero means no limit
+	timeout time.Duration
+	// blockSize computes usage as apparent size rounded up to the blocks, zero keeps allocated size
+	blockSize int64
+	// linkTargets reads targets of symlinks, they are kept in the tree
+	linkTargets bool
+	// sortResults sorts children of dirs by name or size once the scan is done, empty keeps read order
+	sortResults string
 }
 
 // scan performs directory scanning (shared implementation)
-func (s *Server) scan(path string) {
+func (s *Server) scan(path string, opts scanOptions) {
+	if s.beginScan(&opts) {
+		s.runScan([]string{path}, opts)
+	}
+}
+
+// applyIgnoreDefaults sets ignore options of the server to the scan options not given in params
+func (s *Server) applyIgnoreDefaults(opts *scanOptions, params map[string]interface{}) {
+	if _, ok := params["ignore_hidden"]; !ok {
+		opts.ignoreHidden = s.defaultIgnoreHidden
+	}
+	if _, ok := params["ignore_file_patterns"]; !ok {
+		opts.ignoreFiles = s.defaultIgnoreFiles
+	}
+}
+
+// applyGCDefaults sets GC options of the server to the scan options not given in params
+func (s *Server) applyGCDefaults(opts *scanOptions, params map[string]interface{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := params["const_gc"]; !ok {
+		opts.constGC = s.defaultConstGC
+	}
+	if _, ok := params["gc_percent"]; !ok {
+		opts.gcPercent = s.defaultGCPercent
+	}
+}
+
+// beginScan marks scan as running and fills defaults of the options,
+// false is returned when another scan is already running
+func (s *Server) beginScan(opts *scanOptions) bool {
 	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.isScanning {
-		s.mu.Unlock()
-		return
+		return false
 	}
 	s.isScanning = true
+	s.timedOut = false
+	s.partialKept = false
+	s.scanDone = make(chan struct{})
+	s.scanError = ""
+	s.memoryWarning = ""
+	s.memoryError = ""
 	s.progress = common.CurrentProgress{}
-	s.mu.Unlock()
+	if opts.concurrency <= 0 {
+		opts.concurrency = s.concurrency
+	}
+	if s.maxThrottle > 0 && (opts.throttle <= 0 || opts.throttle > s.maxThrottle) {
+		opts.throttle = s.maxThrottle
+	}
+	s.scanThrottle = opts.throttle
+	// GC of the scan must not let the heap grow over the ceiling
+	if s.maxMemory > 0 && opts.memoryLimit > s.maxMemory {
+		opts.memoryLimit = s.maxMemory
+	}
+	if opts.gcPercent > 0 {
+		opts.constGC = true
+	}
+	s.scanGCMode = scanGCMode(*opts)
+	s.scanGCPercent = opts.gcPercent
+	return true
+}
+
+// runScan scans the paths, roots of multiple paths are children of virtual root of the tree.
+// The scan must be marked as running by beginScan.
+func (s *Server) runScan(paths []string, opts scanOptions) {
+	if a, ok := s.analyzer.(interface{ SetConcurrency(int) }); ok {
+		a.SetConcurrency(opts.concurrency)
+	}
+	if a, ok := s.analyzer.(interface{ SetDirsPerSecondLimit(int) }); ok {
+		a.SetDirsPerSecondLimit(opts.throttle)
+	}
+	if a, ok := s.analyzer.(interface{ SetMemoryLimit(int64) }); ok {
+		a.SetMemoryLimit(opts.memoryLimit)
+	}
+	if a, ok := s.analyzer.(interface{ SetIgnoreHidden(bool) }); ok {
+		a.SetIgnoreHidden(opts.ignoreHidden)
+	}
+	if a, ok := s.analyzer.(interface {
+		SetFileIgnore(common.ShouldFileBeIgnored)
+	}); ok {
+		a.SetFileIgnore(createFileIgnoreFunc(opts.ignoreFiles))
+	}
+	if a, ok := s.analyzer.(interface{ SetTrackTopFiles(int) }); ok {
+		a.SetTrackTopFiles(opts.trackTopFiles)
+	}
+	if a, ok := s.analyzer.(interface{ SetBlockSize(int64) }); ok {
+		a.SetBlockSize(opts.blockSize)
+	}
+	if a, ok := s.analyzer.(interface{ SetReadLinkTargets(bool) }); ok {
+		a.SetReadLinkTargets(opts.linkTargets)
+	}
+	if a, ok := s.analyzer.(interface{ SetSortResults(string) }); ok {
+		a.SetSortResults(opts.sortResults)
+	}
 
+	s.mu.RLock()
+	done := s.scanDone
+	s.mu.RUnlock()
 	defer func() {
 		s.mu.Lock()
 		s.isScanning = false
 		s.mu.Unlock()
+		close(done)
 	}()
 
+	// Start with zero totals and fresh done channel
+	s.analyzer.ResetProgress()
+
 	// Set up progress monitoring
 	progressChan := s.analyzer.GetProgressChan()
 	doneChan := s.analyzer.GetDone()
@@ -88,7 +685,25 @@ func (s *Server) scan(path string) {
 	s.cancelFunc = cancel
 	s.mu.Unlock()
 
+	s.mu.RLock()
+	interval := s.progressInterval
+	ceiling := s.maxMemory
+	s.mu.RUnlock()
+
+	// memory guard runs only while dirs are read
+	guardCtx, stopGuard := context.WithCancel(ctx)
+	guardFinished := make(chan struct{})
+	go func() {
+		defer close(guardFinished)
+		if ceiling > 0 {
+			newMemoryGuard(s, ceiling).run(guardCtx)
+		}
+	}()
+
+	monitorFinished := make(chan struct{})
 	go func() {
+		defer close(monitorFinished)
+		var lastEvent time.Time
 		for {
 			select {
 			case <-ctx.Done():
@@ -97,27 +712,268 @@ func (s *Server) scan(path string) {
 				s.mu.Lock()
 				s.progress = progress
 				s.mu.Unlock()
+
+				// updates coming faster are coalesced, clients get the latest totals
+				if time.Since(lastEvent) >= interval {
+					lastEvent = time.Now()
+					s.events.publish(Event{Event: EventProgress, Data: s.progressResponse()})
+				}
 			case <-doneChan:
+				// the last snapshot may not have been read from the channel,
+				// take the final totals from the analyzer
+				s.mu.Lock()
+				cancelled := ctx.Err() != nil
+				if !cancelled {
+					s.progress = s.analyzer.GetProgress()
+				}
+				s.mu.Unlock()
+
+				// final totals are pushed even if they were throttled
+				if !cancelled {
+					s.events.publish(Event{Event: EventProgress, Data: s.progressResponse()})
+				}
 				return
 			}
 		}
 	}()
 
+	var timer *time.Timer
+	if opts.timeout > 0 {
+		timer = time.AfterFunc(opts.timeout, s.analyzer.Cancel)
+	}
+
 	// Perform the scan
-	dir := s.analyzer.AnalyzeDir(path, func(name, path string) bool { return false }, false)
-	dir.UpdateStats(make(fs.HardLinkedItems, 10))
+	s.mu.Lock()
+	s.scanStartedAt = time.Now()
+	s.scanFinishedAt = time.Time{}
+	s.mu.Unlock()
+
+	if opts.gcPercent > 0 {
+		prevPercent := debug.SetGCPercent(opts.gcPercent)
+		defer debug.SetGCPercent(prevPercent)
+	}
+
+	ignore := func(name, path string) bool { return false }
+	var dir fs.Item
+	if len(paths) == 1 {
+		dir = s.analyzer.AnalyzeDir(paths[0], ignore, opts.constGC)
+	} else {
+		dir = s.analyzer.(multiPathAnalyzer).AnalyzeDirs(paths, ignore, opts.constGC)
+	}
+	// timer which already fired has cancelled the scan, the result is partial.
+	// It is stopped right away so it can't cancel the analyzer once the analysis is done.
+	timedOut := timer != nil && !timer.Stop()
+	stopGuard()
+	<-guardFinished
+	scanned := strings.Join(paths, ", ")
+	scanErr := scanError(paths, dir)
+	s.mu.RLock()
+	if s.memoryError != "" {
+		scanErr = s.memoryError
+	}
+	s.mu.RUnlock()
+	if scanErr != "" {
+		log.Errorf("Scan of %s failed: %s", scanned, scanErr)
+		s.metrics.observeScanError()
+	}
+
+	s.mu.Lock()
+	s.scanFinishedAt = time.Now()
+	s.scanError = scanErr
+	duration := s.scanFinishedAt.Sub(s.scanStartedAt)
+	s.mu.Unlock()
+	log.Infof("Scan of %s finished in %v", scanned, duration)
+	<-monitorFinished
 
-	// Store the result
 	s.mu.Lock()
-	s.currentDir = dir
+	s.timedOut = timedOut
+	if ctx.Err() == nil {
+		s.pendingDir = dir
+	}
 	s.mu.Unlock()
 
+	s.treeMu.Lock()
+	if d, ok := dir.(interface {
+		UpdateStatsParallel(fs.HardLinkedItems, int)
+	}); ok {
+		d.UpdateStatsParallel(make(fs.HardLinkedItems, 10), opts.concurrency)
+	} else {
+		dir.UpdateStats(make(fs.HardLinkedItems, 10))
+	}
+	s.treeMu.Unlock()
+
+	index := buildPathIndex(dir)
+
+	var topFiles fs.Files
+	if a, ok := s.analyzer.(interface{ GetTopFiles() fs.Files }); ok {
+		topFiles = a.GetTopFiles()
+	}
+
+	// watch mode of the previous tree ends when the new tree is swapped in
+	if ctx.Err() == nil {
+		s.stopWatch()
+	}
+
+	// Swap the pending result in, unless the scan was cancelled meanwhile
+	s.mu.Lock()
+	if ctx.Err() != nil {
+		s.pendingDir = nil
+		s.mu.Unlock()
+		s.notifyWebhook(dir, true)
+		return
+	}
+	s.completedDir = dir
+	s.pendingDir = nil
+	s.pathIndex = index
+	s.treeOpts = opts
+	s.topFiles = topFiles
+	s.topLimit = 0
+	if topFiles != nil {
+		s.topLimit = opts.trackTopFiles
+	}
+	s.scanGeneration++
+	s.scannedAt = time.Now()
+	partialKept := s.partialKept
+	s.updates = newTreeUpdates(dir.GetPath(), s.scannedAt)
+	summary := convertToDirInfo(dir, 0, dirInfoOptions{updates: s.updates})
+	summary.ScanGeneration = s.scanGeneration
+	summary.ScannedAt = s.scannedAt.Unix()
+	s.mu.Unlock()
+
+	s.events.publish(Event{Event: EventScanComplete, Data: summary})
+	s.metrics.observeScan(dir, duration)
+	s.notifyWebhook(dir, partialKept)
+	s.evaluateAlerts()
+
+	if opts.watch {
+		if err := s.startWatch(); err != nil {
+			log.Errorf("Failed to start watch mode: %v", err)
+		}
+	}
+
 	// Cancel the progress monitor
 	cancel()
 }
 
+// cancelKeepingPartial stops reading of the running scan, the tree read so far is finalized
+// and served as its result, with dirs which were not read completely marked incomplete.
+// It waits until the tree is swapped in or the context is done,
+// false is returned when no scan is running.
+func (s *Server) cancelKeepingPartial(ctx context.Context) bool {
+	s.mu.Lock()
+	if !s.isScanning || s.cancelFunc == nil {
+		s.mu.Unlock()
+		return false
+	}
+	s.partialKept = true
+	done := s.scanDone
+	s.mu.Unlock()
+
+	// the scan finishes the same way as after its timeout
+	s.analyzer.Cancel()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return true
+}
+
+// flagReasoner is implemented by dirs keeping reasons of their flag
+type flagReasoner interface {
+	FlagReasons() (analyze.DirFlags, string)
+}
+
+// rootError returns error of reading the scanned root, empty if it was read
+func rootError(path string, dir fs.Item) string {
+	if dir.GetFlag() != '!' {
+		return ""
+	}
+	if d, ok := dir.(flagReasoner); ok {
+		if flags, message := d.FlagReasons(); flags&analyze.DirReadError != 0 && message != "" {
+			return message
+		}
+	}
+
+	// the analyzer did not keep the error, reading of the dir is tried again to get it
+	f, err := os.Open(path)
+	if err == nil {
+		_, err = f.Readdirnames(1)
+		f.Close()
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		return fmt.Sprintf("failed to read %s", path)
+	}
+	return err.Error()
+}
+
+// clampDepth limits requested depth to the server ceiling,
+// returns true if the depth was lowered
+func (s *Server) clampDepth(depth int) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if depth < 0 {
+		return 0, false
+	}
+	if s.maxDepth > 0 && depth > s.maxDepth {
+		return s.maxDepth, true
+	}
+	return depth, false
+}
+
+// dirInfoOptions holds settings of DirInfo conversion
+type dirInfoOptions struct {
+	// capped marks directories at the depth limit having children as truncated
+	capped       bool
+	includeTimes bool
+	includeOwner bool
+	// updates adds time of the last change and dirty marker to items
+	updates *treeUpdates
+	// minSize hides children smaller than the size in the size mode, they are only counted
+	minSize int64
+	// human adds sizes formatted with binary prefixes
+	human bool
+	// percent adds share of the parent to children, cumulative adds running share
+	// to children sorted by size. usage compares physical sizes instead of apparent ones.
+	percent    bool
+	cumulative bool
+	usage      bool
+	// types adds targets of symlinks
+	types bool
+}
+
+// size returns size of the item in the requested size mode
+func (opts dirInfoOptions) size(item fs.Item) int64 {
+	if opts.usage {
+		return item.GetUsage()
+	}
+	return item.GetSize()
+}
+
+// percentOf returns share of the part in the whole in percent rounded to two decimals,
+// share of empty whole is zero
+func percentOf(part, whole int64) *float64 {
+	percent := 0.0
+	if whole > 0 {
+		percent = math.Round(float64(part)*10000/float64(whole)) / 100
+	}
+	return &percent
+}
+
+// itemID returns id of item stable across scans derived from its device and inode number.
+// Hard links of the same file share the id.
+// Hash of the path is used when inode is not known.
+func itemID(dev, ino uint64, path string) string {
+	if ino != 0 {
+		return strconv.FormatUint(dev, 16) + ":" + strconv.FormatUint(ino, 16)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	return "p:" + strconv.FormatUint(h.Sum64(), 16)
+}
+
 // convertToDirInfo converts fs.Item to DirInfo for JSON serialization
-func convertToDirInfo(item fs.Item, depth int) DirInfo {
+func convertToDirInfo(item fs.Item, depth int, opts dirInfoOptions) DirInfo {
 	info := DirInfo{
 		Name:         item.GetName(),
 		Path:         item.GetPath(),
@@ -127,20 +983,188 @@ func convertToDirInfo(item fs.Item, depth int) DirInfo {
 		Flag:         string(item.GetFlag()),
 		Mtime:        item.GetMtime().Unix(),
 		IsDir:        item.IsDir(),
+		Type:         itemType(item),
 		Children:     []DirInfo{},
 	}
+	if i, ok := item.(interface{ GetInode() (dev, ino uint64) }); ok {
+		info.Device, info.Inode = i.GetInode()
+	}
+	info.ID = itemID(info.Device, info.Inode, info.Path)
+	if d, ok := item.(flagReasoner); ok {
+		flags, message := d.FlagReasons()
+		info.Flags, info.ErrorMessage = flags.Names(), message
+		if flags&(analyze.DirCancelled|analyze.DirIncomplete) != 0 {
+			complete := false
+			info.Complete = &complete
+		}
+	}
 
-	if depth > 0 && item.IsDir() {
-		if dirItem, ok := item.(interface{ GetFiles() fs.Files }); ok {
-			for _, child := range dirItem.GetFiles() {
-				info.Children = append(info.Children, convertToDirInfo(child, depth-1))
-			}
+	if opts.includeTimes {
+		if atime := item.GetAtime(); !atime.IsZero() {
+			info.Atime = atime.Unix()
+		}
+		if ctime := item.GetCtime(); !ctime.IsZero() {
+			info.Ctime = ctime.Unix()
+		}
+	}
+	if opts.includeOwner {
+		uid, gid := item.GetOwner()
+		info.UID, info.GID = &uid, &gid
+	}
+	if opts.updates != nil {
+		info.LastUpdated = opts.updates.lastUpdated(info.Path).Unix()
+		info.Dirty = opts.updates.isDirty(info.Path)
+	}
+	if opts.human {
+		info.setHumanSizes()
+	}
+	if file, ok := item.(*analyze.File); ok && opts.types && file.Link != nil {
+		info.LinkTarget = file.Link.Target
+		info.Broken = file.Link.Broken
+	}
+
+	if !item.IsDir() {
+		return info
+	}
+
+	if depth <= 0 {
+		info.Truncated = opts.capped && item.GetItemCount() > 1
+		return info
+	}
+
+	files := item.GetFiles()
+	if opts.cumulative {
+		files = slices.Clone(files)
+		sort.SliceStable(files, func(i, j int) bool {
+			return opts.size(files[i]) > opts.size(files[j])
+		})
+	}
+
+	parentSize := opts.size(item)
+	var cumulative int64
+	for _, child := range files {
+		if opts.size(child) < opts.minSize {
+			info.HiddenCount++
+			info.HiddenSize += opts.size(child)
+			continue
+		}
+		childInfo := convertToDirInfo(child, depth-1, opts)
+		if opts.percent || opts.cumulative {
+			childInfo.PercentOfParent = percentOf(opts.size(child), parentSize)
+		}
+		if opts.cumulative {
+			cumulative += opts.size(child)
+			childInfo.CumulativePercent = percentOf(cumulative, parentSize)
 		}
+		info.Children = append(info.Children, childInfo)
 	}
 
 	return info
 }
 
+// itemType returns type of the item: dir, file, symlink, socket, fifo, chardev, blockdev,
+// or other for special files whose kind is not known
+func itemType(item fs.Item) string {
+	switch item.GetType() {
+	case "Directory":
+		return "dir"
+	case "Symlink":
+		return "symlink"
+	case "Socket":
+		return "socket"
+	case "Fifo":
+		return "fifo"
+	case "CharDevice":
+		return "chardev"
+	case "BlockDevice":
+		return "blockdev"
+	case "Other":
+		return "other"
+	default:
+		return "file"
+	}
+}
+
+// setHumanSizes formats the sizes the same way as gdu shows them
+func (info *DirInfo) setHumanSizes() {
+	info.SizeHuman = formatSize(info.Size)
+	info.PhysicalSizeHuman = formatSize(info.PhysicalSize)
+	if info.Complete != nil && !*info.Complete {
+		info.SizeHuman = ">= " + info.SizeHuman
+		info.PhysicalSizeHuman = ">= " + info.PhysicalSizeHuman
+	}
+}
+
+// formatSize formats size with binary prefix and one decimal place
+func formatSize(size int64) string {
+	fsize := float64(size)
+	asize := math.Abs(fsize)
+
+	switch {
+	case asize >= common.Ei:
+		return fmt.Sprintf("%.1f EiB", fsize/common.Ei)
+	case asize >= common.Pi:
+		return fmt.Sprintf("%.1f PiB", fsize/common.Pi)
+	case asize >= common.Ti:
+		return fmt.Sprintf("%.1f TiB", fsize/common.Ti)
+	case asize >= common.Gi:
+		return fmt.Sprintf("%.1f GiB", fsize/common.Gi)
+	case asize >= common.Mi:
+		return fmt.Sprintf("%.1f MiB", fsize/common.Mi)
+	case asize >= common.Ki:
+		return fmt.Sprintf("%.1f KiB", fsize/common.Ki)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+// buildPathIndex maps full paths of all items in the tree to the items
+func buildPathIndex(root fs.Item) map[string]fs.Item {
+	index := make(map[string]fs.Item)
+	indexItem(root, index)
+	return index
+}
+
+func indexItem(item fs.Item, index map[string]fs.Item) {
+	index[item.GetPath()] = item
+
+	if !item.IsDir() {
+		return
+	}
+
+	for _, child := range item.GetFiles() {
+		indexItem(child, index)
+	}
+}
+
+// attachItem adds item to parent dir and adds its stats to all ancestors.
+// Caller must hold s.mu.
+func attachItem(parent *analyze.Dir, item fs.Item) {
+	item.SetParent(parent)
+	parent.AddFile(item)
+	for cur := parent; cur != nil; {
+		cur.ItemCount += item.GetItemCount()
+		cur.Size += item.GetSize()
+		cur.Usage += item.GetUsage()
+
+		next, ok := cur.Parent.(*analyze.Dir)
+		if !ok {
+			break
+		}
+		cur = next
+	}
+}
+
+// findItem looks the path up in the path index and falls back to walking
+// the tree for items added after the index was built.
+// Caller must hold s.mu.
+func (s *Server) findItem(path string) fs.Item {
+	if item, ok := s.pathIndex[path]; ok {
+		return item
+	}
+	return findDirectory(s.completedDir, path)
+}
+
 // findDirectory finds a directory by path in the scanned tree
 func findDirectory(root fs.Item, path string) fs.Item {
 	if root.GetPath() == path {
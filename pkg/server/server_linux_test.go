@@ -0,0 +1,51 @@
+//go:build linux
+// +build linux
+
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectoryFlagReasons(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read dir without permissions")
+	}
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	err := os.Chmod("test_dir/nested/subnested", 0)
+	assert.Nil(t, err)
+	defer func() {
+		err = os.Chmod("test_dir/nested/subnested", 0o755)
+		assert.Nil(t, err)
+	}()
+	assert.NoError(t, os.Mkdir("test_dir/empty", 0o755))
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+	assert.Empty(t, s.server.progressResponse().Error)
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"directory","params":{"depth":2}}`))
+	assert.True(t, resp.Success, resp.Error)
+	children := map[string]DirInfo{}
+	for _, child := range resp.Data.(DirInfo).Children {
+		children[child.Name] = child
+	}
+	assert.Equal(t, []string{"empty"}, children["empty"].Flags)
+
+	nested := children["nested"]
+	assert.Equal(t, ".", nested.Flag)
+	assert.Empty(t, nested.Flags)
+	subnested := nested.Children[0]
+	if subnested.Name != "subnested" {
+		subnested = nested.Children[1]
+	}
+	assert.Equal(t, "!", subnested.Flag)
+	assert.Equal(t, []string{"read_error"}, subnested.Flags)
+	assert.Contains(t, subnested.ErrorMessage, "permission denied")
+}
@@ -1,323 +1,973 @@
 package server
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"io"
+	"math"
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/dundee/gdu/v5/internal/common"
+	"github.com/dundee/gdu/v5/internal/testdev"
 	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/dundee/gdu/v5/pkg/analyze"
+	"github.com/dundee/gdu/v5/pkg/device"
+	"github.com/dundee/gdu/v5/pkg/fs"
 	"github.com/stretchr/testify/assert"
 )
 
-// TestUnixSocketServerEndToEnd tests complete end-to-end flow with real Unix socket
-func TestUnixSocketServerEndToEnd(t *testing.T) {
-	// Create unique socket path
-	socketPath := "/tmp/test-gdu-e2e-" + time.Now().Format("20060102150405") + ".sock"
-	defer os.Remove(socketPath)
+// TestPathIndex tests lookups through the path index and the tree walk fallback
+func TestPathIndex(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	s.scan("test_dir", scanOptions{})
 
-	// Create test directory
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	assert.Equal(t, 5, s.progress.ItemCount)
+	assert.Equal(t, int64(7), s.progress.TotalSize)
+	assert.Len(t, s.pathIndex, 5)
+	assert.Equal(t, "nested", s.findItem("test_dir/nested").GetName())
+	assert.Equal(t, "file", s.findItem("test_dir/nested/subnested/file").GetName())
+	assert.Nil(t, s.findItem("test_dir/missing"))
+
+	delete(s.pathIndex, "test_dir/nested/file2")
+	assert.Equal(t, "file2", s.findItem("test_dir/nested/file2").GetName())
+}
+
+// TestEstimate tests the depth-limited estimation
+func TestEstimate(t *testing.T) {
 	fin := testdir.CreateTestDir()
 	defer fin()
 
-	// Create and start server
-	server, err := NewUnixSocketServer(socketPath, false, "")
+	budget := &walkBudget{ctx: context.Background()}
+	res, err := estimate("test_dir", 2, budget)
 	assert.NoError(t, err)
+	assert.Equal(t, 4, res.ItemCount)
+	assert.Equal(t, int64(2), res.Size)
+	assert.True(t, res.Partial)
 
-	go func() {
-		err := server.Start()
-		assert.NoError(t, err)
-	}()
+	res, err = estimate("test_dir", 5, budget)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, res.ItemCount)
+	assert.Equal(t, int64(7), res.Size)
+	assert.False(t, res.Partial)
+
+	_, err = estimate("test_dir/missing", 2, budget)
+	assert.Error(t, err)
+
+	// counting stops once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err = estimate("test_dir", 5, &walkBudget{ctx: ctx, examined: budgetCheckInterval - 1})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, res.Partial)
+
+	// depth is capped to the estimate limit
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	resp := s.processRequest([]byte(`{"id":"1","method":"estimate","params":{"path":"test_dir","depth":1000}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, maxEstimateDepth, resp.Data.(EstimateResponse).Depth)
+}
 
-	// Wait for server to start
-	time.Sleep(100 * time.Millisecond)
+// TestMounts tests listing of mounted devices
+func TestMounts(t *testing.T) {
+	s := NewServer(false, "")
+	s.devices = testdev.DevicesInfoGetterMock{
+		Devices: device.Devices{
+			&device.Device{Name: "/dev/sda1", MountPoint: "/", Fstype: "ext4", Size: 1e12, Free: 1e11},
+		},
+	}
 
-	// Connect client
-	conn, err := net.Dial("unix", socketPath)
+	mounts, err := s.mounts()
 	assert.NoError(t, err)
-	defer conn.Close()
+	assert.Equal(t, []MountInfo{
+		{Device: "/dev/sda1", MountPoint: "/", Fstype: "ext4", Size: 1e12, Free: 1e11},
+	}, mounts)
+}
 
-	// Test 1: progress before scan
-	progressReq := Request{
-		ID:     "progress-1",
-		Method: "progress",
-		Params: map[string]interface{}{},
+// TestDirInfoDepthCeiling tests that requested depth is capped on a very deep tree
+func TestDirInfoDepthCeiling(t *testing.T) {
+	root := &analyze.Dir{File: &analyze.File{Name: "root"}}
+	cur := root
+	for i := 0; i < 100000; i++ {
+		sub := &analyze.Dir{File: &analyze.File{Name: "sub", Parent: cur}}
+		cur.AddFile(sub)
+		cur = sub
 	}
-	err = sendSocketRequest(conn, progressReq)
-	assert.NoError(t, err)
+	root.UpdateStats(make(fs.HardLinkedItems))
+
+	s := NewServer(false, "")
+	depth, capped := s.clampDepth(1000000)
+	assert.True(t, capped)
+	assert.Equal(t, DefaultMaxDepth, depth)
+
+	info := convertToDirInfo(root, depth, dirInfoOptions{capped: capped})
+	for i := 0; i < DefaultMaxDepth; i++ {
+		assert.False(t, info.Truncated)
+		assert.Len(t, info.Children, 1)
+		info = info.Children[0]
+	}
+	assert.True(t, info.Truncated)
+	assert.Empty(t, info.Children)
+
+	depth, capped = s.clampDepth(3)
+	assert.False(t, capped)
+	assert.Equal(t, 3, depth)
 
-	resp, err := readSocketResponse(conn)
+	depth, capped = s.clampDepth(-1)
+	assert.False(t, capped)
+	assert.Equal(t, 0, depth)
+}
+
+// TestDirInfoTimesAndOwner tests optional times and owner in DirInfo
+func TestDirInfoTimesAndOwner(t *testing.T) {
+	file := &analyze.File{
+		Name:  "file",
+		Atime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(),
+		Ctime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(),
+		UID:   0,
+		GID:   100,
+	}
+	root := &analyze.Dir{File: &analyze.File{Name: "root"}}
+	file.Parent = root
+	root.AddFile(file)
+
+	info := convertToDirInfo(root, 1, dirInfoOptions{})
+	assert.Zero(t, info.Children[0].Atime)
+	assert.Nil(t, info.Children[0].UID)
+
+	info = convertToDirInfo(root, 1, dirInfoOptions{includeTimes: true, includeOwner: true})
+	assert.Zero(t, info.Atime)
+	assert.Equal(t, int64(1577836800), info.Children[0].Atime)
+	assert.Equal(t, int64(1609459200), info.Children[0].Ctime)
+	assert.Equal(t, uint32(0), *info.Children[0].UID)
+	assert.Equal(t, uint32(100), *info.Children[0].GID)
+
+	data, err := json.Marshal(info.Children[0])
 	assert.NoError(t, err)
-	assert.True(t, resp.Success)
-	assert.Equal(t, "progress-1", resp.ID)
+	assert.Contains(t, string(data), `"uid":0`)
+}
 
-	progressData, ok := resp.Data.(map[string]interface{})
-	assert.True(t, ok)
-	assert.False(t, progressData["is_scanning"].(bool))
+// Helper functions for socket communication
+
+func sendSocketRequest(conn net.Conn, req Request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	lengthBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(lengthBytes, uint32(len(data)))
+
+	if _, err := conn.Write(lengthBytes); err != nil {
+		return err
+	}
+	if _, err := conn.Write(data); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte{'\n'}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func readSocketResponse(conn net.Conn) (*Response, error) {
+	// Read length
+	lengthBytes := make([]byte, 4)
+	_, err := io.ReadFull(conn, lengthBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(lengthBytes)
 
-	// Test 2: start scan
-	scanReq := Request{
-		ID:     "scan-1",
-		Method: "scan",
-		Params: map[string]interface{}{"path": "test_dir"},
+	// Read data
+	data := make([]byte, length)
+	_, err = io.ReadFull(conn, data)
+	if err != nil {
+		return nil, err
 	}
-	err = sendSocketRequest(conn, scanReq)
+
+	// Read newline
+	newline := make([]byte, 1)
+	_, err = conn.Read(newline)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp Response
+	err = json.Unmarshal(data, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// TestLargestFiles tests top files are taken from the scan or walked
+func TestLargestFiles(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	budget := &walkBudget{ctx: context.Background()}
+	_, ok, _ := s.largestFiles(1, budget)
+	assert.False(t, ok)
+
+	s.scan("test_dir", scanOptions{trackTopFiles: 1})
+
+	top, ok, err := s.largestFiles(1, budget)
+	assert.True(t, ok)
 	assert.NoError(t, err)
+	assert.True(t, top.Precomputed)
+	assert.Equal(t, []TopFile{{Path: "test_dir/nested/subnested/file", Size: 5}}, top.Files)
 
-	resp, err = readSocketResponse(conn)
+	top, ok, err = s.largestFiles(2, budget)
+	assert.True(t, ok)
 	assert.NoError(t, err)
+	assert.False(t, top.Precomputed)
+	assert.Equal(t, []TopFile{
+		{Path: "test_dir/nested/subnested/file", Size: 5},
+		{Path: "test_dir/nested/file2", Size: 2},
+	}, top.Files)
+}
+
+func TestSetConcurrency(t *testing.T) {
+	s := &UnixSocketServer{server: NewServer(false, "")}
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"set_concurrency","params":{"value":2}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "No scan in progress", resp.Error)
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"set_concurrency","params":{}}`))
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "missing parameter")
+
+	s.server.mu.Lock()
+	s.server.isScanning = true
+	s.server.mu.Unlock()
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"set_concurrency","params":{"value":-5}}`))
 	assert.True(t, resp.Success)
-	assert.Equal(t, "scan-1", resp.ID)
+	assert.Equal(t, map[string]int{"concurrency": 1}, resp.Data)
+}
 
-	startData, ok := resp.Data.(map[string]interface{})
-	assert.True(t, ok)
-	assert.True(t, startData["started"].(bool))
+// blockingAnalyzer waits until unblocked before analyzing the dir
+type blockingAnalyzer struct {
+	*analyze.ParallelAnalyzer
+	started chan struct{}
+	unblock chan struct{}
+}
 
-	// Test 3: query progress during scan
-	time.Sleep(100 * time.Millisecond)
+func (a *blockingAnalyzer) AnalyzeDir(
+	path string, ignore common.ShouldDirBeIgnored, constGC bool,
+) fs.Item {
+	close(a.started)
+	<-a.unblock
+	return a.ParallelAnalyzer.AnalyzeDir(path, ignore, constGC)
+}
 
-	progressReq2 := Request{
-		ID:     "progress-2",
-		Method: "progress",
-		Params: map[string]interface{}{},
+func TestCancelKeepsCompletedScan(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+
+	gen, scannedAt := s.server.generation()
+	assert.Equal(t, uint64(1), gen)
+	assert.NotZero(t, scannedAt)
+
+	blocking := &blockingAnalyzer{
+		ParallelAnalyzer: analyze.CreateAnalyzer(),
+		started:          make(chan struct{}),
+		unblock:          make(chan struct{}),
 	}
-	err = sendSocketRequest(conn, progressReq2)
-	assert.NoError(t, err)
+	s.server.analyzer = blocking
 
-	resp, err = readSocketResponse(conn)
-	assert.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		s.server.scan("test_dir/nested", scanOptions{})
+		close(done)
+	}()
+	<-blocking.started
+
+	// previous result is served while the new scan runs
+	resp := s.processRequest([]byte(`{"id":"1","method":"directory","params":{}}`))
 	assert.True(t, resp.Success)
+	assert.Equal(t, "test_dir", resp.Data.(DirInfo).Name)
+	assert.Equal(t, uint64(1), resp.Data.(DirInfo).ScanGeneration)
 
-	// Should be scanning now
-	progressData2, ok := resp.Data.(map[string]interface{})
-	assert.True(t, ok)
-	// Note: We might catch it before it starts or after it finishes
-	_ = progressData2["is_scanning"].(bool)
+	// cancel returns once the cancelled scan is done
+	cancelled := make(chan *Response)
+	go func() {
+		cancelled <- s.processRequest([]byte(`{"id":"2","method":"cancel","params":{}}`))
+	}()
+	close(blocking.unblock)
+	<-done
+	resp = <-cancelled
+	assert.True(t, resp.Success)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"directory","params":{}}`))
+	assert.True(t, resp.Success)
+	assert.Equal(t, "test_dir", resp.Data.(DirInfo).Name)
+	assert.Equal(t, uint64(1), s.status().ScanGeneration)
 
-	// Test 4: query directory (root)
-	// Wait for scan to complete
-	time.Sleep(2 * time.Second)
+	s.server.analyzer = analyze.CreateAnalyzer()
+	s.server.scan("test_dir/nested", scanOptions{})
 
-	dirReq := Request{
-		ID:     "dir-1",
-		Method: "directory",
-		Params: map[string]interface{}{"path": "", "depth": 1},
+	resp = s.processRequest([]byte(`{"id":"4","method":"directory","params":{}}`))
+	assert.True(t, resp.Success)
+	assert.Equal(t, "nested", resp.Data.(DirInfo).Name)
+	assert.Equal(t, uint64(2), resp.Data.(DirInfo).ScanGeneration)
+	assert.Equal(t, uint64(2), s.status().ScanGeneration)
+}
+
+func TestScanCancelScan(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 10; j++ {
+			assert.NoError(t, os.MkdirAll(filepath.Join(root, fmt.Sprintf("dir%d", i), fmt.Sprintf("sub%d", j)), 0o755))
+		}
 	}
-	err = sendSocketRequest(conn, dirReq)
-	assert.NoError(t, err)
 
-	resp, err = readSocketResponse(conn)
-	assert.NoError(t, err)
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	scan := `{"id":"1","method":"scan","params":{"path":"` + root + `"}}`
+	for i := 0; i < 10; i++ {
+		generation := s.status().ScanGeneration
+		assert.True(t, s.processRequest([]byte(scan)).Success)
+		resp := s.processRequest([]byte(`{"id":"2","method":"cancel","params":{}}`))
+		assert.True(t, resp.Success)
+		assert.False(t, s.server.progressResponse().IsScanning)
+
+		// the next scan does not run together with the cancelled one
+		assert.True(t, s.processRequest([]byte(scan)).Success)
+		s.server.mu.RLock()
+		done := s.server.scanDone
+		s.server.mu.RUnlock()
+		<-done
+		// the first scan may have finished before it was cancelled
+		assert.Contains(t, []uint64{generation + 1, generation + 2}, s.status().ScanGeneration)
+	}
+}
+
+// cancelSignalingAnalyzer signals when the analysis is cancelled
+type cancelSignalingAnalyzer struct {
+	*blockingAnalyzer
+	cancelled chan struct{}
+}
+
+func (a *cancelSignalingAnalyzer) Cancel() {
+	a.blockingAnalyzer.Cancel()
+	close(a.cancelled)
+}
+
+func TestCancelKeepPartial(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	resp := s.processRequest([]byte(`{"id":"1","method":"cancel","params":{"keep_partial":true}}`))
 	assert.True(t, resp.Success)
+	assert.False(t, resp.Data.(map[string]bool)["partial_kept"])
 
-	dirData, ok := resp.Data.(map[string]interface{})
-	assert.True(t, ok)
-	assert.NotEmpty(t, dirData["name"])
-	assert.True(t, dirData["is_dir"].(bool))
-	assert.Greater(t, int(dirData["item_count"].(float64)), 0)
-
-	// Test 5: cancel (even though scan is done, should handle gracefully)
-	cancelReq := Request{
-		ID:     "cancel-1",
-		Method: "cancel",
-		Params: map[string]interface{}{},
+	analyzer := &cancelSignalingAnalyzer{
+		blockingAnalyzer: &blockingAnalyzer{
+			ParallelAnalyzer: analyze.CreateAnalyzer(),
+			started:          make(chan struct{}),
+			unblock:          make(chan struct{}),
+		},
+		cancelled: make(chan struct{}),
 	}
-	err = sendSocketRequest(conn, cancelReq)
-	assert.NoError(t, err)
+	s.server.analyzer = analyzer
+	sub := s.server.events.subscribe([]string{EventScanComplete})
+	defer s.server.events.unsubscribe(sub)
 
-	resp, err = readSocketResponse(conn)
-	assert.NoError(t, err)
+	go s.server.scan("test_dir", scanOptions{})
+	<-analyzer.started
+
+	cancelled := make(chan *Response)
+	go func() {
+		cancelled <- s.processRequest([]byte(`{"id":"2","method":"cancel","params":{"keep_partial":true}}`))
+	}()
+	<-analyzer.cancelled
+	close(analyzer.unblock)
+
+	// cancel returns once the partial tree is served
+	resp = <-cancelled
 	assert.True(t, resp.Success)
+	assert.True(t, resp.Data.(map[string]bool)["partial_kept"])
+	assert.False(t, s.server.progressResponse().IsScanning)
+
+	summary := (<-sub.events).Data.(DirInfo)
+	assert.Equal(t, false, *summary.Complete)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"directory","params":{"human":true}}`))
+	assert.True(t, resp.Success, resp.Error)
+	info := resp.Data.(DirInfo)
+	assert.Equal(t, "test_dir", info.Name)
+	assert.Equal(t, false, *info.Complete)
+	assert.Contains(t, info.Flags, "cancelled")
+	assert.Equal(t, ">= 4.0 KiB", info.SizeHuman)
+	assert.Equal(t, uint64(1), s.status().ScanGeneration)
+
+	resp = s.processRequest([]byte(`{"id":"4","method":"directory","params":{"allow_partial":true}}`))
+	assert.False(t, resp.Data.(PartialDirInfo).Complete)
+
+	// tree of finished scan is complete
+	s.server.analyzer = analyze.CreateAnalyzer()
+	s.server.scan("test_dir", scanOptions{})
+	resp = s.processRequest([]byte(`{"id":"5","method":"directory","params":{"depth":1}}`))
+	info = resp.Data.(DirInfo)
+	assert.Nil(t, info.Complete)
+	assert.Nil(t, info.Children[0].Complete)
+}
 
-	cancelData, ok := resp.Data.(map[string]interface{})
-	assert.True(t, ok)
-	assert.True(t, cancelData["cancelled"].(bool))
+func TestRescanServesCompleteTrees(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir/nested/subnested", scanOptions{})
+
+	blocking := &blockingAnalyzer{
+		ParallelAnalyzer: analyze.CreateAnalyzer(),
+		started:          make(chan struct{}),
+		unblock:          make(chan struct{}),
+	}
+	s.server.analyzer = blocking
+	defer func() { s.server.analyzer = analyze.CreateAnalyzer() }()
+
+	done := make(chan struct{})
+	go func() {
+		s.server.scan("test_dir", scanOptions{})
+		close(done)
+	}()
+	<-blocking.started
+
+	// old tree and its index are served until the new tree is complete
+	resp := s.processRequest([]byte(`{"id":"1","method":"directory","params":{}}`))
+	assert.True(t, resp.Success)
+	assert.Equal(t, "subnested", resp.Data.(DirInfo).Name)
+	resp = s.processRequest([]byte(`{"id":"2","method":"directory","params":{"path":"test_dir/nested"}}`))
+	assert.False(t, resp.Success)
+
+	close(blocking.unblock)
+	<-done
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"directory","params":{"path":"test_dir/nested"}}`))
+	assert.True(t, resp.Success)
+	info := resp.Data.(DirInfo)
+	assert.Equal(t, int64(7+4096*2), info.Size)
+	assert.Equal(t, uint64(2), s.status().ScanGeneration)
 }
 
+func TestScanRequiresDir(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
 
-// TestSocketErrorHandling tests error handling over socket
-func TestSocketErrorHandling(t *testing.T) {
-	socketPath := "/tmp/test-gdu-err-" + time.Now().Format("20060102150405") + ".sock"
-	defer os.Remove(socketPath)
+	s := &UnixSocketServer{server: NewServer(false, "")}
 
-	server, err := NewUnixSocketServer(socketPath, false, "")
-	assert.NoError(t, err)
+	resp := s.processRequest([]byte(`{"id":"1","method":"scan","params":{"path":"test_dir/nested/file2"}}`))
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "is not a directory")
 
-	go server.Start()
-	time.Sleep(100 * time.Millisecond)
+	resp = s.processRequest([]byte(`{"id":"2","method":"scan","params":{"path":"test_dir/missing"}}`))
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "no such file or directory")
 
-	conn, err := net.Dial("unix", socketPath)
-	assert.NoError(t, err)
-	defer conn.Close()
+	assert.False(t, s.server.progressResponse().IsScanning)
+}
 
-	// Test 1: Invalid method
-	invalidReq := Request{
-		ID:     "invalid-1",
-		Method: "invalid_method",
-		Params: map[string]interface{}{},
-	}
-	err = sendSocketRequest(conn, invalidReq)
-	assert.NoError(t, err)
+func TestScanError(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
 
-	resp, err := readSocketResponse(conn)
-	assert.NoError(t, err)
+	s := NewServer(false, "")
+	s.scan("test_dir", scanOptions{})
+	assert.Empty(t, s.progressResponse().Error)
+
+	// root which could not be read is flagged by the analyzer
+	s.scanError = rootError("test_dir/missing", &analyze.Dir{File: &analyze.File{Flag: '!'}})
+	assert.Contains(t, s.progressResponse().Error, "no such file or directory")
+	assert.Equal(t, "failed to read test_dir", rootError("test_dir", &analyze.Dir{File: &analyze.File{Flag: '!'}}))
+	assert.Empty(t, rootError("test_dir", s.completedDir))
+	// error kept by the analyzer is used as it is
+	root := &analyze.Dir{File: &analyze.File{Flag: '!'}, Flags: analyze.DirReadError, ErrorMessage: "open test_dir: permission denied"}
+	assert.Equal(t, "open test_dir: permission denied", rootError("test_dir", root))
+
+	s.scan("test_dir", scanOptions{})
+	assert.Empty(t, s.progressResponse().Error)
+}
+
+func TestDirectoryMinSize(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"directory","params":{"path":"test_dir/nested","depth":2,"min_size":100}}`))
+	assert.True(t, resp.Success)
+	info := resp.Data.(DirInfo)
+	assert.Equal(t, 1, info.HiddenCount)
+	assert.Equal(t, int64(2), info.HiddenSize)
+	assert.Len(t, info.Children, 1)
+	assert.Equal(t, "subnested", info.Children[0].Name)
+	assert.Empty(t, info.Children[0].Children)
+	assert.Equal(t, 1, info.Children[0].HiddenCount)
+	assert.Equal(t, int64(5), info.Children[0].HiddenSize)
+
+	// children are filtered by size of the size mode
+	root := &analyze.Dir{File: &analyze.File{Name: "root"}}
+	root.AddFile(&analyze.File{Name: "sparse", Size: 1000, Usage: 0, Parent: root})
+	root.AddFile(&analyze.File{Name: "small", Size: 10, Usage: 4096, Parent: root})
+	info = convertToDirInfo(root, 1, dirInfoOptions{minSize: 100, usage: true})
+	assert.Equal(t, 1, info.HiddenCount)
+	assert.Equal(t, int64(0), info.HiddenSize)
+	assert.Len(t, info.Children, 1)
+	assert.Equal(t, "small", info.Children[0].Name)
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"directory","params":{"min_size":-1}}`))
 	assert.False(t, resp.Success)
-	assert.Contains(t, resp.Error, "Unknown method")
+	assert.Contains(t, resp.Error, "min_size")
+}
+
+func TestDirectoryHuman(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"directory","params":{"depth":1,"human":true}}`))
+	assert.True(t, resp.Success)
+	info := resp.Data.(DirInfo)
+	assert.Equal(t, formatSize(info.Size), info.SizeHuman)
+	assert.Equal(t, formatSize(info.PhysicalSize), info.PhysicalSizeHuman)
+	assert.NotEmpty(t, info.Children[0].SizeHuman)
 
-	// Test 2: Missing parameter
-	scanReq := Request{
-		ID:     "scan-no-path",
-		Method: "scan",
-		Params: map[string]interface{}{}, // missing 'path'
+	resp = s.processRequest([]byte(`{"id":"2","method":"directory","params":{"depth":1}}`))
+	assert.True(t, resp.Success)
+	assert.Empty(t, resp.Data.(DirInfo).SizeHuman)
+}
+
+func TestDirectoryPercent(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"directory","params":{"path":"test_dir/nested","depth":1,"percent":true}}`))
+	assert.True(t, resp.Success, resp.Error)
+	info := resp.Data.(DirInfo)
+	assert.Nil(t, info.PercentOfParent)
+	for _, child := range info.Children {
+		expected := math.Round(float64(child.Size)*10000/float64(info.Size)) / 100
+		assert.Equal(t, expected, *child.PercentOfParent)
+		assert.Nil(t, child.CumulativePercent)
 	}
-	err = sendSocketRequest(conn, scanReq)
-	assert.NoError(t, err)
 
-	resp, err = readSocketResponse(conn)
-	assert.NoError(t, err)
+	resp = s.processRequest([]byte(`{"id":"2","method":"directory","params":{"path":"test_dir/nested","depth":1,"cumulative":true,"size_mode":"usage"}}`))
+	assert.True(t, resp.Success, resp.Error)
+	info = resp.Data.(DirInfo)
+	assert.Len(t, info.Children, 2)
+	assert.Equal(t, "subnested", info.Children[0].Name)
+	assert.Equal(t, *info.Children[0].PercentOfParent, *info.Children[0].CumulativePercent)
+	assert.Equal(t, math.Round(float64(info.Children[0].PhysicalSize+info.Children[1].PhysicalSize)*10000/
+		float64(info.PhysicalSize))/100, *info.Children[1].CumulativePercent)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"directory","params":{"depth":1,"size_mode":"blocks"}}`))
 	assert.False(t, resp.Success)
-	assert.Contains(t, resp.Error, "missing parameter")
 
-	// Test 3: Invalid parameter type
-	scanReq2 := Request{
-		ID:     "scan-wrong-type",
-		Method: "scan",
-		Params: map[string]interface{}{
-			"path": 123, // should be string
-		},
+	// default payload is unchanged
+	resp = s.processRequest([]byte(`{"id":"4","method":"directory","params":{"depth":1}}`))
+	assert.True(t, resp.Success)
+	assert.Nil(t, resp.Data.(DirInfo).Children[0].PercentOfParent)
+}
+
+func TestItemType(t *testing.T) {
+	dir := &analyze.Dir{File: &analyze.File{Name: "dir"}}
+	assert.Equal(t, "dir", convertToDirInfo(dir, 0, dirInfoOptions{}).Type)
+	assert.Equal(t, "file", itemType(&analyze.File{Flag: ' '}))
+	assert.Equal(t, "symlink", itemType(&analyze.File{Flag: '@', Kind: analyze.KindSymlink}))
+	assert.Equal(t, "socket", itemType(&analyze.File{Flag: '@', Kind: analyze.KindSocket}))
+	assert.Equal(t, "fifo", itemType(&analyze.File{Kind: analyze.KindFifo}))
+	assert.Equal(t, "chardev", itemType(&analyze.File{Kind: analyze.KindCharDevice}))
+	assert.Equal(t, "blockdev", itemType(&analyze.File{Kind: analyze.KindBlockDevice}))
+	// special file imported from ncdu export has unknown kind
+	assert.Equal(t, "other", itemType(&analyze.File{Flag: '@'}))
+}
+
+func TestDirectoryLinkTargets(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+	assert.NoError(t, os.Symlink("nested/file2", "test_dir/link"))
+	assert.NoError(t, os.Symlink("missing", "test_dir/broken"))
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{linkTargets: true})
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"directory","params":{"depth":1,"include_types":true}}`))
+	assert.True(t, resp.Success, resp.Error)
+	links := map[string]DirInfo{}
+	for _, child := range resp.Data.(DirInfo).Children {
+		links[child.Name] = child
 	}
-	err = sendSocketRequest(conn, scanReq2)
-	assert.NoError(t, err)
+	assert.Equal(t, "symlink", links["link"].Type)
+	assert.Equal(t, "nested/file2", links["link"].LinkTarget)
+	assert.False(t, links["link"].Broken)
+	assert.Equal(t, "missing", links["broken"].LinkTarget)
+	assert.True(t, links["broken"].Broken)
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"directory","params":{"depth":1}}`))
+	for _, child := range resp.Data.(DirInfo).Children {
+		assert.Empty(t, child.LinkTarget)
+	}
+}
 
-	resp, err = readSocketResponse(conn)
-	assert.NoError(t, err)
-	assert.False(t, resp.Success)
-	assert.Contains(t, resp.Error, "must be string")
+func TestPercentOf(t *testing.T) {
+	assert.Equal(t, 0.0, *percentOf(5, 0))
+	assert.Equal(t, 33.33, *percentOf(1, 3))
+	assert.Equal(t, 100.0, *percentOf(7, 7))
 }
 
-// TestSocketMultipleSequentialRequests tests multiple sequential requests on same connection
-func TestSocketMultipleSequentialRequests(t *testing.T) {
-	socketPath := "/tmp/test-gdu-seq-" + time.Now().Format("20060102150405") + ".sock"
-	defer os.Remove(socketPath)
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "0 B", formatSize(0))
+	assert.Equal(t, "1023 B", formatSize(1023))
+	assert.Equal(t, "1.0 KiB", formatSize(1024))
+	assert.Equal(t, "4.2 GiB", formatSize(4509715660))
+	assert.Equal(t, "1.5 TiB", formatSize(3<<39))
+}
 
-	server, err := NewUnixSocketServer(socketPath, false, "")
+func TestSizeRollup(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "sub", "deep"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "sub", "deep", "data"), make([]byte, 10000), 0o600))
+	assert.NoError(t, os.Link(filepath.Join(root, "sub", "deep", "data"), filepath.Join(root, "sub", "deep", "link")))
+	sparse, err := os.Create(filepath.Join(root, "sub", "sparse"))
 	assert.NoError(t, err)
+	assert.NoError(t, sparse.Truncate(1<<20))
+	assert.NoError(t, sparse.Close())
 
-	go server.Start()
-	time.Sleep(100 * time.Millisecond)
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan(root, scanOptions{})
 
-	conn, err := net.Dial("unix", socketPath)
-	assert.NoError(t, err)
-	defer conn.Close()
-
-	// Send multiple progress requests in sequence
-	for i := 0; i < 5; i++ {
-		req := Request{
-			ID:     "progress-seq-" + string(rune('0'+i)),
-			Method: "progress",
-			Params: map[string]interface{}{},
+	resp := s.processRequest([]byte(`{"id":"1","method":"directory","params":{"depth":3}}`))
+	assert.True(t, resp.Success)
+
+	// every dir sums apparent and allocated size of its children separately
+	counted := make(map[uint64]bool)
+	var check func(info DirInfo) (size, usage int64)
+	check = func(info DirInfo) (size, usage int64) {
+		if !info.IsDir {
+			return info.Size, info.PhysicalSize
 		}
+		size, usage = 4096, 4096
+		for _, child := range info.Children {
+			if counted[child.Inode] {
+				continue
+			}
+			counted[child.Inode] = true
+			childSize, childUsage := check(child)
+			size += childSize
+			usage += childUsage
+		}
+		assert.Equal(t, size, info.Size, info.Path)
+		assert.Equal(t, usage, info.PhysicalSize, info.Path)
+		return size, usage
+	}
+	info := resp.Data.(DirInfo)
+	check(info)
 
-		err = sendSocketRequest(conn, req)
-		assert.NoError(t, err)
+	// hard link is counted once, sparse file allocates less than its apparent size
+	children := make(map[string]DirInfo)
+	for _, child := range info.Children[0].Children {
+		children[child.Name] = child
+	}
+	assert.Equal(t, int64(4096+10000), children["deep"].Size)
+	sparseInfo := children["sparse"]
+	assert.Equal(t, int64(1<<20), sparseInfo.Size)
+	assert.Less(t, sparseInfo.PhysicalSize, sparseInfo.Size)
+}
 
-		resp, err := readSocketResponse(conn)
-		assert.NoError(t, err)
-		assert.True(t, resp.Success)
-		assert.Equal(t, req.ID, resp.ID)
+func TestItemID(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	s.scan("test_dir", scanOptions{})
+	first := convertToDirInfo(s.completedDir, 3, dirInfoOptions{})
+
+	s.scan("test_dir", scanOptions{})
+	second := convertToDirInfo(s.completedDir, 3, dirInfoOptions{})
+
+	nested := first.Children[0]
+	assert.NotEmpty(t, first.ID)
+	assert.NotEqual(t, first.ID, nested.ID)
+	assert.NotEqual(t, nested.Children[0].ID, nested.Children[1].ID)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, nested.ID, second.Children[0].ID)
+
+	// inode is not known, hash of the path is used
+	assert.Equal(t, itemID(0, 0, "dir/file"), itemID(0, 0, "dir/file"))
+	assert.NotEqual(t, itemID(0, 0, "dir/file"), itemID(0, 0, "dir/other"))
+	assert.Contains(t, itemID(0, 0, "dir/file"), "p:")
+	assert.Equal(t, "2a:10", itemID(42, 16, "dir/file"))
+}
+
+func TestDeviceAndInode(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	err := os.Link("test_dir/nested/file2", "test_dir/nested/link")
+	assert.NoError(t, err)
+
+	s := NewServer(false, "")
+	s.scan("test_dir", scanOptions{})
+
+	s.mu.RLock()
+	file := convertToDirInfo(s.findItem("test_dir/nested/file2"), 0, dirInfoOptions{})
+	link := convertToDirInfo(s.findItem("test_dir/nested/link"), 0, dirInfoOptions{})
+	dir := convertToDirInfo(s.findItem("test_dir/nested"), 0, dirInfoOptions{})
+	s.mu.RUnlock()
+
+	assert.NotZero(t, file.Inode)
+	assert.Equal(t, file.Device, link.Device)
+	assert.Equal(t, file.Inode, link.Inode)
+	assert.Equal(t, file.Device, dir.Device)
+	assert.NotEqual(t, file.Inode, dir.Inode)
+}
+
+func TestLargestDirs(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	_, ok := s.largestDirs(1, false)
+	assert.False(t, ok)
+
+	s.scan("test_dir", scanOptions{})
+
+	top, ok := s.largestDirs(2, false)
+	assert.True(t, ok)
+	assert.Len(t, top.Dirs, 2)
+	assert.Equal(t, "test_dir", top.Dirs[0].Path)
+	assert.Equal(t, "test_dir/nested", top.Dirs[1].Path)
+	assert.Equal(t, int64(7+4096*3), top.Dirs[0].Size)
+	assert.Empty(t, top.Dirs[0].Children)
+
+	top, ok = s.largestDirs(5, true)
+	assert.True(t, ok)
+	assert.Len(t, top.Dirs, 2)
+	assert.Equal(t, "test_dir/nested", top.Dirs[0].Path)
+	assert.Equal(t, "test_dir/nested/subnested", top.Dirs[1].Path)
+}
+
+func TestFinalProgress(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	for i := 0; i < 10; i++ {
+		s.scan("test_dir", scanOptions{})
+
+		progress := s.progressResponse()
+		assert.False(t, progress.IsScanning)
+		assert.Equal(t, 5, progress.ItemCount)
+		assert.Equal(t, 2, progress.FileCount)
+		assert.Equal(t, 3, progress.DirCount)
+		assert.Equal(t, int64(7), progress.TotalSize)
 	}
 }
 
-// TestSocketConnectionClose tests graceful connection close
-func TestSocketConnectionClose(t *testing.T) {
-	socketPath := "/tmp/test-gdu-close-" + time.Now().Format("20060102150405") + ".sock"
-	defer os.Remove(socketPath)
+func TestScanDuration(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	status := s.status()
+	assert.Zero(t, status.ScanStartedAt)
+	assert.Zero(t, status.ScanDurationMs)
 
-	server, err := NewUnixSocketServer(socketPath, false, "")
+	before := time.Now()
+	s.server.scan("test_dir", scanOptions{})
+
+	startedAt, finishedAt, duration := s.server.scanTimes()
+	assert.False(t, startedAt.Before(before))
+	assert.False(t, finishedAt.Before(startedAt))
+	assert.Equal(t, finishedAt.Sub(startedAt), duration)
+
+	status = s.status()
+	assert.Equal(t, startedAt.Unix(), status.ScanStartedAt)
+	assert.Equal(t, finishedAt.Unix(), status.ScanFinishedAt)
+	assert.Equal(t, duration.Milliseconds(), status.ScanDurationMs)
+}
+
+func TestList(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	resp := s.processRequest([]byte(`{"id":"1","method":"list","params":{}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "No scan completed", resp.Error)
+
+	s.server.scan("test_dir", scanOptions{})
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"list","params":{}}`))
+	assert.True(t, resp.Success)
+	assert.Equal(t, []ListEntry{{Name: "nested", IsDir: true}}, resp.Data)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"list","params":{"path":"test_dir/nested"}}`))
+	assert.True(t, resp.Success)
+	assert.ElementsMatch(t, []ListEntry{
+		{Name: "subnested", IsDir: true},
+		{Name: "file2", IsDir: false},
+	}, resp.Data)
+
+	resp = s.processRequest([]byte(`{"id":"4","method":"list","params":{"path":"test_dir/nested/file2"}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "Not a directory", resp.Error)
+
+	resp = s.processRequest([]byte(`{"id":"5","method":"list","params":{"path":"test_dir/missing"}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "Directory not found", resp.Error)
+
+	resp = s.processRequest([]byte(`{"id":"6","method":"list","params":{"path":"test_dir/.."}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeForbidden, resp.Code)
+}
+
+func TestNewServerReplacesStaleSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+	// leave the socket file behind as a crashed server would
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	_, err = os.Stat(socketPath)
 	assert.NoError(t, err)
 
-	go server.Start()
-	time.Sleep(100 * time.Millisecond)
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	defer server.listener.Close()
 
-	// Connect and immediately close
 	conn, err := net.Dial("unix", socketPath)
 	assert.NoError(t, err)
 	conn.Close()
+}
 
-	// Server should still be running
-	time.Sleep(50 * time.Millisecond)
+func TestNewServerRefusesLiveSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
 
-	// New connection should work
-	conn2, err := net.Dial("unix", socketPath)
+	first, err := NewUnixSocketServer(socketPath, false, "")
 	assert.NoError(t, err)
-	defer conn2.Close()
+	defer first.listener.Close()
 
-	req := Request{
-		ID:     "after-close",
-		Method: "progress",
-		Params: map[string]interface{}{},
-	}
-	err = sendSocketRequest(conn2, req)
+	_, err = NewUnixSocketServer(socketPath, false, "")
+	assert.ErrorIs(t, err, ErrSocketInUse)
+
+	// the first server is still reachable
+	_, err = os.Stat(socketPath)
+	assert.NoError(t, err)
+	conn, err := net.Dial("unix", socketPath)
 	assert.NoError(t, err)
+	conn.Close()
 }
 
-// Helper functions for socket communication
+func TestAncestors(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
 
-func sendSocketRequest(conn net.Conn, req Request) error {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return err
-	}
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	resp := s.processRequest([]byte(`{"id":"1","method":"ancestors","params":{"path":"test_dir"}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "No scan completed", resp.Error)
 
-	lengthBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(lengthBytes, uint32(len(data)))
+	s.server.scan("test_dir", scanOptions{})
 
-	if _, err := conn.Write(lengthBytes); err != nil {
-		return err
-	}
-	if _, err := conn.Write(data); err != nil {
-		return err
-	}
-	if _, err := conn.Write([]byte{'\n'}); err != nil {
-		return err
+	resp = s.processRequest([]byte(`{"id":"2","method":"ancestors","params":{"path":"test_dir/nested/subnested/file","human":true}}`))
+	assert.True(t, resp.Success, resp.Error)
+	chain := resp.Data.([]DirInfo)
+	assert.Len(t, chain, 4)
+	for i, path := range []string{"test_dir", "test_dir/nested", "test_dir/nested/subnested", "test_dir/nested/subnested/file"} {
+		assert.Equal(t, path, chain[i].Path)
+		assert.Nil(t, chain[i].Children)
 	}
+	assert.Equal(t, s.server.completedDir.GetSize(), chain[0].Size)
+	assert.Equal(t, "5 B", chain[3].SizeHuman)
 
-	return nil
+	resp = s.processRequest([]byte(`{"id":"3","method":"ancestors","params":{"path":"test_dir/missing"}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "Item not found", resp.Error)
 }
 
-func readSocketResponse(conn net.Conn) (*Response, error) {
-	// Read length
-	lengthBytes := make([]byte, 4)
-	_, err := io.ReadFull(conn, lengthBytes)
-	if err != nil {
-		return nil, err
-	}
-
-	length := binary.BigEndian.Uint32(lengthBytes)
+func TestScanTimeout(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
 
-	// Read data
-	data := make([]byte, length)
-	_, err = io.ReadFull(conn, data)
-	if err != nil {
-		return nil, err
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	scan := func(params string) {
+		t.Helper()
+		resp := s.processRequest([]byte(`{"id":"1","method":"scan","params":{"path":"test_dir",` + params + `}}`))
+		assert.True(t, resp.Success, resp.Error)
+		s.server.mu.RLock()
+		done := s.server.scanDone
+		s.server.mu.RUnlock()
+		<-done
 	}
 
-	// Read newline
-	newline := make([]byte, 1)
-	_, err = conn.Read(newline)
-	if err != nil {
-		return nil, err
-	}
+	// throttled scan reads one dir per second, the timeout cancels it after the first one
+	scan(`"throttle":1,"timeout_sec":1`)
+	assert.True(t, s.server.progressResponse().TimedOut)
+	resp := s.processRequest([]byte(`{"id":"2","method":"directory","params":{"depth":3}}`))
+	assert.True(t, resp.Success)
+	info := resp.Data.(DirInfo)
+	assert.Equal(t, "test_dir", info.Name)
+	assert.Equal(t, false, *info.Complete)
+
+	scan(`"timeout_sec":60`)
+	assert.False(t, s.server.progressResponse().TimedOut)
+	resp = s.processRequest([]byte(`{"id":"3","method":"directory","params":{}}`))
+	assert.Nil(t, resp.Data.(DirInfo).Complete)
+}
 
-	// Parse response
-	var resp Response
-	err = json.Unmarshal(data, &resp)
-	if err != nil {
-		return nil, err
-	}
+func TestScanThrottle(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
 
-	return &resp, nil
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	resp := s.processRequest([]byte(`{"id":"1","method":"scan","params":{"path":"test_dir","throttle":-1}}`))
+	assert.False(t, resp.Success)
+
+	s.server.scan("test_dir", scanOptions{throttle: 1000})
+	assert.Equal(t, 1000, s.server.progressResponse().Throttle)
+
+	// scans cannot read faster than the server allows
+	s.SetScanThrottle(500)
+	s.server.scan("test_dir", scanOptions{throttle: 1000})
+	assert.Equal(t, 500, s.server.progressResponse().Throttle)
+	s.server.scan("test_dir", scanOptions{})
+	assert.Equal(t, 500, s.server.progressResponse().Throttle)
+	s.server.scan("test_dir", scanOptions{throttle: 100})
+	assert.Equal(t, 100, s.server.progressResponse().Throttle)
+
+	s.SetScanThrottle(0)
+	s.server.scan("test_dir", scanOptions{})
+	assert.Equal(t, 0, s.server.progressResponse().Throttle)
 }
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultSocketMode allows only the current user to access the socket
+const DefaultSocketMode os.FileMode = 0o700
+
+// ErrSocketInUse is returned when another server is listening on the socket
+var ErrSocketInUse = errors.New("socket already in use by another server")
+
+// Options holds settings of the Unix socket server
+type Options struct {
+	// SocketMode is permission mode of the socket file, DefaultSocketMode if zero
+	SocketMode os.FileMode
+	// SocketGroup is name or ID of group the socket file is given to, unchanged if empty
+	SocketGroup string
+	// ReadOnly rejects methods changing the filesystem
+	ReadOnly bool
+	// BaseDir is directory relative paths of requests are resolved against,
+	// paths outside of it are rejected when set
+	BaseDir string
+	// MaxMessageSize is the largest request accepted, DefaultMaxMessageSize if zero
+	MaxMessageSize int
+	// IgnoreHidden skips hidden files in scans not setting ignore_hidden
+	IgnoreHidden bool
+	// IgnoreFilePatterns are patterns of files left out of scans not setting ignore_file_patterns
+	IgnoreFilePatterns []string
+}
+
+// validateSocketMode checks that mode has only permission bits set
+// and lets the owner connect to the socket
+func validateSocketMode(mode os.FileMode) error {
+	if mode&^os.ModePerm != 0 {
+		return fmt.Errorf("invalid socket mode %v: only permission bits can be set", mode)
+	}
+	if mode&0o200 == 0 {
+		return fmt.Errorf("invalid socket mode %04o: owner needs write permission to connect", mode)
+	}
+	return nil
+}
+
+// IsAbstractSocket returns true if the path names socket in the abstract namespace,
+// given by leading '@' or null byte. Abstract sockets have no file, so there is
+// nothing to clean up, but they also have no permissions and are available only on Linux.
+func IsAbstractSocket(socketPath string) bool {
+	return strings.HasPrefix(socketPath, "@") || strings.HasPrefix(socketPath, "\x00")
+}
+
+// listenAbstract binds the socket in the abstract namespace,
+// mode and group of the socket cannot be set as there is no file
+func listenAbstract(socketPath, group string) (net.Listener, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("abstract unix sockets are supported only on Linux")
+	}
+	if group != "" {
+		return nil, fmt.Errorf("socket group cannot be set on abstract unix socket")
+	}
+	// net package binds names beginning with '@' in the abstract namespace
+	listener, err := net.Listen("unix", "@"+socketPath[1:])
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return nil, ErrSocketInUse
+		}
+		return nil, fmt.Errorf("failed to create unix socket: %w", err)
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes socket file if nobody accepts connections on it
+func removeStaleSocket(socketPath string) error {
+	if _, err := os.Lstat(socketPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err == nil {
+		conn.Close()
+		return ErrSocketInUse
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) && !errors.Is(err, syscall.ENOENT) {
+		return fmt.Errorf("failed to check existing socket: %w", err)
+	}
+
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove existing socket: %w", err)
+	}
+	return nil
+}
+
+// listenUnix creates the socket in a private directory, sets its permissions
+// and moves it into place, so nobody can connect before the permissions are set
+func listenUnix(socketPath string, mode os.FileMode, group string) (net.Listener, error) {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(socketPath), ".gdu-sock-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory for unix socket: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpPath := filepath.Join(tmpDir, "sock")
+	listener, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create unix socket: %w", err)
+	}
+	// the socket file is moved away from the bound path, Stop removes it
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := setSocketOwnership(tmpPath, mode, group); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, socketPath); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to move unix socket into place: %w", err)
+	}
+	return listener, nil
+}
+
+// setSocketOwnership sets permission mode of the socket file and gives it to the group
+func setSocketOwnership(path string, mode os.FileMode, group string) error {
+	if group != "" {
+		gid, err := lookupGroupID(group)
+		if err != nil {
+			return err
+		}
+		if err := os.Chown(path, -1, gid); err != nil {
+			return fmt.Errorf("failed to set socket group: %w", err)
+		}
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return nil
+}
+
+// lookupGroupID returns ID of group given by name or numeric ID
+func lookupGroupID(group string) (int, error) {
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		if g, err = user.LookupGroupId(group); err != nil {
+			return 0, fmt.Errorf("unknown socket group %s: %w", group, err)
+		}
+	}
+	return strconv.Atoi(g.Gid)
+}
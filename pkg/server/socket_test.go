@@ -0,0 +1,127 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocketDefaultMode(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "gdu.sock")
+
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	defer server.listener.Close()
+
+	info, err := os.Stat(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultSocketMode, info.Mode().Perm())
+	assert.NotZero(t, info.Mode()&os.ModeSocket)
+
+	// the private directory the socket was created in is removed
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSocketModeAndGroup(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	gid := os.Getgid()
+
+	server, err := NewUnixSocketServerWithOptions(socketPath, false, "", Options{
+		SocketMode:  0o770,
+		SocketGroup: strconv.Itoa(gid),
+	})
+	assert.NoError(t, err)
+	defer server.listener.Close()
+
+	info, err := os.Stat(socketPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o770), info.Mode().Perm())
+	assert.Equal(t, uint32(gid), info.Sys().(*syscall.Stat_t).Gid)
+}
+
+func TestSocketUnknownGroup(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+
+	_, err := NewUnixSocketServerWithOptions(socketPath, false, "", Options{
+		SocketGroup: "no-such-group-gdu",
+	})
+	assert.ErrorContains(t, err, "unknown socket group")
+
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSocketInvalidMode(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+
+	_, err := NewUnixSocketServerWithOptions(socketPath, false, "", Options{
+		SocketMode: os.ModeSetuid | 0o700,
+	})
+	assert.ErrorContains(t, err, "only permission bits")
+
+	_, err = NewUnixSocketServerWithOptions(socketPath, false, "", Options{
+		SocketMode: 0o500,
+	})
+	assert.ErrorContains(t, err, "owner needs write permission")
+
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are supported only on Linux")
+	}
+	socketPath := "@gdu-test-" + strconv.Itoa(os.Getpid())
+
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	go server.Start()
+
+	conn, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	conn.Close()
+
+	_, err = NewUnixSocketServer(socketPath, false, "")
+	assert.ErrorIs(t, err, ErrSocketInUse)
+
+	_, err = NewUnixSocketServerWithOptions("@gdu-test-group", false, "", Options{SocketGroup: "0"})
+	assert.ErrorContains(t, err, "socket group cannot be set")
+
+	assert.NoError(t, server.Stop())
+	_, err = os.Lstat(socketPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSocketServerOptions(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+
+	server, err := NewUnixSocketServerWithOptions(socketPath, false, "", Options{
+		MaxMessageSize:     1024,
+		IgnoreHidden:       true,
+		IgnoreFilePatterns: []string{"*.tmp"},
+	})
+	assert.NoError(t, err)
+	defer server.listener.Close()
+	assert.Equal(t, 1024, server.server.maxMessageSize)
+	assert.True(t, server.server.defaultIgnoreHidden)
+	assert.Equal(t, []FilePattern{{Pattern: "*.tmp", MatchOn: "name"}}, server.server.defaultIgnoreFiles)
+
+	_, err = NewUnixSocketServerWithOptions(socketPath, false, "", Options{MaxMessageSize: -1})
+	assert.ErrorContains(t, err, "max message size")
+
+	_, err = NewUnixSocketServerWithOptions(socketPath, false, "", Options{IgnoreFilePatterns: []string{"[a-"}})
+	assert.ErrorContains(t, err, "invalid file pattern")
+}
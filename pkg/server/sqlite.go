@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+	_ "modernc.org/sqlite" // registers sqlite driver
+)
+
+// sqliteBatchSize is number of rows inserted in one transaction
+const sqliteBatchSize = 10000
+
+const sqliteSchema = `
+CREATE TABLE items (
+	id INTEGER PRIMARY KEY,
+	parent_id INTEGER REFERENCES items(id),
+	name TEXT NOT NULL,
+	path TEXT NOT NULL,
+	is_dir INTEGER NOT NULL,
+	size INTEGER NOT NULL,
+	usage INTEGER NOT NULL,
+	mtime INTEGER NOT NULL,
+	flag TEXT NOT NULL,
+	uid INTEGER NOT NULL,
+	gid INTEGER NOT NULL
+)`
+
+// indexes are created after the rows are inserted, which is faster than updating them with every row
+const sqliteIndexes = `
+CREATE INDEX items_parent_id ON items(parent_id);
+CREATE INDEX items_path ON items(path);
+CREATE INDEX items_size ON items(size);
+CREATE INDEX items_owner ON items(uid, gid)`
+
+// sqliteWriter inserts items in batches, each batch in its own transaction
+type sqliteWriter struct {
+	ctx    context.Context
+	db     *sql.DB
+	tx     *sql.Tx
+	stmt   *sql.Stmt
+	lastID int64
+	rows   int
+	opts   exportOptions
+}
+
+// exportSQLite writes the tree into items table of new SQLite database at output,
+// the file has to be empty or not exist. Items deeper than max depth are left out.
+func exportSQLite(ctx context.Context, output string, root fs.Item, opts exportOptions) error {
+	db, err := sql.Open("sqlite", output)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// database is written once by single connection, durability of its journal is not needed
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, "PRAGMA journal_mode = OFF; PRAGMA synchronous = OFF"); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		return err
+	}
+
+	w := &sqliteWriter{ctx: ctx, db: db, opts: opts}
+	if err := w.insert(root, 0, 0); err != nil {
+		w.rollback()
+		return err
+	}
+	if err := w.commit(); err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, sqliteIndexes)
+	return err
+}
+
+// insert inserts the item and its children, parentID of the root is 0
+func (w *sqliteWriter) insert(item fs.Item, parentID int64, depth int) error {
+	if w.stmt == nil {
+		if err := w.begin(); err != nil {
+			return err
+		}
+	}
+
+	w.lastID++
+	id := w.lastID
+	var parent interface{}
+	if parentID != 0 {
+		parent = parentID
+	}
+	var mtime int64
+	if !item.GetMtime().IsZero() {
+		mtime = item.GetMtime().Unix()
+	}
+	uid, gid := item.GetOwner()
+
+	_, err := w.stmt.ExecContext(w.ctx,
+		id, parent, item.GetName(), item.GetPath(), item.IsDir(),
+		item.GetSize(), item.GetUsage(), mtime, string(item.GetFlag()), uid, gid,
+	)
+	if err != nil {
+		return err
+	}
+	if w.opts.rows != nil {
+		w.opts.rows.Add(1)
+	}
+
+	w.rows++
+	if w.rows == sqliteBatchSize {
+		if err := w.commit(); err != nil {
+			return err
+		}
+	}
+
+	if !item.IsDir() || depth == w.opts.maxDepth {
+		return nil
+	}
+	for _, child := range item.GetFiles() {
+		if err := w.insert(child, id, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *sqliteWriter) begin() error {
+	tx, err := w.db.BeginTx(w.ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(w.ctx, `INSERT INTO items
+		(id, parent_id, name, path, is_dir, size, usage, mtime, flag, uid, gid)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	w.tx, w.stmt = tx, stmt
+	return nil
+}
+
+// commit commits the running batch, next insert begins a new one
+func (w *sqliteWriter) commit() error {
+	if w.tx == nil {
+		return nil
+	}
+	w.stmt.Close()
+	err := w.tx.Commit()
+	w.tx, w.stmt, w.rows = nil, nil, 0
+	return err
+}
+
+func (w *sqliteWriter) rollback() {
+	if w.tx == nil {
+		return
+	}
+	w.stmt.Close()
+	_ = w.tx.Rollback()
+	w.tx, w.stmt, w.rows = nil, nil, 0
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportSQLite(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"export","params":{"format":"sqlite"}}`))
+	assert.False(t, resp.Success)
+
+	dir := t.TempDir()
+	assert.NoError(t, s.SetAllowedPaths([]string{dir}))
+	output := filepath.Join(dir, "tree.db")
+	resp = s.processRequest([]byte(`{"id":"2","method":"export","params":{"format":"sqlite","output":"` + output + `"}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, ExportResponse{Output: output, Rows: 5}, resp.Data)
+
+	// existing database is replaced only with overwrite
+	resp = s.processRequest([]byte(`{"id":"2","method":"export","params":{"format":"sqlite","output":"` + output + `"}}`))
+	assert.False(t, resp.Success)
+	resp = s.processRequest([]byte(`{"id":"2","method":"export","params":{"format":"sqlite","output":"` + output + `","overwrite":true}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, ExportResponse{Output: output, Rows: 5}, resp.Data)
+
+	db, err := sql.Open("sqlite", output)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var count, files, size int64
+	assert.NoError(t, db.QueryRow(
+		`SELECT COUNT(*), SUM(NOT is_dir), SUM(CASE WHEN is_dir THEN 0 ELSE size END) FROM items`,
+	).Scan(&count, &files, &size))
+	assert.Equal(t, int64(5), count)
+	assert.Equal(t, int64(2), files)
+	assert.Equal(t, int64(7), size)
+
+	var parent string
+	assert.NoError(t, db.QueryRow(
+		`SELECT p.path FROM items i JOIN items p ON p.id = i.parent_id WHERE i.name = 'file2'`,
+	).Scan(&parent))
+	assert.Equal(t, "test_dir/nested", parent)
+
+	var root int64
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM items WHERE parent_id IS NULL`).Scan(&root))
+	assert.Equal(t, int64(1), root)
+}
+
+func TestExportSQLiteCancelled(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	s.scan("test_dir", scanOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := exportSQLite(ctx, filepath.Join(t.TempDir(), "tree.db"), s.completedDir, exportOptions{maxDepth: -1})
+	assert.ErrorIs(t, err, context.Canceled)
+}
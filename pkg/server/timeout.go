@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// budgetCheckInterval is number of items examined between two checks of the request deadline
+const budgetCheckInterval = 1024
+
+// TimeoutResponse is data of response to request which ran out of its time budget
+type TimeoutResponse struct {
+	// ItemsExamined is number of items the request went through before it was stopped
+	ItemsExamined int64 `json:"items_examined"`
+	// Partial is result found so far, set by methods whose partial result makes sense
+	Partial interface{} `json:"partial,omitempty"`
+}
+
+// walkBudget stops walk of the tree once deadline of the request passes
+type walkBudget struct {
+	ctx      context.Context
+	examined int64
+}
+
+// step counts examined item, error of the context is returned once it is done.
+// The context is checked only every budgetCheckInterval items.
+func (b *walkBudget) step() error {
+	b.examined++
+	if b.examined%budgetCheckInterval != 0 {
+		return nil
+	}
+	return b.ctx.Err()
+}
+
+// requestTimeout returns time budget of the request, the server default caps budget set by the client.
+// Zero means unlimited.
+func (s *UnixSocketServer) requestTimeout(req *Request) time.Duration {
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout <= 0 || s.defaultTimeout > 0 && s.defaultTimeout < timeout {
+		return s.defaultTimeout
+	}
+	return timeout
+}
+
+// isTimeout returns true if the error was caused by passed deadline of the request
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// setTimeout marks the response as failed by passed deadline
+func (resp *Response) setTimeout(examined int64, partial interface{}) {
+	resp.Success = false
+	resp.Error = "request exceeded its time budget"
+	resp.Code = ErrCodeTimeout
+	resp.Data = TimeoutResponse{ItemsExamined: examined, Partial: partial}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/dundee/gdu/v5/pkg/analyze"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestTimeoutBudget(t *testing.T) {
+	s := &UnixSocketServer{}
+	assert.Zero(t, s.requestTimeout(&Request{}))
+	assert.Equal(t, 50*time.Millisecond, s.requestTimeout(&Request{TimeoutMs: 50}))
+
+	s.SetRequestTimeout(time.Second)
+	assert.Equal(t, time.Second, s.requestTimeout(&Request{}))
+	assert.Equal(t, 50*time.Millisecond, s.requestTimeout(&Request{TimeoutMs: 50}))
+	assert.Equal(t, time.Second, s.requestTimeout(&Request{TimeoutMs: 5000}))
+}
+
+func TestTopFilesTimeout(t *testing.T) {
+	root := &analyze.Dir{File: &analyze.File{Name: "root"}}
+	for i := 0; i < 3*budgetCheckInterval; i++ {
+		attachItem(root, &analyze.File{Name: "file" + strconv.Itoa(i), Size: int64(i)})
+	}
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.completedDir = root
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	resp := s.handleRequest(ctx, &connection{}, &Request{ID: "1", Method: "top_files", Params: map[string]interface{}{"count": 1.0}})
+
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeTimeout, resp.Code)
+	data := resp.Data.(TimeoutResponse)
+	assert.Equal(t, int64(budgetCheckInterval), data.ItemsExamined)
+	// the largest file of those examined before the deadline
+	assert.Equal(t, []TopFile{{Path: "root/file1022", Size: 1022}}, data.Partial.(TopFilesResponse).Files)
+
+	resp = s.handleRequest(context.Background(), &connection{}, &Request{ID: "2", Method: "top_files", Params: map[string]interface{}{"count": 1.0}})
+	assert.True(t, resp.Success, resp.Error)
+}
+
+func TestDuplicatesTimeout(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+
+	resp := s.processRequest([]byte(`{"id":"1","method":"duplicates","timeout_ms":60000}`))
+	assert.True(t, resp.Success, resp.Error)
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	resp = s.handleRequest(ctx, &connection{}, &Request{ID: "2", Method: "duplicates"})
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeTimeout, resp.Code)
+}
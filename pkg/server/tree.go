@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+)
+
+// defaultTreeDepth is depth of tree rendered when max_depth is not given
+const defaultTreeDepth = 2
+
+// TreeResponse is text rendering of the scanned tree
+type TreeResponse struct {
+	Tree string `json:"tree"`
+}
+
+// treeOptions holds settings of tree rendering
+type treeOptions struct {
+	// maxDepth limits depth of rendered items, zero renders only the root
+	maxDepth int
+	// human formats sizes with binary prefixes
+	human bool
+	// usage shows physical sizes instead of apparent ones
+	usage bool
+}
+
+// treeLine is one rendered item, sizes are aligned once all lines are known
+type treeLine struct {
+	size string
+	name string
+}
+
+// renderTree renders the tree as lines of sizes aligned to the right followed by
+// branches and names of items. Children are sorted by size and listed down to maxDepth,
+// names of dirs end with slash. It stops once the context is done.
+func renderTree(ctx context.Context, root fs.Item, opts treeOptions) (string, error) {
+	name := root.GetPath() + dirSuffix(root)
+	if isVirtualRoot(root) {
+		name = ""
+	}
+	lines := []treeLine{{size: opts.formatSize(root), name: name}}
+	lines = appendTreeLines(lines, root, "", opts.maxDepth, opts)
+
+	width := 0
+	for _, line := range lines {
+		width = max(width, len(line.size))
+	}
+
+	var buff strings.Builder
+	w := &ctxWriter{ctx: ctx, w: &buff}
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w, "%*s  %s\n", width, line.size, line.name); err != nil {
+			return "", err
+		}
+	}
+	return buff.String(), nil
+}
+
+// appendTreeLines appends lines of children of the item prefixed by branches
+func appendTreeLines(lines []treeLine, item fs.Item, prefix string, depth int, opts treeOptions) []treeLine {
+	if !item.IsDir() || depth <= 0 {
+		return lines
+	}
+
+	files := append(fs.Files(nil), item.GetFiles()...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return opts.size(files[i]) > opts.size(files[j])
+	})
+
+	for i, child := range files {
+		branch, indent := "├── ", "│   "
+		if i == len(files)-1 {
+			branch, indent = "└── ", "    "
+		}
+		// roots of scan of multiple paths are shown with their paths
+		name := child.GetName()
+		if isVirtualRoot(item) {
+			name = child.GetPath()
+		}
+		lines = append(lines, treeLine{
+			size: opts.formatSize(child),
+			name: prefix + branch + name + dirSuffix(child),
+		})
+		lines = appendTreeLines(lines, child, prefix+indent, depth-1, opts)
+	}
+	return lines
+}
+
+// size returns size of the item in the requested size mode
+func (opts treeOptions) size(item fs.Item) int64 {
+	if opts.usage {
+		return item.GetUsage()
+	}
+	return item.GetSize()
+}
+
+func (opts treeOptions) formatSize(item fs.Item) string {
+	if opts.human {
+		return formatSize(opts.size(item))
+	}
+	return strconv.FormatInt(opts.size(item), 10)
+}
+
+func dirSuffix(item fs.Item) string {
+	if item.IsDir() {
+		return "/"
+	}
+	return ""
+}
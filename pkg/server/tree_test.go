@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTree(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	resp := s.processRequest([]byte(`{"id":"1","method":"tree"}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "No scan completed", resp.Error)
+
+	s.server.scan("test_dir", scanOptions{})
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"tree","params":{"max_depth":3,"human":false}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, ""+
+		"12295  test_dir/\n"+
+		" 8199  └── nested/\n"+
+		" 4101      ├── subnested/\n"+
+		"    5      │   └── file\n"+
+		"    2      └── file2\n",
+		resp.Data.(TreeResponse).Tree)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"tree","params":{"path":"test_dir/nested","max_depth":1}}`))
+	assert.True(t, resp.Success, resp.Error)
+	assert.Equal(t, ""+
+		"8.0 KiB  test_dir/nested/\n"+
+		"4.0 KiB  ├── subnested/\n"+
+		"    2 B  └── file2\n",
+		resp.Data.(TreeResponse).Tree)
+
+	resp = s.processRequest([]byte(`{"id":"4","method":"tree","params":{"max_depth":-1}}`))
+	assert.False(t, resp.Success)
+	resp = s.processRequest([]byte(`{"id":"5","method":"tree","params":{"path":"test_dir/missing"}}`))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "Item not found", resp.Error)
+}
+
+func TestTreeTimeout(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	s.server.scan("test_dir", scanOptions{})
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	resp := s.handleRequest(ctx, &connection{}, &Request{ID: "1", Method: "tree"})
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrCodeTimeout, resp.Code)
+}
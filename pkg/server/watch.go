@@ -0,0 +1,438 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dundee/gdu/v5/pkg/analyze"
+	"github.com/dundee/gdu/v5/pkg/fs"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultWatchLimit is the default max number of directories watched in watch mode
+const DefaultWatchLimit = 8192
+
+// watchDebounce is time changes are collected for before they are pushed to subscribers
+const watchDebounce = 200 * time.Millisecond
+
+// EventTreeUpdate is pushed with changes of the tree made in watch mode
+const EventTreeUpdate = "tree_update"
+
+// Operations of tree changes
+const (
+	ChangeCreate = "create"
+	ChangeDelete = "delete"
+	ChangeModify = "modify"
+)
+
+// TreeChange is a change of the tree item made in watch mode
+type TreeChange struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	IsDir bool   `json:"is_dir"`
+}
+
+// treeUpdates records when items of the scanned tree were last changed
+// and which subtrees may be stale
+type treeUpdates struct {
+	root      string
+	scannedAt time.Time
+	updated   map[string]time.Time
+	dirty     map[string]struct{}
+}
+
+func newTreeUpdates(root string, scannedAt time.Time) *treeUpdates {
+	return &treeUpdates{
+		root:      root,
+		scannedAt: scannedAt,
+		updated:   make(map[string]time.Time),
+		dirty:     make(map[string]struct{}),
+	}
+}
+
+// lastUpdated returns time of the last change of item on path
+func (u *treeUpdates) lastUpdated(path string) time.Time {
+	if t, ok := u.updated[path]; ok {
+		return t
+	}
+	return u.scannedAt
+}
+
+// isDirty returns true if the subtree on path may not reflect the filesystem
+func (u *treeUpdates) isDirty(path string) bool {
+	_, ok := u.dirty[path]
+	return ok
+}
+
+// touch marks item on path and all its ancestors as updated
+func (u *treeUpdates) touch(path string, t time.Time) {
+	for {
+		u.updated[path] = t
+		if path == u.root {
+			return
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return
+		}
+		path = parent
+	}
+}
+
+// treeWatcher watches directories of the scanned tree for changes
+type treeWatcher struct {
+	watcher *fsnotify.Watcher
+	limit   int
+	watched int
+	done    chan struct{}
+	// pending holds operations on paths changed since the last push, guarded by s.mu
+	pending map[string]string
+}
+
+// record remembers change of item on path to be pushed
+func (w *treeWatcher) record(path, op string) {
+	switch prev := w.pending[path]; {
+	case prev == ChangeCreate && op == ChangeDelete:
+		// item which came and went is not interesting for clients
+		delete(w.pending, path)
+	case prev == ChangeCreate && op == ChangeModify:
+	case prev == ChangeDelete && op == ChangeCreate:
+		w.pending[path] = ChangeModify
+	default:
+		w.pending[path] = op
+	}
+}
+
+// add watches directory, false is returned when the limit was reached
+func (w *treeWatcher) add(path string) bool {
+	if w.watched >= w.limit {
+		return false
+	}
+	if err := w.watcher.Add(path); err != nil {
+		log.Warnf("Failed to watch %s: %v", path, err)
+		return false
+	}
+	w.watched++
+	return true
+}
+
+// remove stops watching directory
+func (w *treeWatcher) remove(path string) {
+	// watches of removed directories are dropped by the OS, error is expected then
+	_ = w.watcher.Remove(path)
+}
+
+// sync updates number of watched directories
+func (w *treeWatcher) sync() {
+	w.watched = len(w.watcher.WatchList())
+}
+
+// startWatch registers watches on directories of the scanned tree, largest first,
+// and applies filesystem events to the tree until stopWatch is called.
+// Directories over the limit are marked dirty. Nothing is done when already watching.
+func (s *Server) startWatch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.completedDir == nil {
+		watcher.Close()
+		return errors.New("no scan completed")
+	}
+	if s.watch != nil {
+		watcher.Close()
+		return nil
+	}
+
+	w := &treeWatcher{
+		watcher: watcher,
+		limit:   s.watchLimit,
+		done:    make(chan struct{}),
+		pending: make(map[string]string),
+	}
+
+	dirs := make([]fs.Item, 0)
+	for _, item := range s.pathIndex {
+		if item.IsDir() {
+			dirs = append(dirs, item)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].GetUsage() > dirs[j].GetUsage()
+	})
+	for _, dir := range dirs {
+		if !w.add(dir.GetPath()) {
+			s.updates.dirty[dir.GetPath()] = struct{}{}
+		}
+	}
+
+	s.watch = w
+	go s.watchLoop(w)
+	return nil
+}
+
+// stopWatch removes all watches and waits until no more events are applied
+func (s *Server) stopWatch() {
+	s.mu.Lock()
+	w := s.watch
+	s.watch = nil
+	s.mu.Unlock()
+
+	if w == nil {
+		return
+	}
+	if err := w.watcher.Close(); err != nil {
+		log.Warnf("Failed to stop watching: %v", err)
+	}
+	<-w.done
+}
+
+func (s *Server) watchLoop(w *treeWatcher) {
+	defer close(w.done)
+
+	// changes are collected for watchDebounce after the first one and pushed together,
+	// so bursts produce one push and constant churn still gets pushed regularly
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+	armed := false
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if s.applyEvent(w, event) && !armed {
+				debounce.Reset(watchDebounce)
+				armed = true
+			}
+		case <-debounce.C:
+			armed = false
+			s.publishChanges(w)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				s.mu.Lock()
+				if s.watch == w {
+					s.updates.dirty[s.updates.root] = struct{}{}
+				}
+				s.mu.Unlock()
+			}
+			log.Errorf("Watch error: %v", err)
+		}
+	}
+}
+
+// applyEvent updates the tree according to filesystem event,
+// returns true if the tree was changed
+func (s *Server) applyEvent(w *treeWatcher, event fsnotify.Event) bool {
+	path := event.Name
+
+	// created items are read before the tree is locked,
+	// reading of a large subtree would block all requests otherwise
+	var read fs.Item
+	if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+		s.mu.RLock()
+		opts := s.treeOpts
+		s.mu.RUnlock()
+		read = readWatchedItem(path, opts, event.Has(fsnotify.Create))
+	}
+
+	s.editMu.Lock()
+	defer s.editMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watch != w || s.completedDir == nil {
+		return false
+	}
+
+	switch {
+	case event.Has(fsnotify.Create):
+		s.removeWatchedItem(w, path)
+		s.addWatchedItem(w, path, read)
+		w.record(path, ChangeCreate)
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		s.removeWatchedItem(w, path)
+		w.record(path, ChangeDelete)
+		path = filepath.Dir(path)
+	case event.Has(fsnotify.Write):
+		item, ok := s.pathIndex[path]
+		if !ok || item.IsDir() {
+			return false
+		}
+		s.removeWatchedItem(w, path)
+		s.addWatchedItem(w, path, read)
+		w.record(path, ChangeModify)
+	default:
+		return false
+	}
+
+	// precomputed largest files may not be valid anymore
+	s.topFiles = nil
+	s.topLimit = 0
+	s.updates.touch(path, time.Now())
+	return true
+}
+
+// publishChanges pushes changes collected since the last push to subscribers
+func (s *Server) publishChanges(w *treeWatcher) {
+	s.mu.Lock()
+	if s.watch != w || len(w.pending) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	changes := make([]TreeChange, 0, len(w.pending))
+	for path, op := range w.pending {
+		change := TreeChange{Op: op, Path: path}
+		if item, ok := s.pathIndex[path]; ok && op != ChangeDelete {
+			change.Size = item.GetSize()
+			change.IsDir = item.IsDir()
+		}
+		changes = append(changes, change)
+	}
+	w.pending = make(map[string]string)
+	s.mu.Unlock()
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	s.events.publish(Event{Event: EventTreeUpdate, Data: changes})
+}
+
+// readWatchedItem reads item on path the same way the scan of the tree read it.
+// Dirs are read only when readDirs is set.
+// Nil is returned when the item can't be read or the scan left it out.
+func readWatchedItem(path string, opts scanOptions, readDirs bool) fs.Item {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	name := info.Name()
+	if opts.ignoreHidden && strings.HasPrefix(name, ".") {
+		return nil
+	}
+
+	if info.IsDir() {
+		if !readDirs {
+			return nil
+		}
+		a := analyze.CreateSeqAnalyzer()
+		a.SetIgnoreHidden(opts.ignoreHidden)
+		a.SetFileIgnore(createFileIgnoreFunc(opts.ignoreFiles))
+		a.SetBlockSize(opts.blockSize)
+		a.SetReadLinkTargets(opts.linkTargets)
+		a.SetSortResults(opts.sortResults)
+		subdir := a.AnalyzeDir(path, func(_, _ string) bool { return false }, true).(*analyze.Dir)
+		subdir.UpdateStats(make(fs.HardLinkedItems))
+		return subdir
+	}
+
+	if ignore := createFileIgnoreFunc(opts.ignoreFiles); ignore != nil && ignore(name, path) {
+		return nil
+	}
+	file := analyze.CreateFileFromInfo(info, nil)
+	if opts.blockSize > 0 {
+		file.Usage = (file.Size + opts.blockSize - 1) / opts.blockSize * opts.blockSize
+	}
+	if opts.linkTargets && file.Kind == analyze.KindSymlink {
+		if target, err := os.Readlink(path); err == nil {
+			_, err = os.Stat(path)
+			file.Link = &analyze.Link{Target: target, Broken: err != nil}
+		}
+	}
+	return file
+}
+
+// addWatchedItem adds item read from path to the tree, nil item is skipped.
+// Caller must hold s.mu.
+func (s *Server) addWatchedItem(w *treeWatcher, path string, item fs.Item) {
+	if item == nil {
+		return
+	}
+	parent, ok := s.pathIndex[filepath.Dir(path)].(*analyze.Dir)
+	if !ok {
+		return
+	}
+
+	attachItem(parent, item)
+	indexItem(item, s.pathIndex)
+	if item.IsDir() {
+		walkDirs(item, func(dir fs.Item) {
+			if !w.add(dir.GetPath()) {
+				s.updates.dirty[dir.GetPath()] = struct{}{}
+			}
+		})
+	}
+}
+
+// removeWatchedItem removes item on path from the tree.
+// Caller must hold s.mu.
+func (s *Server) removeWatchedItem(w *treeWatcher, path string) {
+	item, ok := s.pathIndex[path]
+	if !ok {
+		return
+	}
+	parent, ok := item.GetParent().(*analyze.Dir)
+	if !ok {
+		return
+	}
+
+	parent.RemoveFile(item)
+
+	unindex := func(item fs.Item) {
+		delete(s.pathIndex, item.GetPath())
+		delete(s.updates.updated, item.GetPath())
+		delete(s.updates.dirty, item.GetPath())
+	}
+	if !item.IsDir() {
+		unindex(item)
+		return
+	}
+	walkItems(item, unindex)
+	walkDirs(item, func(dir fs.Item) {
+		w.remove(dir.GetPath())
+	})
+	w.sync()
+}
+
+// walkItems calls fn for item and all its descendants
+func walkItems(item fs.Item, fn func(fs.Item)) {
+	fn(item)
+	for _, child := range item.GetFiles() {
+		walkItems(child, fn)
+	}
+}
+
+// walkDirs calls fn for dir and all its subdirectories
+func walkDirs(dir fs.Item, fn func(fs.Item)) {
+	walkItems(dir, func(item fs.Item) {
+		if item.IsDir() {
+			fn(item)
+		}
+	})
+}
+
+// watchInfo returns whether watch mode is active and number of watched directories
+func (s *Server) watchInfo() (bool, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.watch == nil {
+		return false, 0
+	}
+	return true, s.watch.watched
+}
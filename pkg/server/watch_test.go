@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/dundee/gdu/v5/pkg/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchUpdatesTree(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	s.scan("test_dir", scanOptions{watch: true})
+	defer s.stopWatch()
+
+	watching, watched := s.watchInfo()
+	assert.True(t, watching)
+	assert.Equal(t, 3, watched)
+
+	s.mu.RLock()
+	size := s.completedDir.GetSize()
+	count := s.completedDir.GetItemCount()
+	s.mu.RUnlock()
+
+	sizeOf := func(path string) int64 {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if item := s.findItem(path); item != nil {
+			return item.GetSize()
+		}
+		return -1
+	}
+
+	err := os.WriteFile("test_dir/nested/new", []byte("0123456789"), 0o600)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return sizeOf("test_dir/nested/new") == 10 && sizeOf("test_dir") == size+10
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err = os.MkdirAll("test_dir/nested/dir", 0o755)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return sizeOf("test_dir/nested/dir") == 4096
+	}, 5*time.Second, 10*time.Millisecond)
+	_, watched = s.watchInfo()
+	assert.Equal(t, 4, watched)
+
+	err = os.WriteFile("test_dir/nested/dir/file", []byte("abc"), 0o600)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return sizeOf("test_dir/nested/dir") == 4096+3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err = os.RemoveAll("test_dir/nested/dir")
+	assert.NoError(t, err)
+	err = os.Remove("test_dir/nested/new")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return sizeOf("test_dir/nested/dir") == -1 &&
+			sizeOf("test_dir/nested/new") == -1 &&
+			sizeOf("test_dir") == size
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s.mu.RLock()
+	assert.Equal(t, count, s.completedDir.GetItemCount())
+	info := convertToDirInfo(s.completedDir, 1, dirInfoOptions{updates: s.updates})
+	s.mu.RUnlock()
+	assert.NotZero(t, info.LastUpdated)
+	assert.False(t, info.Dirty)
+
+	s.stopWatch()
+	watching, watched = s.watchInfo()
+	assert.False(t, watching)
+	assert.Equal(t, 0, watched)
+}
+
+func TestWatchUsesScanOptions(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	s.scan("test_dir", scanOptions{
+		watch:        true,
+		ignoreHidden: true,
+		ignoreFiles:  []FilePattern{{Pattern: "*.tmp", MatchOn: "name"}},
+		blockSize:    512,
+	})
+	defer s.stopWatch()
+
+	find := func(path string) fs.Item {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.findItem(path)
+	}
+
+	// the dir is filled in a hidden dir left out of the tree and moved in at once
+	assert.NoError(t, os.MkdirAll("test_dir/.staging/dir", 0o755))
+	assert.NoError(t, os.WriteFile("test_dir/.staging/dir/file", []byte("0123456789"), 0o600))
+	assert.NoError(t, os.WriteFile("test_dir/.staging/dir/.hidden", []byte("abc"), 0o600))
+	assert.NoError(t, os.WriteFile("test_dir/.staging/dir/skip.tmp", []byte("abc"), 0o600))
+	assert.NoError(t, os.Rename("test_dir/.staging/dir", "test_dir/nested/dir"))
+	assert.NoError(t, os.WriteFile("test_dir/nested/new.tmp", []byte("abc"), 0o600))
+	assert.NoError(t, os.WriteFile("test_dir/nested/new", []byte("abc"), 0o600))
+
+	assert.Eventually(t, func() bool {
+		return find("test_dir/nested/dir/file") != nil && find("test_dir/nested/new") != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, int64(512), find("test_dir/nested/dir/file").GetUsage())
+	assert.Equal(t, int64(512), find("test_dir/nested/new").GetUsage())
+	assert.Nil(t, find("test_dir/.staging"))
+	assert.Nil(t, find("test_dir/nested/dir/.hidden"))
+	assert.Nil(t, find("test_dir/nested/dir/skip.tmp"))
+	assert.Nil(t, find("test_dir/nested/new.tmp"))
+}
+
+func TestWatchLimit(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	s.watchLimit = 1
+	s.scan("test_dir", scanOptions{watch: true})
+	defer s.stopWatch()
+
+	_, watched := s.watchInfo()
+	assert.Equal(t, 1, watched)
+
+	s.mu.RLock()
+	info := convertToDirInfo(s.completedDir, 2, dirInfoOptions{updates: s.updates})
+	s.mu.RUnlock()
+
+	// the largest directory is watched, the rest is marked dirty
+	assert.False(t, info.Dirty)
+	assert.True(t, info.Children[0].Dirty)
+}
+
+func TestWatchNotEnabled(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	s := NewServer(false, "")
+	s.scan("test_dir", scanOptions{})
+
+	watching, _ := s.watchInfo()
+	assert.False(t, watching)
+}
+
+func TestRecordChanges(t *testing.T) {
+	w := &treeWatcher{pending: make(map[string]string)}
+
+	w.record("a", ChangeCreate)
+	w.record("a", ChangeModify)
+	assert.Equal(t, ChangeCreate, w.pending["a"])
+	w.record("a", ChangeDelete)
+	assert.NotContains(t, w.pending, "a")
+
+	w.record("b", ChangeDelete)
+	w.record("b", ChangeCreate)
+	assert.Equal(t, ChangeModify, w.pending["b"])
+}
+
+func TestWatchMethodPushesChanges(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	socketPath := filepath.Join(t.TempDir(), "gdu.sock")
+	server, err := NewUnixSocketServer(socketPath, false, "")
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, server.Start())
+	}()
+	defer server.Stop()
+
+	conn, err := net.Dial("unix", socketPath)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.NoError(t, sendSocketRequest(conn, Request{ID: "1", Method: "watch"}))
+	resp, err := readSocketResponse(conn)
+	assert.NoError(t, err)
+	assert.False(t, resp.Success, "watch needs finished scan")
+
+	server.server.scan("test_dir", scanOptions{})
+	assert.NoError(t, sendSocketRequest(conn, Request{ID: "2", Method: "watch"}))
+	resp, err = readSocketResponse(conn)
+	assert.NoError(t, err)
+	assert.True(t, resp.Success, resp.Error)
+
+	// burst of changes is pushed at once
+	assert.NoError(t, os.WriteFile("test_dir/nested/new", []byte("0123456789"), 0o600))
+	assert.NoError(t, os.Remove("test_dir/nested/file2"))
+
+	var changes []TreeChange
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for len(changes) < 2 {
+		frame, err := readSocketFrame(conn)
+		if !assert.NoError(t, err) {
+			return
+		}
+		var event struct {
+			Event string       `json:"event"`
+			Data  []TreeChange `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(frame, &event))
+		assert.Equal(t, EventTreeUpdate, event.Event)
+		changes = append(changes, event.Data...)
+	}
+
+	assert.Contains(t, changes, TreeChange{Op: ChangeDelete, Path: "test_dir/nested/file2"})
+	assert.Contains(t, changes, TreeChange{Op: ChangeCreate, Path: "test_dir/nested/new", Size: 10})
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dundee/gdu/v5/pkg/fs"
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of webhook delivery
+const (
+	DefaultWebhookTimeout = 10 * time.Second
+	webhookAttempts       = 3
+	webhookBackoff        = time.Second
+)
+
+// WebhookSignatureHeader carries hex encoded HMAC-SHA256 of the body keyed by the shared secret
+const WebhookSignatureHeader = "X-Gdu-Signature"
+
+// WebhookConfig holds settings of the webhook called when a scan finishes
+type WebhookConfig struct {
+	URL string
+	// Secret signs the payload when set
+	Secret string
+	// Timeout limits each attempt, zero uses DefaultWebhookTimeout
+	Timeout time.Duration
+}
+
+// Validate returns error if webhook can't be set with the config, empty URL is valid as it disables the webhook
+func (c WebhookConfig) Validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	_, err := newWebhook(c)
+	return err
+}
+
+// WebhookPayload is posted to the webhook when a scan completes or is cancelled
+type WebhookPayload struct {
+	Root           string `json:"root"`
+	StartedAt      int64  `json:"started_at"`
+	FinishedAt     int64  `json:"finished_at"`
+	Size           int64  `json:"size"`
+	Usage          int64  `json:"usage"`
+	ItemCount      int    `json:"item_count"`
+	ErrorCount     int    `json:"error_count"`
+	ScanGeneration uint64 `json:"scan_generation"`
+	Cancelled      bool   `json:"cancelled"`
+	TimedOut       bool   `json:"timed_out,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// webhook posts payloads to the configured URL
+type webhook struct {
+	config  WebhookConfig
+	client  *http.Client
+	backoff time.Duration
+}
+
+// newWebhook validates the config and returns webhook posting to its URL
+func newWebhook(config WebhookConfig) (*webhook, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("webhook URL must be absolute http or https URL")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultWebhookTimeout
+	}
+	return &webhook{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		backoff: webhookBackoff,
+	}, nil
+}
+
+// notify posts the payload encoded as JSON, failed attempts are repeated with doubling delay.
+// Failures are only logged.
+func (w *webhook) notify(payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Errorf("Failed to encode webhook payload: %v", err)
+		return
+	}
+
+	delay := w.backoff
+	for attempt := 1; ; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			break
+		}
+		log.Warnf("Webhook attempt %d failed, retrying in %v: %v", attempt, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	log.Errorf("Webhook %s failed after %d attempts: %v", w.config.URL, webhookAttempts, err)
+}
+
+func (w *webhook) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.config.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+signPayload(body, w.config.Secret))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// signPayload returns hex encoded HMAC-SHA256 of the body
+func signPayload(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// countErrors counts dirs of the tree which could not be read
+func countErrors(item fs.Item) int {
+	if !item.IsDir() {
+		return 0
+	}
+	count := 0
+	if item.GetFlag() == '!' {
+		count++
+	}
+	for _, child := range item.GetFiles() {
+		count += countErrors(child)
+	}
+	return count
+}
+
+// setWebhook replaces the webhook, empty URL disables it
+func (s *Server) setWebhook(config WebhookConfig) error {
+	var wh *webhook
+	if config.URL != "" {
+		var err error
+		if wh, err = newWebhook(config); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhook = wh
+	return nil
+}
+
+// notifyWebhook posts summary of the finished scan to the webhook in background
+func (s *Server) notifyWebhook(dir fs.Item, cancelled bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.webhook == nil {
+		return
+	}
+
+	// tree can be changed by watch mode, it is summed under the lock
+	go s.webhook.notify(WebhookPayload{
+		Root:           dir.GetPath(),
+		StartedAt:      s.scanStartedAt.Unix(),
+		FinishedAt:     s.scanFinishedAt.Unix(),
+		Size:           dir.GetSize(),
+		Usage:          dir.GetUsage(),
+		ItemCount:      dir.GetItemCount(),
+		ErrorCount:     countErrors(dir),
+		ScanGeneration: s.scanGeneration,
+		Cancelled:      cancelled,
+		TimedOut:       s.timedOut,
+		Error:          s.scanError,
+	})
+}
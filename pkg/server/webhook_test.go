@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	payloads := make(chan WebhookPayload, 1)
+	var calls atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// first attempt fails and is repeated
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "sha256="+signPayload(body, "secret"), r.Header.Get(WebhookSignatureHeader))
+
+		var payload WebhookPayload
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		payloads <- payload
+	}))
+	defer hook.Close()
+
+	s := &UnixSocketServer{server: NewServer(false, "")}
+	resp := s.processRequest([]byte(`{"id":"1","method":"set_webhook","params":{"url":"` + hook.URL + `","secret":"secret"}}`))
+	assert.True(t, resp.Success, resp.Error)
+	s.server.webhook.backoff = time.Millisecond
+
+	s.server.scan("test_dir", scanOptions{})
+
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, "test_dir", payload.Root)
+		assert.Equal(t, 5, payload.ItemCount)
+		assert.Equal(t, s.server.completedDir.GetSize(), payload.Size)
+		assert.Equal(t, uint64(1), payload.ScanGeneration)
+		assert.False(t, payload.Cancelled)
+		assert.LessOrEqual(t, payload.StartedAt, payload.FinishedAt)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+	assert.Equal(t, int32(2), calls.Load())
+
+	resp = s.processRequest([]byte(`{"id":"2","method":"set_webhook","params":{"url":"ftp://example.com"}}`))
+	assert.False(t, resp.Success)
+
+	resp = s.processRequest([]byte(`{"id":"3","method":"set_webhook","params":{}}`))
+	assert.True(t, resp.Success)
+	assert.Nil(t, s.server.webhook)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// wsIdleTimeout closes WebSocket connection which sent no message nor pong for the time
+	wsIdleTimeout = 60 * time.Second
+	// wsPingInterval is period of pings keeping the connection alive, shorter than wsIdleTimeout
+	wsPingInterval = 25 * time.Second
+	// wsWriteTimeout is time in which a message must be written to the client
+	wsWriteTimeout = 10 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// handleWebSocket serves requests sent as text messages of WebSocket connection.
+// Every message is a Request, or a JSON-RPC call, and gets its response as a text message.
+// Subscribed events are pushed as text messages too.
+func (h *HTTPServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgrader has already replied with error status
+		log.Debugf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer ws.Close()
+
+	id := h.methods.lastConnID.Add(1)
+	logger := log.WithFields(log.Fields{"remote_addr": r.RemoteAddr, "conn_id": id})
+	logger.Debug("New WebSocket connection")
+	defer logger.Debug("WebSocket connection closed")
+
+	c := &connection{ws: ws, logger: logger, id: id}
+	defer c.unsubscribe()
+	h.methods.trackConnection(c)
+	defer h.methods.untrackConnection(c)
+
+	ws.SetReadLimit(int64(h.methods.server.maxMessageSize))
+	extendDeadline := func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(wsIdleTimeout))
+	}
+	if err := extendDeadline(""); err != nil {
+		return
+	}
+	ws.SetPongHandler(extendDeadline)
+
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go pingWebSocket(ws, stopPing)
+
+	for {
+		msgType, data, err := ws.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Debugf("Error reading WebSocket message: %v", err)
+			}
+			return
+		}
+		if err := extendDeadline(""); err != nil {
+			return
+		}
+		if msgType != websocket.TextMessage {
+			logger.Warn("Ignoring binary WebSocket message")
+			continue
+		}
+
+		if err := h.methods.respond(c, data); err != nil {
+			if err != errLimitClose {
+				logger.Errorf("Error sending response: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// pingWebSocket pings the client until stop is closed, so dead peers hit the idle timeout
+func pingWebSocket(ws *websocket.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
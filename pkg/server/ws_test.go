@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dundee/gdu/v5/internal/testdir"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// wsMessage is a response or an event received over WebSocket
+type wsMessage struct {
+	ID      string          `json:"id"`
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Code    string          `json:"code"`
+	Event   string          `json:"event"`
+}
+
+func TestWebSocket(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	ts := httptest.NewServer(NewHTTPServer("", &UnixSocketServer{server: NewServer(false, "")}).Handler())
+	defer ts.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+	assert.NoError(t, err)
+	defer ws.Close()
+	assert.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	read := func() wsMessage {
+		msgType, data, err := ws.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, websocket.TextMessage, msgType)
+		var msg wsMessage
+		assert.NoError(t, json.Unmarshal(data, &msg))
+		return msg
+	}
+
+	assert.NoError(t, ws.WriteMessage(websocket.TextMessage,
+		[]byte(`{"id":"1","method":"subscribe","params":{"events":["progress","scan_complete"]}}`)))
+	msg := read()
+	assert.Equal(t, "1", msg.ID)
+	assert.True(t, msg.Success)
+
+	assert.NoError(t, ws.WriteMessage(websocket.TextMessage,
+		[]byte(`{"id":"2","method":"scan","params":{"path":"test_dir"}}`)))
+
+	var scanned, progressed bool
+	for !scanned {
+		msg = read()
+		switch msg.Event {
+		case "":
+			assert.Equal(t, "2", msg.ID)
+			assert.True(t, msg.Success)
+		case EventProgress:
+			var progress ProgressResponse
+			assert.NoError(t, json.Unmarshal(msg.Data, &progress))
+			progressed = true
+		case EventScanComplete:
+			var info DirInfo
+			assert.NoError(t, json.Unmarshal(msg.Data, &info))
+			assert.Equal(t, "test_dir", info.Name)
+			scanned = true
+		}
+	}
+	assert.True(t, progressed)
+
+	assert.NoError(t, ws.WriteMessage(websocket.TextMessage,
+		[]byte(`{"id":"3","method":"directory","params":{"path":"test_dir/nested","depth":1}}`)))
+	msg = read()
+	assert.Equal(t, "3", msg.ID)
+	assert.True(t, msg.Success)
+	var info DirInfo
+	assert.NoError(t, json.Unmarshal(msg.Data, &info))
+	assert.Len(t, info.Children, 2)
+
+	// binary bodies cannot be sent as text messages
+	assert.NoError(t, ws.WriteMessage(websocket.TextMessage,
+		[]byte(`{"id":"4","method":"set_encoding","params":{"encoding":"msgpack"}}`)))
+	msg = read()
+	assert.Equal(t, "4", msg.ID)
+	assert.False(t, msg.Success)
+}
+
+func TestWebSocketWritesRejected(t *testing.T) {
+	fin := testdir.CreateTestDir()
+	defer fin()
+
+	call := func(socketServer *UnixSocketServer, request string) wsMessage {
+		t.Helper()
+		ts := httptest.NewServer(NewHTTPServer("", socketServer).Handler())
+		defer ts.Close()
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+		assert.NoError(t, err)
+		defer ws.Close()
+		assert.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+		assert.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte(request)))
+		_, data, err := ws.ReadMessage()
+		assert.NoError(t, err)
+		var msg wsMessage
+		assert.NoError(t, json.Unmarshal(data, &msg))
+		return msg
+	}
+	move := `{"id":"1","method":"move","params":{"from":"test_dir/nested/file2","to":"test_dir/file2"}}`
+
+	socketServer := &UnixSocketServer{server: NewServer(false, ""), readOnly: true}
+	socketServer.server.scan("test_dir", scanOptions{})
+	msg := call(socketServer, move)
+	assert.False(t, msg.Success)
+	assert.Equal(t, ErrCodeReadOnly, msg.Code)
+
+	// gateway does not change the filesystem unless it is allowed
+	socketServer.readOnly = false
+	msg = call(socketServer, move)
+	assert.False(t, msg.Success)
+	assert.Equal(t, ErrCodeForbidden, msg.Code)
+	msg = call(socketServer, `{"id":"2","method":"export","params":{"format":"json","output":"out.json"}}`)
+	assert.Equal(t, ErrCodeForbidden, msg.Code)
+	msg = call(socketServer, `{"id":"3","method":"set_webhook","params":{"url":"http://127.0.0.1:1/"}}`)
+	assert.Equal(t, ErrCodeForbidden, msg.Code)
+	assert.FileExists(t, "test_dir/nested/file2")
+
+	socketServer.SetGatewayWrites(true)
+	msg = call(socketServer, move)
+	assert.True(t, msg.Success)
+	assert.FileExists(t, "test_dir/file2")
+}
@@ -86,7 +86,8 @@ func processDir(items []interface{}) (*analyze.Dir, error) {
 				file.Flag = ' '
 			}
 			if mli, ok := item["ino"].(float64); ok {
-				file.Mli = uint64(mli)
+				file.Ino = uint64(mli)
+				file.HardLinked = true
 			}
 			if _, ok := item["hlnkc"].(bool); ok {
 				file.Flag = 'H'
@@ -38,7 +38,7 @@ func TestReadAnalysis(t *testing.T) {
 	assert.Equal(t, 2021, dir.Files[3].GetMtime().Year())
 	alt2 := dir.Files[2].(*analyze.Dir).Files[2].(*analyze.File)
 	assert.Equal(t, "app_linux_test2.go", alt2.Name)
-	assert.Equal(t, uint64(1234), alt2.Mli)
+	assert.Equal(t, uint64(1234), alt2.GetMultiLinkedInode())
 	assert.Equal(t, 'H', alt2.Flag)
 }
 
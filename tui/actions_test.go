@@ -441,8 +441,8 @@ func TestShowInfoWithHardlinks(t *testing.T) {
 	subnested := nested.Files[1].(*analyze.Dir)
 	file := subnested.Files[0].(*analyze.File)
 	file2 := nested.Files[0].(*analyze.File)
-	file.Mli = 1
-	file2.Mli = 1
+	file.Ino, file.HardLinked = 1, true
+	file2.Ino, file2.HardLinked = 1, true
 
 	ui.currentDir.UpdateStats(ui.linkedItems)
 